@@ -44,7 +44,7 @@ func main() {
 	if c.Server.Dev {
 		r.Use(cors.New(cors.Options{
 			AllowedOrigins:   []string{"*"},
-			AllowedMethods:   []string{"GET", "POST", "DELETE", "HEAD", "PUT"},
+			AllowedMethods:   []string{"GET", "POST", "DELETE", "HEAD", "PUT", "PATCH"},
 			AllowedHeaders:   []string{"*"},
 			AllowCredentials: true,
 			Debug:            true,
@@ -92,6 +92,52 @@ func main() {
 		v1.PUT("namespace/:namespace/dataset/:name/sync", api.EnableSyncDataset)
 		v1.DELETE("namespace/:namespace/dataset/:name/sync", api.DisableSyncDataset)
 
+		// dataset metadata schemas
+		v1.GET("namespace/:namespace/dataset/:name/metadata/schema", api.GetMetadataSchema)
+		v1.PUT("namespace/:namespace/dataset/:name/metadata/schema", api.SetMetadataSchema)
+		v1.DELETE("namespace/:namespace/dataset/:name/metadata/schema", api.DeleteMetadataSchema)
+		v1.GET("namespace/:namespace/dataset/:name/metadata/schema/report", api.GetMetadataSchemaReport)
+
+		// dataset metadata sidecar files
+		v1.GET("namespace/:namespace/dataset/:name/metadata/sidecar", api.GetMetadataSidecar)
+		v1.PUT("namespace/:namespace/dataset/:name/metadata/sidecar", api.SetMetadataSidecar)
+		v1.DELETE("namespace/:namespace/dataset/:name/metadata/sidecar", api.DeleteMetadataSidecar)
+
+		// object metadata
+		v1.GET("namespace/:namespace/dataset/:name/object/metadata", api.GetObjectMetadata)
+		v1.PUT("namespace/:namespace/dataset/:name/object/metadata", api.SetObjectMetadata)
+		v1.PATCH("namespace/:namespace/dataset/:name/object/metadata", api.MergeObjectMetadata)
+		v1.DELETE("namespace/:namespace/dataset/:name/object/metadata", api.DeleteObjectMetadata)
+		v1.POST("namespace/:namespace/dataset/:name/object/metadata/batch", api.BatchObjectMetadata)
+
+		// object versions
+		v1.GET("namespace/:namespace/dataset/:name/object/version", api.ListObjectVersions)
+		v1.PUT("namespace/:namespace/dataset/:name/object/version/restore", api.RestoreObjectVersion)
+		v1.DELETE("namespace/:namespace/dataset/:name/object/version", api.PurgeObjectVersions)
+
+		// dataset snapshots
+		v1.POST("namespace/:namespace/dataset/:name/snapshot", api.CreateSnapshot)
+		v1.GET("namespace/:namespace/dataset/:name/snapshot", api.ListSnapshots)
+		v1.GET("namespace/:namespace/dataset/:name/snapshot/:snapshot", api.GetSnapshot)
+		v1.DELETE("namespace/:namespace/dataset/:name/snapshot/:snapshot", api.DeleteSnapshot)
+		v1.GET("namespace/:namespace/dataset/:name/snapshot/:snapshot/object", api.GetSnapshotObject)
+		v1.GET("namespace/:namespace/dataset/:name/snapshot/:snapshot/objects", api.ListSnapshotObjects)
+		v1.GET("namespace/:namespace/dataset/:name/snapshot/:snapshot/diff", api.DiffSnapshot)
+
+		// dataset clone and move jobs
+		v1.POST("namespace/:namespace/dataset/:name/clone", api.CloneDataset)
+		v1.POST("namespace/:namespace/dataset/:name/move", api.MoveDataset)
+		v1.GET("namespace/:namespace/dataset/:name/job", api.ListDatasetJobs)
+		v1.GET("namespace/:namespace/dataset/:name/job/:id", api.GetDatasetJob)
+
+		// dataset access logging
+		v1.GET("namespace/:namespace/dataset/:name/access/logging", api.GetAccessLogging)
+		v1.PUT("namespace/:namespace/dataset/:name/access/logging", api.EnableAccessLogging)
+		v1.DELETE("namespace/:namespace/dataset/:name/access/logging", api.DisableAccessLogging)
+		v1.GET("namespace/:namespace/dataset/:name/access/stats", api.GetDatasetAccessStats)
+		v1.GET("namespace/:namespace/dataset/:name/access/recent", api.ListRecentAccesses)
+		v1.GET("namespace/:namespace/dataset/:name/object/access", api.GetObjectAccessStats)
+
 		// dataset permissions
 		v1.PUT("namespace/:namespace/dataset/:name/user/:username/access/:accesslevel", api.UpdateUserDatasetPerms)
 		v1.DELETE("namespace/:namespace/dataset/:name/user/:username", api.RemoveUserDatasetPerms)
@@ -100,10 +146,33 @@ func main() {
 
 		// metadata search
 		v1.GET("search", api.SearchMetadata)
+		v1.GET("search/facets", api.GetSearchFacets)
+		v1.GET("search/export", api.ExportSearchResults)
+		v1.GET("search/duplicates", api.FindDuplicates)
 		v1.GET("search/namespace/:namespace/dataset/:name/key", api.SuggestKeys)
 		v1.GET("search/namespace/:namespace/dataset/:name/key/:key/value", api.SuggestValues)
 		v1.GET("search/namespace/:namespace/dataset/:name/metadata", api.GetMetadata)
 
+		// metadata search index rebuild jobs
+		v1.POST("search/index/job", api.CreateIndexJob)
+		v1.GET("search/index/job", api.ListIndexJobs)
+		v1.GET("search/index/job/:id", api.GetIndexJob)
+
+		// saved searches and subscriptions
+		v1.POST("search/saved", api.CreateSavedSearch)
+		v1.GET("search/saved", api.ListSavedSearches)
+		v1.GET("search/saved/:id", api.GetSavedSearch)
+		v1.PUT("search/saved/:id", api.UpdateSavedSearch)
+		v1.DELETE("search/saved/:id", api.DeleteSavedSearch)
+		v1.GET("search/saved/:id/run", api.RunSavedSearch)
+		v1.PUT("search/saved/:id/group/:groupname", api.ShareSavedSearch)
+		v1.DELETE("search/saved/:id/group/:groupname", api.UnshareSavedSearch)
+		v1.PUT("search/saved/:id/subscription", api.SubscribeSavedSearch)
+		v1.GET("search/saved/:id/subscription", api.GetSearchSubscription)
+		v1.DELETE("search/saved/:id/subscription", api.UnsubscribeSavedSearch)
+		v1.GET("search/saved/:id/subscription/notifications", api.GetSearchNotifications)
+		v1.GET("search/subscription", api.ListSearchSubscriptions)
+
 		// credentials
 		v1.GET("namespace/:namespace/sts", api.GetUserSTSCredentials)
 
@@ -112,11 +181,16 @@ func main() {
 
 		// Service Account only endpoints
 		v1.GET("configuration/sync", api.GetSyncConfiguration)
+		v1.PUT("configuration/sync/lease", api.AcquireSyncLeases)
 		v1.GET("configuration/queue", api.GetNotificationQueues)
 		v1.GET("object_store/:object_store/sts", api.GetServiceSTSCredentials)
 
 		v1.PUT("search/document/metadata", api.CreateOrUpdateMetadataDocument)
 		v1.DELETE("search/document/metadata", api.DeleteMetadataDocument)
+		v1.POST("search/document/metadata/bulk", api.BulkMetadataDocuments)
+		v1.GET("search/sidecar", api.GetMetadataSidecarByLocation)
+		v1.GET("access/logging", api.GetAccessLoggingByLocation)
+		v1.POST("access/bulk", api.RecordObjectAccesses)
 	}
 
 	r.Run() // listen and serve on 0.0.0.0:8080
@@ -167,16 +241,34 @@ func ConfigMiddleware(config *config.Configuration) gin.HandlerFunc {
 		logrus.Errorf("Failed to patch minio events: %v", err.Error())
 	}
 
+	// Set up the client used for all requests to opensearch
+	if err := opensearch.Configure(&config.Server.OpenSearch); err != nil {
+		logrus.Fatalf("Failed to configure Opensearch client: %v", err.Error())
+	}
+
 	// Start the background dataset delete worker
 	// This function will loop infinitely, waiting for datasets to be
 	// ready for delete.
 	exitCh := make(chan bool)
-	go worker.DeleteDatasetWorker(config, db, s, exitCh)
+	go worker.DeleteDatasetWorker(config, db, s, ase, exitCh)
+
+	// Start the background search index rebuild worker
+	go worker.IndexJobWorker(config, db, s, exitCh)
+
+	// Start the background dataset clone and move worker
+	go worker.DatasetJobWorker(config, db, s, ase, exitCh)
 
 	// Wait for opensearch to be ready
 	for i := 0; i < 30; i++ {
-		_, err = http.Get(config.Server.ElasticsearchEndpoint)
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, config.Server.ElasticsearchEndpoint, nil)
+		if err != nil {
+			break
+		}
+		var resp *http.Response
+		resp, err = opensearch.Do(req)
 		if err == nil {
+			resp.Body.Close()
 			break
 		}
 
@@ -187,12 +279,25 @@ func ConfigMiddleware(config *config.Configuration) gin.HandlerFunc {
 		logrus.WithField("error", err.Error()).Fatal("Couldn't connect to Opensearch service after 60 seconds")
 	}
 
-	// Create metadata search index if it has yet to be created
-	err = opensearch.CreateMetadataSearchIndex(config.Server.ElasticsearchEndpoint)
+	// Create metadata search index if it has yet to be created. If the index needs to be migrated to new mappings
+	// the migration runs in the background, and a rebuild of the whole index is scheduled once for each version
+	err = opensearch.CreateMetadataSearchIndex(config.Server.ElasticsearchEndpoint, func(version int) error {
+		created, err := db.CreateIndexVersionJob(version)
+		if created {
+			logrus.Infof("Scheduled a search index rebuild for metadata index version %d", version)
+		}
+		return err
+	})
 	if err != nil {
 		logrus.Errorf("Failed to initialize metadata search index: %v", err.Error())
 	}
 
+	// Create the saved search index used to notify subscribers if it has yet to be created
+	err = api.SyncSavedSearchQueries(config, db)
+	if err != nil {
+		logrus.Errorf("Failed to initialize saved search index: %v", err.Error())
+	}
+
 	return func(c *gin.Context) {
 		c.Set("config", config)
 		c.Set("stores", s)
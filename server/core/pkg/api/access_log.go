@@ -0,0 +1,493 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+)
+
+// maxObjectAccessRecords limits the number of downloads recorded by one bulk request
+const maxObjectAccessRecords = 1000
+
+// ObjectAccessRecord is a download of an object, read from a bucket event by the sync service
+type ObjectAccessRecord struct {
+	// DatasetExtended is a compound string that uniquely identifies a dataset (<object store name>|<bucket name>|<dataset name>)
+	DatasetExtended string `json:"dataset_extended" binding:"required"`
+	// ObjectKey is the object key in the bucket
+	ObjectKey string `json:"object_key" binding:"required"`
+	// Principal is the access key or user that downloaded the object, as reported by the object store
+	Principal string `json:"principal"`
+	// Accessed is the datetime string of the download in RFC3339 format
+	Accessed string `json:"accessed"`
+}
+
+type objectAccessBulkInput struct {
+	Accesses []*ObjectAccessRecord `json:"accesses" binding:"required,dive"`
+}
+
+// ObjectAccessBulkResponse is the result of recording downloads
+type ObjectAccessBulkResponse struct {
+	// Recorded is the number of downloads that were recorded
+	Recorded int `json:"recorded"`
+	// Skipped is the number of downloads that were not recorded because access logging isn't enabled for the
+	// dataset, or the dataset doesn't exist
+	Skipped int `json:"skipped"`
+}
+
+// DatasetAccessStats are the download counts of a dataset and its most downloaded objects
+type DatasetAccessStats struct {
+	// Since is the start of the period the downloads were counted for, if limited
+	Since *time.Time `json:"since,omitempty"`
+	// Dataset is the number of downloads of all objects in the dataset
+	Dataset *database.ObjectAccessCount `json:"dataset"`
+	// Objects are the number of downloads of each object, most downloaded first
+	Objects []*database.ObjectAccessCount `json:"objects"`
+}
+
+// parseAccessSince parses the optional `since` query arg, returning the zero time if it isn't set
+func parseAccessSince(c *gin.Context) (time.Time, bool) {
+	since := c.Query("since")
+	if since == "" {
+		return time.Time{}, true
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 datetime (e.g. 2006-01-02T15:04:05Z)"})
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// GetAccessLogging gets the access logging state of a dataset
+// @Summary Get a dataset's access logging
+// @Schemes
+// @Description Get the access logging record of a dataset. If access logging is enabled, the sync service records
+// @Description who downloaded each object of the dataset and when
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 200 {object} database.AccessLogging
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/access/logging [get]
+func GetAccessLogging(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	logging, err := db.GetAccessLogging(dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, logging)
+}
+
+// EnableAccessLogging enables access logging for a dataset
+// @Summary Enable a dataset's access logging
+// @Schemes
+// @Description Start recording the downloads of the dataset's objects. Downloads are read from the object store's
+// @Description bucket events by the sync service, so sync must be enabled for the dataset. Only MinIO object stores
+// @Description send bucket events for downloads. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 200 {object} database.AccessLogging
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/access/logging [put]
+func EnableAccessLogging(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	if dataset.Namespace.ObjectStore.ObjectStoreType != "minio" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "access logging is only supported for datasets in MinIO object stores"})
+		return
+	}
+
+	logging, err := db.EnableAccessLogging(dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, logging)
+}
+
+// DisableAccessLogging disables access logging for a dataset
+// @Summary Disable a dataset's access logging
+// @Schemes
+// @Description Stop recording the downloads of the dataset's objects. Downloads that were already recorded are kept.
+// @Description Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/access/logging [delete]
+func DisableAccessLogging(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	if err := db.DisableAccessLogging(dataset); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetDatasetAccessStats gets the download counts of a dataset
+// @Summary Get a dataset's download counts
+// @Schemes
+// @Description Get the number of downloads and distinct users of a dataset's objects, and of each object ordered
+// @Description by the number of downloads. Only downloads made while access logging was enabled are counted
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	since  query  string  false  "Only count downloads after the RFC3339 datetime (e.g. 2006-01-02T15:04:05Z)"
+// @Param	limit  query  int  false  "Maximum number of objects to return" default(25)
+// @Param	offset  query  int  false  "Number of objects to skip" default(0)
+// @Success 200 {object} DatasetAccessStats
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/access/stats [get]
+func GetDatasetAccessStats(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	since, ok := parseAccessSince(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	stats := &DatasetAccessStats{}
+	if !since.IsZero() {
+		stats.Since = &since
+	}
+
+	stats.Dataset, err = db.GetDatasetAccessCount(dataset, since)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	stats.Objects, err = db.ListObjectAccessCounts(dataset, since, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetObjectAccessStats gets the download count of an object
+// @Summary Get an object's download count
+// @Schemes
+// @Description Get the number of downloads and distinct users of an object in a dataset. Only downloads made while
+// @Description access logging was enabled are counted
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Param	since  query  string  false  "Only count downloads after the RFC3339 datetime (e.g. 2006-01-02T15:04:05Z)"
+// @Success 200 {object} database.ObjectAccessCount
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/access [get]
+func GetObjectAccessStats(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	key := c.Query("key")
+	if err := validateObjectKey(key); err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	since, ok := parseAccessSince(c)
+	if !ok {
+		return
+	}
+
+	count, err := db.GetObjectAccessCount(dataset, key, since)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, count)
+}
+
+// ListRecentAccesses lists the recent downloads of a dataset's objects
+// @Summary List recent downloads
+// @Schemes
+// @Description List who downloaded the dataset's objects and when, most recent first. Set `key` to only list the
+// @Description downloads of one object. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  false  "Object Key"
+// @Param	limit  query  int  false  "Maximum number of downloads to return" default(25)
+// @Param	offset  query  int  false  "Number of downloads to skip" default(0)
+// @Success 200 {object} []database.ObjectAccess
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/access/recent [get]
+func ListRecentAccesses(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	key := c.Query("key")
+	if key != "" {
+		if err := validateObjectKey(key); err != nil {
+			handleObjectMetadataError(c, err)
+			return
+		}
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	accesses, err := db.ListObjectAccesses(dataset, key, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accesses)
+}
+
+// GetAccessLoggingByLocation gets the access logging state of the dataset identified by its search index location
+// @Summary Get the access logging of a dataset by its search index location
+// @Schemes
+// @Description Get the access logging record of the dataset identified by `dataset_extended`
+// @Description (`<object store name>|<bucket name>|<dataset name>`), as used in the metadata search index.
+// @Description This is used by the sync service to decide which download events to record.
+// @Description **NOTE: This endpoint is only available to the service account**
+// @Tags Service Account
+// @Accept json
+// @Produce json
+// @Param	dataset_extended  query  string  true  "The dataset's search index location"
+// @Success 200 {object} database.AccessLogging
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /access/logging [get]
+func GetAccessLoggingByLocation(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	if !getUserInfo(c).IsService {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	location := strings.SplitN(c.Query("dataset_extended"), "|", 3)
+	if len(location) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataset_extended must be in the format <object store name>|<bucket name>|<dataset name>"})
+		return
+	}
+
+	logging, err := db.GetAccessLoggingByLocation(location[0], location[1], location[2])
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, logging)
+}
+
+// RecordObjectAccesses records object downloads read from bucket events
+// @Summary Record object downloads
+// @Schemes
+// @Description Record downloads of objects in datasets with access logging enabled. The principal of each download
+// @Description is attributed to the user the temporary credentials with that access key were issued to, or is
+// @Description recorded as is if it isn't a known access key. Downloads in other datasets are skipped.
+// @Description At most 1000 downloads can be recorded in one request.
+// @Description **NOTE: This endpoint is only available to the service account**
+// @Tags Service Account
+// @Accept json
+// @Produce json
+// @Param	accessesInput		body	objectAccessBulkInput	true	"Object downloads"
+// @Success 200 {object} ObjectAccessBulkResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /access/bulk [post]
+func RecordObjectAccesses(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	if !getUserInfo(c).IsService {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	input := objectAccessBulkInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Accesses) > maxObjectAccessRecords {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at most " + strconv.Itoa(maxObjectAccessRecords) + " downloads can be recorded at once"})
+		return
+	}
+
+	principals := []string{}
+	for _, record := range input.Accesses {
+		if record.Principal != "" {
+			principals = append(principals, record.Principal)
+		}
+	}
+	usernames, err := db.GetUsernamesByAccessKeys(principals)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// the access logging of each dataset in the request, nil if it isn't enabled
+	datasets := map[string]*database.AccessLogging{}
+	accesses := []*database.ObjectAccess{}
+	for _, record := range input.Accesses {
+		logging, ok := datasets[record.DatasetExtended]
+		if !ok {
+			location := strings.SplitN(record.DatasetExtended, "|", 3)
+			if len(location) == 3 {
+				logging, err = db.GetAccessLoggingByLocation(location[0], location[1], location[2])
+				if err != nil && err != database.ErrNotFound {
+					HandleError(c, err)
+					return
+				}
+			}
+			datasets[record.DatasetExtended] = logging
+		}
+
+		// the object key includes the dataset's root directory
+		parts := strings.SplitN(record.ObjectKey, "/", 2)
+		if logging == nil || len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+
+		username, ok := usernames[record.Principal]
+		if !ok {
+			username = record.Principal
+		}
+
+		accessed, err := time.Parse(time.RFC3339, record.Accessed)
+		if err != nil {
+			logrus.Debugf("Recording download of %s with the current time, invalid access time '%s'", record.ObjectKey, record.Accessed)
+			accessed = time.Now()
+		}
+
+		accesses = append(accesses, &database.ObjectAccess{
+			DatasetId: logging.DatasetId,
+			FilePath:  parts[1],
+			Username:  username,
+			Accessed:  accessed.UTC(),
+		})
+	}
+
+	if err := db.CreateObjectAccesses(accesses); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &ObjectAccessBulkResponse{
+		Recorded: len(accesses),
+		Skipped:  len(input.Accesses) - len(accesses),
+	})
+}
@@ -76,6 +76,16 @@ func CreateDataset(c *gin.Context) {
 		return
 	}
 
+	reserved, err := datasetNameReserved(db, namespace, dsInput.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if reserved {
+		HandleError(c, database.ErrExists)
+		return
+	}
+
 	// Load the Object Store from the request context
 	currentStore, err := getStoreByName(getStores(c), namespace.ObjectStore.Name)
 	if err != nil {
@@ -98,7 +108,7 @@ func CreateDataset(c *gin.Context) {
 		// service, in the api message handleSync() function, we manually craft this value again since
 		// RootDirectory for the dataset is not available there. If this default behavior is ever changed
 		// the handleSync() function must also be modified.
-		return db.CreateDataset(namespace, dsInput.Name, *dsInput.Description, dsInput.Name+"/", username)
+		return db.CreateDataset(namespace, dsInput.Name, *dsInput.Description, datasetRootDirectory(dsInput.Name), username)
 	})
 	tx.AddRollback(func() error {
 		return db.DeleteDataset(namespace, dsInput.Name)
@@ -428,3 +438,8 @@ func RestoreDataset(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// datasetRootDirectory returns the prefix in the namespace's bucket where a new dataset's objects are written
+func datasetRootDirectory(name string) string {
+	return name + "/"
+}
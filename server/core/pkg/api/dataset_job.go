@@ -0,0 +1,488 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+)
+
+type datasetCloneInput struct {
+	// Namespace is the namespace to create the new dataset in, defaults to the dataset's namespace
+	Namespace string `json:"namespace"`
+	// Name is the unique name of the new dataset
+	Name string `json:"name" binding:"required"`
+	// Description is a short description of the new dataset, defaults to the dataset's description
+	Description *string `json:"description"`
+	// CopyPermissions also grants the groups with access to the dataset the same access to the new dataset
+	CopyPermissions bool `json:"copy_permissions"`
+}
+
+type datasetMoveInput struct {
+	// Namespace is the namespace to move the dataset to, defaults to the dataset's namespace
+	Namespace string `json:"namespace"`
+	// Name is the new name of the dataset, defaults to the dataset's name
+	Name string `json:"name"`
+}
+
+// datasetGrant is a group's access to a dataset
+type datasetGrant struct {
+	group      string
+	permission string
+}
+
+// CloneDataset creates a new dataset and schedules a job that copies the dataset's objects into it
+// @Summary Clone a dataset
+// @Schemes
+// @Description Create a new dataset, optionally in another namespace or object store, and schedule a background job
+// @Description that copies all objects and their metadata into it. Objects are copied by the object store if both
+// @Description datasets are in the same object store, and streamed through the core service otherwise. The new
+// @Description dataset has the same owner, metadata schema, and metadata sidecar declaration. The owner, the user
+// @Description cloning the dataset, and admins have read/write access, and if `copy_permissions` is set, the groups
+// @Description with access to the dataset are given the same access. Requires read access to the dataset, and
+// @Description the authorized user must have the admin or privileged role.
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	datasetCloneInput		body	datasetCloneInput	true	"Dataset Clone Input"
+// @Success 202 {object} database.DatasetJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/clone [post]
+func CloneDataset(c *gin.Context) {
+	_, db := getAppConfig(c)
+	userInfo := getUserInfo(c)
+
+	if privileged := validatePrivileged(userInfo.Role); !privileged {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	source, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+	if source.DeleteStatus != string(database.NOT_SCHEDULED) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "datasets marked for delete can't be cloned"})
+		return
+	}
+
+	input := datasetCloneInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Same restrictions on dataset names as CreateDataset
+	if strings.Contains(input.Name, "/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataset names cannot contain `/` character"})
+		return
+	}
+	if strings.Contains(input.Name, "|") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataset names cannot contain `|` character"})
+		return
+	}
+
+	namespaceName := input.Namespace
+	if namespaceName == "" {
+		namespaceName = source.Namespace.Name
+	}
+	namespace, err := db.GetNamespace(namespaceName)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	reserved, err := datasetNameReserved(db, namespace, input.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if reserved {
+		HandleError(c, database.ErrExists)
+		return
+	}
+
+	description := source.Description
+	if input.Description != nil {
+		description = *input.Description
+	}
+
+	// Load the Object Store of the new dataset from the request context
+	currentStore, err := getStoreByName(getStores(c), namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// Later grants replace earlier ones, so the default access is kept even if it was limited on the dataset
+	owner := source.Owner.Username
+	grants := []datasetGrant{}
+	if input.CopyPermissions {
+		for _, perm := range source.Permissions {
+			grants = append(grants, datasetGrant{group: perm.Group.GroupName, permission: perm.Permission})
+		}
+	}
+	grants = append(grants, datasetGrant{group: db.GetUserDefaultGroup(owner), permission: database.PERM_READ_WRITE})
+	if !userInfo.IsService && userInfo.Username != owner {
+		grants = append(grants, datasetGrant{group: db.GetUserDefaultGroup(userInfo.Username), permission: database.PERM_READ_WRITE})
+	}
+	grants = append(grants, datasetGrant{group: "admin", permission: database.PERM_READ_WRITE})
+
+	tx := &Transaction{}
+
+	// Create database entry, using the same root directory convention as CreateDataset
+	tx.AddFunction(func() error {
+		return db.CreateDataset(namespace, input.Name, description, datasetRootDirectory(input.Name), owner)
+	})
+	tx.AddRollback(func() error {
+		return db.DeleteDataset(namespace, input.Name)
+	})
+
+	// Add permissions
+	tx.AddFunction(func() error {
+		for _, grant := range grants {
+			if err := db.UpdateDatasetPermissions(namespace, input.Name, grant.group, grant.permission); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// NOTE: no rollback as deleting the dataset will remove the permissions
+
+	// Copy the metadata settings, so the copied objects are indexed and validated the same way
+	tx.AddFunction(func() error {
+		ds, err := db.GetDataset(namespace, input.Name)
+		if err != nil {
+			return err
+		}
+
+		schema, err := db.GetMetadataSchema(source)
+		if err == nil {
+			_, err = db.SetMetadataSchema(ds, schema)
+		}
+		if err != nil && err != database.ErrNotFound {
+			return err
+		}
+
+		sidecar, err := db.GetMetadataSidecar(source)
+		if err == nil {
+			_, err = db.SetMetadataSidecar(ds, sidecar.Suffixes)
+		}
+		if err != nil && err != database.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+	// NOTE: no rollback as deleting the dataset will remove the metadata settings
+
+	// Create datastore entry
+	tx.AddFunction(func() error {
+		return currentStore.CreateDataset(input.Name, namespace)
+	})
+	tx.AddRollback(func() error {
+		ds, err := db.GetDataset(namespace, input.Name)
+		if err != nil {
+			return err
+		}
+		return currentStore.DeleteDataset(ds.RootDirectory, namespace)
+	})
+
+	// Enable bucket notifications for the new dataset, so the copied objects are indexed by the sync service
+	tx.AddFunction(func() error {
+		ds, err := db.GetDataset(namespace, input.Name)
+		if err != nil {
+			return err
+		}
+		return currentStore.EnableEvents(namespace, ds)
+	})
+	tx.AddRollback(func() error {
+		ds, err := db.GetDataset(namespace, input.Name)
+		if err != nil {
+			return err
+		}
+		return currentStore.DisableEvents(namespace, ds)
+	})
+
+	// Render the policies of the users with access to the new dataset
+	tx.AddFunction(func() error {
+		usernames, err := db.GetUsersWithPermissionsToDataset(namespace, input.Name)
+		if err != nil {
+			return err
+		}
+		for _, username := range usernames {
+			perms, err := db.GetPermissionsByUser(&namespace.ObjectStore, username, false)
+			if err != nil {
+				return err
+			}
+			if err := currentStore.SetUserPolicy(username, perms); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// NOTE: no rollback as this is the final step
+
+	err = tx.Execute()
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	target, err := db.GetDataset(namespace, input.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	job, err := db.CreateDatasetJob(database.DATASET_JOB_CLONE, source, target, userInfo.Username)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// MoveDataset renames a dataset or moves it to another namespace, and schedules a job that relocates its objects
+// @Summary Rename or move a dataset
+// @Schemes
+// @Description Rename a dataset, move it to another namespace, or both, and schedule a background job that moves
+// @Description its objects to the new location. The dataset keeps its name and is read from its old location until
+// @Description every object has been copied with its metadata, and is then renamed, keeping its permissions,
+// @Description metadata schema, sync configuration, and other settings. If the job fails before then, the dataset
+// @Description stays in its old location. Once the dataset is renamed, the job updates the access policies and
+// @Description sync targets, and removes the old location and its search index documents. The job can be resumed
+// @Description if it is interrupted, and the new name can't be used by another dataset until it completes. Only the
+// @Description latest version of each object is moved, so datasets with snapshots can't be moved. Requires write
+// @Description access to the dataset, and the authorized user must have the admin or privileged role.
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	datasetMoveInput		body	datasetMoveInput	true	"Dataset Move Input"
+// @Success 202 {object} database.DatasetJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/move [post]
+func MoveDataset(c *gin.Context) {
+	_, db := getAppConfig(c)
+	userInfo := getUserInfo(c)
+
+	if privileged := validatePrivileged(userInfo.Role); !privileged {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+	if dataset.DeleteStatus != string(database.NOT_SCHEDULED) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "datasets marked for delete can't be moved"})
+		return
+	}
+
+	input := datasetMoveInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := input.Name
+	if name == "" {
+		name = dataset.Name
+	}
+	namespaceName := input.Namespace
+	if namespaceName == "" {
+		namespaceName = dataset.Namespace.Name
+	}
+	if name == dataset.Name && namespaceName == dataset.Namespace.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a new name or namespace is required"})
+		return
+	}
+
+	// Same restrictions on dataset names as CreateDataset
+	if strings.Contains(name, "/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataset names cannot contain `/` character"})
+		return
+	}
+	if strings.Contains(name, "|") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataset names cannot contain `|` character"})
+		return
+	}
+
+	namespace, err := db.GetNamespace(namespaceName)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// Make sure the job can load the Object Store of the new namespace
+	_, err = getStoreByName(getStores(c), namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// Snapshots reference the versions of the objects, which are not kept when the objects are moved
+	snapshots, err := db.ListSnapshots(dataset, 1, 0)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if len(snapshots) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "datasets with snapshots can't be moved"})
+		return
+	}
+
+	// Jobs find their datasets by name, so the dataset can't be moved while a job is copying its objects
+	active, err := db.HasActiveDatasetJobs(dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if active {
+		c.JSON(http.StatusConflict, gin.H{"error": "the dataset can't be moved until its clone and move jobs are complete"})
+		return
+	}
+
+	reserved, err := datasetNameReserved(db, namespace, name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if reserved {
+		HandleError(c, database.ErrExists)
+		return
+	}
+
+	job, err := db.MoveDataset(dataset, namespace, name, userInfo.Username)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// datasetNameReserved returns true if the name is used by a dataset that is being moved, either as its old or its new
+// name. The dataset takes the new name once its objects are copied, and the objects at the old location are removed
+// after that, so a new dataset can't use either name until the move is complete
+func datasetNameReserved(db *database.Database, namespace *database.Namespace, name string) (bool, error) {
+	return db.HasActiveDatasetJobs(&database.Dataset{Name: name, Namespace: namespace})
+}
+
+// ListDatasetJobs lists the jobs that copied objects from or into a dataset
+// @Summary List a dataset's jobs
+// @Schemes
+// @Description List the clone jobs that copied objects from or into a dataset, and the jobs that moved it, and
+// @Description their progress, most recent first
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	limit  query  int  false  "Maximum number of jobs to return" default(25)
+// @Param	offset  query  int  false  "Number of jobs to skip" default(0)
+// @Success 200 {object} []database.DatasetJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/job [get]
+func ListDatasetJobs(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	jobs, err := db.ListDatasetJobs(dataset, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetDatasetJob gets a job that copied objects from or into a dataset
+// @Summary Get a dataset job
+// @Schemes
+// @Description Get the status and progress of a clone job that copies objects from or into a dataset, or of a job
+// @Description that moves it
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	jobId   path      int  true  "Job ID"
+// @Success 200 {object} database.DatasetJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/job/{jobId} [get]
+func GetDatasetJob(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job id must be an integer"})
+		return
+	}
+
+	job, err := db.GetDatasetJob(id)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// only jobs of this dataset can be read with access to it
+	isSource := job.Namespace == dataset.Namespace.Name && job.Dataset == dataset.Name
+	isTarget := job.TargetNamespace == dataset.Namespace.Name && job.TargetDataset == dataset.Name
+	if !isSource && !isTarget {
+		HandleError(c, database.ErrNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxDuplicateGroups is the maximum number of duplicate groups that can be requested at once
+	maxDuplicateGroups = 1000
+	// maxDuplicateObjects is the maximum number of objects returned per duplicate group, which is
+	// limited by the default opensearch `index.max_inner_result_window` setting
+	maxDuplicateObjects = 100
+)
+
+type ContentHashExistsFilter struct {
+	Exists struct {
+		Field string `json:"field"`
+	} `json:"exists"`
+}
+
+type DuplicatesSearchPayload struct {
+	Size  int `json:"size"`
+	Query struct {
+		Bool struct {
+			Filter struct {
+				Bool struct {
+					Must []interface{} `json:"must"`
+				} `json:"bool"`
+			} `json:"filter"`
+		} `json:"bool"`
+	} `json:"query"`
+	Aggs struct {
+		Duplicates struct {
+			Terms struct {
+				Field       string `json:"field"`
+				MinDocCount int    `json:"min_doc_count"`
+				Size        int    `json:"size"`
+			} `json:"terms"`
+			Aggs struct {
+				Objects struct {
+					TopHits struct {
+						Size int `json:"size"`
+					} `json:"top_hits"`
+				} `json:"objects"`
+			} `json:"aggs"`
+		} `json:"duplicates"`
+	} `json:"aggs"`
+}
+
+type DuplicatesSearchResponse struct {
+	Aggregations struct {
+		Duplicates struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+				Objects  struct {
+					Hits struct {
+						Hits []struct {
+							Source MetadataSearchSource `json:"_source"`
+						} `json:"hits"`
+					} `json:"hits"`
+				} `json:"objects"`
+			} `json:"buckets"`
+		} `json:"duplicates"`
+	} `json:"aggregations"`
+}
+
+type DuplicateGroup struct {
+	// ContentHash is the hex encoded SHA-256 hash shared by the objects
+	ContentHash string `json:"content_hash"`
+	// Count is the total number of objects with this content hash
+	Count int `json:"count"`
+	// SizeBytes is the size of each object in bytes
+	SizeBytes int `json:"size_bytes"`
+	// ReclaimableBytes is the storage used by all but one of the copies
+	ReclaimableBytes int `json:"reclaimable_bytes"`
+	// Objects are the objects with this content hash, limited by the `max_objects` parameter
+	Objects []MetadataSearchResult `json:"objects"`
+}
+
+// FindDuplicates searches the metadata index for objects with identical content
+// @Summary Find duplicate objects
+// @Schemes
+// @Description Find objects with identical content, based on the SHA-256 content hash computed by the
+// @Description sync service when an object is created. The search process will apply permissions to the
+// @Description results, only including objects in datasets to which the authorized user has access.
+// @Description Duplicate groups are ordered by the number of copies.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	size  query  int  false  "Number of duplicate groups to return (max 1000)" default(25)
+// @Param	max_objects  query  int  false  "Number of objects to return per duplicate group (max 100)" default(10)
+// @Param	namespace  query  string  false  "If set, restrict results to this namespace"
+// @Param	dataset  query  string  false  "If set, restrict results to this dataset. `namespace` must be set."
+// @Success 200 {object} object{duplicates=[]DuplicateGroup}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/duplicates [get]
+func FindDuplicates(c *gin.Context) {
+	config, db := getAppConfig(c)
+
+	queryParams := c.Request.URL.Query()
+
+	size := 25
+	maxObjects := 10
+	var err error
+	if sizeParam, ok := queryParams["size"]; ok {
+		size, err = strconv.Atoi(sizeParam[0])
+		if err != nil || size < 1 || size > maxDuplicateGroups {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size must be between 1 and %d", maxDuplicateGroups)})
+			return
+		}
+	}
+	if maxObjectsParam, ok := queryParams["max_objects"]; ok {
+		maxObjects, err = strconv.Atoi(maxObjectsParam[0])
+		if err != nil || maxObjects < 1 || maxObjects > maxDuplicateObjects {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_objects must be between 1 and %d", maxDuplicateObjects)})
+			return
+		}
+	}
+
+	// check if user wants to search within a specific namespace or dataset
+	var namespaceName string
+	var datasetName string
+	if namespaceParam, ok := queryParams["namespace"]; ok {
+		namespaceName = namespaceParam[0]
+	}
+	if datasetParam, ok := queryParams["dataset"]; ok {
+		if namespaceName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "must specify namespace if searching within a dataset"})
+			return
+		}
+		datasetName = datasetParam[0]
+	}
+
+	// get user's dataset permissions
+	userInfo := getUserInfo(c)
+	datasetsFilter, datasetNamespaces, err := getSearchableDatasets(db, userInfo.Username, namespaceName, datasetName)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// create payload, only the aggregation results are needed
+	payload := DuplicatesSearchPayload{}
+	payload.Size = 0
+
+	coreServiceFilter := CoreServiceFilter{}
+	coreServiceFilter.Term.CoreServiceEndpoint = getCoreServiceEndpoint()
+	hashExistsFilter := ContentHashExistsFilter{}
+	hashExistsFilter.Exists.Field = "content_hash"
+	payload.Query.Bool.Filter.Bool.Must = []interface{}{datasetsFilter, coreServiceFilter, hashExistsFilter}
+
+	payload.Aggs.Duplicates.Terms.Field = "content_hash"
+	payload.Aggs.Duplicates.Terms.MinDocCount = 2
+	payload.Aggs.Duplicates.Terms.Size = size
+	payload.Aggs.Duplicates.Aggs.Objects.TopHits.Size = maxObjects
+
+	response := DuplicatesSearchResponse{}
+	if err := searchMetadataIndex(config.Server.ElasticsearchEndpoint, &payload, &response); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	duplicates := []DuplicateGroup{}
+	for _, bucket := range response.Aggregations.Duplicates.Buckets {
+		group := DuplicateGroup{
+			ContentHash: bucket.Key,
+			Count:       bucket.DocCount,
+			Objects:     []MetadataSearchResult{},
+		}
+		for _, hit := range bucket.Objects.Hits.Hits {
+			group.SizeBytes = hit.Source.SizeBytes
+			group.Objects = append(group.Objects, newMetadataSearchResult(&hit.Source, datasetNamespaces))
+		}
+		group.ReclaimableBytes = group.SizeBytes * (group.Count - 1)
+
+		duplicates = append(duplicates, group)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"duplicates": duplicates})
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// exportBatchSize is the number of results fetched from the search index at a time while exporting
+const exportBatchSize = 1000
+
+// exportCSVHeader are the CSV columns. Metadata is written as a JSON object, as objects have different keys
+var exportCSVHeader = []string{"uri", "namespace", "dataset", "file_path", "last_modified_date", "size_bytes", "content_hash", "metadata"}
+
+// exportWriter writes search results in an export format
+type exportWriter interface {
+	Write(result *MetadataSearchResult) error
+	Flush() error
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+	w       http.ResponseWriter
+}
+
+func (e *ndjsonExportWriter) Write(result *MetadataSearchResult) error {
+	return e.encoder.Encode(result)
+}
+
+func (e *ndjsonExportWriter) Flush() error {
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+	w      http.ResponseWriter
+}
+
+func (e *csvExportWriter) Write(result *MetadataSearchResult) error {
+	metadata := map[string]string{}
+	for _, pair := range result.Metadata {
+		for key, value := range pair {
+			metadata[key] = value
+		}
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return e.writer.Write([]string{
+		result.URI,
+		result.Namespace,
+		result.Dataset,
+		result.FilePath,
+		result.LastModifiedDate,
+		strconv.Itoa(result.SizeBytes),
+		result.ContentHash,
+		string(metadataBytes),
+	})
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.writer.Flush()
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return e.writer.Error()
+}
+
+// ExportSearchResults streams every result of a metadata search
+// @Summary Export object metadata search results
+// @Schemes
+// @Description Stream every object that matches a metadata search, using the same filters and sort as
+// @Description `GET /search`, as newline delimited JSON (one result per line) or CSV. The search process
+// @Description will apply permissions to the results, only including objects in datasets to which the
+// @Description authorized user has access. If an error occurs after the export has started, the NDJSON
+// @Description export ends with a line containing an `error` field and the CSV export is truncated.
+// @Tags Search
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Param	format  query  string  false  "Export format ('ndjson' or 'csv')" default(ndjson)
+// @Param	namespace  query  string  false  "If set, restrict results to this namespace"
+// @Param	dataset  query  string  false  "If set, restrict results to this dataset. `namespace` must be set."
+// @Param	metadata  query  string  false  "A comma separated list of key-value pairs to search for, matching objects with any of the pairs. (e.g. foo:bar,fizz:buzz)"
+// @Param	q  query  string  false  "A metadata query (e.g. `subject:mouse* AND NOT status:failed AND size>1GB`)"
+// @Param	filename  query  string  false  "If set, restrict results to objects whose file name contains this text, case insensitively (e.g. `calib`)"
+// @Param	path  query  string  false  "If set, restrict results to objects whose path contains these directories anywhere (e.g. `session_03` or `raw/session_03`), or with a leading `/`, to objects under this directory of the dataset (e.g. `/raw/session_03`)"
+// @Param	sort  query  string  false  "Sort results in the format `<field>[:asc|desc]`, where field is `modified`, `size`, `key`, or `metadata.<key>`"
+// @Param	modified_after  query  string  false  "Filter results to include only objects modified after the specified datetime string in the format '2006-01-02T15:04:05.000Z'"
+// @Param	modified_before  query  string  false  "Filter results to include only objects modified before the specified datetime string in the format '2006-01-02T15:04:05.000Z'"
+// @Success 200 {array} MetadataSearchResult
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/export [get]
+func ExportSearchResults(c *gin.Context) {
+	config, _ := getAppConfig(c)
+
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be 'ndjson' or 'csv'"})
+		return
+	}
+
+	query, datasetNamespaces, ok := buildSearchQuery(c)
+	if !ok {
+		return
+	}
+	_, sortClauses, ok := parseSearchSort(c)
+	if !ok {
+		return
+	}
+
+	payload := newExportSearchPayload(query, sortClauses)
+
+	// fetch the first batch before writing the response, so errors can still be returned as an error response
+	response := MetadataSearchResponse{}
+	if err := searchMetadataIndex(config.Server.ElasticsearchEndpoint, payload, &response); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	var writer exportWriter
+	var ndjsonWriter *ndjsonExportWriter
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="search-results.csv"`)
+		csvWriter := csv.NewWriter(c.Writer)
+		if err := csvWriter.Write(exportCSVHeader); err != nil {
+			logrus.Errorf("Failed to write search export: %s", err.Error())
+			return
+		}
+		writer = &csvExportWriter{writer: csvWriter, w: c.Writer}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="search-results.ndjson"`)
+		ndjsonWriter = &ndjsonExportWriter{encoder: json.NewEncoder(c.Writer), w: c.Writer}
+		writer = ndjsonWriter
+	}
+	c.Status(http.StatusOK)
+
+	for {
+		for _, hit := range response.Hits.Hits {
+			result := newMetadataSearchResult(&hit.Source, datasetNamespaces)
+			if err := writer.Write(&result); err != nil {
+				// the client most likely disconnected
+				logrus.Errorf("Failed to write search export: %s", err.Error())
+				return
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			logrus.Errorf("Failed to write search export: %s", err.Error())
+			return
+		}
+
+		if !nextExportPage(payload, &response) {
+			return
+		}
+
+		response = MetadataSearchResponse{}
+		if err := searchMetadataIndex(config.Server.ElasticsearchEndpoint, payload, &response); err != nil {
+			logrus.Errorf("Failed to search metadata index during export: %s", err.Error())
+			if ndjsonWriter != nil {
+				ndjsonWriter.encoder.Encode(gin.H{"error": "export failed before all results were written"})
+			}
+			return
+		}
+	}
+}
+
+// newExportSearchPayload builds the search for the first batch of exported results
+func newExportSearchPayload(query *SearchQuery, sortClauses []interface{}) *MetadataSearchPayload {
+	payload := &MetadataSearchPayload{}
+	payload.Size = exportBatchSize
+	payload.Sort = sortClauses
+	payload.Query = *query
+	return payload
+}
+
+// nextExportPage updates the payload to search for the batch of results after the response, returning false if
+// the response was the last batch. Results are paged using the sort values of the last hit
+func nextExportPage(payload *MetadataSearchPayload, response *MetadataSearchResponse) bool {
+	if len(response.Hits.Hits) < exportBatchSize {
+		return false
+	}
+
+	payload.SearchAfter = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	return true
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// newExportResponse returns a search response with n hits, each sorted by its index
+func newExportResponse(n int) *MetadataSearchResponse {
+	response := &MetadataSearchResponse{}
+	for i := 0; i < n; i++ {
+		hit := struct {
+			Source MetadataSearchSource `json:"_source"`
+			Sort   []json.RawMessage    `json:"sort"`
+		}{}
+		hit.Source.ObjectKey = fmt.Sprintf("ds/file-%d.txt", i)
+		hit.Sort = []json.RawMessage{json.RawMessage(`"store|bucket|ds"`), json.RawMessage(fmt.Sprintf(`"ds/file-%d.txt"`, i))}
+		response.Hits.Hits = append(response.Hits.Hits, hit)
+	}
+	return response
+}
+
+func TestExportSearchPayload(t *testing.T) {
+	query, err := buildSearchFilters(url.Values{"q": {"subject:mouse"}}, nil)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	sortClauses, err := opensearch.ParseSearchSort("size:desc")
+	if err != nil {
+		t.Fatalf("failed to parse sort: %v", err)
+	}
+
+	payload := newExportSearchPayload(query, sortClauses)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	decoded := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+
+	// the first batch starts at the beginning of the results, sorted with the tiebreakers used for paging
+	test.AssertEqual(t, string(decoded["size"]), fmt.Sprint(exportBatchSize))
+	test.AssertEqual(t, string(decoded["from"]), "0")
+	test.AssertEqual(t, string(decoded["sort"]),
+		`[{"size_bytes":{"order":"desc"}},{"dataset_extended":{"order":"asc"}},{"object_key":{"order":"asc"}}]`)
+	_, ok := decoded["search_after"]
+	test.AssertEqual(t, ok, false)
+
+	queryBody, _ := json.Marshal(query)
+	test.AssertEqual(t, string(decoded["query"]), string(queryBody))
+}
+
+func TestNextExportPage(t *testing.T) {
+	payload := newExportSearchPayload(&SearchQuery{}, nil)
+
+	// a full batch continues after the sort values of its last hit
+	test.AssertEqual(t, nextExportPage(payload, newExportResponse(exportBatchSize)), true)
+	searchAfter, _ := json.Marshal(payload.SearchAfter)
+	test.AssertEqual(t, string(searchAfter), fmt.Sprintf(`["store|bucket|ds","ds/file-%d.txt"]`, exportBatchSize-1))
+	test.AssertEqual(t, payload.From, 0)
+
+	// a partial or empty batch is the last one
+	test.AssertEqual(t, nextExportPage(payload, newExportResponse(exportBatchSize-1)), false)
+	test.AssertEqual(t, nextExportPage(payload, newExportResponse(0)), false)
+}
+
+func TestExportWriters(t *testing.T) {
+	hostname := os.Getenv("EXTERNAL_HOSTNAME")
+	os.Setenv("EXTERNAL_HOSTNAME", "https://hoss.example.com")
+	defer os.Setenv("EXTERNAL_HOSTNAME", hostname)
+
+	source := MetadataSearchSource{
+		ObjectKey:        "ds/dir/file.txt",
+		DatasetExtended:  "store|bucket|ds",
+		LastModifiedDate: "2021-01-01T00:00:00.000Z",
+		SizeBytes:        42,
+		Metadata:         []string{"subject:mouse", "url:http://example.com"},
+		ContentHash:      "abc123",
+	}
+	result := newMetadataSearchResult(&source, map[string]string{"store|bucket|ds": "ns"})
+
+	t.Run("csv", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		writer := &csvExportWriter{writer: csv.NewWriter(recorder), w: recorder}
+		if err := writer.Write(&result); err != nil {
+			t.Fatalf("failed to write result: %v", err)
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatalf("failed to flush results: %v", err)
+		}
+
+		records, err := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+		if err != nil {
+			t.Fatalf("failed to read csv: %v", err)
+		}
+		test.AssertEqual(t, len(records), 1)
+		test.AssertEqual(t, len(records[0]), len(exportCSVHeader))
+		test.AssertEqual(t, strings.Join(records[0], "|"),
+			`hoss+https://hoss.example.com:ns:ds/dir/file.txt|ns|ds|dir/file.txt|2021-01-01T00:00:00.000Z|42|abc123|{"subject":"mouse","url":"http://example.com"}`)
+		test.AssertEqual(t, recorder.Flushed, true)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		writer := &ndjsonExportWriter{encoder: json.NewEncoder(recorder), w: recorder}
+		for i := 0; i < 2; i++ {
+			if err := writer.Write(&result); err != nil {
+				t.Fatalf("failed to write result: %v", err)
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatalf("failed to flush results: %v", err)
+		}
+
+		// one result per line
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		test.AssertEqual(t, len(lines), 2)
+		decoded := MetadataSearchResult{}
+		if err := json.Unmarshal([]byte(lines[0]), &decoded); err != nil {
+			t.Fatalf("failed to decode line: %v", err)
+		}
+		test.AssertEqual(t, decoded.URI, "hoss+https://hoss.example.com:ns:ds/dir/file.txt")
+		test.AssertEqual(t, decoded.ContentHash, "abc123")
+		test.AssertEqual(t, len(decoded.Metadata), 2)
+		test.AssertEqual(t, recorder.Flushed, true)
+	})
+}
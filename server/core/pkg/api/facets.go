@@ -0,0 +1,302 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+)
+
+const (
+	// maxFacetPairs is the number of metadata key-value pairs aggregated to build the key facets
+	maxFacetPairs = 5000
+	// maxFacetDatasets is the maximum number of datasets aggregated
+	maxFacetDatasets = 1000
+	// maxFacetValues is the maximum number of values that can be requested per metadata key
+	maxFacetValues = 100
+)
+
+// facetIntervals are the supported `last_modified_date` histogram intervals
+var facetIntervals = map[string]bool{
+	"day":     true,
+	"week":    true,
+	"month":   true,
+	"quarter": true,
+	"year":    true,
+}
+
+type TermsAggregation struct {
+	Terms struct {
+		Field string `json:"field"`
+		Size  int    `json:"size"`
+	} `json:"terms"`
+	Aggs map[string]interface{} `json:"aggs,omitempty"`
+}
+
+type SumAggregation struct {
+	Sum struct {
+		Field string `json:"field"`
+	} `json:"sum"`
+}
+
+type DateHistogramAggregation struct {
+	DateHistogram struct {
+		Field            string `json:"field"`
+		CalendarInterval string `json:"calendar_interval"`
+		MinDocCount      int    `json:"min_doc_count"`
+	} `json:"date_histogram"`
+}
+
+type FacetsSearchPayload struct {
+	Size           int                    `json:"size"`
+	TrackTotalHits bool                   `json:"track_total_hits"`
+	Query          SearchQuery            `json:"query"`
+	Aggs           map[string]interface{} `json:"aggs"`
+}
+
+type FacetsSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations struct {
+		Metadata struct {
+			SumOtherDocCount int `json:"sum_other_doc_count"`
+			Buckets          []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"metadata"`
+		TotalSize struct {
+			Value float64 `json:"value"`
+		} `json:"total_size"`
+		Datasets struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+				Size     struct {
+					Value float64 `json:"value"`
+				} `json:"size"`
+			} `json:"buckets"`
+		} `json:"datasets"`
+		Modified struct {
+			Buckets []struct {
+				KeyAsString string `json:"key_as_string"`
+				DocCount    int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"modified"`
+	} `json:"aggregations"`
+}
+
+type FacetValue struct {
+	// Value is the metadata value (lowercase, as values are normalized in the search index)
+	Value string `json:"value"`
+	// Count is the number of objects with this key-value pair
+	Count int `json:"count"`
+}
+
+type KeyFacet struct {
+	// Key is the metadata key
+	Key string `json:"key"`
+	// Count is the number of objects with this metadata key
+	Count int `json:"count"`
+	// Values are the most common values of the key, limited by the `values` parameter
+	Values []FacetValue `json:"values"`
+	// OtherValuesCount is the number of objects with a value that is not included in Values
+	OtherValuesCount int `json:"other_values_count"`
+}
+
+type DatasetFacet struct {
+	// Namespace is the namespace the dataset is in
+	Namespace string `json:"namespace"`
+	// Dataset is the dataset name
+	Dataset string `json:"dataset"`
+	// Count is the number of matching objects in the dataset
+	Count int `json:"count"`
+	// SizeBytes is the total size of the matching objects in the dataset
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+type DateFacet struct {
+	// Date is the start of the histogram interval
+	Date string `json:"date"`
+	// Count is the number of objects last modified within the interval
+	Count int `json:"count"`
+}
+
+type SearchFacets struct {
+	// TotalObjects is the number of matching objects
+	TotalObjects int `json:"total_objects"`
+	// TotalSizeBytes is the total size of the matching objects
+	TotalSizeBytes int64 `json:"total_size_bytes"`
+	// Keys are the metadata keys of the matching objects, ordered by the number of objects with the key
+	Keys []KeyFacet `json:"keys"`
+	// KeysTruncated is true if there were too many distinct key-value pairs to aggregate them all,
+	// in which case the key counts are lower bounds
+	KeysTruncated bool `json:"keys_truncated"`
+	// Datasets are the number of matching objects in each dataset
+	Datasets []DatasetFacet `json:"datasets"`
+	// Modified is a histogram of the matching objects' last modified dates
+	Modified []DateFacet `json:"modified"`
+}
+
+// SearchFacets aggregates the objects matching a metadata search
+// @Summary Get metadata search facets
+// @Schemes
+// @Description Aggregate the objects that match a metadata search, using the same filters as `GET /search`.
+// @Description Returns the number of objects with each metadata key and its most common values, the total size
+// @Description and number of objects, the number of objects in each dataset, and a histogram of the objects'
+// @Description last modified dates. The search process will apply permissions, only including objects in
+// @Description datasets to which the authorized user has access.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	namespace  query  string  false  "If set, restrict results to this namespace"
+// @Param	dataset  query  string  false  "If set, restrict results to this dataset. `namespace` must be set."
+// @Param	metadata  query  string  false  "A comma separated list of key-value pairs to search for, matching objects with any of the pairs. (e.g. foo:bar,fizz:buzz)"
+// @Param	q  query  string  false  "A metadata query (e.g. `subject:mouse* AND NOT status:failed AND size>1GB`)"
+// @Param	filename  query  string  false  "If set, restrict results to objects whose file name contains this text, case insensitively (e.g. `calib`)"
+// @Param	path  query  string  false  "If set, restrict results to objects whose path contains these directories anywhere (e.g. `session_03` or `raw/session_03`), or with a leading `/`, to objects under this directory of the dataset (e.g. `/raw/session_03`)"
+// @Param	modified_after  query  string  false  "Filter results to include only objects modified after the specified datetime string in the format '2006-01-02T15:04:05.000Z'"
+// @Param	modified_before  query  string  false  "Filter results to include only objects modified before the specified datetime string in the format '2006-01-02T15:04:05.000Z'"
+// @Param	values  query  int  false  "Number of values to return per metadata key (max 100)" default(10)
+// @Param	interval  query  string  false  "Last modified date histogram interval ('day', 'week', 'month', 'quarter', or 'year')" default(month)
+// @Success 200 {object} SearchFacets
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/facets [get]
+func GetSearchFacets(c *gin.Context) {
+	config, _ := getAppConfig(c)
+	queryParams := c.Request.URL.Query()
+
+	values := 10
+	interval := "month"
+	var err error
+	if valuesParam, ok := queryParams["values"]; ok {
+		values, err = strconv.Atoi(valuesParam[0])
+		if err != nil || values < 1 || values > maxFacetValues {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("values must be between 1 and %d", maxFacetValues)})
+			return
+		}
+	}
+	if intervalParam, ok := queryParams["interval"]; ok {
+		interval = intervalParam[0]
+		if !facetIntervals[interval] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be one of 'day', 'week', 'month', 'quarter', or 'year'"})
+			return
+		}
+	}
+
+	query, datasetNamespaces, ok := buildSearchQuery(c)
+	if !ok {
+		return
+	}
+
+	payload := newFacetsSearchPayload(query, interval)
+	response := FacetsSearchResponse{}
+	if err := searchMetadataIndex(config.Server.ElasticsearchEndpoint, payload, &response); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newSearchFacets(&response, values, datasetNamespaces))
+}
+
+// newFacetsSearchPayload builds the search that aggregates the objects matching the query, with a
+// `last_modified_date` histogram using the given interval
+func newFacetsSearchPayload(query *SearchQuery, interval string) *FacetsSearchPayload {
+	metadataAgg := TermsAggregation{}
+	metadataAgg.Terms.Field = "metadata"
+	metadataAgg.Terms.Size = maxFacetPairs
+
+	totalSizeAgg := SumAggregation{}
+	totalSizeAgg.Sum.Field = "size_bytes"
+
+	datasetsAgg := TermsAggregation{}
+	datasetsAgg.Terms.Field = "dataset_extended"
+	datasetsAgg.Terms.Size = maxFacetDatasets
+	datasetsAgg.Aggs = map[string]interface{}{"size": totalSizeAgg}
+
+	modifiedAgg := DateHistogramAggregation{}
+	modifiedAgg.DateHistogram.Field = "last_modified_date"
+	modifiedAgg.DateHistogram.CalendarInterval = interval
+	modifiedAgg.DateHistogram.MinDocCount = 1
+
+	return &FacetsSearchPayload{
+		Size:           0,
+		TrackTotalHits: true,
+		Query:          *query,
+		Aggs: map[string]interface{}{
+			"metadata":   metadataAgg,
+			"total_size": totalSizeAgg,
+			"datasets":   datasetsAgg,
+			"modified":   modifiedAgg,
+		},
+	}
+}
+
+// newSearchFacets builds the facets from the aggregations, returning up to values values per metadata key.
+// datasetNamespaces maps extended dataset names to namespace names
+func newSearchFacets(response *FacetsSearchResponse, values int, datasetNamespaces map[string]string) SearchFacets {
+	facets := SearchFacets{
+		TotalObjects:   response.Hits.Total.Value,
+		TotalSizeBytes: int64(response.Aggregations.TotalSize.Value),
+		Keys:           []KeyFacet{},
+		KeysTruncated:  response.Aggregations.Metadata.SumOtherDocCount > 0,
+		Datasets:       []DatasetFacet{},
+		Modified:       []DateFacet{},
+	}
+
+	// The metadata field stores "key:value" strings, so the buckets are grouped by key. Buckets are
+	// ordered by count, so the first values seen for each key are the most common
+	keys := map[string]*KeyFacet{}
+	for _, bucket := range response.Aggregations.Metadata.Buckets {
+		key, value := opensearch.SplitMetadataPair(bucket.Key)
+		facet, ok := keys[key]
+		if !ok {
+			facet = &KeyFacet{Key: key, Values: []FacetValue{}}
+			keys[key] = facet
+		}
+
+		facet.Count += bucket.DocCount
+		if len(facet.Values) < values {
+			facet.Values = append(facet.Values, FacetValue{Value: value, Count: bucket.DocCount})
+		} else {
+			facet.OtherValuesCount += bucket.DocCount
+		}
+	}
+	for _, facet := range keys {
+		facets.Keys = append(facets.Keys, *facet)
+	}
+	sort.Slice(facets.Keys, func(i, j int) bool {
+		if facets.Keys[i].Count != facets.Keys[j].Count {
+			return facets.Keys[i].Count > facets.Keys[j].Count
+		}
+		return facets.Keys[i].Key < facets.Keys[j].Key
+	})
+
+	for _, bucket := range response.Aggregations.Datasets.Buckets {
+		facets.Datasets = append(facets.Datasets, DatasetFacet{
+			Namespace: datasetNamespaces[bucket.Key],
+			Dataset:   bucket.Key[strings.LastIndex(bucket.Key, "|")+1:],
+			Count:     bucket.DocCount,
+			SizeBytes: int64(bucket.Size.Value),
+		})
+	}
+
+	for _, bucket := range response.Aggregations.Modified.Buckets {
+		facets.Modified = append(facets.Modified, DateFacet{Date: bucket.KeyAsString, Count: bucket.DocCount})
+	}
+
+	return facets
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestFacetsSearchPayload(t *testing.T) {
+	query, err := buildSearchFilters(url.Values{"metadata": {"subject:mouse"}}, nil)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+
+	payload := newFacetsSearchPayload(query, "week")
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	decoded := struct {
+		Size           int                        `json:"size"`
+		TrackTotalHits bool                       `json:"track_total_hits"`
+		Query          json.RawMessage            `json:"query"`
+		Aggs           map[string]json.RawMessage `json:"aggs"`
+	}{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+
+	// only the aggregations are returned, counting every matching object
+	test.AssertEqual(t, decoded.Size, 0)
+	test.AssertEqual(t, decoded.TrackTotalHits, true)
+
+	// the aggregations use the same query as the search
+	queryBody, _ := json.Marshal(query)
+	test.AssertEqual(t, string(decoded.Query), string(queryBody))
+
+	test.AssertEqual(t, len(decoded.Aggs), 4)
+	test.AssertEqual(t, string(decoded.Aggs["metadata"]),
+		fmt.Sprintf(`{"terms":{"field":"metadata","size":%d}}`, maxFacetPairs))
+	test.AssertEqual(t, string(decoded.Aggs["total_size"]), `{"sum":{"field":"size_bytes"}}`)
+	test.AssertEqual(t, string(decoded.Aggs["datasets"]),
+		fmt.Sprintf(`{"terms":{"field":"dataset_extended","size":%d},"aggs":{"size":{"sum":{"field":"size_bytes"}}}}`, maxFacetDatasets))
+	test.AssertEqual(t, string(decoded.Aggs["modified"]),
+		`{"date_histogram":{"field":"last_modified_date","calendar_interval":"week","min_doc_count":1}}`)
+}
+
+func TestSearchFacets(t *testing.T) {
+	response := FacetsSearchResponse{}
+	err := json.Unmarshal([]byte(`{
+		"hits": {"total": {"value": 12}},
+		"aggregations": {
+			"metadata": {"sum_other_doc_count": 3, "buckets": [
+				{"key": "subject:mouse", "doc_count": 6},
+				{"key": "status:done", "doc_count": 5},
+				{"key": "subject:rat", "doc_count": 4},
+				{"key": "subject:fish", "doc_count": 2},
+				{"key": "status:failed", "doc_count": 1},
+				{"key": "url:http://example.com", "doc_count": 1}
+			]},
+			"total_size": {"value": 4096},
+			"datasets": {"buckets": [
+				{"key": "store|bucket|ds-1", "doc_count": 8, "size": {"value": 3072}},
+				{"key": "store|bucket|ds-2", "doc_count": 4, "size": {"value": 1024}}
+			]},
+			"modified": {"buckets": [
+				{"key_as_string": "2021-01-01T00:00:00.000Z", "doc_count": 7},
+				{"key_as_string": "2021-02-01T00:00:00.000Z", "doc_count": 5}
+			]}
+		}
+	}`), &response)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	facets := newSearchFacets(&response, 2, map[string]string{"store|bucket|ds-1": "ns-1", "store|bucket|ds-2": "ns-2"})
+
+	test.AssertEqual(t, facets.TotalObjects, 12)
+	test.AssertEqual(t, facets.TotalSizeBytes, int64(4096))
+	test.AssertEqual(t, facets.KeysTruncated, true)
+
+	// keys are ordered by count, with the values past the limit counted as other values
+	keys := ""
+	for _, key := range facets.Keys {
+		keys += fmt.Sprintf("%s=%d(", key.Key, key.Count)
+		for _, value := range key.Values {
+			keys += fmt.Sprintf("%s=%d,", value.Value, value.Count)
+		}
+		keys += fmt.Sprintf("other=%d) ", key.OtherValuesCount)
+	}
+	test.AssertEqual(t, keys, "subject=12(mouse=6,rat=4,other=2) status=6(done=5,failed=1,other=0) url=1(http://example.com=1,other=0) ")
+
+	datasets := ""
+	for _, dataset := range facets.Datasets {
+		datasets += fmt.Sprintf("%s/%s=%d:%d ", dataset.Namespace, dataset.Dataset, dataset.Count, dataset.SizeBytes)
+	}
+	test.AssertEqual(t, datasets, "ns-1/ds-1=8:3072 ns-2/ds-2=4:1024 ")
+
+	modified := ""
+	for _, date := range facets.Modified {
+		modified += fmt.Sprintf("%s=%d ", date.Date, date.Count)
+	}
+	test.AssertEqual(t, modified, "2021-01-01T00:00:00.000Z=7 2021-02-01T00:00:00.000Z=5 ")
+}
+
+func TestSearchFacetsEmpty(t *testing.T) {
+	facets := newSearchFacets(&FacetsSearchResponse{}, 10, map[string]string{})
+
+	// empty results are encoded as empty lists, not null
+	body, err := json.Marshal(facets)
+	if err != nil {
+		t.Fatalf("failed to encode facets: %v", err)
+	}
+	test.AssertEqual(t, string(body),
+		`{"total_objects":0,"total_size_bytes":0,"keys":[],"keys_truncated":false,"datasets":[],"modified":[]}`)
+}
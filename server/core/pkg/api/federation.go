@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+)
+
+// defaultFederationTimeoutSeconds is how long to wait for a peer core service if no timeout is configured
+const defaultFederationTimeoutSeconds = 10
+
+// FederatedServer is the status of a core service that was searched in a federated search
+type FederatedServer struct {
+	// Name is the name the server's results are labeled with
+	Name string `json:"name"`
+	// Endpoint is the server's core service API root, empty for this core service
+	Endpoint string `json:"endpoint,omitempty"`
+	// Error is set if the server couldn't be searched, in which case its results are missing
+	Error string `json:"error,omitempty"`
+	// Results is the number of results returned by the server
+	Results int `json:"results"`
+}
+
+// localServerName returns the name that results from this core service are labeled with in federated searches
+func localServerName(c *config.Configuration) string {
+	if c.Server.Federation.Name != "" {
+		return c.Server.Federation.Name
+	}
+	return os.Getenv("EXTERNAL_HOSTNAME")
+}
+
+// searchPeers sends a search to every peer core service at the same time, returning the results labeled with the
+// peer's name and the status of each peer. Peers that fail or time out are reported but don't fail the search
+func searchPeers(c *gin.Context, params url.Values) ([]MetadataSearchResult, []*FederatedServer) {
+	appConfig, _ := getAppConfig(c)
+	federation := appConfig.Server.Federation
+
+	timeout := federation.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = defaultFederationTimeoutSeconds
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	userToken := c.GetHeader("Authorization")
+
+	results := make([][]MetadataSearchResult, len(federation.Peers))
+	servers := make([]*FederatedServer, len(federation.Peers))
+	var wg sync.WaitGroup
+	for i := range federation.Peers {
+		wg.Add(1)
+		go func(i int, peer config.FederationPeer) {
+			defer wg.Done()
+
+			servers[i] = &FederatedServer{Name: peer.Name, Endpoint: peer.Endpoint}
+			peerResults, err := searchPeer(client, &peer, params, userToken)
+			if err != nil {
+				logrus.Warnf("Federated search of %s failed: %s", peer.Endpoint, err.Error())
+				servers[i].Error = err.Error()
+				return
+			}
+
+			for j := range peerResults {
+				peerResults[j].Server = peer.Name
+			}
+			results[i] = peerResults
+			servers[i].Results = len(peerResults)
+		}(i, federation.Peers[i])
+	}
+	wg.Wait()
+
+	merged := []MetadataSearchResult{}
+	for _, peerResults := range results {
+		merged = append(merged, peerResults...)
+	}
+
+	return merged, servers
+}
+
+// searchPeer sends a search to a peer core service, authenticated with the peer's delegated token if it has one
+// or the user's token
+func searchPeer(client *http.Client, peer *config.FederationPeer, params url.Values, userToken string) ([]MetadataSearchResult, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(peer.Endpoint, "/")+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	authorization := userToken
+	if peer.TokenEnv != "" {
+		token := os.Getenv(peer.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("delegated token %s is not set", peer.TokenEnv)
+		}
+		authorization = "Bearer " + token
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("User-Agent", "exec-env/hoss-core-service")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read search response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search failed with status %s", resp.Status)
+	}
+
+	response := struct {
+		Results []MetadataSearchResult `json:"results"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, errors.Wrap(err, "could not parse search response")
+	}
+
+	return response.Results, nil
+}
+
+// sortFederatedResults orders the merged results of a federated search by the search's sort, then by namespace,
+// dataset, file path, and server, so results from different servers are ranked together
+func sortFederatedResults(results []MetadataSearchResult, sortParam string) {
+	field, order := opensearch.SplitSearchSort(sortParam)
+
+	// compare returns a negative number if a sorts before b by the sort field, 0 if they are equal
+	compare := func(a, b *MetadataSearchResult) int {
+		switch field {
+		case "modified":
+			return strings.Compare(normalizeDate(a.LastModifiedDate), normalizeDate(b.LastModifiedDate))
+		case "size":
+			return a.SizeBytes - b.SizeBytes
+		case "key":
+			return strings.Compare(a.Dataset+"/"+a.FilePath, b.Dataset+"/"+b.FilePath)
+		}
+		return 0
+	}
+
+	var metadataKey string
+	if strings.HasPrefix(field, opensearch.MetadataSortPrefix) {
+		metadataKey = strings.ToLower(strings.TrimPrefix(field, opensearch.MetadataSortPrefix))
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := &results[i], &results[j]
+
+		if metadataKey != "" {
+			// numbers sort before dates, and objects without a typed value always sort last
+			aRank, aValue := federatedSortValue(a, metadataKey)
+			bRank, bValue := federatedSortValue(b, metadataKey)
+			if aRank != bRank {
+				return aRank < bRank
+			}
+			if aValue != bValue {
+				if order == "desc" {
+					return aValue > bValue
+				}
+				return aValue < bValue
+			}
+		} else if cmp := compare(a, b); cmp != 0 {
+			if order == "desc" {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+
+		if cmp := strings.Compare(a.Namespace, b.Namespace); cmp != 0 {
+			return cmp < 0
+		}
+		if cmp := strings.Compare(a.Dataset, b.Dataset); cmp != 0 {
+			return cmp < 0
+		}
+		if cmp := strings.Compare(a.FilePath, b.FilePath); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Server < b.Server
+	})
+}
+
+// federatedSortValue returns the sort rank (0 for numbers, 1 for dates, 2 for missing) and value of a metadata key
+func federatedSortValue(result *MetadataSearchResult, key string) (int, float64) {
+	for _, pair := range result.Metadata {
+		value, ok := pair[key]
+		if !ok {
+			continue
+		}
+		if typed, ok := opensearch.NewTypedMetadataValue(key, value, database.METADATA_TYPE_NUMBER); ok {
+			return 0, *typed.Number
+		}
+		if typed, ok := opensearch.NewTypedMetadataValue(key, value, database.METADATA_TYPE_DATE); ok {
+			d, _ := time.Parse(time.RFC3339Nano, typed.Date)
+			return 1, float64(d.UnixNano())
+		}
+	}
+	return 2, 0
+}
+
+// normalizeDate converts a date to RFC3339 in UTC, so dates with different precision compare correctly as strings
+func normalizeDate(date string) string {
+	if d, err := time.Parse(time.RFC3339Nano, date); err == nil {
+		return d.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	}
+	return date
+}
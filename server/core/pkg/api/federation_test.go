@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// describeResults describes search results as <server>:<dataset>/<file path>
+func describeResults(results []MetadataSearchResult) string {
+	described := []string{}
+	for _, result := range results {
+		described = append(described, result.Server+":"+result.Dataset+"/"+result.FilePath)
+	}
+	return strings.Join(described, " ")
+}
+
+func TestSortFederatedResults(t *testing.T) {
+	results := []MetadataSearchResult{
+		{Server: "b", Namespace: "ns", Dataset: "ds", FilePath: "1.txt", SizeBytes: 10,
+			LastModifiedDate: "2021-01-01T12:00:00.5Z", Metadata: []map[string]string{{"reading": "2"}}},
+		{Server: "a", Namespace: "ns", Dataset: "ds", FilePath: "2.txt", SizeBytes: 30,
+			LastModifiedDate: "2021-01-01T13:00:00+02:00", Metadata: []map[string]string{{"reading": "2021-01-01"}}},
+		{Server: "a", Namespace: "ns", Dataset: "ds", FilePath: "1.txt", SizeBytes: 10,
+			LastModifiedDate: "2021-01-01T12:00:00Z", Metadata: []map[string]string{{"reading": "10"}}},
+		{Server: "c", Namespace: "ns", Dataset: "ds", FilePath: "3.txt", SizeBytes: 20,
+			LastModifiedDate: "2021-01-02T00:00:00Z", Metadata: []map[string]string{{"reading": "unknown"}}},
+		{Server: "a", Namespace: "alpha", Dataset: "ds", FilePath: "4.txt", SizeBytes: 20,
+			LastModifiedDate: "2020-12-31T00:00:00Z"},
+	}
+
+	tests := []struct {
+		name string
+		sort string
+		want string
+	}{
+		// results without a sort are ordered by namespace, dataset, file path, then server
+		{"default", "", "a:ds/4.txt a:ds/1.txt b:ds/1.txt a:ds/2.txt c:ds/3.txt"},
+		// dates are compared in UTC, with fractional seconds
+		{"modified", "modified", "a:ds/4.txt a:ds/2.txt a:ds/1.txt b:ds/1.txt c:ds/3.txt"},
+		{"modified descending", "modified:desc", "c:ds/3.txt b:ds/1.txt a:ds/1.txt a:ds/2.txt a:ds/4.txt"},
+		// ties are ordered the same way in both directions
+		{"size", "size", "a:ds/1.txt b:ds/1.txt a:ds/4.txt c:ds/3.txt a:ds/2.txt"},
+		{"size descending", "size:desc", "a:ds/2.txt a:ds/4.txt c:ds/3.txt a:ds/1.txt b:ds/1.txt"},
+		{"key", "key", "a:ds/1.txt b:ds/1.txt a:ds/2.txt c:ds/3.txt a:ds/4.txt"},
+		// numbers sort before dates, and results without a typed value sort last in both directions
+		{"metadata", "metadata.reading", "b:ds/1.txt a:ds/1.txt a:ds/2.txt a:ds/4.txt c:ds/3.txt"},
+		{"metadata descending", "metadata.Reading:desc", "a:ds/1.txt b:ds/1.txt a:ds/2.txt a:ds/4.txt c:ds/3.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := make([]MetadataSearchResult, len(results))
+			copy(sorted, results)
+			sortFederatedResults(sorted, tt.sort)
+			test.AssertEqual(t, describeResults(sorted), tt.want)
+		})
+	}
+}
+
+// newFederationContext returns a request context for a federated search by a user, with the given federation
+// configuration
+func newFederationContext(federation config.Federation) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/search?federated=true", nil)
+	c.Request.Header.Set("Authorization", "Bearer user-token")
+
+	appConfig := &config.Configuration{}
+	appConfig.Server.Federation = federation
+	c.Set("config", appConfig)
+	c.Set("db", (*database.Database)(nil))
+	return c
+}
+
+// newFederationPeer starts a peer core service that responds to searches with the given status and results,
+// recording the Authorization header of the last request
+func newFederationPeer(t *testing.T, status int, results []MetadataSearchResult, authorization *string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/core/v1/search" || r.URL.Query().Get("metadata") != "subject:mouse" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if authorization != nil {
+			*authorization = r.Header.Get("Authorization")
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/core/v1"
+}
+
+func TestSearchPeers(t *testing.T) {
+	token := os.Getenv("HOSS_PEER_TOKEN")
+	os.Setenv("HOSS_PEER_TOKEN", "delegated-token")
+	defer os.Setenv("HOSS_PEER_TOKEN", token)
+
+	// a peer that doesn't respond before the timeout
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	var userAuthorization, delegatedAuthorization string
+	federation := config.Federation{
+		TimeoutSeconds: 1,
+		Peers: []config.FederationPeer{
+			{Name: "one", Endpoint: newFederationPeer(t, http.StatusOK, []MetadataSearchResult{
+				{Dataset: "ds", FilePath: "a.txt"}, {Dataset: "ds", FilePath: "b.txt"},
+			}, &userAuthorization)},
+			{Name: "failing", Endpoint: newFederationPeer(t, http.StatusInternalServerError, nil, nil)},
+			{Name: "slow", Endpoint: slow.URL + "/core/v1"},
+			{Name: "delegated", Endpoint: newFederationPeer(t, http.StatusOK, []MetadataSearchResult{
+				{Dataset: "other", FilePath: "c.txt"},
+			}, &delegatedAuthorization) + "/", TokenEnv: "HOSS_PEER_TOKEN"},
+			{Name: "missing token", Endpoint: newFederationPeer(t, http.StatusOK, nil, nil), TokenEnv: "HOSS_MISSING_TOKEN"},
+		},
+	}
+
+	results, servers := searchPeers(newFederationContext(federation), url.Values{"metadata": {"subject:mouse"}})
+
+	// the results of the peers that responded are labeled with the peer and kept
+	test.AssertEqual(t, describeResults(results), "one:ds/a.txt one:ds/b.txt delegated:other/c.txt")
+
+	// peers are searched with the user's token, unless they have a delegated token
+	test.AssertEqual(t, userAuthorization, "Bearer user-token")
+	test.AssertEqual(t, delegatedAuthorization, "Bearer delegated-token")
+
+	// peers that fail or time out are reported without failing the search
+	test.AssertEqual(t, len(servers), 5)
+	tests := []struct {
+		name    string
+		results int
+		err     string
+	}{
+		{"one", 2, ""},
+		{"failing", 0, "search failed with status 500 Internal Server Error"},
+		{"slow", 0, "Client.Timeout exceeded"},
+		{"delegated", 1, ""},
+		{"missing token", 0, "delegated token HOSS_MISSING_TOKEN is not set"},
+	}
+	for i, tt := range tests {
+		server := servers[i]
+		test.AssertEqual(t, server.Name, tt.name)
+		test.AssertEqual(t, server.Results, tt.results)
+		if tt.err == "" && server.Error != "" {
+			t.Errorf("unexpected error for %s: %s", tt.name, server.Error)
+		}
+		if !strings.Contains(server.Error, tt.err) {
+			t.Errorf("expected the error for %s to contain '%s', got '%s'", tt.name, tt.err, server.Error)
+		}
+	}
+}
+
+func TestSearchPeersNone(t *testing.T) {
+	results, servers := searchPeers(newFederationContext(config.Federation{}), url.Values{})
+	test.AssertEqual(t, len(results), 0)
+	test.AssertEqual(t, len(servers), 0)
+}
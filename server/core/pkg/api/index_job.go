@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateIndexJob schedules a rebuild of the metadata search index
+// @Summary Rebuild the metadata search index
+// @Schemes
+// @Description Schedule a background job that rebuilds the metadata search index from the object store. The job
+// @Description walks every object in each dataset, loading its metadata and updating its search index document,
+// @Description then removes documents for objects that no longer exist. Use this if the search index lost data or
+// @Description missed bucket events. The job can be limited to a namespace or a single dataset. Technical metadata
+// @Description and content hashes are kept from the existing documents, as the object content isn't read.
+// @Description The authorized user must have the admin role.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	namespace  query  string  false  "If set, only rebuild documents in this namespace"
+// @Param	dataset  query  string  false  "If set, only rebuild documents in this dataset. `namespace` must be set."
+// @Success 202 {object} database.IndexJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/index/job [post]
+func CreateIndexJob(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	userInfo := getUserInfo(c)
+	if isAdmin := validateAdmin(userInfo.Role); !isAdmin {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	namespaceName := c.Query("namespace")
+	datasetName := c.Query("dataset")
+	if datasetName != "" && namespaceName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "must specify namespace if rebuilding a dataset"})
+		return
+	}
+
+	// check that the namespace and dataset exist, so typos aren't reported as a failed job later
+	if namespaceName != "" {
+		namespace, err := db.GetNamespace(namespaceName)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+		if datasetName != "" {
+			if _, err := db.GetDataset(namespace, datasetName); err != nil {
+				HandleError(c, err)
+				return
+			}
+		}
+	}
+
+	job, err := db.CreateIndexJob(namespaceName, datasetName)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListIndexJobs lists metadata search index rebuild jobs
+// @Summary List metadata search index rebuild jobs
+// @Schemes
+// @Description List metadata search index rebuild jobs and their progress, most recent first.
+// @Description The authorized user must have the admin role.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	limit  query  int  false  "Maximum number of jobs to return" default(25)
+// @Param	offset  query  int  false  "Number of jobs to skip" default(0)
+// @Success 200 {object} []database.IndexJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/index/job [get]
+func ListIndexJobs(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	userInfo := getUserInfo(c)
+	if isAdmin := validateAdmin(userInfo.Role); !isAdmin {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	jobs, err := db.ListIndexJobs(limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetIndexJob gets a metadata search index rebuild job
+// @Summary Get a metadata search index rebuild job
+// @Schemes
+// @Description Get the status and progress of a metadata search index rebuild job.
+// @Description The authorized user must have the admin role.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	jobId   path      int  true  "Job ID"
+// @Success 200 {object} database.IndexJob
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/index/job/{jobId} [get]
+func GetIndexJob(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	userInfo := getUserInfo(c)
+	if isAdmin := validateAdmin(userInfo.Role); !isAdmin {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job id must be an integer"})
+		return
+	}
+
+	job, err := db.GetIndexJob(id)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
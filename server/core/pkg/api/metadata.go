@@ -13,23 +13,26 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gigantum/hoss-core/pkg/database"
 	"github.com/gigantum/hoss-core/pkg/opensearch"
+	"github.com/gigantum/hoss-service/search"
 	"github.com/gin-gonic/gin"
 )
 
+// maxSearchResultWindow is the maximum `from` + `size` of a search, which is limited by the default
+// opensearch `index.max_result_window` setting
+const maxSearchResultWindow = 10000
+
 func getDatasetExtended(objStoreName string, bucketName string, rootDir string) string {
-	return fmt.Sprintf(
-		"%s|%s|%s",
-		objStoreName,
-		bucketName,
-		strings.Replace(rootDir, "/", "", 1),
-	)
+	return opensearch.DatasetExtended(objStoreName, bucketName, rootDir)
 }
 
-type DatasetTerm struct {
-	Term struct {
-		DatasetExtended string `json:"dataset_extended"`
-	} `json:"term"`
+// DatasetsFilter restricts a search to a set of datasets, using a single terms query so the size of the
+// query doesn't grow with a clause per dataset
+type DatasetsFilter struct {
+	Terms struct {
+		DatasetExtended []string `json:"dataset_extended"`
+	} `json:"terms"`
 }
 
 type MetadataTerms struct {
@@ -48,36 +51,42 @@ type CoreServiceFilter struct {
 	} `json:"term"`
 }
 
+type SearchQuery struct {
+	Bool struct {
+		Must struct {
+			Terms    *MetadataTerms `json:"terms,omitempty"`
+			MatchAll map[string]int `json:"match_all,omitempty"`
+		} `json:"must"`
+		Filter struct {
+			Bool struct {
+				Must []interface{} `json:"must"`
+			} `json:"bool"`
+		} `json:"filter"`
+	} `json:"bool"`
+}
+
 type MetadataSearchPayload struct {
-	Size  int `json:"size"`
-	From  int `json:"from"`
-	Query struct {
-		Bool struct {
-			Must struct {
-				Terms    *MetadataTerms `json:"terms,omitempty"`
-				MatchAll map[string]int `json:"match_all,omitempty"`
-			} `json:"must"`
-			Filter struct {
-				Bool struct {
-					Must               []interface{} `json:"must"`
-					Should             []DatasetTerm `json:"should"`
-					MinimumShouldMatch int           `json:"minimum_should_match"`
-				} `json:"bool"`
-			} `json:"filter"`
-		} `json:"bool"`
-	} `json:"query"`
+	Size        int               `json:"size"`
+	From        int               `json:"from"`
+	Sort        []interface{}     `json:"sort,omitempty"`
+	SearchAfter []json.RawMessage `json:"search_after,omitempty"`
+	Query       SearchQuery       `json:"query"`
+}
+
+type MetadataSearchSource struct {
+	ObjectKey        string   `json:"object_key"`
+	DatasetExtended  string   `json:"dataset_extended"`
+	LastModifiedDate string   `json:"last_modified_date"`
+	SizeBytes        int      `json:"size_bytes"`
+	Metadata         []string `json:"metadata"`
+	ContentHash      string   `json:"content_hash"`
 }
 
 type MetadataSearchResponse struct {
 	Hits struct {
 		Hits []struct {
-			Source struct {
-				ObjectKey        string   `json:"object_key"`
-				DatasetExtended  string   `json:"dataset_extended"`
-				LastModifiedDate string   `json:"last_modified_date"`
-				SizeBytes        int      `json:"size_bytes"`
-				Metadata         []string `json:"metadata"`
-			} `json:"_source"`
+			Source MetadataSearchSource `json:"_source"`
+			Sort   []json.RawMessage    `json:"sort"`
 		} `json:"hits"`
 	} `json:"hits"`
 }
@@ -97,6 +106,10 @@ type MetadataSearchResult struct {
 	SizeBytes int `json:"size_bytes"`
 	// Metadata is a map of key-value pairs of metadata written to the object.
 	Metadata []map[string]string `json:"metadata"`
+	// ContentHash is the hex encoded SHA-256 hash of the object's content, if it has been computed
+	ContentHash string `json:"content_hash,omitempty"`
+	// Server is the name of the core service the object is stored in, only set for federated searches
+	Server string `json:"server,omitempty"`
 }
 
 // SearchMetadata searched the elasticsearch metadata index for the given key pairs
@@ -104,19 +117,36 @@ type MetadataSearchResult struct {
 // @Schemes
 // @Description Search object metadata based on key pairs or modified dates. The search process
 // @Description will apply permissions to the results, only showing results in datasets to which
-// @Description the authorized user has access. If no metadata key-value pairs are provided all
+// @Description the authorized user has access. If no metadata key-value pairs or query are provided all
 // @Description objects will be returned
+// @Description
+// @Description The `q` parameter accepts a query, combining terms with `AND`, `OR`, `NOT`, and parentheses:
+// @Description `key:value` (metadata pair), `key:val*` (wildcard value), `key:*` (key exists),
+// @Description `key>100` (number, date, or boolean comparison using = > >= < <=), `size>10MB` (size comparison),
+// @Description and `path=raw/**/*.tif` (object path pattern).
+// @Description Values containing spaces can be quoted (e.g. `key:"some value"`).
+// @Description
+// @Description If `federated` is true, the search is also sent to the peer core services configured on this
+// @Description server. The results are merged in the requested sort order and labeled with the `server` they are
+// @Description from, and `servers` reports each server's status. Servers that fail or time out are reported
+// @Description with an `error` and their results are left out. Federated searches page with `from`, not `cursor`.
 // @Tags Search
 // @Accept json
 // @Produce json
-// @Param	size  query  int  false  "Number of results to return" default(540)
-// @Param	from  query  int  false  "Result index to start from if paging results" default(0)
+// @Param	size  query  int  false  "Number of results to return" default(25)
+// @Param	from  query  int  false  "Result index to start from if paging results, `from` + `size` must not exceed 10000" default(0)
+// @Param	cursor  query  string  false  "The `next_cursor` value from the previous page of results, to page through any number of results. Can't be combined with `from`"
 // @Param	namespace  query  string  false  "If set, restrict results to this namespace"
 // @Param	dataset  query  string  false  "If set, restrict results to this dataset. `namespace` must be set."
-// @Param	metadata  query  string  false  "A comma separated list of key-value pairs to search for. (e.g. foo:bar,fizz:buzz)"
+// @Param	metadata  query  string  false  "A comma separated list of key-value pairs to search for, matching objects with any of the pairs. (e.g. foo:bar,fizz:buzz)"
+// @Param	q  query  string  false  "A metadata query (e.g. `subject:mouse* AND NOT status:failed AND size>1GB`)"
+// @Param	filename  query  string  false  "If set, restrict results to objects whose file name contains this text, case insensitively (e.g. `calib`)"
+// @Param	path  query  string  false  "If set, restrict results to objects whose path contains these directories anywhere (e.g. `session_03` or `raw/session_03`), or with a leading `/`, to objects under this directory of the dataset (e.g. `/raw/session_03`)"
+// @Param	sort  query  string  false  "Sort results in the format `<field>[:asc|desc]`, where field is `modified`, `size`, `key`, or `metadata.<key>` to sort by the typed value of a metadata key"
 // @Param	modified_after  query  string  false  "Filter results to include only objects modified after the specified datetime string in the format '2006-01-02T15:04:05.000Z'"
 // @Param	modified_before  query  string  false  "Filter results to include only objects modified before the specified datetime string in the format '2006-01-02T15:04:05.000Z'"
-// @Success 200 {object} object{result=[]MetadataSearchResult}
+// @Param	federated  query  bool  false  "If true, also search the peer core services configured on this server"
+// @Success 200 {object} object{results=[]MetadataSearchResult,next_cursor=string,servers=[]FederatedServer}
 // @Failure 400 {object} object{error=string}
 // @Failure 401 {object} object{error=string}
 // @Failure 403 {object} object{error=string}
@@ -125,7 +155,7 @@ type MetadataSearchResult struct {
 // @Security BearerToken
 // @Router /search [get]
 func SearchMetadata(c *gin.Context) {
-	config, db := getAppConfig(c)
+	config, _ := getAppConfig(c)
 
 	// get key-value pairs from query parameters
 	queryParams := c.Request.URL.Query()
@@ -137,18 +167,145 @@ func SearchMetadata(c *gin.Context) {
 	if sizeParam, ok := queryParams["size"]; ok {
 		size, err = strconv.Atoi(sizeParam[0])
 		if err != nil {
-			HandleError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be an integer"})
 			return
 		}
 	}
 	if fromParam, ok := queryParams["from"]; ok {
 		from, err = strconv.Atoi(fromParam[0])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an integer"})
+			return
+		}
+	}
+	if size < 0 || from < 0 || from+size > maxSearchResultWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+			"size and from must be positive and from + size must not exceed %d, use cursor to page through more results",
+			maxSearchResultWindow)})
+		return
+	}
+
+	federated := c.Query("federated") == "true"
+	if federated {
+		if _, ok := queryParams["cursor"]; ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor can't be used with a federated search"})
+			return
+		}
+	}
+
+	query, datasetNamespaces, ok := buildSearchQuery(c)
+	if !ok {
+		return
+	}
+
+	sortParam, sortClauses, ok := parseSearchSort(c)
+	if !ok {
+		return
+	}
+
+	// create payload
+	payload := MetadataSearchPayload{}
+	payload.Size = size
+	payload.From = from
+	payload.Sort = sortClauses
+	payload.Query = *query
+
+	// a federated search merges the first from + size results of every server, then takes the requested page
+	if federated {
+		payload.Size = from + size
+		payload.From = 0
+	}
+
+	if cursorParam, ok := queryParams["cursor"]; ok {
+		if _, ok := queryParams["from"]; ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from can't be used with cursor"})
+			return
+		}
+		payload.SearchAfter, err = opensearch.DecodeSearchCursor(sortParam, cursorParam[0])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	response := MetadataSearchResponse{}
+	if err := searchMetadataIndex(config.Server.ElasticsearchEndpoint, &payload, &response); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// reformat results to clean up and add URI
+	results := []MetadataSearchResult{}
+	for _, hit := range response.Hits.Hits {
+		results = append(results, newMetadataSearchResult(&hit.Source, datasetNamespaces))
+	}
+
+	if federated {
+		local := &FederatedServer{Name: localServerName(config), Results: len(results)}
+		for i := range results {
+			results[i].Server = local.Name
+		}
+
+		// peers return their first from + size results, and never forward the search to their own peers
+		params := url.Values{}
+		for key, values := range queryParams {
+			switch key {
+			case "federated", "from", "size":
+			default:
+				params[key] = values
+			}
+		}
+		params.Set("size", strconv.Itoa(from+size))
+
+		peerResults, servers := searchPeers(c, params)
+		results = append(results, peerResults...)
+		sortFederatedResults(results, sortParam)
+
+		if from > len(results) {
+			from = len(results)
+		}
+		end := from + size
+		if end > len(results) {
+			end = len(results)
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results[from:end], "servers": append([]*FederatedServer{local}, servers...)})
+		return
+	}
+
+	// a full page means there may be more results
+	body := gin.H{"results": results}
+	if size > 0 && len(response.Hits.Hits) == size {
+		nextCursor, err := opensearch.EncodeSearchCursor(sortParam, response.Hits.Hits[len(response.Hits.Hits)-1].Sort)
 		if err != nil {
 			HandleError(c, err)
 			return
 		}
+		body["next_cursor"] = nextCursor
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// parseSearchSort parses the sort query parameter, returning the parameter and the sort clauses. If the
+// parameter is invalid an error response is sent and false is returned
+func parseSearchSort(c *gin.Context) (string, []interface{}, bool) {
+	sortParam := c.Query("sort")
+	sortClauses, err := opensearch.ParseSearchSort(sortParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
 	}
 
+	return sortParam, sortClauses, true
+}
+
+// buildSearchQuery builds the search index query from the request's search filter query parameters, returning
+// the query and a map of extended dataset names to namespace names. If the parameters are invalid an error
+// response is sent and false is returned
+func buildSearchQuery(c *gin.Context) (*SearchQuery, map[string]string, bool) {
+	_, db := getAppConfig(c)
+	queryParams := c.Request.URL.Query()
+
 	// check if user wants to search within a specific namespace or dataset
 	var namespaceName string
 	var datasetName string
@@ -157,86 +314,87 @@ func SearchMetadata(c *gin.Context) {
 	}
 	if datasetParam, ok := queryParams["dataset"]; ok {
 		if namespaceName == "" {
-			HandleError(c, errors.New("must specify namespace if searching within a dataset"))
-			return
+			c.JSON(http.StatusBadRequest, gin.H{"error": "must specify namespace if searching within a dataset"})
+			return nil, nil, false
 		}
 		datasetName = datasetParam[0]
 	}
 
 	// get user's dataset permissions
 	userInfo := getUserInfo(c)
-	datasetRoots := []DatasetTerm{}
-	datasetNamespaces := map[string]string{}
-	limit := 10
-	offset := 0
-	for {
-		objStores, err := db.ListObjectStores(limit, offset)
+	datasetsFilter, datasetNamespaces, err := getSearchableDatasets(db, userInfo.Username, namespaceName, datasetName)
+	if err != nil {
+		HandleError(c, err)
+		return nil, nil, false
+	}
+
+	// comparisons use the types declared in the searched dataset's schema, if the user can read it
+	var types map[string]string
+	if len(datasetsFilter.Terms.DatasetExtended) > 0 {
+		types, err = searchMetadataTypes(db, namespaceName, datasetName)
 		if err != nil {
 			HandleError(c, err)
-			return
-		}
-		if len(objStores) == 0 {
-			break
-		}
-		for _, objStore := range objStores {
-			perms, err := db.GetPermissionsByUser(objStore, userInfo.Username, false)
-			if err != nil {
-				HandleError(c, err)
-				return
-			}
-
-			for _, perm := range perms {
-				// if searching within a specific namespace or dataset, only add the requested datasets
-				if namespaceName != "" {
-					if perm.Dataset.Namespace.Name != namespaceName {
-						continue
-					}
-					if datasetName != "" {
-						if perm.Dataset.Name != datasetName {
-							continue
-						}
-					}
-				}
-
-				datasetTerm := DatasetTerm{}
-				datasetTerm.Term.DatasetExtended = getDatasetExtended(
-					objStore.Name,
-					perm.Dataset.Namespace.BucketName,
-					perm.Dataset.RootDirectory,
-				)
-				datasetRoots = append(datasetRoots, datasetTerm)
-
-				// update datasetNamespaces map
-				datasetNamespaces[datasetTerm.Term.DatasetExtended] = perm.Dataset.Namespace.Name
-			}
+			return nil, nil, false
 		}
+	}
 
-		offset += limit
+	query, err := buildSearchFilters(queryParams, types)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
 	}
+	query.Bool.Filter.Bool.Must = append([]interface{}{datasetsFilter}, query.Bool.Filter.Bool.Must...)
 
-	// create payload
-	payload := MetadataSearchPayload{}
-	payload.Size = size
-	payload.From = from
-	payload.Query.Bool.Filter.Bool.Should = datasetRoots
-	payload.Query.Bool.Filter.Bool.MinimumShouldMatch = 1
-	payload.Query.Bool.Filter.Bool.Must = []interface{}{}
+	return query, datasetNamespaces, true
+}
+
+// buildSearchFilters builds the search index query from the search filter query parameters, except for the
+// namespace and dataset filters, which depend on the user's permissions. types are the declared metadata types
+// used by comparisons in the metadata query. It returns an error describing the problem if the parameters are invalid
+func buildSearchFilters(queryParams url.Values, types map[string]string) (*SearchQuery, error) {
+	query := &SearchQuery{}
+	query.Bool.Filter.Bool.Must = []interface{}{}
 
 	// add metadata key value pairs, or if none provided then return all objects
 	if metadata, ok := queryParams["metadata"]; ok {
 		metadataTerms := MetadataTerms{
 			Metadata: strings.Split(metadata[0], ","),
 		}
-		payload.Query.Bool.Must.Terms = &metadataTerms
+		query.Bool.Must.Terms = &metadataTerms
 	} else {
-		payload.Query.Bool.Must.MatchAll = map[string]int{"boost": 1.0}
+		query.Bool.Must.MatchAll = map[string]int{"boost": 1.0}
+	}
+
+	// add the metadata query, which is applied in addition to any metadata key value pairs
+	if queryParam, ok := queryParams["q"]; ok {
+		metadataQuery, err := opensearch.ParseMetadataQuery(queryParam[0], types)
+		if err != nil {
+			return nil, err
+		}
+		query.Bool.Filter.Bool.Must = append(query.Bool.Filter.Bool.Must, metadataQuery)
+	}
+
+	// add file name and path filters, which search the analyzed fields of the object key
+	if filenameParam, ok := queryParams["filename"]; ok {
+		filenameQuery, err := opensearch.FilenameQuery(filenameParam[0])
+		if err != nil {
+			return nil, err
+		}
+		query.Bool.Filter.Bool.Must = append(query.Bool.Filter.Bool.Must, filenameQuery)
+	}
+	if pathParam, ok := queryParams["path"]; ok {
+		pathQuery, err := opensearch.PathSearchQuery(pathParam[0])
+		if err != nil {
+			return nil, err
+		}
+		query.Bool.Filter.Bool.Must = append(query.Bool.Filter.Bool.Must, pathQuery)
 	}
 
 	// add core service filter
 	coreServiceFilter := CoreServiceFilter{}
 	coreServiceFilter.Term.CoreServiceEndpoint = getCoreServiceEndpoint()
-	payload.Query.Bool.Filter.Bool.Must = append(
-		payload.Query.Bool.Filter.Bool.Must,
+	query.Bool.Filter.Bool.Must = append(
+		query.Bool.Filter.Bool.Must,
 		coreServiceFilter,
 	)
 
@@ -246,100 +404,136 @@ func SearchMetadata(c *gin.Context) {
 	timeRangeQuery.Range.LastModifiedDate = make(map[string]string)
 	var t1 time.Time
 	var t2 time.Time
+	var err error
 	if startTime, ok := queryParams["modified_after"]; ok {
 		t1, err = time.Parse(layout, startTime[0])
 		if err != nil {
-			HandleError(c, err)
-			return
+			return nil, errors.New("modified_after must be in the format " + layout)
 		}
 		timeRangeQuery.Range.LastModifiedDate["gte"] = startTime[0]
 	}
 	if endTime, ok := queryParams["modified_before"]; ok {
 		t2, err = time.Parse(layout, endTime[0])
 		if err != nil {
-			HandleError(c, err)
-			return
+			return nil, errors.New("modified_before must be in the format " + layout)
 		} else if t1.After(t2) {
-			HandleError(c, errors.New("the `modified_after` time must be before the `modified_before` time"))
-			return
+			return nil, errors.New("the `modified_after` time must be before the `modified_before` time")
 		}
 		timeRangeQuery.Range.LastModifiedDate["lte"] = endTime[0]
 	}
 
 	if len(timeRangeQuery.Range.LastModifiedDate) > 0 {
-		payload.Query.Bool.Filter.Bool.Must = append(
-			payload.Query.Bool.Filter.Bool.Must,
+		query.Bool.Filter.Bool.Must = append(
+			query.Bool.Filter.Bool.Must,
 			timeRangeQuery,
 		)
 	}
 
-	// convert payload to bytes
-	payloadBytes, err := json.Marshal(payload)
+	return query, nil
+}
+
+// getSearchableDatasets returns a filter for the datasets the user has access to, and a map of extended
+// dataset names to namespace names. If namespaceName, or namespaceName and datasetName, are set only the
+// matching datasets are included. The user's datasets are cached by the database
+func getSearchableDatasets(db *database.Database, username, namespaceName, datasetName string) (DatasetsFilter, map[string]string, error) {
+	datasetsFilter := DatasetsFilter{}
+	datasetsFilter.Terms.DatasetExtended = []string{}
+	datasetNamespaces := map[string]string{}
+
+	datasets, err := db.GetReadableDatasets(username)
 	if err != nil {
-		HandleError(c, err)
-		return
+		return datasetsFilter, nil, err
 	}
 
-	// create request to search metadata index
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", config.Server.ElasticsearchEndpoint+"/metadata-index/_search", bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		HandleError(c, err)
-		return
+	for _, dataset := range datasets {
+		// if searching within a specific namespace or dataset, only add the requested datasets
+		if namespaceName != "" {
+			if dataset.NamespaceName != namespaceName {
+				continue
+			}
+			if datasetName != "" && dataset.DatasetName != datasetName {
+				continue
+			}
+		}
+
+		datasetExtended := getDatasetExtended(dataset.ObjectStoreName, dataset.BucketName, dataset.RootDirectory)
+		datasetsFilter.Terms.DatasetExtended = append(datasetsFilter.Terms.DatasetExtended, datasetExtended)
+		datasetNamespaces[datasetExtended] = dataset.NamespaceName
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	// make request
-	resp, err := client.Do(req)
-	if err != nil {
-		HandleError(c, err)
-		return
+	return datasetsFilter, datasetNamespaces, nil
+}
+
+// searchMetadataTypes returns the metadata types declared in the schema of the searched dataset, or nil if the search
+// isn't within a single dataset or the dataset doesn't have a schema
+func searchMetadataTypes(db *database.Database, namespaceName, datasetName string) (map[string]string, error) {
+	if datasetName == "" {
+		return nil, nil
 	}
-	if resp.StatusCode != 200 {
-		HandleError(c, fmt.Errorf("unable to query metadata index, status code = %d", resp.StatusCode))
-		return
+
+	namespace, err := db.GetNamespace(namespaceName)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dataset, err := db.GetDataset(namespace, datasetName)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	// unpack results
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		HandleError(c, err)
-		return
+	schema, err := db.GetMetadataSchema(dataset)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
-	response := MetadataSearchResponse{}
-	if err := json.Unmarshal(body, &response); err != nil {
-		HandleError(c, err)
-		return
+	return schema.Types, nil
+}
+
+// userCanReadDataset returns true if the dataset is one of the user's readable datasets
+func userCanReadDataset(db *database.Database, username, namespaceName, datasetName string) (bool, error) {
+	datasets, err := db.GetReadableDatasets(username)
+	if err != nil {
+		return false, err
 	}
 
-	// reformat results to clean up and add URI
-	results := []MetadataSearchResult{}
-	for _, hit := range response.Hits.Hits {
-		result := MetadataSearchResult{
-			FilePath:         strings.Join(strings.Split(hit.Source.ObjectKey, "/")[1:], "/"),
-			Dataset:          strings.Split(hit.Source.ObjectKey, "/")[0],
-			Namespace:        datasetNamespaces[hit.Source.DatasetExtended],
-			LastModifiedDate: hit.Source.LastModifiedDate,
-			SizeBytes:        hit.Source.SizeBytes,
+	for _, dataset := range datasets {
+		if dataset.NamespaceName == namespaceName && dataset.DatasetName == datasetName {
+			return true, nil
 		}
-		result.URI = fmt.Sprintf(
-			"hoss+%s://%s:%s:%s/%s",
-			strings.Split(os.Getenv("EXTERNAL_HOSTNAME"), "://")[0],
-			strings.Split(os.Getenv("EXTERNAL_HOSTNAME"), "://")[1],
-			result.Namespace,
-			result.Dataset,
-			result.FilePath,
-		)
-		metadata := []map[string]string{}
-		for _, metadataPair := range hit.Source.Metadata {
-			metadataPairSplit := strings.SplitN(metadataPair, ":", 2)
-			metadata = append(metadata, map[string]string{metadataPairSplit[0]: metadataPairSplit[1]})
-		}
-		result.Metadata = metadata
-		results = append(results, result)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"results": results})
+	return false, nil
+}
+
+// newMetadataSearchResult reformats a search index document to clean up and add the URI
+func newMetadataSearchResult(source *MetadataSearchSource, datasetNamespaces map[string]string) MetadataSearchResult {
+	result := MetadataSearchResult{
+		FilePath:         strings.Join(strings.Split(source.ObjectKey, "/")[1:], "/"),
+		Dataset:          strings.Split(source.ObjectKey, "/")[0],
+		Namespace:        datasetNamespaces[source.DatasetExtended],
+		LastModifiedDate: source.LastModifiedDate,
+		SizeBytes:        source.SizeBytes,
+		ContentHash:      source.ContentHash,
+	}
+	result.URI = fmt.Sprintf(
+		"hoss+%s://%s:%s:%s/%s",
+		strings.Split(os.Getenv("EXTERNAL_HOSTNAME"), "://")[0],
+		strings.Split(os.Getenv("EXTERNAL_HOSTNAME"), "://")[1],
+		result.Namespace,
+		result.Dataset,
+		result.FilePath,
+	)
+	metadata := []map[string]string{}
+	for _, metadataPair := range source.Metadata {
+		key, value := opensearch.SplitMetadataPair(metadataPair)
+		metadata = append(metadata, map[string]string{key: value})
+	}
+	result.Metadata = metadata
+	return result
 }
 
 type SuggestPayload struct {
@@ -387,20 +581,20 @@ func makeSuggestQuery(prefix string, limit int, datasetExtended string, elasticU
 	}
 
 	// create request to search metadata index
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", elasticUrl+"/metadata-index/_search", bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequest("GET", elasticUrl+"/"+search.MetadataIndexAlias+"/_search", bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return SuggestResponse{}, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	// make request
-	resp, err := client.Do(req)
+	resp, err := opensearch.Do(req)
 	if err != nil {
 		return SuggestResponse{}, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return SuggestResponse{}, err
+		return SuggestResponse{}, fmt.Errorf("unable to query metadata index, status code = %d", resp.StatusCode)
 	}
 
 	// unpack results
@@ -456,20 +650,14 @@ func SuggestKeys(c *gin.Context) {
 
 	// check that user has permissions for this dataset
 	userInfo := getUserInfo(c)
-	permUsers, err := db.GetUsersWithPermissionsToDataset(namespace, datasetName)
+	permissionGranted, err := userCanReadDataset(db, userInfo.Username, namespaceName, datasetName)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	permissionGranted := false
-	for _, user := range permUsers {
-		if user == userInfo.Username {
-			permissionGranted = true
-			break
-		}
-	}
 	if !permissionGranted {
 		HandleError(c, errors.New("user does not have permission to suggest tags within this dataset"))
+		return
 	}
 
 	// get query parameters
@@ -505,8 +693,7 @@ func SuggestKeys(c *gin.Context) {
 	keyMap := make(map[string]bool)
 	for _, option := range response.Suggest.TagSuggest[0].Options {
 		for _, metadataStr := range option.Source.Metadata {
-			metadataPair := strings.SplitN(metadataStr, ":", 2)
-			key := metadataPair[0]
+			key, _ := opensearch.SplitMetadataPair(metadataStr)
 			if strings.HasPrefix(key, prefix) {
 				keyMap[key] = true
 			}
@@ -567,20 +754,14 @@ func SuggestValues(c *gin.Context) {
 
 	// check that user has permissions for this dataset
 	userInfo := getUserInfo(c)
-	permUsers, err := db.GetUsersWithPermissionsToDataset(namespace, datasetName)
+	permissionGranted, err := userCanReadDataset(db, userInfo.Username, namespaceName, datasetName)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	permissionGranted := false
-	for _, user := range permUsers {
-		if user == userInfo.Username {
-			permissionGranted = true
-			break
-		}
-	}
 	if !permissionGranted {
 		HandleError(c, errors.New("user does not have permission to suggest tags within this dataset"))
+		return
 	}
 
 	// get query parameters
@@ -617,8 +798,7 @@ func SuggestValues(c *gin.Context) {
 	valueMap := make(map[string]bool)
 	for _, option := range response.Suggest.TagSuggest[0].Options {
 		for _, metadataStr := range option.Source.Metadata {
-			metadataPair := strings.SplitN(metadataStr, ":", 2)
-			val := metadataPair[1]
+			_, val := opensearch.SplitMetadataPair(metadataStr)
 			if strings.HasPrefix(val, prefix) {
 				valueMap[val] = true
 			}
@@ -688,20 +868,14 @@ func GetMetadata(c *gin.Context) {
 
 	// check that user has permissions for this dataset
 	userInfo := getUserInfo(c)
-	permUsers, err := db.GetUsersWithPermissionsToDataset(namespace, datasetName)
+	permissionGranted, err := userCanReadDataset(db, userInfo.Username, namespaceName, datasetName)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	permissionGranted := false
-	for _, user := range permUsers {
-		if user == userInfo.Username {
-			permissionGranted = true
-			break
-		}
-	}
 	if !permissionGranted {
 		HandleError(c, errors.New("user does not have permission to access metadata in this dataset"))
+		return
 	}
 
 	payload := opensearch.MetadataIndexPayload{CoreServiceEndpoint: getCoreServiceEndpoint(),
@@ -715,9 +889,39 @@ func GetMetadata(c *gin.Context) {
 
 	m := map[string]string{}
 	for _, meta := range doc.Source.Metadata {
-		parts := strings.SplitN(meta, ":", 2)
-		m[parts[0]] = parts[1]
+		key, value := opensearch.SplitMetadataPair(meta)
+		m[key] = value
 	}
 
 	c.JSON(http.StatusOK, gin.H{"metadata": m})
 }
+
+// searchMetadataIndex runs a search request against the metadata index, unpacking the results into response
+func searchMetadataIndex(opensearchEndpoint string, payload interface{}, response interface{}) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", opensearchEndpoint+"/"+search.MetadataIndexAlias+"/_search", bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := opensearch.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unable to query metadata index, status code = %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, response)
+}
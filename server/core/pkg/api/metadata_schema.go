@@ -0,0 +1,259 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+)
+
+const (
+	defaultSchemaReportSize = 100
+	maxSchemaReportSize     = 1000
+)
+
+type metadataSchemaInput struct {
+	// Types maps metadata keys to the type their values are indexed as ('string', 'number', 'date', or 'boolean')
+	Types map[string]string `json:"types"`
+	// Required are the metadata keys every object must have
+	Required []string `json:"required"`
+	// AllowedValues maps metadata keys to the only values they can have
+	AllowedValues map[string][]string `json:"allowed_values"`
+	// Patterns maps metadata keys to a regular expression their whole value must match
+	Patterns map[string]string `json:"patterns"`
+	// Enforce rejects metadata edits through the core service that don't conform to the schema
+	Enforce bool `json:"enforce"`
+}
+
+// userDatasetAccess returns true if the user is in a group that has access to the dataset. If readWrite is
+// true the group must have read-write access. Privileged users always have access
+func userDatasetAccess(userInfo UserInfo, dataset *database.Dataset, readWrite bool) bool {
+	if validatePrivileged(userInfo.Role) {
+		return true
+	}
+
+	for _, perm := range dataset.Permissions {
+		if readWrite && perm.Permission != database.PERM_READ_WRITE {
+			continue
+		}
+		for _, group := range userInfo.Groups {
+			if perm.Group.GroupName == group {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// loadDataset loads the namespace and dataset from the request path and checks the user's access to the dataset
+func loadDataset(c *gin.Context, readWrite bool) (*database.Dataset, bool) {
+	_, db := getAppConfig(c)
+
+	namespace, err := db.GetNamespace(c.Param("namespace"))
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+
+	dataset, err := db.GetDataset(namespace, c.Param("name"))
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+
+	if !userDatasetAccess(getUserInfo(c), dataset, readWrite) {
+		HandleError(c, ErrUnauthorized)
+		return nil, false
+	}
+
+	return dataset, true
+}
+
+// GetMetadataSchema gets the metadata schema of a dataset
+// @Summary Get a dataset's metadata schema
+// @Schemes
+// @Description Get the metadata schema of a dataset, which declares the type that metadata values are
+// @Description indexed as for range queries and sorting, and the rules that objects' metadata must follow
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 200 {object} database.MetadataSchema
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/schema [get]
+func GetMetadataSchema(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	schema, err := db.GetMetadataSchema(dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+// SetMetadataSchema creates or replaces the metadata schema of a dataset
+// @Summary Set a dataset's metadata schema
+// @Schemes
+// @Description Create or replace the metadata schema of a dataset. `types` maps metadata keys to the type their
+// @Description values are indexed as ('string', 'number', 'date', or 'boolean'). The type of values for keys
+// @Description that are not in the schema is inferred. `required` lists the keys every object must have,
+// @Description `allowed_values` maps keys to the only values they can have, and `patterns` maps keys to a regular
+// @Description expression their whole value must match. Objects whose metadata doesn't conform are flagged in the
+// @Description search index and listed by the schema report. If `enforce` is true, metadata edits through the
+// @Description core service that don't conform are rejected. Changes apply to objects indexed after the schema
+// @Description is set; run an index job for the dataset to apply them to existing objects.
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	schemaInput		body	metadataSchemaInput	true	"Metadata Schema"
+// @Success 200 {object} database.MetadataSchema
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/schema [put]
+func SetMetadataSchema(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	input := metadataSchemaInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schema := &database.MetadataSchema{
+		Types:         input.Types,
+		Required:      input.Required,
+		AllowedValues: input.AllowedValues,
+		Patterns:      input.Patterns,
+		Enforce:       input.Enforce,
+	}
+	if err := schema.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schema, err := db.SetMetadataSchema(dataset, schema)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+// DeleteMetadataSchema removes the metadata schema of a dataset
+// @Summary Delete a dataset's metadata schema
+// @Schemes
+// @Description Remove the metadata schema of a dataset. The type of all metadata values will be inferred
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/schema [delete]
+func DeleteMetadataSchema(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteMetadataSchema(dataset); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetMetadataSchemaReport lists the objects of a dataset that don't conform to its metadata schema
+// @Summary Get a dataset's metadata schema compliance report
+// @Schemes
+// @Description List the objects in a dataset whose indexed metadata doesn't conform to the dataset's metadata schema,
+// @Description ordered by object key, with a description of each violation. `total` is the number of non-conforming
+// @Description objects. When a page is full the response includes `next_after`, which is passed as `after` to get
+// @Description the next page. Objects are checked when they are indexed, so objects indexed before the schema was
+// @Description last changed are checked against the previous schema until an index job is run for the dataset.
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	size   query      int  false  "Page size (default 100, max 1000)"
+// @Param	after   query      string  false  "Object key to start after"
+// @Success 200 {object} opensearch.SchemaReport
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/schema/report [get]
+func GetMetadataSchemaReport(c *gin.Context) {
+	config, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	if _, err := db.GetMetadataSchema(dataset); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	size := defaultSchemaReportSize
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		var err error
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < 1 || size > maxSchemaReportSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between 1 and 1000"})
+			return
+		}
+	}
+
+	datasetExtended := opensearch.DatasetExtended(dataset.Namespace.ObjectStore.Name, dataset.Namespace.BucketName, dataset.RootDirectory)
+	report, err := opensearch.GetSchemaReport(config.Server.ElasticsearchEndpoint, getCoreServiceEndpoint(), datasetExtended,
+		size, c.Query("after"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
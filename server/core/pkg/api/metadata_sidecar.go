@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+)
+
+type metadataSidecarInput struct {
+	// Suffixes are the file name suffixes of sidecar files (e.g. '.meta.json')
+	Suffixes []string `json:"suffixes"`
+}
+
+// GetMetadataSidecar gets the metadata sidecar declaration of a dataset
+// @Summary Get a dataset's metadata sidecar files
+// @Schemes
+// @Description Get the file name suffixes of a dataset's metadata sidecar files. The flattened key-value pairs of
+// @Description a sidecar file are indexed as metadata of the object it describes
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 200 {object} database.MetadataSidecar
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/sidecar [get]
+func GetMetadataSidecar(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	sidecar, err := db.GetMetadataSidecar(dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sidecar)
+}
+
+// SetMetadataSidecar creates or replaces the metadata sidecar declaration of a dataset
+// @Summary Set a dataset's metadata sidecar files
+// @Schemes
+// @Description Create or replace the file name suffixes of a dataset's metadata sidecar files. A sidecar file is named
+// @Description after the object it describes, followed by one of the suffixes (e.g. `image.tif.meta.json` describes
+// @Description `image.tif`). JSON and YAML sidecar files are supported. Nested keys are flattened with '.'. Changes
+// @Description apply to sidecar files and objects written after the suffixes are set.
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	sidecarInput		body	metadataSidecarInput	true	"Metadata Sidecar"
+// @Success 200 {object} database.MetadataSidecar
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/sidecar [put]
+func SetMetadataSidecar(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	input := metadataSidecarInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sidecar, err := db.SetMetadataSidecar(dataset, input.Suffixes)
+	if err == database.ErrInvalidInput {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one suffix is required, and suffixes can't be empty or contain a '/'"})
+		return
+	} else if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sidecar)
+}
+
+// DeleteMetadataSidecar removes the metadata sidecar declaration of a dataset
+// @Summary Delete a dataset's metadata sidecar files
+// @Schemes
+// @Description Remove the metadata sidecar declaration of a dataset. Files are no longer treated as sidecar files
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/metadata/sidecar [delete]
+func DeleteMetadataSidecar(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteMetadataSidecar(dataset); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetMetadataSidecarByLocation gets the metadata sidecar declaration of the dataset identified by its search index location
+// @Summary Get the metadata sidecar files of a dataset by its search index location
+// @Schemes
+// @Description Get the metadata sidecar declaration of the dataset identified by `dataset_extended`
+// @Description (`<object store name>|<bucket name>|<dataset name>`), as used in the metadata search index.
+// @Description This is used by the sync service to find sidecar files in bucket events.
+// @Description **NOTE: This endpoint is only available to the service account**
+// @Tags Service Account
+// @Accept json
+// @Produce json
+// @Param	dataset_extended  query  string  true  "The dataset's search index location"
+// @Success 200 {object} database.MetadataSidecar
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/sidecar [get]
+func GetMetadataSidecarByLocation(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	if !getUserInfo(c).IsService {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	location := strings.SplitN(c.Query("dataset_extended"), "|", 3)
+	if len(location) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dataset_extended must be in the format <object store name>|<bucket name>|<dataset name>"})
+		return
+	}
+
+	sidecar, err := db.GetMetadataSidecarByLocation(location[0], location[1], location[2])
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sidecar)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestBuildSearchFiltersPath(t *testing.T) {
+	hostname := os.Getenv("EXTERNAL_HOSTNAME")
+	os.Setenv("EXTERNAL_HOSTNAME", "https://hoss.example.com")
+	defer os.Setenv("EXTERNAL_HOSTNAME", hostname)
+
+	// file name and path filters are combined with the metadata filters
+	query, err := buildSearchFilters(url.Values{
+		"metadata": {"subject:mouse"},
+		"q":        {"status:done"},
+		"filename": {"calib"},
+		"path":     {"/raw/session_03"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+
+	body, err := json.Marshal(query)
+	if err != nil {
+		t.Fatalf("failed to encode query: %v", err)
+	}
+	test.AssertEqual(t, string(body), `{"bool":{"must":{"terms":{"metadata":["subject:mouse"]}},"filter":{"bool":{"must":[`+
+		`{"term":{"metadata":"status:done"}},`+
+		`{"match":{"object_key.filename":{"operator":"and","query":"calib"}}},`+
+		`{"term":{"object_key.path":"raw/session_03"}},`+
+		`{"term":{"core_service_endpoint":"https://hoss.example.com/core/v1"}}]}}}}`)
+}
+
+func TestBuildSearchFiltersPathErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		params url.Values
+	}{
+		{"short file name", url.Values{"filename": {"a"}}},
+		{"file name with directory", url.Values{"filename": {"raw/calib"}}},
+		{"empty path", url.Values{"path": {""}}},
+		{"path wildcard", url.Values{"path": {"raw/*/data"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildSearchFilters(tt.params, nil); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
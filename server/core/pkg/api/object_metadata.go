@@ -0,0 +1,482 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+	"github.com/gigantum/hoss-core/pkg/store"
+)
+
+// Object metadata update actions
+const (
+	ObjectMetadataActionSet    = "set"
+	ObjectMetadataActionMerge  = "merge"
+	ObjectMetadataActionDelete = "delete"
+)
+
+const (
+	// maxObjectMetadataOperations limits the number of objects updated by one batch request
+	maxObjectMetadataOperations = 1000
+	// maxObjectMetadataBytes is the maximum size of an object's user metadata allowed by S3
+	maxObjectMetadataBytes = 2048
+)
+
+type objectMetadataInput struct {
+	// Metadata are the key-value pairs to set
+	Metadata map[string]string `json:"metadata" binding:"required"`
+}
+
+// ObjectMetadataOperation is an update of one object's user metadata
+type ObjectMetadataOperation struct {
+	// Key is the object key, relative to the dataset's root directory
+	Key string `json:"key" binding:"required"`
+	// Action is `set` to replace all metadata, `merge` to add or update keys, or `delete` to remove keys
+	Action string `json:"action" binding:"required"`
+	// Metadata are the key-value pairs to set or merge
+	Metadata map[string]string `json:"metadata"`
+	// Keys are the metadata keys to delete. All metadata is deleted if no keys are given
+	Keys []string `json:"keys"`
+}
+
+type objectMetadataBatchInput struct {
+	Operations []*ObjectMetadataOperation `json:"operations" binding:"required,dive"`
+}
+
+// ObjectMetadataResponse is an object's user metadata
+type ObjectMetadataResponse struct {
+	// Key is the object key, relative to the dataset's root directory
+	Key string `json:"key"`
+	// Metadata is the object's user metadata, with lowercase keys
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ObjectMetadataResult is the result of one operation of a batch update
+type ObjectMetadataResult struct {
+	Key      string            `json:"key"`
+	Status   int               `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ObjectMetadataBatchResponse is the result of a batch update, with one item per operation in the same order
+type ObjectMetadataBatchResponse struct {
+	// Errors is true if any operation failed
+	Errors bool                    `json:"errors"`
+	Items  []*ObjectMetadataResult `json:"items"`
+}
+
+// objectMetadataError is a failed object metadata update, with the status code to return
+type objectMetadataError struct {
+	status  int
+	message string
+}
+
+func (e *objectMetadataError) Error() string {
+	return e.message
+}
+
+// GetObjectMetadata gets the user metadata of an object
+// @Summary Get an object's metadata
+// @Schemes
+// @Description Get the user metadata of an object in a dataset, loaded from the object store. The `key` query
+// @Description arg is the object key relative to the dataset's root directory (e.g. `raw/image.tif`)
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Success 200 {object} ObjectMetadataResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/metadata [get]
+func GetObjectMetadata(c *gin.Context) {
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	key := c.Query("key")
+	if err := validateObjectKey(key); err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	metadata, err := objStore.GetObjectMetadata(dataset.Namespace, objectPath(dataset, key))
+	if err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &ObjectMetadataResponse{Key: key, Metadata: metadata})
+}
+
+// SetObjectMetadata replaces the user metadata of an object
+// @Summary Replace an object's metadata
+// @Schemes
+// @Description Replace all of the user metadata of an object in a dataset. The object is copied onto itself in
+// @Description the object store with the new metadata, and the search index is updated by the sync service. Keys
+// @Description are stored in lower case and may contain letters, numbers, '-', '_' and '.'. Values must be
+// @Description printable ASCII, and the total size of an object's metadata is limited to 2KB. Objects larger
+// @Description than 5GB can't be updated. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Param	metadataInput		body	objectMetadataInput	true	"Object Metadata"
+// @Success 200 {object} ObjectMetadataResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/metadata [put]
+func SetObjectMetadata(c *gin.Context) {
+	input := objectMetadataInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updateObjectMetadata(c, &ObjectMetadataOperation{
+		Key:      c.Query("key"),
+		Action:   ObjectMetadataActionSet,
+		Metadata: input.Metadata,
+	})
+}
+
+// MergeObjectMetadata adds or updates user metadata keys of an object
+// @Summary Merge an object's metadata
+// @Schemes
+// @Description Add or update user metadata keys of an object in a dataset, keeping its other keys. The same
+// @Description rules as replacing an object's metadata apply. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Param	metadataInput		body	objectMetadataInput	true	"Object Metadata"
+// @Success 200 {object} ObjectMetadataResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/metadata [patch]
+func MergeObjectMetadata(c *gin.Context) {
+	input := objectMetadataInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updateObjectMetadata(c, &ObjectMetadataOperation{
+		Key:      c.Query("key"),
+		Action:   ObjectMetadataActionMerge,
+		Metadata: input.Metadata,
+	})
+}
+
+// DeleteObjectMetadata removes user metadata keys from an object
+// @Summary Delete an object's metadata
+// @Schemes
+// @Description Remove user metadata keys from an object in a dataset. If no `metadata_key` query args are given,
+// @Description all of the object's user metadata is removed. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Param	metadata_key   query      []string  false  "Metadata keys to remove"  collectionFormat(multi)
+// @Success 200 {object} ObjectMetadataResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/metadata [delete]
+func DeleteObjectMetadata(c *gin.Context) {
+	updateObjectMetadata(c, &ObjectMetadataOperation{
+		Key:    c.Query("key"),
+		Action: ObjectMetadataActionDelete,
+		Keys:   c.QueryArray("metadata_key"),
+	})
+}
+
+// BatchObjectMetadata updates the user metadata of multiple objects
+// @Summary Update the metadata of multiple objects
+// @Schemes
+// @Description Update the user metadata of up to 1000 objects in a dataset. Each operation has an object `key`
+// @Description and an `action`: `set` replaces all metadata with `metadata`, `merge` adds or updates the keys in
+// @Description `metadata`, and `delete` removes the `keys` (or all metadata if no keys are given). Operations are
+// @Description applied in order, and the response contains the `status` and `error` of each operation in the
+// @Description same order. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	batchInput		body	objectMetadataBatchInput	true	"Object Metadata Operations"
+// @Success 200 {object} ObjectMetadataBatchResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/metadata/batch [post]
+func BatchObjectMetadata(c *gin.Context) {
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	input := objectMetadataBatchInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Operations) > maxObjectMetadataOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch can contain at most %d operations", maxObjectMetadataOperations)})
+		return
+	}
+
+	schema, err := loadEnforcedSchema(c, dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	response := &ObjectMetadataBatchResponse{Items: []*ObjectMetadataResult{}}
+	for _, operation := range input.Operations {
+		result := &ObjectMetadataResult{Key: operation.Key, Status: http.StatusOK}
+
+		metadata, err := applyObjectMetadataOperation(objStore, dataset, schema, operation)
+		if err != nil {
+			result.Status, result.Error = objectMetadataErrorStatus(err)
+			response.Errors = true
+		} else {
+			result.Metadata = metadata
+		}
+
+		response.Items = append(response.Items, result)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// updateObjectMetadata applies an update to a single object and writes the response
+func updateObjectMetadata(c *gin.Context, operation *ObjectMetadataOperation) {
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	schema, err := loadEnforcedSchema(c, dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	metadata, err := applyObjectMetadataOperation(objStore, dataset, schema, operation)
+	if err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &ObjectMetadataResponse{Key: operation.Key, Metadata: metadata})
+}
+
+// loadEnforcedSchema returns the dataset's metadata schema if metadata edits must conform to it, or nil
+func loadEnforcedSchema(c *gin.Context, dataset *database.Dataset) (*database.MetadataSchema, error) {
+	_, db := getAppConfig(c)
+
+	schema, err := db.GetMetadataSchema(dataset)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !schema.Enforce {
+		return nil, nil
+	}
+
+	return schema, nil
+}
+
+// applyObjectMetadataOperation validates an operation and updates the object's metadata in the object store. If schema
+// is set, the update is rejected if the object's new metadata doesn't conform to it
+func applyObjectMetadataOperation(objStore store.ObjectStore, dataset *database.Dataset, schema *database.MetadataSchema,
+	operation *ObjectMetadataOperation) (map[string]string, error) {
+
+	if err := validateObjectKey(operation.Key); err != nil {
+		return nil, err
+	}
+
+	update := map[string]string{}
+	for key, value := range operation.Metadata {
+		key = strings.ToLower(key)
+		if err := validateObjectMetadataPair(key, value); err != nil {
+			return nil, err
+		}
+		update[key] = value
+	}
+
+	var apply func(metadata map[string]string) map[string]string
+	switch operation.Action {
+	case ObjectMetadataActionSet:
+		apply = func(metadata map[string]string) map[string]string {
+			return update
+		}
+	case ObjectMetadataActionMerge:
+		apply = func(metadata map[string]string) map[string]string {
+			for key, value := range update {
+				metadata[key] = value
+			}
+			return metadata
+		}
+	case ObjectMetadataActionDelete:
+		apply = func(metadata map[string]string) map[string]string {
+			if len(operation.Keys) == 0 {
+				return map[string]string{}
+			}
+			for _, key := range operation.Keys {
+				delete(metadata, strings.ToLower(key))
+			}
+			return metadata
+		}
+	default:
+		return nil, &objectMetadataError{http.StatusBadRequest, fmt.Sprintf("unsupported action `%s`", operation.Action)}
+	}
+
+	return objStore.UpdateObjectMetadata(dataset.Namespace, objectPath(dataset, operation.Key),
+		func(metadata map[string]string) (map[string]string, error) {
+			metadata = apply(metadata)
+
+			size := 0
+			for key, value := range metadata {
+				size += len(key) + len(value)
+			}
+			if size > maxObjectMetadataBytes {
+				return nil, &objectMetadataError{http.StatusBadRequest,
+					fmt.Sprintf("object metadata can't be larger than %d bytes", maxObjectMetadataBytes)}
+			}
+
+			if schema != nil {
+				if violations := opensearch.CheckMetadata(metadata, schema); len(violations) > 0 {
+					return nil, &objectMetadataError{http.StatusBadRequest,
+						"metadata doesn't conform to the dataset's schema: " + strings.Join(violations, "; ")}
+				}
+			}
+
+			return metadata, nil
+		})
+}
+
+// objectPath returns the full key of an object in a dataset. The root directory includes a trailing slash when the
+// dataset is created by the API, so it is trimmed before joining the key
+func objectPath(dataset *database.Dataset, key string) string {
+	return strings.TrimSuffix(dataset.RootDirectory, "/") + "/" + key
+}
+
+// relativeObjectKey returns the key of an object relative to the dataset's root directory, the inverse of objectPath
+func relativeObjectKey(dataset *database.Dataset, path string) string {
+	return strings.TrimPrefix(path, objectPath(dataset, ""))
+}
+
+// validateObjectKey checks that an object key is relative to the dataset's root directory
+func validateObjectKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return &objectMetadataError{http.StatusBadRequest, "an object key relative to the dataset is required"}
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return &objectMetadataError{http.StatusBadRequest, "object keys can't contain '..'"}
+		}
+	}
+	return nil
+}
+
+// validateObjectMetadataPair checks that a metadata key-value pair can be stored as S3 user metadata and indexed
+func validateObjectMetadataPair(key, value string) error {
+	if key == "" {
+		return &objectMetadataError{http.StatusBadRequest, "metadata keys can't be empty"}
+	}
+	for _, r := range key {
+		if !((r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.') {
+			return &objectMetadataError{http.StatusBadRequest,
+				fmt.Sprintf("metadata key `%s` can only contain letters, numbers, '-', '_' and '.'", key)}
+		}
+	}
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			return &objectMetadataError{http.StatusBadRequest,
+				fmt.Sprintf("the value of metadata key `%s` can only contain printable ASCII characters", key)}
+		}
+	}
+	return nil
+}
+
+// objectMetadataErrorStatus returns the status code and message for a failed object metadata update
+func objectMetadataErrorStatus(err error) (int, string) {
+	switch e := err.(type) {
+	case *objectMetadataError:
+		return e.status, e.message
+	}
+
+	switch err {
+	case database.ErrNotFound:
+		return http.StatusNotFound, "Resource not found"
+	case store.ErrObjectTooLarge, store.ErrDeleteMarker:
+		return http.StatusBadRequest, err.Error()
+	case store.ErrObjectModified:
+		return http.StatusConflict, err.Error()
+	default:
+		logrus.Errorf("Failed to update object metadata: %s", err.Error())
+		return http.StatusInternalServerError, "Unhandled error"
+	}
+}
+
+// handleObjectMetadataError writes the response for a failed object metadata request
+func handleObjectMetadataError(c *gin.Context, err error) {
+	status, message := objectMetadataErrorStatus(err)
+	c.JSON(status, gin.H{"error": message})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestObjectPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		rootDirectory string
+		key           string
+		want          string
+	}{
+		{"created root", datasetRootDirectory("my-dataset"), "file.txt", "my-dataset/file.txt"},
+		{"root with trailing slash", "my-dataset/", "file.txt", "my-dataset/file.txt"},
+		{"root without trailing slash", "my-dataset", "file.txt", "my-dataset/file.txt"},
+		{"nested key", "my-dataset/", "dir/sub dir/file.txt", "my-dataset/dir/sub dir/file.txt"},
+		{"nested key without trailing slash", "my-dataset", "dir/sub dir/file.txt", "my-dataset/dir/sub dir/file.txt"},
+		{"nested root", "group/my-dataset/", "a/b.txt", "group/my-dataset/a/b.txt"},
+		{"empty key", "my-dataset/", "", "my-dataset/"},
+		{"empty key without trailing slash", "my-dataset", "", "my-dataset/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := &database.Dataset{Name: "my-dataset", RootDirectory: tt.rootDirectory}
+			test.AssertEqual(t, objectPath(dataset, tt.key), tt.want)
+		})
+	}
+}
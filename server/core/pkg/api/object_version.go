@@ -0,0 +1,227 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/store"
+)
+
+// ObjectVersionsResponse is the version history of an object
+type ObjectVersionsResponse struct {
+	// Key is the object key, relative to the dataset's root directory
+	Key string `json:"key"`
+	// Versions are the versions and delete markers of the object, newest first
+	Versions []*store.ObjectVersion `json:"versions"`
+}
+
+// ObjectVersionRestoreResponse is the result of restoring a version of an object
+type ObjectVersionRestoreResponse struct {
+	// Key is the object key, relative to the dataset's root directory
+	Key string `json:"key"`
+	// VersionId is the version that was restored
+	VersionId string `json:"version_id"`
+	// Method is `remove_delete_marker` if the object's delete markers were removed, `copy` if the version was copied
+	// to become the latest version, or `none` if the version was already the latest version
+	Method string `json:"method"`
+}
+
+// ListObjectVersions lists the versions of an object
+// @Summary List an object's versions
+// @Schemes
+// @Description List the versions and delete markers of an object in a dataset, newest first, with the size, time,
+// @Description and user metadata of each version. Versions are only kept if versioning is enabled for the bucket
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Success 200 {object} ObjectVersionsResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/version [get]
+func ListObjectVersions(c *gin.Context) {
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	key := c.Query("key")
+	if err := validateObjectKey(key); err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	versions, err := objStore.ListObjectVersions(dataset.Namespace, objectPath(dataset, key))
+	if err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &ObjectVersionsResponse{Key: key, Versions: versions})
+}
+
+// RestoreObjectVersion makes a prior version of an object the latest version
+// @Summary Restore an object version
+// @Schemes
+// @Description Make a prior version of an object the latest version. If the object was deleted and the version was
+// @Description the latest version before it was deleted, the delete markers are removed. Otherwise the version is
+// @Description copied to become the latest version, which is limited to versions up to 5GB. The search index is
+// @Description updated by the sync service. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Param	version_id   query      string  true  "Version ID"
+// @Success 200 {object} ObjectVersionRestoreResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/version/restore [put]
+func RestoreObjectVersion(c *gin.Context) {
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	key := c.Query("key")
+	if err := validateObjectKey(key); err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	versionId := c.Query("version_id")
+	if versionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a version_id is required"})
+		return
+	}
+
+	method, err := objStore.RestoreObjectVersion(dataset.Namespace, objectPath(dataset, key), versionId)
+	if err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &ObjectVersionRestoreResponse{Key: key, VersionId: versionId, Method: method})
+}
+
+// PurgeObjectVersions permanently removes versions of an object
+// @Summary Purge object versions
+// @Schemes
+// @Description Permanently remove versions or delete markers of an object. Removed versions can't be restored.
+// @Description If the latest version is removed, the next newest version becomes the latest version. Versions
+// @Description recorded in a dataset snapshot can't be removed until the snapshot is deleted.
+// @Description **NOTE: This endpoint is only available to admins**
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	key   query      string  true  "Object Key"
+// @Param	version_id   query      []string  true  "Version IDs" collectionFormat(multi)
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/object/version [delete]
+func PurgeObjectVersions(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	// Only Admins can permanently remove versions
+	if isAdmin := validateAdmin(getUserInfo(c).Role); !isAdmin {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	key := c.Query("key")
+	if err := validateObjectKey(key); err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	versionIds := c.QueryArray("version_id")
+	if len(versionIds) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one version_id is required"})
+		return
+	}
+
+	// only remove versions of this object, so a version id of another object can't be removed by mistake
+	path := objectPath(dataset, key)
+	versions, err := objStore.ListObjectVersions(dataset.Namespace, path)
+	if err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+	existing := map[string]bool{}
+	for _, version := range versions {
+		existing[version.VersionId] = true
+	}
+	for _, versionId := range versionIds {
+		if !existing[versionId] {
+			c.JSON(http.StatusNotFound, gin.H{"error": "version `" + versionId + "` of the object doesn't exist"})
+			return
+		}
+	}
+
+	// versions recorded in a snapshot are kept so the snapshot can still be read. Snapshots record the object's key
+	// relative to the dataset's root directory, which is the key of the request
+	snapshots, err := db.GetSnapshotsReferencingVersions(dataset, key, versionIds)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if len(snapshots) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "the versions are recorded in snapshots `" + strings.Join(snapshots, "`, `") +
+			"` and can't be purged until the snapshots are deleted"})
+		return
+	}
+
+	for _, versionId := range versionIds {
+		err := objStore.DeleteObjectVersion(dataset.Namespace, path, versionId)
+		if err != nil {
+			handleObjectMetadataError(c, err)
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/store"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestObjectVersionKeys(t *testing.T) {
+	dataset := &database.Dataset{Name: "my-dataset", RootDirectory: datasetRootDirectory("my-dataset")}
+
+	// The version endpoints resolve keys to the same object keys the object store writes for the dataset
+	test.AssertEqual(t, objectPath(dataset, ".dataset.yaml"), "my-dataset/.dataset.yaml")
+	test.AssertEqual(t, objectPath(dataset, ".dataset.yaml"), store.NewMetadataFile("my-dataset").Key())
+
+	tests := []struct {
+		rootDirectory string
+		key           string
+		path          string
+	}{
+		{"my-dataset/", "file.txt", "my-dataset/file.txt"},
+		{"my-dataset/", "dir/file.txt", "my-dataset/dir/file.txt"},
+		{"my-dataset", "dir/file.txt", "my-dataset/dir/file.txt"},
+		{"moved/", "dir/file.txt", "moved/dir/file.txt"},
+	}
+
+	for _, tt := range tests {
+		dataset := &database.Dataset{Name: "my-dataset", RootDirectory: tt.rootDirectory}
+		test.AssertEqual(t, objectPath(dataset, tt.key), tt.path)
+
+		// Snapshots record keys relative to the root directory, so the request key is also the key that is
+		// checked for snapshot references before purging versions
+		test.AssertEqual(t, relativeObjectKey(dataset, tt.path), tt.key)
+	}
+}
@@ -0,0 +1,512 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+)
+
+// savedSearchParameters are the `GET /search` query parameters that can be saved in a saved search
+var savedSearchParameters = map[string]bool{
+	"namespace":       true,
+	"dataset":         true,
+	"metadata":        true,
+	"q":               true,
+	"filename":        true,
+	"path":            true,
+	"sort":            true,
+	"modified_after":  true,
+	"modified_before": true,
+}
+
+// savedSearchPageParameters are the `GET /search` query parameters that can be passed when running a saved search
+var savedSearchPageParameters = []string{"size", "from", "cursor", "federated"}
+
+type savedSearchInput struct {
+	// Name is the name of the search, unique for the user
+	Name string `json:"name" binding:"required"`
+	// Description is a description of the search
+	Description string `json:"description"`
+	// Parameters are the search's `GET /search` query parameters (namespace, dataset, metadata, q, filename, path,
+	// sort, modified_after, and modified_before)
+	Parameters map[string]string `json:"parameters"`
+}
+
+// validateSavedSearchParameters returns an error describing the problem if the parameters can't be saved
+func validateSavedSearchParameters(db *database.Database, parameters map[string]string) error {
+	for key := range parameters {
+		if !savedSearchParameters[key] {
+			return fmt.Errorf("parameter '%s' can't be saved", key)
+		}
+	}
+	if parameters["dataset"] != "" && parameters["namespace"] == "" {
+		return fmt.Errorf("must specify namespace if searching within a dataset")
+	}
+	if _, err := opensearch.ParseSearchSort(parameters["sort"]); err != nil {
+		return err
+	}
+	types, err := searchMetadataTypes(db, parameters["namespace"], parameters["dataset"])
+	if err != nil {
+		return err
+	}
+	_, err = buildSearchFilters(savedSearchValues(parameters), types)
+	return err
+}
+
+// savedSearchValues converts the parameters of a saved search to query parameters
+func savedSearchValues(parameters map[string]string) url.Values {
+	values := url.Values{}
+	for key, value := range parameters {
+		values.Set(key, value)
+	}
+	return values
+}
+
+// savedSearchQuery returns the query that is matched against newly indexed documents to notify subscribers. The
+// namespace and dataset filters depend on each subscriber's permissions, so they are applied to the matches instead
+func savedSearchQuery(db *database.Database, search *database.SavedSearch) (interface{}, error) {
+	types, err := searchMetadataTypes(db, search.Parameters["namespace"], search.Parameters["dataset"])
+	if err != nil {
+		return nil, err
+	}
+	return buildSearchFilters(savedSearchValues(search.Parameters), types)
+}
+
+// userCanReadSavedSearch returns true if the user owns the saved search, is a member of a group it is shared
+// with, or is an admin
+func userCanReadSavedSearch(userInfo UserInfo, search *database.SavedSearch) bool {
+	if userCanEditSavedSearch(userInfo, search) {
+		return true
+	}
+
+	for _, sharedGroup := range search.Groups {
+		for _, group := range userInfo.Groups {
+			if sharedGroup == group {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// userCanEditSavedSearch returns true if the user owns the saved search or is an admin
+func userCanEditSavedSearch(userInfo UserInfo, search *database.SavedSearch) bool {
+	if validateAdmin(userInfo.Role) {
+		return true
+	}
+	return search.Owner != nil && search.Owner.Username == userInfo.Username
+}
+
+// loadSavedSearch loads the saved search from the request path and checks the user's access to it. If edit is
+// true the user must own the search
+func loadSavedSearch(c *gin.Context, edit bool) (*database.SavedSearch, bool) {
+	_, db := getAppConfig(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "saved search id must be an integer"})
+		return nil, false
+	}
+
+	search, err := db.GetSavedSearch(id)
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+
+	userInfo := getUserInfo(c)
+	if !userCanReadSavedSearch(userInfo, search) {
+		// searches the user can't read are hidden
+		HandleError(c, database.ErrNotFound)
+		return nil, false
+	}
+	if edit && !userCanEditSavedSearch(userInfo, search) {
+		HandleError(c, ErrUnauthorized)
+		return nil, false
+	}
+
+	return search, true
+}
+
+// SyncSavedSearchQueries creates the saved search index if it doesn't exist, adding the query of every saved search
+// to it, so newly indexed documents can be matched against them
+func SyncSavedSearchQueries(config *config.Configuration, db *database.Database) error {
+	created, err := opensearch.CreateSavedSearchIndex(config.Server.ElasticsearchEndpoint)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return nil
+	}
+
+	searches, err := db.GetAllSavedSearches()
+	if err != nil {
+		return err
+	}
+
+	queries := map[int64]interface{}{}
+	for _, search := range searches {
+		query, err := savedSearchQuery(db, search)
+		if err != nil {
+			logrus.Warnf("Skipping saved search %d, its query is no longer valid: %s", search.Id, err.Error())
+			continue
+		}
+		queries[search.Id] = query
+
+		if len(queries) == maxBulkOperations {
+			if err := opensearch.PutSavedSearchQueries(config.Server.ElasticsearchEndpoint, queries); err != nil {
+				return err
+			}
+			queries = map[int64]interface{}{}
+		}
+	}
+
+	return opensearch.PutSavedSearchQueries(config.Server.ElasticsearchEndpoint, queries)
+}
+
+// CreateSavedSearch saves a search
+// @Summary Save a search
+// @Schemes
+// @Description Save the parameters of a search so it can be run again by its id. Saved searches can be shared
+// @Description with groups, and users can subscribe to them to be notified of new objects that match.
+// @Description The parameters are the `GET /search` query parameters `namespace`, `dataset`, `metadata`, `q`,
+// @Description `filename`, `path`, `sort`, `modified_after`, and `modified_before`.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchInput		body	savedSearchInput	true	"Saved Search Input"
+// @Success 201 {object} database.SavedSearch
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved [post]
+func CreateSavedSearch(c *gin.Context) {
+	config, db := getAppConfig(c)
+
+	input := savedSearchInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSavedSearchParameters(db, input.Parameters); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userInfo := getUserInfo(c)
+	search, err := db.CreateSavedSearch(userInfo.Username, input.Name, input.Description, input.Parameters)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	query, err := savedSearchQuery(db, search)
+	if err == nil {
+		err = opensearch.PutSavedSearchQueries(config.Server.ElasticsearchEndpoint, map[int64]interface{}{search.Id: query})
+	}
+	if err != nil {
+		// the search can't notify subscribers without its query, so it isn't kept
+		if deleteErr := db.DeleteSavedSearch(search); deleteErr != nil {
+			logrus.Errorf("Failed to remove saved search %d: %s", search.Id, deleteErr.Error())
+		}
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, search)
+}
+
+// ListSavedSearches lists the saved searches the user can run
+// @Summary List saved searches
+// @Schemes
+// @Description List the searches the user saved and the searches that are shared with the user's groups,
+// @Description ordered by name
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	limit  query  int  false  "Maximum number of saved searches to return" default(25)
+// @Param	offset  query  int  false  "Number of saved searches to skip" default(0)
+// @Success 200 {object} []database.SavedSearch
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved [get]
+func ListSavedSearches(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	userInfo := getUserInfo(c)
+	searches, err := db.ListSavedSearches(userInfo.Username, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, searches)
+}
+
+// GetSavedSearch gets a saved search
+// @Summary Get a saved search
+// @Schemes
+// @Description Get a saved search that the user saved or that is shared with one of the user's groups
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Success 200 {object} database.SavedSearch
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId} [get]
+func GetSavedSearch(c *gin.Context) {
+	search, ok := loadSavedSearch(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+// UpdateSavedSearch updates a saved search
+// @Summary Update a saved search
+// @Schemes
+// @Description Replace the name, description, and parameters of a saved search. Only the user who saved the
+// @Description search can update it.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Param	savedSearchInput		body	savedSearchInput	true	"Saved Search Input"
+// @Success 200 {object} database.SavedSearch
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId} [put]
+func UpdateSavedSearch(c *gin.Context) {
+	config, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, true)
+	if !ok {
+		return
+	}
+
+	input := savedSearchInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSavedSearchParameters(db, input.Parameters); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	search.Name = input.Name
+	search.Description = input.Description
+	search.Parameters = input.Parameters
+	if err := db.UpdateSavedSearch(search); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	query, err := savedSearchQuery(db, search)
+	if err == nil {
+		err = opensearch.PutSavedSearchQueries(config.Server.ElasticsearchEndpoint, map[int64]interface{}{search.Id: query})
+	}
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+// DeleteSavedSearch removes a saved search
+// @Summary Delete a saved search
+// @Schemes
+// @Description Remove a saved search and all subscriptions to it. Only the user who saved the search can remove it.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId} [delete]
+func DeleteSavedSearch(c *gin.Context) {
+	config, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, true)
+	if !ok {
+		return
+	}
+
+	if err := opensearch.DeleteSavedSearchQuery(config.Server.ElasticsearchEndpoint, search.Id); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if err := db.DeleteSavedSearch(search); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RunSavedSearch runs a saved search
+// @Summary Run a saved search
+// @Schemes
+// @Description Run a saved search, returning the same response as `GET /search` with the saved parameters.
+// @Description Results are limited to the datasets the user can read, so users a search is shared with may
+// @Description see different results.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Param	size  query  int  false  "Number of results to return" default(25)
+// @Param	from  query  int  false  "Result index to start from if paging results, `from` + `size` must not exceed 10000" default(0)
+// @Param	cursor  query  string  false  "The `next_cursor` value from the previous page of results, to page through any number of results. Can't be combined with `from`"
+// @Param	federated  query  bool  false  "If true, also search the peer core services configured on this server"
+// @Success 200 {object} object{results=[]MetadataSearchResult,next_cursor=string,servers=[]FederatedServer}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/run [get]
+func RunSavedSearch(c *gin.Context) {
+	search, ok := loadSavedSearch(c, false)
+	if !ok {
+		return
+	}
+
+	// replace the request's query parameters with the saved parameters and the paging parameters
+	values := savedSearchValues(search.Parameters)
+	queryParams := c.Request.URL.Query()
+	for _, key := range savedSearchPageParameters {
+		if value, ok := queryParams[key]; ok {
+			values[key] = value
+		}
+	}
+	c.Request.URL.RawQuery = values.Encode()
+
+	SearchMetadata(c)
+}
+
+// ShareSavedSearch shares a saved search with a group
+// @Summary Share a saved search with a group
+// @Schemes
+// @Description Share a saved search with a group, so the group's members can run and subscribe to it. Only the
+// @Description user who saved the search can share it.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Param	groupName   path      string  true  "Group Name"
+// @Success 200 {object} database.SavedSearch
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/group/{groupName} [put]
+func ShareSavedSearch(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, true)
+	if !ok {
+		return
+	}
+
+	if err := db.ShareSavedSearch(search, c.Param("groupname")); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	search, err := db.GetSavedSearch(search.Id)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+// UnshareSavedSearch stops sharing a saved search with a group
+// @Summary Stop sharing a saved search with a group
+// @Schemes
+// @Description Stop sharing a saved search with a group. Members of the group that can no longer read the search
+// @Description stop receiving notifications from their subscriptions to it. Only the user who saved the search
+// @Description can change who it is shared with.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Param	groupName   path      string  true  "Group Name"
+// @Success 200 {object} database.SavedSearch
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/group/{groupName} [delete]
+func UnshareSavedSearch(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, true)
+	if !ok {
+		return
+	}
+
+	if err := db.UnshareSavedSearch(search, c.Param("groupname")); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	search, err := db.GetSavedSearch(search.Id)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/gigantum/hoss-core/pkg/database"
 	"github.com/gigantum/hoss-core/pkg/opensearch"
 	"github.com/gin-gonic/gin"
 )
@@ -25,7 +28,7 @@ import (
 // @Security BearerToken
 // @Router /search/document/metadata [put]
 func CreateOrUpdateMetadataDocument(c *gin.Context) {
-	config, _ := getAppConfig(c)
+	config, db := getAppConfig(c)
 	user := getUserInfo(c)
 
 	if !user.IsService {
@@ -39,15 +42,150 @@ func CreateOrUpdateMetadataDocument(c *gin.Context) {
 		return
 	}
 
-	err = opensearch.CreateOrUpdateDocument(config.Server.ElasticsearchEndpoint, &payload)
+	// index the metadata values by type and flag schema violations, using the dataset's schema if it has one
+	var schema *database.MetadataSchema
+	location := strings.SplitN(payload.DatasetExtended, "|", 3)
+	if len(location) == 3 {
+		schema, err = db.GetMetadataSchemaByLocation(location[0], location[1], location[2])
+		if err == database.ErrNotFound {
+			schema = nil
+		} else if err != nil {
+			HandleError(c, err)
+			return
+		}
+	}
+	opensearch.ApplyMetadataSchema(&payload, schema)
+
+	created, err := opensearch.CreateOrUpdateDocument(config.Server.ElasticsearchEndpoint, &payload)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
 
+	// notify the subscribers of saved searches that match the new object
+	if created {
+		go notifySearchSubscriptions(config, db, []*opensearch.MetadataIndexPayload{&payload})
+	}
+
 	c.Status(http.StatusNoContent)
 }
 
+// maxBulkOperations is the maximum number of operations in a single bulk metadata document request
+const maxBulkOperations = 1000
+
+// BulkMetadataDocumentsInput is the body of a bulk metadata document request
+type BulkMetadataDocumentsInput struct {
+	Operations []*opensearch.BulkOperation `json:"operations" binding:"required,dive"`
+}
+
+// BulkMetadataDocumentsResponse is the result of a bulk metadata document request
+type BulkMetadataDocumentsResponse struct {
+	// Errors is true if any of the operations failed
+	Errors bool `json:"errors"`
+	// Items are the results of each operation, in the same order as the operations in the request
+	Items []*opensearch.BulkItemResult `json:"items"`
+}
+
+// BulkMetadataDocuments creates, updates, and deletes documents in the metadata search index
+// @Summary Create, update, or delete documents in the metadata search index in bulk
+// @Schemes
+// @Description Applies a batch of `index`, `delete`, and `sidecar` operations to the metadata search index with a single
+// @Description request. `sidecar` operations replace the sidecar metadata (`sidecar_metadata`) of an existing document,
+// @Description and are skipped with a 404 status if the document doesn't exist. Operations are applied in order. The result of each operation is returned in the same order, so
+// @Description failed operations can be retried. A batch can contain at most 1000 operations.
+// @Description **NOTE: This endpoint is only available to the service account**
+// @Tags Service Account
+// @Accept json
+// @Produce json
+// @Param	bulkInput		body	BulkMetadataDocumentsInput	true	"Bulk Input"
+// @Success 200 {object} BulkMetadataDocumentsResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/document/metadata/bulk [post]
+func BulkMetadataDocuments(c *gin.Context) {
+	config, db := getAppConfig(c)
+	user := getUserInfo(c)
+
+	if !user.IsService {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	input := BulkMetadataDocumentsInput{}
+	err := c.Bind(&input)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if len(input.Operations) > maxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a bulk request can contain at most %d operations", maxBulkOperations)})
+		return
+	}
+
+	for _, operation := range input.Operations {
+		switch operation.Action {
+		case opensearch.BulkActionIndex, opensearch.BulkActionDelete, opensearch.BulkActionSidecar:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported bulk action: " + operation.Action})
+			return
+		}
+	}
+
+	// merge sidecar metadata into the documents of the objects the sidecar files describe, then index the metadata
+	// values by type and flag schema violations, loading the schema of each dataset in the batch once. Merged
+	// documents that are changed by another request before they are indexed are merged and prepared again
+	schemas := map[string]*database.MetadataSchema{}
+	results, err := opensearch.ApplyBulkOperations(config.Server.ElasticsearchEndpoint, input.Operations,
+		func(operations []*opensearch.BulkOperation) error {
+			for _, operation := range operations {
+				if operation.Action != opensearch.BulkActionIndex {
+					continue
+				}
+
+				schema, ok := schemas[operation.Document.DatasetExtended]
+				if !ok {
+					location := strings.SplitN(operation.Document.DatasetExtended, "|", 3)
+					if len(location) == 3 {
+						var err error
+						schema, err = db.GetMetadataSchemaByLocation(location[0], location[1], location[2])
+						if err == database.ErrNotFound {
+							schema = nil
+						} else if err != nil {
+							return err
+						}
+					}
+					schemas[operation.Document.DatasetExtended] = schema
+				}
+				opensearch.ApplyMetadataSchema(operation.Document, schema)
+			}
+			return nil
+		})
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	response := BulkMetadataDocumentsResponse{Items: results}
+	created := []*opensearch.MetadataIndexPayload{}
+	for i, result := range results {
+		if result.Error != "" {
+			response.Errors = true
+		} else if result.Status == http.StatusCreated && input.Operations[i].Action == opensearch.BulkActionIndex {
+			created = append(created, input.Operations[i].Document)
+		}
+	}
+
+	// notify the subscribers of saved searches that match the new objects
+	go notifySearchSubscriptions(config, db, created)
+
+	c.JSON(http.StatusOK, response)
+}
+
 // DeleteMetadataDocument deletes a document in the metadata search index
 // @Summary Delete a document in the metadata search index
 // @Schemes
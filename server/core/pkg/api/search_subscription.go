@@ -0,0 +1,523 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+)
+
+const (
+	// searchNotificationRetention is how long notifications are kept in subscription feeds
+	searchNotificationRetention = 30 * 24 * time.Hour
+	// searchNotificationCleanupPeriod is how often expired notifications are removed
+	searchNotificationCleanupPeriod = time.Hour
+	// webhookTimeout is how long to wait for a subscription's webhook to respond
+	webhookTimeout = 10 * time.Second
+
+	defaultNotificationFeedSize = 100
+	maxNotificationFeedSize     = 1000
+)
+
+var (
+	// lastNotificationCleanup is when expired notifications were last removed
+	lastNotificationCleanup     time.Time
+	lastNotificationCleanupLock sync.Mutex
+)
+
+// privateNetworks are the address ranges webhooks can't be sent to unless private webhooks are allowed, so users
+// can't use webhooks to reach services on the core service's network
+var privateNetworks = func() []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.168.0.0/16", "::/128", "::1/128", "fc00::/7", "fe80::/10",
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+type searchSubscriptionInput struct {
+	// WebhookURL is the http or https URL notifications are posted to. If empty, notifications are only
+	// available from the subscription's feed
+	WebhookURL string `json:"webhook_url"`
+}
+
+// SearchSubscriptionResult is a subscription with the name of its saved search
+type SearchSubscriptionResult struct {
+	*database.SearchSubscription
+	// SavedSearchName is the name of the saved search
+	SavedSearchName string `json:"saved_search_name"`
+}
+
+// SearchNotificationResult is a notification with the Hoss URI of the object
+type SearchNotificationResult struct {
+	*database.SearchNotification
+	// URI is the Hoss URI that can be loaded via the client library
+	URI string `json:"uri"`
+}
+
+// searchWebhookPayload is the body of the request sent to a subscription's webhook
+type searchWebhookPayload struct {
+	SavedSearchId   int64                       `json:"saved_search_id"`
+	SavedSearchName string                      `json:"saved_search_name"`
+	Notifications   []*SearchNotificationResult `json:"notifications"`
+}
+
+// newSearchNotificationResult adds the Hoss URI to a notification
+func newSearchNotificationResult(notification *database.SearchNotification) *SearchNotificationResult {
+	return &SearchNotificationResult{
+		SearchNotification: notification,
+		URI: fmt.Sprintf(
+			"hoss+%s://%s:%s:%s/%s",
+			strings.Split(os.Getenv("EXTERNAL_HOSTNAME"), "://")[0],
+			strings.Split(os.Getenv("EXTERNAL_HOSTNAME"), "://")[1],
+			notification.Namespace,
+			notification.Dataset,
+			notification.FilePath,
+		),
+	}
+}
+
+// validateWebhookURL returns an error if the URL can't be used as a webhook
+func validateWebhookURL(webhookURL string) error {
+	if webhookURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return errors.New("webhook_url is not a valid URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("webhook_url must be an http or https URL")
+	}
+	if u.Host == "" {
+		return errors.New("webhook_url must include a host")
+	}
+	return nil
+}
+
+// newWebhookClient returns the client used to send webhooks. Unless allowPrivate is true, it refuses to connect to
+// private addresses, which is checked when connecting so host names can't be changed to resolve to one later
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return errors.New("webhook address is not an IP address: " + host)
+			}
+			for _, network := range privateNetworks {
+				if network.Contains(ip) {
+					return errors.New("webhooks can't be sent to private address " + host)
+				}
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+		// redirects could be used to reach addresses that weren't checked when subscribing
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// notifySearchSubscriptions matches newly created documents against the saved searches, and creates notifications
+// for the subscribers of the matching searches that can read the documents' datasets and the search. Webhooks are
+// sent after the notifications are saved. This runs in the background, so errors are logged
+func notifySearchSubscriptions(config *config.Configuration, db *database.Database, documents []*opensearch.MetadataIndexPayload) {
+	if len(documents) == 0 {
+		return
+	}
+
+	matches, err := opensearch.PercolateDocuments(config.Server.ElasticsearchEndpoint, documents)
+	if err != nil {
+		logrus.Errorf("Failed to match new documents to saved searches: %s", err.Error())
+		return
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	ids := []int64{}
+	for id := range matches {
+		ids = append(ids, id)
+	}
+	subscriptions, err := db.GetSubscriptionsBySavedSearches(ids)
+	if err != nil {
+		logrus.Errorf("Failed to load search subscriptions: %s", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	notifications := []*database.SearchNotification{}
+	bySubscription := map[int64][]*database.SearchNotification{}
+	for _, subscription := range subscriptions {
+		username := subscription.User.Username
+		canRead, err := db.CanReadSavedSearch(subscription.SavedSearch, username)
+		if err != nil {
+			logrus.Errorf("Failed to check access to saved search %d: %s", subscription.SavedSearchId, err.Error())
+			continue
+		}
+		if !canRead {
+			continue
+		}
+
+		readable, err := db.GetReadableDatasets(username)
+		if err != nil {
+			logrus.Errorf("Failed to load readable datasets of %s: %s", username, err.Error())
+			continue
+		}
+		datasets := map[string]*database.ReadableDataset{}
+		for _, dataset := range readable {
+			datasets[getDatasetExtended(dataset.ObjectStoreName, dataset.BucketName, dataset.RootDirectory)] = dataset
+		}
+
+		namespaceName := subscription.SavedSearch.Parameters["namespace"]
+		datasetName := subscription.SavedSearch.Parameters["dataset"]
+		for _, slot := range matches[subscription.SavedSearchId] {
+			if slot < 0 || slot >= len(documents) {
+				continue
+			}
+			document := documents[slot]
+
+			dataset, ok := datasets[document.DatasetExtended]
+			if !ok || (namespaceName != "" && dataset.NamespaceName != namespaceName) ||
+				(datasetName != "" && dataset.DatasetName != datasetName) {
+				continue
+			}
+
+			notification := &database.SearchNotification{
+				SubscriptionId:   subscription.Id,
+				Namespace:        dataset.NamespaceName,
+				Dataset:          dataset.DatasetName,
+				FilePath:         strings.Join(strings.Split(document.ObjectKey, "/")[1:], "/"),
+				LastModifiedDate: document.LastModifiedDate,
+				Created:          now,
+			}
+			notifications = append(notifications, notification)
+			bySubscription[subscription.Id] = append(bySubscription[subscription.Id], notification)
+		}
+	}
+
+	if err := db.CreateSearchNotifications(notifications); err != nil {
+		logrus.Errorf("Failed to save search notifications: %s", err.Error())
+		return
+	}
+
+	client := newWebhookClient(config.Server.AllowPrivateWebhooks)
+	for _, subscription := range subscriptions {
+		if subscription.WebhookURL == "" || len(bySubscription[subscription.Id]) == 0 {
+			continue
+		}
+		go sendSearchWebhook(client, subscription, bySubscription[subscription.Id])
+	}
+
+	cleanupSearchNotifications(db)
+}
+
+// sendSearchWebhook posts notifications to a subscription's webhook. Failed webhooks are logged and not retried,
+// the notifications are still available from the subscription's feed
+func sendSearchWebhook(client *http.Client, subscription *database.SearchSubscription, notifications []*database.SearchNotification) {
+	payload := searchWebhookPayload{
+		SavedSearchId:   subscription.SavedSearchId,
+		SavedSearchName: subscription.SavedSearch.Name,
+		Notifications:   []*SearchNotificationResult{},
+	}
+	for _, notification := range notifications {
+		payload.Notifications = append(payload.Notifications, newSearchNotificationResult(notification))
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		logrus.Errorf("Failed to marshal webhook payload: %s", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.WebhookURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		logrus.Warnf("Failed to create webhook request for subscription %d: %s", subscription.Id, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "exec-env/hoss-core-service")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.Warnf("Webhook for subscription %d failed: %s", subscription.Id, err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logrus.Warnf("Webhook for subscription %d failed with status %s", subscription.Id, resp.Status)
+	}
+}
+
+// cleanupSearchNotifications removes expired notifications, at most once per cleanup period
+func cleanupSearchNotifications(db *database.Database) {
+	lastNotificationCleanupLock.Lock()
+	if time.Since(lastNotificationCleanup) < searchNotificationCleanupPeriod {
+		lastNotificationCleanupLock.Unlock()
+		return
+	}
+	lastNotificationCleanup = time.Now()
+	lastNotificationCleanupLock.Unlock()
+
+	removed, err := db.DeleteSearchNotificationsBefore(time.Now().UTC().Add(-searchNotificationRetention))
+	if err != nil {
+		logrus.Errorf("Failed to remove expired search notifications: %s", err.Error())
+		return
+	}
+	if removed > 0 {
+		logrus.Infof("Removed %d expired search notifications", removed)
+	}
+}
+
+// SubscribeSavedSearch subscribes the user to a saved search
+// @Summary Subscribe to a saved search
+// @Schemes
+// @Description Subscribe to a saved search to be notified of newly indexed objects that match it. Notifications
+// @Description are available from the subscription's feed for 30 days, and if `webhook_url` is set they are also
+// @Description posted to it as JSON. Only objects in datasets the user can read are included. Subscribing again
+// @Description replaces the webhook URL.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Param	subscriptionInput		body	searchSubscriptionInput	false	"Subscription Input"
+// @Success 200 {object} database.SearchSubscription
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/subscription [put]
+func SubscribeSavedSearch(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, false)
+	if !ok {
+		return
+	}
+
+	input := searchSubscriptionInput{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := validateWebhookURL(input.WebhookURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userInfo := getUserInfo(c)
+	subscription, err := db.SubscribeSavedSearch(search, userInfo.Username, input.WebhookURL)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// GetSearchSubscription gets the user's subscription to a saved search
+// @Summary Get a saved search subscription
+// @Schemes
+// @Description Get the user's subscription to a saved search
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Success 200 {object} database.SearchSubscription
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/subscription [get]
+func GetSearchSubscription(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, false)
+	if !ok {
+		return
+	}
+
+	userInfo := getUserInfo(c)
+	subscription, err := db.GetSearchSubscription(search, userInfo.Username)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// UnsubscribeSavedSearch removes the user's subscription to a saved search
+// @Summary Unsubscribe from a saved search
+// @Schemes
+// @Description Remove the user's subscription to a saved search and its notifications
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/subscription [delete]
+func UnsubscribeSavedSearch(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, false)
+	if !ok {
+		return
+	}
+
+	userInfo := getUserInfo(c)
+	if err := db.UnsubscribeSavedSearch(search, userInfo.Username); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetSearchNotifications gets the notification feed of the user's subscription to a saved search
+// @Summary Get saved search notifications
+// @Schemes
+// @Description Get the notifications of the user's subscription to a saved search, oldest first. Each notification
+// @Description is a newly indexed object that matched the search. Pass the `next_after` value as `after` to get
+// @Description the next page, or to poll for new notifications. Notifications are kept for 30 days.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param	savedSearchId   path      int  true  "Saved Search ID"
+// @Param	after  query  int  false  "Only return notifications with an id greater than this" default(0)
+// @Param	limit  query  int  false  "Maximum number of notifications to return, at most 1000" default(100)
+// @Success 200 {object} object{notifications=[]SearchNotificationResult,next_after=int}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/saved/{savedSearchId}/subscription/notifications [get]
+func GetSearchNotifications(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	search, ok := loadSavedSearch(c, false)
+	if !ok {
+		return
+	}
+
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after must be an integer"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultNotificationFeedSize)))
+	if err != nil || limit < 1 || limit > maxNotificationFeedSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be an integer from 1 to %d", maxNotificationFeedSize)})
+		return
+	}
+
+	userInfo := getUserInfo(c)
+	subscription, err := db.GetSearchSubscription(search, userInfo.Username)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	notifications, err := db.ListSearchNotifications(subscription, after, limit)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	results := []*SearchNotificationResult{}
+	nextAfter := after
+	for _, notification := range notifications {
+		results = append(results, newSearchNotificationResult(notification))
+		nextAfter = notification.Id
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": results, "next_after": nextAfter})
+}
+
+// ListSearchSubscriptions lists the user's saved search subscriptions
+// @Summary List saved search subscriptions
+// @Schemes
+// @Description List the user's subscriptions to saved searches
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Success 200 {object} []SearchSubscriptionResult
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /search/subscription [get]
+func ListSearchSubscriptions(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	userInfo := getUserInfo(c)
+	subscriptions, err := db.ListSearchSubscriptions(userInfo.Username)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	results := []*SearchSubscriptionResult{}
+	for _, subscription := range subscriptions {
+		result := &SearchSubscriptionResult{SearchSubscription: subscription}
+		if subscription.SavedSearch != nil {
+			result.SavedSearchName = subscription.SavedSearch.Name
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, results)
+}
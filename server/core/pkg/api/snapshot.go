@@ -0,0 +1,494 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/store"
+)
+
+type snapshotInput struct {
+	// Name is the name of the snapshot, unique in the dataset (e.g. `v1.0`)
+	Name string `json:"name" binding:"required"`
+	// Description is a description of the snapshot
+	Description string `json:"description"`
+}
+
+// SnapshotObjectLocation is where the version of an object recorded in a snapshot can be read from
+type SnapshotObjectLocation struct {
+	database.SnapshotObject
+	// BucketName is the bucket the object is stored in
+	BucketName string `json:"bucket_name"`
+	// ObjectKey is the key of the object in the bucket. Read the object with this key and the version ID to get the
+	// content recorded in the snapshot
+	ObjectKey string `json:"object_key"`
+}
+
+// SnapshotObjectChange is an object whose content is different in two states of a dataset
+type SnapshotObjectChange struct {
+	// FilePath is the path of the object in the dataset
+	FilePath string `json:"file_path"`
+	// From is the version of the object in the snapshot being compared
+	From *database.SnapshotObject `json:"from"`
+	// To is the version of the object in the state the snapshot is compared to
+	To *database.SnapshotObject `json:"to"`
+}
+
+// SnapshotDiff is the difference between a snapshot and another snapshot or the current state of a dataset
+type SnapshotDiff struct {
+	// From is the name of the snapshot being compared
+	From string `json:"from"`
+	// To is the name of the snapshot it is compared to, or empty for the current state of the dataset
+	To string `json:"to"`
+	// Added are the objects that are only in the `to` state
+	Added []*database.SnapshotObject `json:"added"`
+	// Removed are the objects that are only in the `from` snapshot
+	Removed []*database.SnapshotObject `json:"removed"`
+	// Modified are the objects whose content is different
+	Modified []*SnapshotObjectChange `json:"modified"`
+}
+
+// currentSnapshotObjects returns the latest version of every object in a dataset
+func currentSnapshotObjects(objStore store.ObjectStore, dataset *database.Dataset) ([]*database.SnapshotObject, error) {
+	objects := []*database.SnapshotObject{}
+	err := objStore.WalkLatestVersions(dataset.Namespace, objectPath(dataset, ""), func(key string, version *store.ObjectVersion) error {
+		objects = append(objects, &database.SnapshotObject{
+			FilePath:  relativeObjectKey(dataset, key),
+			VersionId: version.VersionId,
+			ETag:      version.ETag,
+			Size:      version.Size,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// diffSnapshotObjects compares two states of a dataset. An object is modified if its version changed and its ETag or
+// size is different, so uploading the same content again isn't a change. The results are ordered by path
+func diffSnapshotObjects(from, to []*database.SnapshotObject) (added, removed []*database.SnapshotObject, modified []*SnapshotObjectChange) {
+	added = []*database.SnapshotObject{}
+	removed = []*database.SnapshotObject{}
+	modified = []*SnapshotObjectChange{}
+
+	toObjects := map[string]*database.SnapshotObject{}
+	for _, object := range to {
+		toObjects[object.FilePath] = object
+	}
+
+	for _, object := range from {
+		other, ok := toObjects[object.FilePath]
+		if !ok {
+			removed = append(removed, object)
+			continue
+		}
+		delete(toObjects, object.FilePath)
+
+		if object.VersionId != other.VersionId && (object.ETag != other.ETag || object.Size != other.Size) {
+			modified = append(modified, &SnapshotObjectChange{FilePath: object.FilePath, From: object, To: other})
+		}
+	}
+	for _, object := range to {
+		if _, ok := toObjects[object.FilePath]; ok {
+			added = append(added, object)
+		}
+	}
+
+	sort.Slice(added, func(i, j int) bool { return added[i].FilePath < added[j].FilePath })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].FilePath < removed[j].FilePath })
+	sort.Slice(modified, func(i, j int) bool { return modified[i].FilePath < modified[j].FilePath })
+	return added, removed, modified
+}
+
+// loadSnapshot loads the dataset and snapshot from the request path and checks the user's access to the dataset
+func loadSnapshot(c *gin.Context, readWrite bool) (*database.Dataset, *database.DatasetSnapshot, bool) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, readWrite)
+	if !ok {
+		return nil, nil, false
+	}
+
+	snapshot, err := db.GetSnapshot(dataset, c.Param("snapshot"))
+	if err != nil {
+		HandleError(c, err)
+		return nil, nil, false
+	}
+
+	return dataset, snapshot, true
+}
+
+// CreateSnapshot records a snapshot of a dataset
+// @Summary Create a dataset snapshot
+// @Schemes
+// @Description Record the current version ID, ETag, and size of every object in a dataset under a name, such as
+// @Description `v1.0`. Snapshots can't be changed once created. Objects in a snapshot are read by their version ID,
+// @Description so versioning must be enabled for the namespace's bucket. Requires write access to the dataset
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	snapshotInput		body	snapshotInput	true	"Snapshot Input"
+// @Success 201 {object} database.DatasetSnapshot
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot [post]
+func CreateSnapshot(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, true)
+	if !ok {
+		return
+	}
+
+	input := snapshotInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Snapshot names are part of the snapshot's URL
+	if strings.Contains(input.Name, "/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot names cannot contain `/` character"})
+		return
+	}
+
+	// check the name before listing the dataset's objects, which can take a while
+	if _, err := db.GetSnapshot(dataset, input.Name); err != database.ErrNotFound {
+		if err == nil {
+			err = database.ErrExists
+		}
+		HandleError(c, err)
+		return
+	}
+
+	objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	enabled, err := objStore.VersioningEnabled(dataset.Namespace)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "versioning must be enabled for the namespace's bucket to create snapshots"})
+		return
+	}
+
+	objects, err := currentSnapshotObjects(objStore, dataset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	snapshot, err := db.CreateSnapshot(dataset, getUserInfo(c).Username, input.Name, input.Description, objects)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// ListSnapshots lists the snapshots of a dataset
+// @Summary List dataset snapshots
+// @Schemes
+// @Description List the snapshots of a dataset, newest first
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	limit   query      int  false  "Limit"
+// @Param	offset   query      int  false  "Offset"
+// @Success 200 {array} database.DatasetSnapshot
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot [get]
+func ListSnapshots(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, ok := loadDataset(c, false)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshots, err := db.ListSnapshots(dataset, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// GetSnapshot gets a snapshot of a dataset
+// @Summary Get a dataset snapshot
+// @Schemes
+// @Description Get a snapshot of a dataset by name
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	snapshotName   path      string  true  "Snapshot Name"
+// @Success 200 {object} database.DatasetSnapshot
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot/{snapshotName} [get]
+func GetSnapshot(c *gin.Context) {
+	_, snapshot, ok := loadSnapshot(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// DeleteSnapshot removes a snapshot of a dataset
+// @Summary Delete a dataset snapshot
+// @Schemes
+// @Description Remove a snapshot of a dataset. The object versions it recorded are not removed, but they are no
+// @Description longer protected from being purged.
+// @Description **NOTE: This endpoint is only available to admins**
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	snapshotName   path      string  true  "Snapshot Name"
+// @Success 204
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot/{snapshotName} [delete]
+func DeleteSnapshot(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	// Only Admins can remove snapshots, since they are immutable
+	if isAdmin := validateAdmin(getUserInfo(c).Role); !isAdmin {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	_, snapshot, ok := loadSnapshot(c, true)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteSnapshot(snapshot); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetSnapshotObject resolves an object in a snapshot to the version that can be read
+// @Summary Get an object in a dataset snapshot
+// @Schemes
+// @Description Get the version of an object recorded in a snapshot, with the bucket and object key to read it
+// @Description from. Reading the object with the version ID returns the content at the time of the snapshot
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	snapshotName   path      string  true  "Snapshot Name"
+// @Param	key   query      string  true  "Object Key"
+// @Success 200 {object} SnapshotObjectLocation
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot/{snapshotName}/object [get]
+func GetSnapshotObject(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, snapshot, ok := loadSnapshot(c, false)
+	if !ok {
+		return
+	}
+
+	key := c.Query("key")
+	if err := validateObjectKey(key); err != nil {
+		handleObjectMetadataError(c, err)
+		return
+	}
+
+	object, err := db.GetSnapshotObject(snapshot, key)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshotObjectLocation(dataset, object))
+}
+
+// snapshotObjectLocation returns where a version recorded in a snapshot is stored, using the object's full key in
+// the bucket
+func snapshotObjectLocation(dataset *database.Dataset, object *database.SnapshotObject) *SnapshotObjectLocation {
+	return &SnapshotObjectLocation{
+		SnapshotObject: *object,
+		BucketName:     dataset.Namespace.BucketName,
+		ObjectKey:      objectPath(dataset, object.FilePath),
+	}
+}
+
+// ListSnapshotObjects lists the objects in a snapshot
+// @Summary List the objects in a dataset snapshot
+// @Schemes
+// @Description List the objects recorded in a snapshot, ordered by path, with the version ID of each object
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	snapshotName   path      string  true  "Snapshot Name"
+// @Param	prefix   query      string  false  "Path prefix"
+// @Param	limit   query      int  false  "Limit"
+// @Param	offset   query      int  false  "Offset"
+// @Success 200 {array} database.SnapshotObject
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot/{snapshotName}/objects [get]
+func ListSnapshotObjects(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	_, snapshot, ok := loadSnapshot(c, false)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	objects, err := db.ListSnapshotObjects(snapshot, c.Query("prefix"), limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, objects)
+}
+
+// DiffSnapshot compares a snapshot to another snapshot or the current state of the dataset
+// @Summary Compare a dataset snapshot
+// @Schemes
+// @Description Compare a snapshot to another snapshot of the dataset, or to the current objects in the dataset if
+// @Description `to` isn't set. Objects are modified if their version changed and their ETag or size is different
+// @Tags Dataset
+// @Accept json
+// @Produce json
+// @Param	namespaceName   path      string  true  "Namespace Name"
+// @Param	datasetName   path      string  true  "Dataset Name"
+// @Param	snapshotName   path      string  true  "Snapshot Name"
+// @Param	to   query      string  false  "Snapshot Name to compare to"
+// @Success 200 {object} SnapshotDiff
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /namespace/{namespaceName}/dataset/{datasetName}/snapshot/{snapshotName}/diff [get]
+func DiffSnapshot(c *gin.Context) {
+	_, db := getAppConfig(c)
+
+	dataset, snapshot, ok := loadSnapshot(c, false)
+	if !ok {
+		return
+	}
+
+	from, err := db.GetAllSnapshotObjects(snapshot)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	var to []*database.SnapshotObject
+	toName := c.Query("to")
+	if toName != "" {
+		toSnapshot, err := db.GetSnapshot(dataset, toName)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+		to, err = db.GetAllSnapshotObjects(toSnapshot)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+	} else {
+		objStore, err := getStoreByName(getStores(c), dataset.Namespace.ObjectStore.Name)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+		to, err = currentSnapshotObjects(objStore, dataset)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+	}
+
+	added, removed, modified := diffSnapshotObjects(from, to)
+	c.JSON(http.StatusOK, &SnapshotDiff{
+		From:     snapshot.Name,
+		To:       toName,
+		Added:    added,
+		Removed:  removed,
+		Modified: modified,
+	})
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/store"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// fakeVersionStore is an object store with the latest version of each object, by key
+type fakeVersionStore struct {
+	store.ObjectStore
+	versions map[string]*store.ObjectVersion
+}
+
+func (s *fakeVersionStore) WalkLatestVersions(n *database.Namespace, prefix string, fn func(key string, version *store.ObjectVersion) error) error {
+	keys := []string{}
+	for key := range s.versions {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, s.versions[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// erroringVersionStore is an object store whose objects can't be listed
+type erroringVersionStore struct {
+	store.ObjectStore
+}
+
+func (s *erroringVersionStore) WalkLatestVersions(n *database.Namespace, prefix string, fn func(key string, version *store.ObjectVersion) error) error {
+	return fmt.Errorf("listing %s failed", prefix)
+}
+
+// describeSnapshotObjects describes snapshot objects as <file path>@<version id>
+func describeSnapshotObjects(objects []*database.SnapshotObject) string {
+	described := []string{}
+	for _, object := range objects {
+		described = append(described, object.FilePath+"@"+object.VersionId)
+	}
+	return strings.Join(described, " ")
+}
+
+func TestSnapshotObjectLocation(t *testing.T) {
+	dataset := &database.Dataset{
+		Name:          "my-dataset",
+		RootDirectory: datasetRootDirectory("my-dataset"),
+		Namespace:     &database.Namespace{BucketName: "data"},
+	}
+
+	// Snapshots record the key relative to the root directory, the same way snapshots are created
+	object := &database.SnapshotObject{FilePath: relativeObjectKey(dataset, "my-dataset/dir/file.txt"), VersionId: "v1"}
+	test.AssertEqual(t, object.FilePath, "dir/file.txt")
+
+	location := snapshotObjectLocation(dataset, object)
+	test.AssertEqual(t, location.BucketName, "data")
+	test.AssertEqual(t, location.ObjectKey, "my-dataset/dir/file.txt")
+	test.AssertEqual(t, location.VersionId, "v1")
+}
+
+func TestSnapshotObjectsResolveToVersions(t *testing.T) {
+	dataset := &database.Dataset{
+		Name:          "my-dataset",
+		RootDirectory: datasetRootDirectory("my-dataset"),
+		Namespace:     &database.Namespace{BucketName: "data"},
+	}
+	objStore := &fakeVersionStore{versions: map[string]*store.ObjectVersion{
+		"my-dataset/.dataset.yaml":     {VersionId: "v0", ETag: "e0", Size: 10},
+		"my-dataset/dir/file.txt":      {VersionId: "v1", ETag: "e1", Size: 20},
+		"my-dataset/file.txt":          {VersionId: "v2", ETag: "e2", Size: 30},
+		"my-dataset-2/file.txt":        {VersionId: "v3", ETag: "e3", Size: 40},
+		"other-dataset/my-dataset.txt": {VersionId: "v4", ETag: "e4", Size: 50},
+	}}
+
+	// only the dataset's objects are recorded, with keys relative to the root directory
+	objects, err := currentSnapshotObjects(objStore, dataset)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	test.AssertEqual(t, describeSnapshotObjects(objects), ".dataset.yaml@v0 dir/file.txt@v1 file.txt@v2")
+
+	// each recorded key resolves to the object it was recorded from, read by the recorded version
+	tests := []struct {
+		key       string
+		objectKey string
+		versionId string
+		etag      string
+		size      int64
+	}{
+		{".dataset.yaml", "my-dataset/.dataset.yaml", "v0", "e0", 10},
+		{"dir/file.txt", "my-dataset/dir/file.txt", "v1", "e1", 20},
+		{"file.txt", "my-dataset/file.txt", "v2", "e2", 30},
+	}
+	for i, tt := range tests {
+		location := snapshotObjectLocation(dataset, objects[i])
+		test.AssertEqual(t, location.FilePath, tt.key)
+		test.AssertEqual(t, location.BucketName, "data")
+		test.AssertEqual(t, location.ObjectKey, tt.objectKey)
+		test.AssertEqual(t, location.VersionId, tt.versionId)
+		test.AssertEqual(t, location.ETag, tt.etag)
+		test.AssertEqual(t, location.Size, tt.size)
+	}
+
+	// the stored objects are found again from a key read from a snapshot
+	for _, object := range objects {
+		location := snapshotObjectLocation(dataset, object)
+		version, ok := objStore.versions[location.ObjectKey]
+		if !ok || version.VersionId != location.VersionId {
+			t.Errorf("%s doesn't resolve to the recorded version, got %s", object.FilePath, location.ObjectKey)
+		}
+	}
+}
+
+func TestSnapshotObjectsWalkError(t *testing.T) {
+	objStore := &erroringVersionStore{}
+	dataset := &database.Dataset{Name: "my-dataset", RootDirectory: "my-dataset/", Namespace: &database.Namespace{}}
+	if _, err := currentSnapshotObjects(objStore, dataset); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDiffSnapshotObjects(t *testing.T) {
+	object := func(path, versionId, etag string, size int64) *database.SnapshotObject {
+		return &database.SnapshotObject{FilePath: path, VersionId: versionId, ETag: etag, Size: size}
+	}
+
+	tests := []struct {
+		name     string
+		from     []*database.SnapshotObject
+		to       []*database.SnapshotObject
+		added    string
+		removed  string
+		modified string
+	}{
+		{
+			name: "unchanged",
+			from: []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+			to:   []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+		},
+		{
+			name:  "added",
+			from:  []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+			to:    []*database.SnapshotObject{object("c.txt", "v3", "e3", 30), object("a.txt", "v1", "e1", 10), object("b.txt", "v2", "e2", 20)},
+			added: "b.txt@v2 c.txt@v3",
+		},
+		{
+			name:    "removed",
+			from:    []*database.SnapshotObject{object("c.txt", "v3", "e3", 30), object("a.txt", "v1", "e1", 10), object("b.txt", "v2", "e2", 20)},
+			to:      []*database.SnapshotObject{object("b.txt", "v2", "e2", 20)},
+			removed: "a.txt@v1 c.txt@v3",
+		},
+		{
+			name:     "changed etag",
+			from:     []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+			to:       []*database.SnapshotObject{object("a.txt", "v2", "e2", 10)},
+			modified: "a.txt@v1->v2",
+		},
+		{
+			name:     "changed size",
+			from:     []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+			to:       []*database.SnapshotObject{object("a.txt", "v2", "e1", 11)},
+			modified: "a.txt@v1->v2",
+		},
+		{
+			// uploading the same content again creates a version, but isn't a change
+			name: "same content",
+			from: []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+			to:   []*database.SnapshotObject{object("a.txt", "v2", "e1", 10)},
+		},
+		{
+			name: "all",
+			from: []*database.SnapshotObject{
+				object("dir/removed.txt", "v1", "e1", 10), object("changed.txt", "v2", "e2", 20),
+				object("same.txt", "v3", "e3", 30), object("a-changed.txt", "v4", "e4", 40),
+			},
+			to: []*database.SnapshotObject{
+				object("same.txt", "v3", "e3", 30), object("changed.txt", "v5", "e5", 20),
+				object("added.txt", "v6", "e6", 60), object("a-changed.txt", "v7", "e7", 40),
+			},
+			added:    "added.txt@v6",
+			removed:  "dir/removed.txt@v1",
+			modified: "a-changed.txt@v4->v7 changed.txt@v2->v5",
+		},
+		{
+			name:  "empty snapshot",
+			from:  []*database.SnapshotObject{},
+			to:    []*database.SnapshotObject{object("a.txt", "v1", "e1", 10)},
+			added: "a.txt@v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, modified := diffSnapshotObjects(tt.from, tt.to)
+			test.AssertEqual(t, describeSnapshotObjects(added), tt.added)
+			test.AssertEqual(t, describeSnapshotObjects(removed), tt.removed)
+
+			described := []string{}
+			for _, change := range modified {
+				test.AssertEqual(t, change.From.FilePath, change.FilePath)
+				test.AssertEqual(t, change.To.FilePath, change.FilePath)
+				described = append(described, change.FilePath+"@"+change.From.VersionId+"->"+change.To.VersionId)
+			}
+			test.AssertEqual(t, strings.Join(described, " "), tt.modified)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gigantum/hoss-core/pkg/database"
 
@@ -154,5 +155,15 @@ func GetUserSTSCredentials(c *gin.Context) {
 		return
 	}
 
+	// Remember who the credentials were issued to, so downloads can be attributed to the user when access
+	// logging is enabled. Failing to do so shouldn't stop the user from getting credentials
+	expiration, err := time.Parse(time.RFC3339, creds.Expiration)
+	if err == nil {
+		err = db.SaveSTSSession(user.Username, creds.AccessKeyId, expiration)
+	}
+	if err != nil {
+		logrus.Warnf("Unable to save STS session for %s: %s", user.Username, err.Error())
+	}
+
 	c.JSON(http.StatusOK, creds)
 }
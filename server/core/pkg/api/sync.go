@@ -164,6 +164,8 @@ type fullSyncConfiguration struct {
 
 	TargetCoreService string `json:"target_core_service"`
 	TargetNamespace   string `json:"target_namespace"`
+
+	CascadeDelete bool `json:"cascade_delete"`
 }
 
 // GetSyncConfiguration returns the SyncConfiguration data needed by the Sync Service
@@ -256,6 +258,7 @@ func GetSyncConfiguration(c *gin.Context) {
 			SourcePolicies:    policies,
 			TargetCoreService: config.TargetCoreService,
 			TargetNamespace:   config.TargetNamespace,
+			CascadeDelete:     config.CascadeDelete,
 		})
 	}
 
@@ -263,6 +266,77 @@ func GetSyncConfiguration(c *gin.Context) {
 	c.JSON(http.StatusOK, fullConfigs)
 }
 
+// @Description Input parameters for a Sync Service instance to acquire or renew its shard leases
+type syncLeaseRequest struct {
+	// InstanceId uniquely identifies the Sync Service instance (e.g. the hostname of the container)
+	InstanceId string `json:"instance_id" binding:"required"`
+	// ShardCount is the total number of shards the sync workload is divided into. All instances must use the same value
+	ShardCount int `json:"shard_count" binding:"required"`
+	// LeaseDuration is the number of seconds the leases are valid for if they are not renewed
+	LeaseDuration int `json:"lease_duration" binding:"required"`
+	// Released is the list of shards the instance was asked to release and has finished processing
+	Released []int `json:"released"`
+}
+
+// @Description The shards currently owned by a Sync Service instance
+type syncLeaseResponse struct {
+	// Shards is the list of shards the instance owns until the lease expires
+	Shards []int `json:"shards"`
+	// Releasing is the list of shards the instance must stop taking messages for. They are still leased to the
+	// instance until it lists them in `released`, once it has finished the messages it is processing
+	Releasing []int `json:"releasing"`
+}
+
+// AcquireSyncLeases registers a Sync Service instance and returns the shards it owns
+// @Summary Acquire or renew Sync Service shard leases
+// @Schemes
+// @Description Registers or renews a Sync Service instance and returns the shards of the sync workload
+// @Description that the instance owns. Shards are balanced between all live instances. An instance that
+// @Description does not renew within the lease duration is considered dead and its shards are released
+// @Description to the remaining instances. Shards that are rebalanced to another instance are returned in
+// @Description `releasing`, and are freed once the instance lists them in `released`.
+// @Description **NOTE: This endpoint is only available to the service account**
+// @Tags Service Account
+// @Accept json
+// @Produce json
+// @Param	syncLeaseRequest		body	api.syncLeaseRequest	true	"Sync Service instance lease request"
+// @Success 200 {object} syncLeaseResponse
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Security BearerToken
+// @Router /configuration/sync/lease [put]
+func AcquireSyncLeases(c *gin.Context) {
+	_, db := getAppConfig(c)
+	userInfo := getUserInfo(c)
+
+	if !userInfo.IsService {
+		HandleError(c, ErrUnauthorized)
+		return
+	}
+
+	var input syncLeaseRequest
+	err := c.BindJSON(&input)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if input.ShardCount <= 0 || input.LeaseDuration <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shard_count and lease_duration must be greater than zero"})
+		return
+	}
+
+	shards, releasing, err := db.AcquireSyncLeases(input.InstanceId, input.ShardCount,
+		time.Duration(input.LeaseDuration)*time.Second, input.Released)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, syncLeaseResponse{Shards: shards, Releasing: releasing})
+}
+
 // @Description Input parameters to configure a sync relationship between namespaces
 type syncNamespaceTarget struct {
 	// TargetCoreService is the url to the core service that contains the namespace to which you
@@ -272,6 +346,9 @@ type syncNamespaceTarget struct {
 	TargetNamespace string `json:"target_namespace"`
 	// SyncType is the type of sync relationship to configure ('simplex' or 'duplex')
 	SyncType string `json:"sync_type" binding:"required"`
+	// CascadeDelete is an optional flag that, if true, will cause dataset deletes in this namespace to
+	// schedule the delete of the corresponding dataset in the target namespace
+	CascadeDelete bool `json:"cascade_delete"`
 }
 
 // EnableSyncNamespace enables synchronization of a namespace
@@ -280,6 +357,9 @@ type syncNamespaceTarget struct {
 // @Description Configure synchronization for this namespace, enabling datasets to be configured for sync
 // @Description Note: Currently in the UI we only support a single sync target, but the system
 // @Description could in theory support a multi-way sync configuration between more than 2 namespaces.
+// @Description If `cascade_delete` is true, when a synced dataset is deleted in this namespace the delete
+// @Description will be scheduled in the target dataset as well. The target's delete delay still applies.
+// @Description If the sync configuration already exists, only the `cascade_delete` flag is updated.
 // @Tags Namespace
 // @Accept json
 // @Produce json
@@ -349,6 +429,13 @@ func EnableSyncNamespace(c *gin.Context) {
 	// Note: This will mutate the sync_configuration_meta.last_updated cell with the current timestamp, if the query succeeds
 	err = db.CreateSyncConfiguration(namespace, input.TargetCoreService, input.TargetNamespace, input.SyncType)
 	if err == database.ErrExists {
+		// Note: This will mutate the sync_configuration_meta.last_updated cell with the current timestamp, if the value changes
+		err = db.SetSyncConfigurationCascadeDelete(namespace, input.TargetCoreService, input.TargetNamespace, input.CascadeDelete)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+
 		c.Status(http.StatusNoContent)
 		return
 	} else if err != nil {
@@ -356,9 +443,17 @@ func EnableSyncNamespace(c *gin.Context) {
 		return
 	}
 
+	if input.CascadeDelete {
+		err = db.SetSyncConfigurationCascadeDelete(namespace, input.TargetCoreService, input.TargetNamespace, input.CascadeDelete)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+	}
+
 	// If it is a duplex configuration, enable sync on the target namespace
 	if input.SyncType == database.SYNC_TYPE_DUPLEX {
-		err = sync.SyncNamespaceHandler(c, currentStore, namespace, input.TargetCoreService, input.TargetNamespace)
+		err = sync.SyncNamespaceHandler(c, currentStore, namespace, input.TargetCoreService, input.TargetNamespace, input.CascadeDelete)
 		if err != nil {
 			HandleError(c, err)
 			return
@@ -63,6 +63,51 @@ type Server struct {
 	SyncFrequencyMinutes       int    `yaml:"sync_frequency_minutes"`
 	DatasetDeleteDelayMinutes  int    `yaml:"dataset_delete_delay_minutes"`
 	DatasetDeletePeriodSeconds int    `yaml:"dataset_delete_period_seconds"`
+	IndexJobPeriodSeconds      int    `yaml:"index_job_period_seconds"`
+	DatasetJobPeriodSeconds    int    `yaml:"dataset_job_period_seconds"`
+	AllowPrivateWebhooks       bool   `yaml:"allow_private_webhooks"`
+
+	OpenSearch OpenSearch `yaml:"opensearch"`
+	Federation Federation `yaml:"federation"`
+}
+
+// Federation contains the peer core services that searches are sent to when a user requests a federated search
+type Federation struct {
+	// Name labels the search results from this core service, defaults to EXTERNAL_HOSTNAME
+	Name string `yaml:"name"`
+	// Peers are the other core services to search
+	Peers []FederationPeer `yaml:"peers"`
+	// TimeoutSeconds is how long to wait for each peer before returning the results without it
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+}
+
+// FederationPeer is a core service that federated searches are sent to
+type FederationPeer struct {
+	// Name labels the search results from the peer
+	Name string `yaml:"name"`
+	// Endpoint is the root of the peer's core service API (e.g. https://hoss.example.com/core/v1)
+	Endpoint string `yaml:"endpoint"`
+	// TokenEnv is the environment variable containing a delegated token for the peer. If unset, the user's token
+	// is sent to the peer, which requires the peer to trust the same auth service
+	TokenEnv string `yaml:"token_env"`
+}
+
+// OpenSearch contains the settings used to connect to the Opensearch service at `elasticsearch_endpoint`.
+// Secrets are loaded from the OPENSEARCH_PASSWORD and OPENSEARCH_API_KEY environment variables
+type OpenSearch struct {
+	// AuthType is how requests are authenticated: `basic`, `api_key`, `aws_sigv4`, or empty for no authentication
+	AuthType string `yaml:"auth_type"`
+	// Username is the user for `basic` authentication
+	Username string `yaml:"username"`
+	// AwsRegion, AwsProfile and AwsService are used to sign requests for `aws_sigv4` authentication
+	AwsRegion  string `yaml:"aws_region"`
+	AwsProfile string `yaml:"aws_profile"`
+	AwsService string `yaml:"aws_service"`
+	// CACert is the path to a PEM encoded CA bundle used to verify the Opensearch service's certificate
+	CACert             string `yaml:"ca_cert"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	TimeoutSeconds     int    `yaml:"timeout_seconds"`
+	MaxRetries         int    `yaml:"max_retries"`
 }
 
 // Load creates a default config and then initializes it with values from
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+)
+
+// GetAccessLogging gets the access logging record for a dataset
+// Note: returns ErrNotFound if access logging isn't enabled for the dataset
+func (db *Database) GetAccessLogging(dataset *Dataset) (*AccessLogging, error) {
+	logging := &AccessLogging{DatasetId: dataset.Id}
+	err := db.conn.Model(logging).WherePK().Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return logging, nil
+}
+
+// GetAccessLoggingByLocation gets the access logging record for the dataset stored in the given object store,
+// bucket, and root directory (without the '/'), which are the values used in the search index to identify a dataset
+// Note: returns ErrNotFound if the dataset doesn't exist or access logging isn't enabled for it
+func (db *Database) GetAccessLoggingByLocation(objectStoreName, bucketName, rootDirectory string) (*AccessLogging, error) {
+	logging := &AccessLogging{}
+	err := db.conn.Model(logging).
+		Join(`JOIN datasets AS d ON d.id = "access_logging"."dataset_id"`).
+		Join(`JOIN namespaces AS ns ON ns.id = d.namespace_id`).
+		Join(`JOIN object_stores AS os ON os.id = ns.object_store_id`).
+		Where(`os.name = ?`, objectStoreName).
+		Where(`ns.bucket_name = ?`, bucketName).
+		Where(`regexp_replace(d.root_directory, '/', '') = ?`, rootDirectory).
+		Limit(1).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return logging, nil
+}
+
+// EnableAccessLogging enables access logging for a dataset
+// Note: there is no error if access logging is already enabled
+func (db *Database) EnableAccessLogging(dataset *Dataset) (*AccessLogging, error) {
+	logging := &AccessLogging{
+		DatasetId: dataset.Id,
+		Created:   time.Now().UTC(),
+	}
+	_, err := db.conn.Model(logging).
+		OnConflict("(dataset_id) DO NOTHING").
+		Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to enable access logging"))
+	}
+
+	return db.GetAccessLogging(dataset)
+}
+
+// DisableAccessLogging disables access logging for a dataset. Downloads that were already recorded are kept
+// Note: there is no error if access logging isn't enabled
+func (db *Database) DisableAccessLogging(dataset *Dataset) error {
+	_, err := db.conn.Model((*AccessLogging)(nil)).
+		Where("dataset_id = ?", dataset.Id).
+		Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
+
+// SaveSTSSession records the access key of temporary object store credentials issued to a user, and removes the
+// user's expired sessions
+func (db *Database) SaveSTSSession(username, accessKeyId string, expiration time.Time) error {
+	user, err := db.GetOrCreateUser(username)
+	if err != nil {
+		return err
+	}
+
+	return db.conn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.Model((*STSSession)(nil)).
+			Where("user_id = ?", user.Id).
+			Where("expiration < ?", time.Now().UTC()).
+			Delete()
+		if err != nil {
+			return ConvertError(err)
+		}
+
+		session := &STSSession{AccessKeyId: accessKeyId, UserId: user.Id, Expiration: expiration.UTC()}
+		_, err = tx.Model(session).
+			OnConflict("(access_key_id) DO UPDATE").
+			Set("user_id = EXCLUDED.user_id").
+			Set("expiration = EXCLUDED.expiration").
+			Insert()
+		if err != nil {
+			return ConvertError(errors.Wrap(err, "failed to save sts session"))
+		}
+
+		return nil
+	})
+}
+
+// GetUsernamesByAccessKeys returns a map of the given temporary credential access keys to the users they were
+// issued to. Unknown access keys are not included
+func (db *Database) GetUsernamesByAccessKeys(accessKeyIds []string) (map[string]string, error) {
+	usernames := map[string]string{}
+	if len(accessKeyIds) == 0 {
+		return usernames, nil
+	}
+
+	sessions := []*STSSession{}
+	err := db.conn.Model(&sessions).
+		Relation("User").
+		Where("access_key_id IN (?)", pg.In(accessKeyIds)).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	for _, session := range sessions {
+		usernames[session.AccessKeyId] = session.User.Username
+	}
+	return usernames, nil
+}
+
+// CreateObjectAccesses records object downloads
+func (db *Database) CreateObjectAccesses(accesses []*ObjectAccess) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+
+	_, err := db.conn.Model(&accesses).Insert()
+	if err != nil {
+		return ConvertError(errors.Wrap(err, "failed to record object accesses"))
+	}
+
+	return nil
+}
+
+// objectAccessCountQuery returns a query that counts the downloads and users of a dataset's objects since a time
+func (db *Database) objectAccessCountQuery(dataset *Dataset, since time.Time) *orm.Query {
+	return db.conn.Model((*ObjectAccess)(nil)).
+		ColumnExpr("count(*) AS downloads").
+		ColumnExpr("count(DISTINCT username) AS users").
+		ColumnExpr("max(accessed) AS last_accessed").
+		Where("dataset_id = ?", dataset.Id).
+		Where("accessed >= ?", since)
+}
+
+// GetDatasetAccessCount returns the number of downloads of all objects in a dataset since a time
+func (db *Database) GetDatasetAccessCount(dataset *Dataset, since time.Time) (*ObjectAccessCount, error) {
+	count := &ObjectAccessCount{}
+	err := db.objectAccessCountQuery(dataset, since).Select(count)
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return count, nil
+}
+
+// GetObjectAccessCount returns the number of downloads of an object in a dataset since a time
+func (db *Database) GetObjectAccessCount(dataset *Dataset, filePath string, since time.Time) (*ObjectAccessCount, error) {
+	count := &ObjectAccessCount{}
+	err := db.objectAccessCountQuery(dataset, since).
+		Where("file_path = ?", filePath).
+		Select(count)
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	count.FilePath = filePath
+	return count, nil
+}
+
+// ListObjectAccessCounts returns the number of downloads of each object in a dataset that was downloaded since a
+// time, most downloaded first, with limit/offset for pagination
+func (db *Database) ListObjectAccessCounts(dataset *Dataset, since time.Time, limit int, offset int) ([]*ObjectAccessCount, error) {
+	counts := []*ObjectAccessCount{}
+	err := db.objectAccessCountQuery(dataset, since).
+		Column("file_path").
+		Group("file_path").
+		Order("downloads DESC", "file_path ASC").
+		Limit(limit).
+		Offset(offset).
+		Select(&counts)
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return counts, nil
+}
+
+// ListObjectAccesses lists the downloads of a dataset's objects, or of a single object if filePath is set, most
+// recent first, with limit/offset for pagination
+func (db *Database) ListObjectAccesses(dataset *Dataset, filePath string, limit int, offset int) ([]*ObjectAccess, error) {
+	accesses := []*ObjectAccess{}
+	query := db.conn.Model(&accesses).
+		Where("dataset_id = ?", dataset.Id)
+	if filePath != "" {
+		query = query.Where("file_path = ?", filePath)
+	}
+	err := query.
+		Order("accessed DESC", "id DESC").
+		Limit(limit).
+		Offset(offset).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return accesses, nil
+}
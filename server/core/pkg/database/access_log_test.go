@@ -0,0 +1,154 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestAccessLogging(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	_, err = db.GetAccessLoggingByLocation("default", "data", "test_dataset")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	logging, err := db.EnableAccessLogging(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but enable access logging failed: %v", err)
+	}
+
+	// Enabling again keeps the original record
+	again, err := db.EnableAccessLogging(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but enable access logging failed: %v", err)
+	}
+	test.AssertEqual(t, again.Created.Equal(logging.Created), true)
+
+	logging, err = db.GetAccessLoggingByLocation("default", "data", "test_dataset")
+	if err != nil {
+		t.Fatalf("Expected no error but get access logging by location failed: %v", err)
+	}
+	test.AssertEqual(t, logging.DatasetId, ds.Id)
+
+	err = db.DisableAccessLogging(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but disable access logging failed: %v", err)
+	}
+
+	_, err = db.GetAccessLogging(ds)
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+}
+
+func TestSTSSession(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	err = db.SaveSTSSession("test_user", "EXPIREDKEY", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error but save sts session failed: %v", err)
+	}
+
+	// Saving a new session removes the user's expired sessions
+	err = db.SaveSTSSession("test_user", "ACCESSKEY", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error but save sts session failed: %v", err)
+	}
+
+	usernames, err := db.GetUsernamesByAccessKeys([]string{"ACCESSKEY", "EXPIREDKEY", "UNKNOWNKEY"})
+	if err != nil {
+		t.Fatalf("Expected no error but get usernames failed: %v", err)
+	}
+	test.AssertEqual(t, len(usernames), 1)
+	test.AssertEqual(t, usernames["ACCESSKEY"], "test_user")
+}
+
+func TestObjectAccesses(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	now := time.Now().UTC()
+	accesses := []*ObjectAccess{
+		{DatasetId: ds.Id, FilePath: "a.tif", Username: "test_user", Accessed: now.Add(-48 * time.Hour)},
+		{DatasetId: ds.Id, FilePath: "a.tif", Username: "test_user", Accessed: now.Add(-2 * time.Hour)},
+		{DatasetId: ds.Id, FilePath: "a.tif", Username: "other_user", Accessed: now.Add(-time.Hour)},
+		{DatasetId: ds.Id, FilePath: "b.tif", Username: "test_user", Accessed: now},
+	}
+	err = db.CreateObjectAccesses(accesses)
+	if err != nil {
+		t.Fatalf("Expected no error but create object accesses failed: %v", err)
+	}
+
+	total, err := db.GetDatasetAccessCount(ds, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset access count failed: %v", err)
+	}
+	test.AssertEqual(t, total.Downloads, int64(4))
+	test.AssertEqual(t, total.Users, int64(2))
+
+	count, err := db.GetObjectAccessCount(ds, "a.tif", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error but get object access count failed: %v", err)
+	}
+	test.AssertEqual(t, count.Downloads, int64(2))
+	test.AssertEqual(t, count.Users, int64(2))
+
+	count, err = db.GetObjectAccessCount(ds, "c.tif", time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error but get object access count failed: %v", err)
+	}
+	test.AssertEqual(t, count.Downloads, int64(0))
+	test.AssertEqual(t, count.LastAccessed == nil, true)
+
+	counts, err := db.ListObjectAccessCounts(ds, time.Time{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list object access counts failed: %v", err)
+	}
+	test.AssertEqual(t, len(counts), 2)
+	test.AssertEqual(t, counts[0].FilePath, "a.tif")
+	test.AssertEqual(t, counts[0].Downloads, int64(3))
+	test.AssertEqual(t, counts[1].FilePath, "b.tif")
+
+	recent, err := db.ListObjectAccesses(ds, "", 2, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list object accesses failed: %v", err)
+	}
+	test.AssertEqual(t, len(recent), 2)
+	test.AssertEqual(t, recent[0].FilePath, "b.tif")
+	test.AssertEqual(t, recent[1].Username, "other_user")
+
+	recent, err = db.ListObjectAccesses(ds, "a.tif", 10, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but list object accesses failed: %v", err)
+	}
+	test.AssertEqual(t, len(recent), 2)
+}
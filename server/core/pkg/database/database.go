@@ -17,6 +17,8 @@ import (
 // Database holds any database related data needed for interacting with the database
 type Database struct {
 	conn *pg.DB
+
+	readableDatasets *readableDatasetsCache
 }
 
 // Load creates a connection to the database and applies the migrations
@@ -29,9 +31,37 @@ func Load() *Database {
 		hossMigrations.Register0002()
 		// Sync Policy support
 		hossMigrations.Register0003()
-	}
-
-	db := &Database{}
+		// Cascading dataset deletes to sync targets
+		hossMigrations.Register0004()
+		// Sync service shard leases
+		hossMigrations.Register0005()
+		// Dataset metadata schemas
+		hossMigrations.Register0006()
+		// Search index rebuild jobs
+		hossMigrations.Register0007()
+		// Dataset metadata sidecar files
+		hossMigrations.Register0008()
+		// Metadata schema validation rules
+		hossMigrations.Register0009()
+		// Saved searches and search subscriptions
+		hossMigrations.Register0010()
+		// Object access logging
+		hossMigrations.Register0011()
+		// Dataset snapshots
+		hossMigrations.Register0012()
+		// Dataset clone jobs
+		hossMigrations.Register0013()
+		// Dataset move jobs
+		hossMigrations.Register0014()
+		// Dataset job owners and heartbeats
+		hossMigrations.Register0015()
+		// Index rebuilds after metadata index migrations
+		hossMigrations.Register0016()
+		// Shared readable datasets cache version
+		hossMigrations.Register0017()
+	}
+
+	db := &Database{readableDatasets: newReadableDatasetsCache()}
 
 	db.conn = pg.Connect(&pg.Options{
 		Addr:     os.Getenv("POSTGRES_HOST"),
@@ -275,6 +305,31 @@ func (db *Database) CreateSyncConfiguration(namespace *Namespace, targetCoreServ
 	return nil
 }
 
+// SetSyncConfigurationCascadeDelete sets the CascadeDelete flag on an existing SyncConfiguration
+// Note: triggers an update to the LastModified SyncConfigurationMeta timestamp if there is a change in the database
+func (db *Database) SetSyncConfigurationCascadeDelete(namespace *Namespace, targetCoreService, targetNamespace string, cascadeDelete bool) error {
+	sc := SyncConfiguration{
+		SourceNamespaceId: namespace.Id,
+		TargetCoreService: targetCoreService,
+		TargetNamespace:   targetNamespace,
+	}
+	res, err := db.conn.Model(&sc).
+		Set("cascade_delete = ?", cascadeDelete).
+		Where("source_namespace_id = ?source_namespace_id").
+		Where("target_core_service = ?target_core_service").
+		Where("target_namespace = ?target_namespace").
+		Update()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 // DeleteSyncConfiguration deletes a SyncConfiguration from the database
 // Note: there is no error if you delete a non-existent sync configuration
 // Note: triggers an update to the LastModified SyncConfigurationMeta timestamp if there is a change in the database
@@ -371,3 +426,112 @@ func (db *Database) ListDatasetsInNamespace(namespace *Namespace) ([]*Dataset, e
 
 	return datasets, nil
 }
+
+// AcquireSyncLeases registers (or renews) a Sync Service instance and returns the shards it currently owns, and the
+// shards it must release.
+//
+// Shards are balanced between all live instances, with each instance owning at most
+// ceil(shardCount / liveInstances) shards. When a new instance registers, the existing
+// instances are told to release their excess shards the next time they renew. They stop taking new messages
+// for those shards, and once the messages they are processing are done they list the shards in released
+// when they renew, which frees them for the new instance to claim. When an instance stops renewing, its leases
+// are released once it expires and are claimed by the remaining instances.
+func (db *Database) AcquireSyncLeases(instanceId string, shardCount int, leaseDuration time.Duration, released []int) ([]int, []int, error) {
+	if instanceId == "" || shardCount <= 0 || leaseDuration <= 0 {
+		return nil, nil, ErrInvalidInput
+	}
+
+	shards := []int{}
+	releasing := []int{}
+	err := db.conn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// Serialize lease changes so that concurrent instances cannot claim the same shard
+		_, err := tx.Exec(`LOCK TABLE sync_leases IN EXCLUSIVE MODE`)
+		if err != nil {
+			return err
+		}
+
+		// Remove instances that stopped renewing, which releases their leases
+		_, err = tx.Model((*SyncInstance)(nil)).Where("expires_at < now()").Delete()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO sync_instances (instance_id, expires_at)
+			VALUES (?, now() + ? * interval '1 millisecond')
+			ON CONFLICT (instance_id) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+			instanceId, leaseDuration.Milliseconds())
+		if err != nil {
+			return err
+		}
+
+		// Release shards that no longer exist, in case the shard count was reduced
+		_, err = tx.Model((*SyncLease)(nil)).Where("shard >= ?", shardCount).Delete()
+		if err != nil {
+			return err
+		}
+
+		instanceCount, err := tx.Model((*SyncInstance)(nil)).Count()
+		if err != nil {
+			return err
+		}
+		maxShards := (shardCount + instanceCount - 1) / instanceCount
+
+		err = tx.Model((*SyncLease)(nil)).Column("shard").
+			Where("instance_id = ?", instanceId).
+			Order("shard ASC").Select(&shards)
+		if err != nil {
+			return err
+		}
+
+		if len(shards) > maxShards {
+			// The excess shards stay leased until the instance has finished their messages, so that another
+			// instance doesn't process messages for the same objects at the same time
+			done := map[int]bool{}
+			for _, shard := range released {
+				done[shard] = true
+			}
+			freed := []int{}
+			for _, shard := range shards[maxShards:] {
+				if done[shard] {
+					freed = append(freed, shard)
+				} else {
+					releasing = append(releasing, shard)
+				}
+			}
+
+			if len(freed) > 0 {
+				_, err = tx.Model((*SyncLease)(nil)).
+					Where("instance_id = ?", instanceId).
+					Where("shard IN (?)", pg.In(freed)).
+					Delete()
+				if err != nil {
+					return err
+				}
+			}
+			shards = shards[:maxShards]
+		} else if len(shards) < maxShards {
+			var unowned []int
+			_, err = tx.Query(&unowned, `SELECT s FROM generate_series(0, ? - 1) AS s
+				WHERE s NOT IN (SELECT shard FROM sync_leases)
+				ORDER BY s LIMIT ?`, shardCount, maxShards-len(shards))
+			if err != nil {
+				return err
+			}
+
+			for _, shard := range unowned {
+				_, err = tx.Model(&SyncLease{Shard: shard, InstanceId: instanceId}).Insert()
+				if err != nil {
+					return err
+				}
+				shards = append(shards, shard)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, ConvertError(err)
+	}
+
+	return shards, releasing, nil
+}
@@ -287,6 +287,47 @@ func TestCreateSyncConfigurationExisting(t *testing.T) {
 	}
 }
 
+func TestSetSyncConfigurationCascadeDelete(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+
+	err = db.SetSyncConfigurationCascadeDelete(ns, "http://localhost/core/v1", "target_namespace", true)
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	err = db.CreateSyncConfiguration(ns, "http://localhost/core/v1", "target_namespace", "simplex")
+	if err != nil {
+		t.Fatalf("Expected no error but create sync configuration failed: %v", err)
+	}
+
+	syncConfigs, err := db.GetNamespaceSyncTargets(ns)
+	if err != nil {
+		t.Fatalf("Expected no error but get sync targets failed: %v", err)
+	}
+	test.AssertEqual(t, len(syncConfigs), 1)
+	test.AssertEqual(t, syncConfigs[0].CascadeDelete, false)
+
+	err = db.SetSyncConfigurationCascadeDelete(ns, "http://localhost/core/v1", "target_namespace", true)
+	if err != nil {
+		t.Fatalf("Expected no error but set cascade delete failed: %v", err)
+	}
+
+	syncConfigs, err = db.GetNamespaceSyncTargets(ns)
+	if err != nil {
+		t.Fatalf("Expected no error but get sync targets failed: %v", err)
+	}
+	test.AssertEqual(t, len(syncConfigs), 1)
+	test.AssertEqual(t, syncConfigs[0].CascadeDelete, true)
+}
+
 func TestDeleteSyncConfiguration(t *testing.T) {
 	db, err := SetupDatabaseTest(t)
 	if err != nil {
@@ -372,3 +413,110 @@ func TestDatasetsInANamespace(t *testing.T) {
 	}
 
 }
+
+func TestAcquireSyncLeases(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	// A single instance owns every shard
+	shards, releasing, err := db.AcquireSyncLeases("instance-1", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 4)
+	test.AssertEqual(t, len(releasing), 0)
+
+	// A second instance can't claim any shards until the first releases its excess
+	shards, _, err = db.AcquireSyncLeases("instance-2", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 0)
+
+	// The first instance is asked to release its excess shards, which stay leased to it until it has finished them
+	shards, releasing, err = db.AcquireSyncLeases("instance-1", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 2)
+	test.AssertEqual(t, shards[0], 0)
+	test.AssertEqual(t, shards[1], 1)
+	test.AssertEqual(t, len(releasing), 2)
+	test.AssertEqual(t, releasing[0], 2)
+	test.AssertEqual(t, releasing[1], 3)
+
+	shards, _, err = db.AcquireSyncLeases("instance-2", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 0)
+
+	// Once the first instance has finished one of the shards, it is freed for the second instance
+	shards, releasing, err = db.AcquireSyncLeases("instance-1", 4, time.Minute, []int{3})
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 2)
+	test.AssertEqual(t, len(releasing), 1)
+	test.AssertEqual(t, releasing[0], 2)
+
+	shards, _, err = db.AcquireSyncLeases("instance-2", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 1)
+	test.AssertEqual(t, shards[0], 3)
+
+	// Only the shards the instance was asked to release are freed
+	shards, releasing, err = db.AcquireSyncLeases("instance-1", 4, time.Minute, []int{0, 2})
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 2)
+	test.AssertEqual(t, shards[0], 0)
+	test.AssertEqual(t, len(releasing), 0)
+
+	shards, _, err = db.AcquireSyncLeases("instance-2", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 2)
+	test.AssertEqual(t, shards[0], 2)
+	test.AssertEqual(t, shards[1], 3)
+}
+
+func TestAcquireSyncLeasesExpired(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	shards, _, err := db.AcquireSyncLeases("instance-1", 4, time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 4)
+
+	time.Sleep(10 * time.Millisecond)
+
+	// The first instance has expired, so the second instance takes over all of the shards
+	shards, _, err = db.AcquireSyncLeases("instance-2", 4, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but acquire sync leases failed: %v", err)
+	}
+	test.AssertEqual(t, len(shards), 4)
+}
+
+func TestAcquireSyncLeasesInvalid(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	_, _, err = db.AcquireSyncLeases("instance-1", 0, time.Minute, nil)
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+}
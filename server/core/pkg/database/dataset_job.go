@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+)
+
+type DatasetJobType string
+
+const (
+	// DATASET_JOB_CLONE copies the objects of a dataset into a new dataset
+	DATASET_JOB_CLONE DatasetJobType = "CLONE"
+	// DATASET_JOB_MOVE relocates the objects of a dataset that is being renamed or moved to another namespace
+	DATASET_JOB_MOVE DatasetJobType = "MOVE"
+)
+
+type DatasetJobStatus string
+
+const (
+	DATASET_JOB_PENDING     DatasetJobStatus = "PENDING"
+	DATASET_JOB_IN_PROGRESS DatasetJobStatus = "IN_PROGRESS"
+	DATASET_JOB_COMPLETE    DatasetJobStatus = "COMPLETE"
+	DATASET_JOB_ERROR       DatasetJobStatus = "ERROR"
+)
+
+type DatasetJobPhase string
+
+// datasetJobColumns are the columns of a dataset job that are saved as it runs
+var datasetJobColumns = []string{"status", "phase", "objects_copied", "objects_failed", "bytes_copied", "error", "started", "finished"}
+
+const (
+	// DATASET_JOB_PHASE_COPY copies the objects from the dataset's old location, while the dataset is still read
+	// from it. The dataset is renamed once every object is copied
+	DATASET_JOB_PHASE_COPY DatasetJobPhase = "COPY"
+	// DATASET_JOB_PHASE_SWITCH updates the object store policies and sync targets for the dataset's new location, and
+	// copies the objects written to the old location before it was switched
+	DATASET_JOB_PHASE_SWITCH DatasetJobPhase = "SWITCH"
+	// DATASET_JOB_PHASE_CLEANUP removes the objects and search index documents of the dataset's old location
+	DATASET_JOB_PHASE_CLEANUP DatasetJobPhase = "CLEANUP"
+)
+
+// CreateDatasetJob creates a pending job that copies the objects of a dataset into the target dataset
+func (db *Database) CreateDatasetJob(jobType DatasetJobType, source, target *Dataset, username string) (*DatasetJob, error) {
+	job := &DatasetJob{
+		Type:            string(jobType),
+		Namespace:       source.Namespace.Name,
+		Dataset:         source.Name,
+		TargetNamespace: target.Namespace.Name,
+		TargetDataset:   target.Name,
+		Status:          string(DATASET_JOB_PENDING),
+		CreatedBy:       username,
+		Created:         time.Now().UTC(),
+	}
+	_, err := db.conn.Model(job).Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to create dataset job"))
+	}
+
+	return job, nil
+}
+
+// MoveDataset creates the pending job that relocates a dataset's objects to a new name and namespace. The dataset
+// keeps its name and root directory, and is read from its old location, until the job has copied every object and
+// switches it with SwitchMovedDataset
+// Note: returns ErrExists if the name is already used in the namespace
+func (db *Database) MoveDataset(dataset *Dataset, namespace *Namespace, name, username string) (*DatasetJob, error) {
+	job := &DatasetJob{
+		Type:            string(DATASET_JOB_MOVE),
+		Namespace:       dataset.Namespace.Name,
+		Dataset:         dataset.Name,
+		TargetNamespace: namespace.Name,
+		TargetDataset:   name,
+		Status:          string(DATASET_JOB_PENDING),
+		Phase:           string(DATASET_JOB_PHASE_COPY),
+		CreatedBy:       username,
+		Created:         time.Now().UTC(),
+	}
+
+	err := db.conn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		exists, err := tx.Model((*Dataset)(nil)).
+			Where("namespace_id = ?", namespace.Id).
+			Where("name = ?", name).
+			Exists()
+		if err != nil {
+			return ConvertError(err)
+		}
+		if exists {
+			return ErrExists
+		}
+
+		_, err = tx.Model(job).Insert()
+		if err != nil {
+			return ConvertError(errors.Wrap(err, "failed to create dataset job"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// SwitchMovedDataset renames a dataset and moves it to the target namespace of its move job, once the job has copied
+// every object to the new location. The dataset's root directory follows its name, using the same convention as
+// CreateDataset. The dataset and the job's SWITCH phase are saved in a single transaction, so the dataset is read
+// from its old location until the switch, and a move that fails before it leaves the dataset where it was
+// Note: returns ErrNotFound if the dataset doesn't exist or the job has a different owner, and triggers an update to
+// the LastModified SyncConfigurationMeta timestamp
+func (db *Database) SwitchMovedDataset(job *DatasetJob, dataset *Dataset, namespace *Namespace) error {
+	switched := *job
+	switched.Phase = string(DATASET_JOB_PHASE_SWITCH)
+
+	err := db.conn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		res, err := tx.Model((*Dataset)(nil)).
+			Set("namespace_id = ?", namespace.Id).
+			Set("name = ?", job.TargetDataset).
+			Set("root_directory = ?", job.TargetDataset+"/").
+			Where("id = ?", dataset.Id).
+			Update()
+		if err != nil {
+			return ConvertError(errors.Wrap(err, "failed to move dataset"))
+		}
+		if res.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		res, err = tx.Model(&switched).
+			Column(datasetJobColumns...).
+			WherePK().
+			Where("owner = ?", job.Owner).
+			Update()
+		if err != nil {
+			return ConvertError(err)
+		}
+		if res.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	job.Phase = switched.Phase
+	return nil
+}
+
+// HasActiveDatasetJobs returns true if a job that copies objects from or into a dataset hasn't finished. Move jobs
+// that failed are retried, so they are also active
+func (db *Database) HasActiveDatasetJobs(dataset *Dataset) (bool, error) {
+	count, err := db.conn.Model((*DatasetJob)(nil)).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where("namespace = ? AND dataset = ?", dataset.Namespace.Name, dataset.Name).
+				WhereOr("target_namespace = ? AND target_dataset = ?", dataset.Namespace.Name, dataset.Name)
+			return q, nil
+		}).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where("status IN (?)", pg.In([]DatasetJobStatus{DATASET_JOB_PENDING, DATASET_JOB_IN_PROGRESS})).
+				WhereOr("type = ? AND status = ?", DATASET_JOB_MOVE, DATASET_JOB_ERROR)
+			return q, nil
+		}).
+		Count()
+	if err != nil {
+		return false, ConvertError(err)
+	}
+
+	return count > 0, nil
+}
+
+// GetDatasetJob gets a dataset job by its id
+func (db *Database) GetDatasetJob(id int64) (*DatasetJob, error) {
+	job := &DatasetJob{Id: id}
+	err := db.conn.Model(job).WherePK().Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return job, nil
+}
+
+// ListDatasetJobs lists the jobs that copied objects from or into a dataset, including moves, most recent first, with limit/offset
+// for pagination
+func (db *Database) ListDatasetJobs(dataset *Dataset, limit int, offset int) ([]*DatasetJob, error) {
+	jobs := []*DatasetJob{}
+	err := db.conn.Model(&jobs).
+		WhereOrGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where("namespace = ? AND dataset = ?", dataset.Namespace.Name, dataset.Name).
+				WhereOr("target_namespace = ? AND target_dataset = ?", dataset.Namespace.Name, dataset.Name)
+			return q, nil
+		}).
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return jobs, nil
+}
+
+// GetDatasetJobsByStatus returns the dataset jobs with the given status, oldest first
+func (db *Database) GetDatasetJobsByStatus(status DatasetJobStatus) ([]*DatasetJob, error) {
+	jobs := []*DatasetJob{}
+	err := db.conn.Model(&jobs).Where("status = ?", status).Order("id ASC").Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return jobs, nil
+}
+
+// ClaimDatasetJob starts a pending job for the given owner, in a single statement so a job is only claimed by one
+// core service instance. It returns false if the job is no longer pending, e.g. because another instance claimed it.
+// The job is reloaded when it is claimed, so it has the latest phase and progress
+func (db *Database) ClaimDatasetJob(job *DatasetJob, owner string) (bool, error) {
+	res, err := db.conn.Model(job).
+		Set("status = ?", DATASET_JOB_IN_PROGRESS).
+		Set("owner = ?", owner).
+		Set("heartbeat = now()").
+		Set("started = now()").
+		Set("finished = NULL").
+		Set("error = ''").
+		Where("id = ?", job.Id).
+		Where("status = ?", DATASET_JOB_PENDING).
+		Returning("*").
+		Update()
+	if err == pg.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, ConvertError(err)
+	}
+
+	return res.RowsAffected() > 0, nil
+}
+
+// HeartbeatDatasetJob records that the owner is still running the job. It returns false if the job is no longer
+// running for the owner, e.g. because its heartbeat was stale and it was requeued
+func (db *Database) HeartbeatDatasetJob(job *DatasetJob, owner string) (bool, error) {
+	res, err := db.conn.Model((*DatasetJob)(nil)).
+		Set("heartbeat = now()").
+		Where("id = ?", job.Id).
+		Where("owner = ?", owner).
+		Where("status = ?", DATASET_JOB_IN_PROGRESS).
+		Update()
+	if err != nil {
+		return false, ConvertError(err)
+	}
+
+	return res.RowsAffected() > 0, nil
+}
+
+// RequeueDatasetJobs resets jobs to PENDING so they are run again, returning the number of jobs requeued. This is
+// in progress jobs without a heartbeat for staleAfter, whose owner stopped while running them, and failed move
+// jobs, as a moved dataset may have objects in both its old and new location until its move completes
+func (db *Database) RequeueDatasetJobs(staleAfter time.Duration) (int, error) {
+	res, err := db.conn.Model((*DatasetJob)(nil)).
+		Set("status = ?", DATASET_JOB_PENDING).
+		Set("owner = ''").
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+				q = q.Where("status = ?", DATASET_JOB_IN_PROGRESS).
+					Where("heartbeat IS NULL OR heartbeat < now() - ? * interval '1 millisecond'", staleAfter.Milliseconds())
+				return q, nil
+			}).WhereOrGroup(func(q *orm.Query) (*orm.Query, error) {
+				q = q.Where("type = ?", DATASET_JOB_MOVE).
+					Where("status = ?", DATASET_JOB_ERROR)
+				return q, nil
+			})
+			return q, nil
+		}).
+		Update()
+	if err != nil {
+		return 0, ConvertError(err)
+	}
+
+	return res.RowsAffected(), nil
+}
+
+// UpdateDatasetJob saves the status, phase, and progress of a dataset job. The job is only saved if it is still
+// owned by job.Owner, so an instance that lost a job after its heartbeat went stale can't overwrite the progress of
+// the instance that claimed it next
+// Note: returns ErrNotFound if the job doesn't exist or has a different owner
+func (db *Database) UpdateDatasetJob(job *DatasetJob) error {
+	res, err := db.conn.Model(job).
+		Column(datasetJobColumns...).
+		WherePK().
+		Where("owner = ?", job.Owner).
+		Update()
+	if err != nil {
+		return ConvertError(err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestDatasetJobs(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	source, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	err = db.CreateDataset(ns, "test_clone", "", "test_clone/", "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but create dataset failed: %v", err)
+	}
+	target, err := db.GetDataset(ns, "test_clone")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	job, err := db.CreateDatasetJob(DATASET_JOB_CLONE, source, target, "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but create dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(DATASET_JOB_PENDING))
+	test.AssertEqual(t, job.TargetDataset, "test_clone")
+
+	pending, err := db.GetDatasetJobsByStatus(DATASET_JOB_PENDING)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, len(pending), 1)
+
+	job.Status = string(DATASET_JOB_COMPLETE)
+	job.ObjectsCopied = 10
+	job.BytesCopied = 1024
+	err = db.UpdateDatasetJob(job)
+	if err != nil {
+		t.Fatalf("Expected no error but update dataset job failed: %v", err)
+	}
+
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(DATASET_JOB_COMPLETE))
+	test.AssertEqual(t, job.ObjectsCopied, int64(10))
+	test.AssertEqual(t, job.BytesCopied, int64(1024))
+
+	// Jobs are listed for both the source and the target dataset
+	jobs, err := db.ListDatasetJobs(source, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, len(jobs), 1)
+
+	jobs, err = db.ListDatasetJobs(target, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, len(jobs), 1)
+	test.AssertEqual(t, jobs[0].Id, job.Id)
+}
+
+func TestMoveDataset(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	dataset, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	err = db.CreateDataset(ns, "test_existing", "", "test_existing/", "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but create dataset failed: %v", err)
+	}
+
+	// The name is already used in the namespace
+	_, err = db.MoveDataset(dataset, ns, "test_existing", "test_user")
+	test.AssertEqual(t, err, ErrExists)
+
+	job, err := db.MoveDataset(dataset, ns, "test_moved", "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but move dataset failed: %v", err)
+	}
+	test.AssertEqual(t, job.Type, string(DATASET_JOB_MOVE))
+	test.AssertEqual(t, job.Phase, string(DATASET_JOB_PHASE_COPY))
+	test.AssertEqual(t, job.Dataset, "test_dataset")
+	test.AssertEqual(t, job.TargetDataset, "test_moved")
+
+	// The dataset keeps its name and location until its objects are copied
+	assertNotMoved := func() {
+		t.Helper()
+		current, err := db.GetDataset(ns, "test_dataset")
+		if err != nil {
+			t.Fatal("Failed to get dataset")
+		}
+		test.AssertEqual(t, current.RootDirectory, "test_dataset/")
+		_, err = db.GetDataset(ns, "test_moved")
+		test.AssertEqual(t, err, ErrNotFound)
+	}
+	assertNotMoved()
+
+	// Both names are used by the move
+	for _, name := range []string{"test_dataset", "test_moved"} {
+		active, err := db.HasActiveDatasetJobs(&Dataset{Name: name, Namespace: ns})
+		if err != nil {
+			t.Fatalf("Expected no error but checking dataset jobs failed: %v", err)
+		}
+		test.AssertEqual(t, active, true)
+	}
+
+	// Failed moves are retried, so they are still active, and the dataset stays where it was
+	job.Status = string(DATASET_JOB_ERROR)
+	err = db.UpdateDatasetJob(job)
+	if err != nil {
+		t.Fatalf("Expected no error but update dataset job failed: %v", err)
+	}
+	active, err := db.HasActiveDatasetJobs(dataset)
+	if err != nil {
+		t.Fatalf("Expected no error but checking dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, active, true)
+	assertNotMoved()
+
+	requeued, err := db.RequeueDatasetJobs(time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error but requeue dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, requeued, 1)
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(DATASET_JOB_PENDING))
+
+	// Only the instance running the job switches the dataset
+	claimed, err := db.ClaimDatasetJob(job, "instance-a")
+	if err != nil {
+		t.Fatalf("Expected no error but claim dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, claimed, true)
+	other := *job
+	other.Owner = "instance-b"
+	err = db.SwitchMovedDataset(&other, dataset, ns)
+	test.AssertEqual(t, err, ErrNotFound)
+	test.AssertEqual(t, other.Phase, string(DATASET_JOB_PHASE_COPY))
+	assertNotMoved()
+
+	err = db.SwitchMovedDataset(job, dataset, ns)
+	if err != nil {
+		t.Fatalf("Expected no error but switch moved dataset failed: %v", err)
+	}
+	test.AssertEqual(t, job.Phase, string(DATASET_JOB_PHASE_SWITCH))
+
+	_, err = db.GetDataset(ns, "test_dataset")
+	test.AssertEqual(t, err, ErrNotFound)
+
+	moved, err := db.GetDataset(ns, "test_moved")
+	if err != nil {
+		t.Fatal("Failed to get moved dataset")
+	}
+	test.AssertEqual(t, moved.Id, dataset.Id)
+	test.AssertEqual(t, moved.RootDirectory, "test_moved/")
+
+	saved, err := db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, saved.Phase, string(DATASET_JOB_PHASE_SWITCH))
+
+	job.Status = string(DATASET_JOB_COMPLETE)
+	err = db.UpdateDatasetJob(job)
+	if err != nil {
+		t.Fatalf("Expected no error but update dataset job failed: %v", err)
+	}
+	active, err = db.HasActiveDatasetJobs(moved)
+	if err != nil {
+		t.Fatalf("Expected no error but checking dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, active, false)
+}
+
+func TestClaimDatasetJob(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	source, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+	err = db.CreateDataset(ns, "test_clone", "", "test_clone/", "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but create dataset failed: %v", err)
+	}
+	target, err := db.GetDataset(ns, "test_clone")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	job, err := db.CreateDatasetJob(DATASET_JOB_CLONE, source, target, "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but create dataset job failed: %v", err)
+	}
+	other, err := db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+
+	// Only the first instance to claim a pending job runs it
+	claimed, err := db.ClaimDatasetJob(job, "instance-a")
+	if err != nil {
+		t.Fatalf("Expected no error but claim dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, claimed, true)
+	test.AssertEqual(t, job.Status, string(DATASET_JOB_IN_PROGRESS))
+	test.AssertEqual(t, job.Owner, "instance-a")
+	test.AssertEqual(t, job.Started != nil, true)
+
+	claimed, err = db.ClaimDatasetJob(other, "instance-b")
+	if err != nil {
+		t.Fatalf("Expected no error but claim dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, claimed, false)
+
+	running, err := db.HeartbeatDatasetJob(job, "instance-a")
+	if err != nil {
+		t.Fatalf("Expected no error but heartbeat failed: %v", err)
+	}
+	test.AssertEqual(t, running, true)
+	running, err = db.HeartbeatDatasetJob(job, "instance-b")
+	if err != nil {
+		t.Fatalf("Expected no error but heartbeat failed: %v", err)
+	}
+	test.AssertEqual(t, running, false)
+
+	// Running jobs with a recent heartbeat are not requeued
+	requeued, err := db.RequeueDatasetJobs(time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error but requeue dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, requeued, 0)
+
+	// Once the heartbeat is stale the job is requeued, and the instance that lost it can't save its progress
+	time.Sleep(10 * time.Millisecond)
+	requeued, err = db.RequeueDatasetJobs(time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected no error but requeue dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, requeued, 1)
+
+	job.ObjectsCopied = 10
+	err = db.UpdateDatasetJob(job)
+	test.AssertEqual(t, err, ErrNotFound)
+
+	running, err = db.HeartbeatDatasetJob(job, "instance-a")
+	if err != nil {
+		t.Fatalf("Expected no error but heartbeat failed: %v", err)
+	}
+	test.AssertEqual(t, running, false)
+
+	claimed, err = db.ClaimDatasetJob(other, "instance-b")
+	if err != nil {
+		t.Fatalf("Expected no error but claim dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, claimed, true)
+	test.AssertEqual(t, other.Owner, "instance-b")
+	test.AssertEqual(t, other.ObjectsCopied, int64(0))
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type IndexJobStatus string
+
+const (
+	INDEX_JOB_PENDING     IndexJobStatus = "PENDING"
+	INDEX_JOB_IN_PROGRESS IndexJobStatus = "IN_PROGRESS"
+	INDEX_JOB_COMPLETE    IndexJobStatus = "COMPLETE"
+	INDEX_JOB_ERROR       IndexJobStatus = "ERROR"
+)
+
+// CreateIndexJob creates a pending search index rebuild job. If namespaceName is set the job is limited to
+// the namespace, and if datasetName is also set the job is limited to the dataset
+func (db *Database) CreateIndexJob(namespaceName, datasetName string) (*IndexJob, error) {
+	if datasetName != "" && namespaceName == "" {
+		return nil, ErrInvalidInput
+	}
+
+	job := &IndexJob{
+		Namespace: namespaceName,
+		Dataset:   datasetName,
+		Status:    string(INDEX_JOB_PENDING),
+		Created:   time.Now().UTC(),
+	}
+	_, err := db.conn.Model(job).Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to create index job"))
+	}
+
+	return job, nil
+}
+
+// CreateIndexVersionJob creates a pending rebuild job for the whole index after the metadata index is migrated to a
+// new version. Only one job is created for each version, so it returns false if the version already has a job
+func (db *Database) CreateIndexVersionJob(version int) (bool, error) {
+	job := &IndexJob{
+		Status:       string(INDEX_JOB_PENDING),
+		IndexVersion: version,
+		Created:      time.Now().UTC(),
+	}
+	result, err := db.conn.Model(job).
+		OnConflict("(index_version) WHERE index_version > 0 DO NOTHING").
+		Insert()
+	if err != nil {
+		return false, ConvertError(errors.Wrap(err, "failed to create index version job"))
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// GetIndexJob gets a search index rebuild job by its id
+func (db *Database) GetIndexJob(id int64) (*IndexJob, error) {
+	job := &IndexJob{Id: id}
+	err := db.conn.Model(job).WherePK().Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return job, nil
+}
+
+// ListIndexJobs lists search index rebuild jobs, most recent first, with limit/offset for pagination
+func (db *Database) ListIndexJobs(limit int, offset int) ([]*IndexJob, error) {
+	jobs := []*IndexJob{}
+	err := db.conn.Model(&jobs).Order("id DESC").Limit(limit).Offset(offset).Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return jobs, nil
+}
+
+// GetIndexJobsByStatus returns the search index rebuild jobs with the given status, oldest first
+func (db *Database) GetIndexJobsByStatus(status IndexJobStatus) ([]*IndexJob, error) {
+	jobs := []*IndexJob{}
+	err := db.conn.Model(&jobs).Where("status = ?", status).Order("id ASC").Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return jobs, nil
+}
+
+// UpdateIndexJob saves the status and progress of a search index rebuild job
+func (db *Database) UpdateIndexJob(job *IndexJob) error {
+	_, err := db.conn.Model(job).
+		Column("status", "datasets_total", "datasets_complete", "objects_indexed", "objects_failed",
+			"documents_deleted", "error", "started", "finished").
+		WherePK().
+		Update()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestCreateIndexJob(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	job, err := db.CreateIndexJob("test_namespace", "test_dataset")
+	if err != nil {
+		t.Fatalf("Expected no error but create index job failed: %v", err)
+	}
+
+	loaded, err := db.GetIndexJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get index job failed: %v", err)
+	}
+
+	test.AssertEqual(t, loaded.Namespace, "test_namespace")
+	test.AssertEqual(t, loaded.Dataset, "test_dataset")
+	test.AssertEqual(t, loaded.Status, string(INDEX_JOB_PENDING))
+	if loaded.Started != nil || loaded.Finished != nil {
+		t.Fatal("Expected a pending job to not have started or finished")
+	}
+
+	pending, err := db.GetIndexJobsByStatus(INDEX_JOB_PENDING)
+	if err != nil {
+		t.Fatalf("Expected no error but get index jobs by status failed: %v", err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Expected one pending job but got %d", len(pending))
+	}
+}
+
+func TestCreateIndexJobInvalid(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	_, err = db.CreateIndexJob("", "test_dataset")
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error when the dataset is set without the namespace but got: %v", err)
+	}
+}
+
+func TestCreateIndexVersionJob(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	created, err := db.CreateIndexVersionJob(2)
+	if err != nil {
+		t.Fatalf("Expected no error but create index version job failed: %v", err)
+	}
+	test.AssertEqual(t, created, true)
+
+	// every core service instance tries to create the job, only the first one does
+	created, err = db.CreateIndexVersionJob(2)
+	if err != nil {
+		t.Fatalf("Expected no error but create index version job failed: %v", err)
+	}
+	test.AssertEqual(t, created, false)
+
+	// jobs that aren't for a version aren't limited
+	_, err = db.CreateIndexJob("", "")
+	if err != nil {
+		t.Fatalf("Expected no error but create index job failed: %v", err)
+	}
+	_, err = db.CreateIndexJob("", "")
+	if err != nil {
+		t.Fatalf("Expected no error but create index job failed: %v", err)
+	}
+
+	pending, err := db.GetIndexJobsByStatus(INDEX_JOB_PENDING)
+	if err != nil {
+		t.Fatalf("Expected no error but get index jobs by status failed: %v", err)
+	}
+	test.AssertEqual(t, len(pending), 3)
+	test.AssertEqual(t, pending[0].IndexVersion, 2)
+	test.AssertEqual(t, pending[0].Namespace, "")
+	test.AssertEqual(t, pending[0].Dataset, "")
+}
+
+func TestUpdateIndexJob(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	job, err := db.CreateIndexJob("", "")
+	if err != nil {
+		t.Fatalf("Expected no error but create index job failed: %v", err)
+	}
+
+	now := time.Now().UTC()
+	job.Status = string(INDEX_JOB_COMPLETE)
+	job.DatasetsTotal = 2
+	job.DatasetsComplete = 2
+	job.ObjectsIndexed = 10
+	job.DocumentsDeleted = 1
+	job.Started = &now
+	job.Finished = &now
+	if err := db.UpdateIndexJob(job); err != nil {
+		t.Fatalf("Expected no error but update index job failed: %v", err)
+	}
+
+	jobs, err := db.ListIndexJobs(10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list index jobs failed: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected one job but got %d", len(jobs))
+	}
+
+	test.AssertEqual(t, jobs[0].Status, string(INDEX_JOB_COMPLETE))
+	test.AssertEqual(t, jobs[0].DatasetsComplete, 2)
+	test.AssertEqual(t, jobs[0].ObjectsIndexed, int64(10))
+	test.AssertEqual(t, jobs[0].DocumentsDeleted, int64(1))
+	if jobs[0].Finished == nil {
+		t.Fatal("Expected the job to have a finished time")
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validMetadataTypes are the types a metadata key can be declared as
+var validMetadataTypes = map[string]bool{
+	METADATA_TYPE_STRING:  true,
+	METADATA_TYPE_NUMBER:  true,
+	METADATA_TYPE_DATE:    true,
+	METADATA_TYPE_BOOLEAN: true,
+}
+
+// GetMetadataSchema gets the metadata schema for a dataset
+// Note: returns ErrNotFound if the dataset doesn't have a schema
+func (db *Database) GetMetadataSchema(dataset *Dataset) (*MetadataSchema, error) {
+	schema := &MetadataSchema{DatasetId: dataset.Id}
+	err := db.conn.Model(schema).WherePK().Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return schema, nil
+}
+
+// GetMetadataSchemaByLocation gets the metadata schema for the dataset stored in the given object store, bucket, and
+// root directory (without the '/'), which are the values used in the search index to identify a dataset
+// Note: returns ErrNotFound if the dataset doesn't exist or doesn't have a schema
+func (db *Database) GetMetadataSchemaByLocation(objectStoreName, bucketName, rootDirectory string) (*MetadataSchema, error) {
+	schema := &MetadataSchema{}
+	err := db.conn.Model(schema).
+		Join(`JOIN datasets AS d ON d.id = "metadata_schema"."dataset_id"`).
+		Join(`JOIN namespaces AS ns ON ns.id = d.namespace_id`).
+		Join(`JOIN object_stores AS os ON os.id = ns.object_store_id`).
+		Where(`os.name = ?`, objectStoreName).
+		Where(`ns.bucket_name = ?`, bucketName).
+		Where(`regexp_replace(d.root_directory, '/', '') = ?`, rootDirectory).
+		Limit(1).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return schema, nil
+}
+
+// Validate checks that the schema's types, allowed values, and patterns are valid
+func (ms *MetadataSchema) Validate() error {
+	for key, t := range ms.Types {
+		if key == "" || !validMetadataTypes[t] {
+			return errors.New(fmt.Sprintf("the type of key `%s` must be one of 'string', 'number', 'date', or 'boolean'", key))
+		}
+	}
+	for _, key := range ms.Required {
+		if key == "" {
+			return errors.New("required keys can't be empty")
+		}
+	}
+	for key, values := range ms.AllowedValues {
+		if key == "" || len(values) == 0 {
+			return errors.New(fmt.Sprintf("the allowed values of key `%s` can't be empty", key))
+		}
+	}
+	for key, pattern := range ms.Patterns {
+		if key == "" {
+			return errors.New("pattern keys can't be empty")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.New(fmt.Sprintf("the pattern of key `%s` is not a valid regular expression: %s", key, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// SetMetadataSchema creates or replaces the metadata schema for a dataset
+// Note: returns ErrInvalidInput if the schema isn't valid
+func (db *Database) SetMetadataSchema(dataset *Dataset, schema *MetadataSchema) (*MetadataSchema, error) {
+	if err := schema.Validate(); err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	schema.DatasetId = dataset.Id
+	schema.Updated = time.Now().UTC()
+	if schema.Types == nil {
+		schema.Types = map[string]string{}
+	}
+	if schema.Required == nil {
+		schema.Required = []string{}
+	}
+	if schema.AllowedValues == nil {
+		schema.AllowedValues = map[string][]string{}
+	}
+	if schema.Patterns == nil {
+		schema.Patterns = map[string]string{}
+	}
+
+	_, err := db.conn.Model(schema).
+		OnConflict("(dataset_id) DO UPDATE").
+		Set("types = EXCLUDED.types").
+		Set("required = EXCLUDED.required").
+		Set("allowed_values = EXCLUDED.allowed_values").
+		Set("patterns = EXCLUDED.patterns").
+		Set("enforce = EXCLUDED.enforce").
+		Set("updated = EXCLUDED.updated").
+		Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to set metadata schema"))
+	}
+
+	return schema, nil
+}
+
+// DeleteMetadataSchema removes the metadata schema for a dataset
+// Note: there is no error if the dataset doesn't have a schema
+func (db *Database) DeleteMetadataSchema(dataset *Dataset) error {
+	_, err := db.conn.Model((*MetadataSchema)(nil)).
+		Where("dataset_id = ?", dataset.Id).
+		Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
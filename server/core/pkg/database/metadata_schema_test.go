@@ -0,0 +1,104 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestSetMetadataSchema(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	_, err = db.GetMetadataSchema(ds)
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	_, err = db.SetMetadataSchema(ds, &MetadataSchema{Types: map[string]string{"exposure_ms": METADATA_TYPE_NUMBER}})
+	if err != nil {
+		t.Fatalf("Expected no error but set metadata schema failed: %v", err)
+	}
+
+	// Setting the schema again replaces it
+	_, err = db.SetMetadataSchema(ds, &MetadataSchema{
+		Types:         map[string]string{"acquired": METADATA_TYPE_DATE, "subject": METADATA_TYPE_STRING},
+		Required:      []string{"subject"},
+		AllowedValues: map[string][]string{"species": {"mouse", "rat"}},
+		Patterns:      map[string]string{"subject": "^S[0-9]+$"},
+		Enforce:       true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but set metadata schema failed: %v", err)
+	}
+
+	schema, err := db.GetMetadataSchema(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but get metadata schema failed: %v", err)
+	}
+	test.AssertEqual(t, len(schema.Types), 2)
+	test.AssertEqual(t, schema.Types["acquired"], METADATA_TYPE_DATE)
+	test.AssertEqual(t, schema.Types["subject"], METADATA_TYPE_STRING)
+	test.AssertEqual(t, len(schema.Required), 1)
+	test.AssertEqual(t, len(schema.AllowedValues["species"]), 2)
+	test.AssertEqual(t, schema.Patterns["subject"], "^S[0-9]+$")
+	test.AssertEqual(t, schema.Enforce, true)
+
+	schema, err = db.GetMetadataSchemaByLocation("default", "data", "test_dataset")
+	if err != nil {
+		t.Fatalf("Expected no error but get metadata schema by location failed: %v", err)
+	}
+	test.AssertEqual(t, schema.DatasetId, ds.Id)
+
+	err = db.DeleteMetadataSchema(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but delete metadata schema failed: %v", err)
+	}
+
+	_, err = db.GetMetadataSchemaByLocation("default", "data", "test_dataset")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+}
+
+func TestSetMetadataSchemaInvalid(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	_, err = db.SetMetadataSchema(ds, &MetadataSchema{Types: map[string]string{"exposure_ms": "integer"}})
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+
+	_, err = db.SetMetadataSchema(ds, &MetadataSchema{Patterns: map[string]string{"subject": "S[0-9"}})
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+
+	_, err = db.SetMetadataSchema(ds, &MetadataSchema{AllowedValues: map[string][]string{"species": {}}})
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GetMetadataSidecar gets the metadata sidecar declaration for a dataset
+// Note: returns ErrNotFound if the dataset doesn't have sidecar files
+func (db *Database) GetMetadataSidecar(dataset *Dataset) (*MetadataSidecar, error) {
+	sidecar := &MetadataSidecar{DatasetId: dataset.Id}
+	err := db.conn.Model(sidecar).WherePK().Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return sidecar, nil
+}
+
+// GetMetadataSidecarByLocation gets the metadata sidecar declaration for the dataset stored in the given object
+// store, bucket, and root directory (without the '/'), which are the values used in the search index to identify
+// a dataset
+// Note: returns ErrNotFound if the dataset doesn't exist or doesn't have sidecar files
+func (db *Database) GetMetadataSidecarByLocation(objectStoreName, bucketName, rootDirectory string) (*MetadataSidecar, error) {
+	sidecar := &MetadataSidecar{}
+	err := db.conn.Model(sidecar).
+		Join(`JOIN datasets AS d ON d.id = "metadata_sidecar"."dataset_id"`).
+		Join(`JOIN namespaces AS ns ON ns.id = d.namespace_id`).
+		Join(`JOIN object_stores AS os ON os.id = ns.object_store_id`).
+		Where(`os.name = ?`, objectStoreName).
+		Where(`ns.bucket_name = ?`, bucketName).
+		Where(`regexp_replace(d.root_directory, '/', '') = ?`, rootDirectory).
+		Limit(1).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return sidecar, nil
+}
+
+// SetMetadataSidecar creates or replaces the metadata sidecar declaration for a dataset
+// Note: returns ErrInvalidInput if there are no suffixes, or a suffix is empty or contains a '/'
+func (db *Database) SetMetadataSidecar(dataset *Dataset, suffixes []string) (*MetadataSidecar, error) {
+	if len(suffixes) == 0 {
+		return nil, ErrInvalidInput
+	}
+	for _, suffix := range suffixes {
+		if suffix == "" || strings.Contains(suffix, "/") {
+			return nil, ErrInvalidInput
+		}
+	}
+
+	sidecar := &MetadataSidecar{
+		DatasetId: dataset.Id,
+		Suffixes:  suffixes,
+		Updated:   time.Now().UTC(),
+	}
+	_, err := db.conn.Model(sidecar).
+		OnConflict("(dataset_id) DO UPDATE").
+		Set("suffixes = EXCLUDED.suffixes").
+		Set("updated = EXCLUDED.updated").
+		Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to set metadata sidecar"))
+	}
+
+	return sidecar, nil
+}
+
+// DeleteMetadataSidecar removes the metadata sidecar declaration for a dataset
+// Note: there is no error if the dataset doesn't have sidecar files
+func (db *Database) DeleteMetadataSidecar(dataset *Dataset) error {
+	_, err := db.conn.Model((*MetadataSidecar)(nil)).
+		Where("dataset_id = ?", dataset.Id).
+		Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
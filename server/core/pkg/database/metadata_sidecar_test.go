@@ -0,0 +1,89 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestSetMetadataSidecar(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	_, err = db.GetMetadataSidecar(ds)
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	_, err = db.SetMetadataSidecar(ds, []string{".meta.json"})
+	if err != nil {
+		t.Fatalf("Expected no error but set metadata sidecar failed: %v", err)
+	}
+
+	// Setting the sidecar suffixes again replaces them
+	_, err = db.SetMetadataSidecar(ds, []string{".meta.yaml", ".meta.yml"})
+	if err != nil {
+		t.Fatalf("Expected no error but set metadata sidecar failed: %v", err)
+	}
+
+	sidecar, err := db.GetMetadataSidecar(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but get metadata sidecar failed: %v", err)
+	}
+	test.AssertEqual(t, len(sidecar.Suffixes), 2)
+	test.AssertEqual(t, sidecar.Suffixes[0], ".meta.yaml")
+	test.AssertEqual(t, sidecar.Suffixes[1], ".meta.yml")
+
+	sidecar, err = db.GetMetadataSidecarByLocation("default", "data", "test_dataset")
+	if err != nil {
+		t.Fatalf("Expected no error but get metadata sidecar by location failed: %v", err)
+	}
+	test.AssertEqual(t, sidecar.DatasetId, ds.Id)
+
+	err = db.DeleteMetadataSidecar(ds)
+	if err != nil {
+		t.Fatalf("Expected no error but delete metadata sidecar failed: %v", err)
+	}
+
+	_, err = db.GetMetadataSidecarByLocation("default", "data", "test_dataset")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+}
+
+func TestSetMetadataSidecarInvalid(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	_, err = db.SetMetadataSidecar(ds, []string{})
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+
+	_, err = db.SetMetadataSidecar(ds, []string{"meta/info.json"})
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+}
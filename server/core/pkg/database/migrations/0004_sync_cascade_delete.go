@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0004() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// The existing sync_configuration_updated trigger fires on any UPDATE of sync_configurations,
+		// so toggling this column will cause the sync service to reload its configuration
+		fmt.Println("Altering table sync_configurations (adding column cascade_delete) ...")
+		_, err := db.Exec(`ALTER TABLE sync_configurations
+			ADD COLUMN cascade_delete boolean NOT NULL DEFAULT false
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Altering table sync_configurations (dropping column cascade_delete) ...")
+		_, err := db.Exec(`ALTER TABLE sync_configurations
+			DROP COLUMN IF EXISTS cascade_delete
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
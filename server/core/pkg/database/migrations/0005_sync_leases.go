@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0005() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		fmt.Println("Creating table sync_instances...")
+		_, err := db.Exec(`CREATE TABLE sync_instances (
+			instance_id text PRIMARY KEY,
+			expires_at timestamptz NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		// Leases are removed with the instance that owns them, so expiring an instance releases its shards
+		fmt.Println("Creating table sync_leases...")
+		_, err = db.Exec(`CREATE TABLE sync_leases (
+			shard integer PRIMARY KEY,
+			instance_id text NOT NULL REFERENCES sync_instances(instance_id) ON DELETE CASCADE
+		)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping table sync_leases...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS sync_leases`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Dropping table sync_instances...")
+		_, err = db.Exec(`DROP TABLE IF EXISTS sync_instances`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0006() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		fmt.Println("Creating table metadata_schemas...")
+		_, err := db.Exec(`CREATE TABLE metadata_schemas (
+			dataset_id bigint PRIMARY KEY REFERENCES datasets ON DELETE CASCADE,
+			types jsonb NOT NULL DEFAULT '{}',
+			updated timestamptz NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping table metadata_schemas...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS metadata_schemas`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0007() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// Jobs reference the namespace and dataset by name, so the job history is kept if they are deleted
+		fmt.Println("Creating table index_jobs...")
+		_, err := db.Exec(`CREATE TABLE index_jobs (
+			id bigserial PRIMARY KEY,
+			namespace text NOT NULL DEFAULT '',
+			dataset text NOT NULL DEFAULT '',
+			status text NOT NULL,
+			datasets_total integer NOT NULL DEFAULT 0,
+			datasets_complete integer NOT NULL DEFAULT 0,
+			objects_indexed bigint NOT NULL DEFAULT 0,
+			objects_failed bigint NOT NULL DEFAULT 0,
+			documents_deleted bigint NOT NULL DEFAULT 0,
+			error text NOT NULL DEFAULT '',
+			created timestamptz NOT NULL,
+			started timestamptz,
+			finished timestamptz
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX index_jobs_status_idx ON index_jobs (status)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping table index_jobs...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS index_jobs`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0009() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		fmt.Println("Adding validation rules to table metadata_schemas...")
+		_, err := db.Exec(`ALTER TABLE metadata_schemas
+			ADD COLUMN required text[] NOT NULL DEFAULT '{}',
+			ADD COLUMN allowed_values jsonb NOT NULL DEFAULT '{}',
+			ADD COLUMN patterns jsonb NOT NULL DEFAULT '{}',
+			ADD COLUMN enforce boolean NOT NULL DEFAULT false`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Removing validation rules from table metadata_schemas...")
+		_, err := db.Exec(`ALTER TABLE metadata_schemas
+			DROP COLUMN IF EXISTS required,
+			DROP COLUMN IF EXISTS allowed_values,
+			DROP COLUMN IF EXISTS patterns,
+			DROP COLUMN IF EXISTS enforce`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
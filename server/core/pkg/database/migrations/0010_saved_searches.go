@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0010() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		fmt.Println("Creating table saved_searches...")
+		_, err := db.Exec(`CREATE TABLE saved_searches (
+			id bigserial PRIMARY KEY,
+			owner_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+			name text NOT NULL,
+			description text NOT NULL DEFAULT '',
+			parameters jsonb NOT NULL DEFAULT '{}',
+			created timestamptz NOT NULL,
+			updated timestamptz NOT NULL,
+			UNIQUE (owner_id, name)
+		)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating table saved_search_shares...")
+		_, err = db.Exec(`CREATE TABLE saved_search_shares (
+			saved_search_id bigint NOT NULL REFERENCES saved_searches ON DELETE CASCADE,
+			group_id bigint NOT NULL REFERENCES groups ON DELETE CASCADE,
+			PRIMARY KEY (saved_search_id, group_id)
+		)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating table search_subscriptions...")
+		_, err = db.Exec(`CREATE TABLE search_subscriptions (
+			id bigserial PRIMARY KEY,
+			saved_search_id bigint NOT NULL REFERENCES saved_searches ON DELETE CASCADE,
+			user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+			webhook_url text NOT NULL DEFAULT '',
+			created timestamptz NOT NULL,
+			UNIQUE (saved_search_id, user_id)
+		)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating table search_notifications...")
+		_, err = db.Exec(`CREATE TABLE search_notifications (
+			id bigserial PRIMARY KEY,
+			subscription_id bigint NOT NULL REFERENCES search_subscriptions ON DELETE CASCADE,
+			namespace text NOT NULL,
+			dataset text NOT NULL,
+			file_path text NOT NULL,
+			last_modified_date text NOT NULL DEFAULT '',
+			created timestamptz NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX search_notifications_subscription_idx ON search_notifications (subscription_id, id)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX search_notifications_created_idx ON search_notifications (created)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping saved search tables...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS search_notifications, search_subscriptions, saved_search_shares, saved_searches`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
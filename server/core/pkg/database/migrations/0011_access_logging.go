@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0011() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		fmt.Println("Creating table access_logging...")
+		_, err := db.Exec(`CREATE TABLE access_logging (
+			dataset_id bigint PRIMARY KEY REFERENCES datasets ON DELETE CASCADE,
+			created timestamptz NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating table object_accesses...")
+		_, err = db.Exec(`CREATE TABLE object_accesses (
+			id bigserial PRIMARY KEY,
+			dataset_id bigint NOT NULL REFERENCES datasets ON DELETE CASCADE,
+			file_path text NOT NULL,
+			username text NOT NULL,
+			accessed timestamptz NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX object_accesses_dataset_idx ON object_accesses (dataset_id, accessed)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX object_accesses_file_path_idx ON object_accesses (dataset_id, file_path, accessed)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating table sts_sessions...")
+		_, err = db.Exec(`CREATE TABLE sts_sessions (
+			access_key_id text PRIMARY KEY,
+			user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+			expiration timestamptz NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX sts_sessions_user_idx ON sts_sessions (user_id, expiration)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping access logging tables...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS sts_sessions, object_accesses, access_logging`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0012() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		fmt.Println("Creating table dataset_snapshots...")
+		_, err := db.Exec(`CREATE TABLE dataset_snapshots (
+			id bigserial PRIMARY KEY,
+			dataset_id bigint NOT NULL REFERENCES datasets ON DELETE CASCADE,
+			name text NOT NULL,
+			description text NOT NULL DEFAULT '',
+			created_by_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+			created timestamptz NOT NULL,
+			object_count bigint NOT NULL DEFAULT 0,
+			total_bytes bigint NOT NULL DEFAULT 0,
+			UNIQUE (dataset_id, name)
+		)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating table snapshot_objects...")
+		_, err = db.Exec(`CREATE TABLE snapshot_objects (
+			snapshot_id bigint NOT NULL REFERENCES dataset_snapshots ON DELETE CASCADE,
+			file_path text NOT NULL,
+			version_id text NOT NULL,
+			etag text NOT NULL DEFAULT '',
+			size bigint NOT NULL DEFAULT 0,
+			PRIMARY KEY (snapshot_id, file_path)
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX snapshot_objects_version_idx ON snapshot_objects (file_path, version_id)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping dataset snapshot tables...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS snapshot_objects, dataset_snapshots`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0013() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// Jobs reference the namespaces and datasets by name, so the job history is kept if they are deleted
+		fmt.Println("Creating table dataset_jobs...")
+		_, err := db.Exec(`CREATE TABLE dataset_jobs (
+			id bigserial PRIMARY KEY,
+			type text NOT NULL,
+			namespace text NOT NULL,
+			dataset text NOT NULL,
+			target_namespace text NOT NULL,
+			target_dataset text NOT NULL,
+			status text NOT NULL,
+			objects_copied bigint NOT NULL DEFAULT 0,
+			objects_failed bigint NOT NULL DEFAULT 0,
+			bytes_copied bigint NOT NULL DEFAULT 0,
+			error text NOT NULL DEFAULT '',
+			created_by text NOT NULL,
+			created timestamptz NOT NULL,
+			started timestamptz,
+			finished timestamptz
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX dataset_jobs_status_idx ON dataset_jobs (status)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX dataset_jobs_dataset_idx ON dataset_jobs (namespace, dataset)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`CREATE INDEX dataset_jobs_target_idx ON dataset_jobs (target_namespace, target_dataset)`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping table dataset_jobs...")
+		_, err := db.Exec(`DROP TABLE IF EXISTS dataset_jobs`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0014() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// Move jobs run in phases, so an interrupted move resumes from the phase it was in
+		fmt.Println("Adding column dataset_jobs.phase...")
+		_, err := db.Exec(`ALTER TABLE dataset_jobs ADD COLUMN phase text NOT NULL DEFAULT ''`)
+		if err != nil {
+			return err
+		}
+
+		// The sync service matches objects to datasets by their root directory, so moving a dataset must also
+		// update the sync configuration timestamp for the sync service to reload its configuration
+		fmt.Println("Recreating trigger dataset_sync_updated...")
+		_, err = db.Exec(`DROP TRIGGER IF EXISTS dataset_sync_updated ON datasets`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`CREATE TRIGGER dataset_sync_updated
+			AFTER UPDATE OF sync_enabled, namespace_id, name, root_directory OR DELETE ON datasets
+			FOR EACH ROW EXECUTE PROCEDURE sync_configuration_updated()
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Recreating trigger dataset_sync_updated...")
+		_, err := db.Exec(`DROP TRIGGER IF EXISTS dataset_sync_updated ON datasets`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`CREATE TRIGGER dataset_sync_updated
+			AFTER UPDATE OF sync_enabled OR DELETE ON datasets
+			FOR EACH ROW EXECUTE PROCEDURE sync_configuration_updated()
+		`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Dropping column dataset_jobs.phase...")
+		_, err = db.Exec(`ALTER TABLE dataset_jobs DROP COLUMN IF EXISTS phase`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
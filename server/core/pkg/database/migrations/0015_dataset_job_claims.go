@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0015() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// Jobs are claimed by the core service instance that runs them, which records a heartbeat while the job
+		// runs. Jobs whose heartbeat stops are requeued, so a job is only run by one instance at a time
+		fmt.Println("Adding columns dataset_jobs.owner and dataset_jobs.heartbeat...")
+		_, err := db.Exec(`ALTER TABLE dataset_jobs ADD COLUMN owner text NOT NULL DEFAULT ''`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`ALTER TABLE dataset_jobs ADD COLUMN heartbeat timestamptz`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping columns dataset_jobs.owner and dataset_jobs.heartbeat...")
+		_, err := db.Exec(`ALTER TABLE dataset_jobs DROP COLUMN IF EXISTS heartbeat`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`ALTER TABLE dataset_jobs DROP COLUMN IF EXISTS owner`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
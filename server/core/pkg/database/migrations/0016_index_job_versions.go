@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+func Register0016() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// A rebuild of the whole index is run once for each metadata index version, after the alias is switched to
+		// it. The unique index makes sure only one rebuild is created no matter how many instances see the switch
+		fmt.Println("Adding column index_jobs.index_version...")
+		_, err := db.Exec(`ALTER TABLE index_jobs ADD COLUMN index_version integer NOT NULL DEFAULT 0`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`CREATE UNIQUE INDEX index_jobs_index_version_idx ON index_jobs (index_version) WHERE index_version > 0`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		fmt.Println("Dropping column index_jobs.index_version...")
+		_, err := db.Exec(`DROP INDEX IF EXISTS index_jobs_index_version_idx`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`ALTER TABLE index_jobs DROP COLUMN IF EXISTS index_version`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
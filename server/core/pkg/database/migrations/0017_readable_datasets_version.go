@@ -0,0 +1,90 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/migrations/v8"
+)
+
+// readableDatasetsTriggers are the changes that can change the datasets a user can read, or where their objects are
+var readableDatasetsTriggers = []struct {
+	name  string
+	table string
+	event string
+}{
+	{"permissions_readable_datasets", "permissions", "INSERT OR UPDATE OR DELETE"},
+	{"memberships_readable_datasets", "memberships", "INSERT OR UPDATE OR DELETE"},
+	{"datasets_readable_datasets", "datasets", "UPDATE OF namespace_id, name, root_directory, delete_status OR DELETE"},
+	{"namespaces_readable_datasets", "namespaces", "UPDATE OF name, bucket_name, object_store_id OR DELETE"},
+	{"object_stores_readable_datasets", "object_stores", "UPDATE OF name OR DELETE"},
+}
+
+func Register0017() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		// Each core service instance caches the datasets each user can read. The version is incremented by
+		// triggers whenever a change is committed that could change a user's readable datasets, no matter which
+		// instance made it, and instances drop their cached datasets when the version changes
+		fmt.Println("Creating table readable_datasets_meta...")
+		_, err := db.Exec(`CREATE TABLE readable_datasets_meta (
+			id bigserial PRIMARY KEY,
+			version bigint NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`INSERT INTO readable_datasets_meta (version) VALUES (1)`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Creating function readable_datasets_updated...")
+		_, err = db.Exec(`CREATE FUNCTION readable_datasets_updated() RETURNS TRIGGER AS $readable_updated$
+			BEGIN
+				IF NEW IS DISTINCT FROM OLD THEN
+					UPDATE readable_datasets_meta SET version = version + 1;
+				END IF;
+				return NULL;
+			END
+			$readable_updated$ LANGUAGE plpgsql
+		`)
+		if err != nil {
+			return err
+		}
+
+		for _, trigger := range readableDatasetsTriggers {
+			fmt.Printf("Creating trigger %s...\n", trigger.name)
+			_, err = db.Exec(fmt.Sprintf(`CREATE TRIGGER %s
+				AFTER %s ON %s
+				FOR EACH ROW EXECUTE PROCEDURE readable_datasets_updated()
+			`, trigger.name, trigger.event, trigger.table))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db migrations.DB) error {
+		for _, trigger := range readableDatasetsTriggers {
+			fmt.Printf("Dropping trigger %s...\n", trigger.name)
+			_, err := db.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS %s ON %s`, trigger.name, trigger.table))
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Println("Dropping function readable_datasets_updated...")
+		_, err := db.Exec(`DROP FUNCTION IF EXISTS readable_datasets_updated()`)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Dropping table readable_datasets_meta...")
+		_, err = db.Exec(`DROP TABLE IF EXISTS readable_datasets_meta`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
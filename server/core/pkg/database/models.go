@@ -25,6 +25,13 @@ const (
 	SYNC_TYPE_DUPLEX  = "duplex"
 )
 
+const (
+	METADATA_TYPE_STRING  = "string"
+	METADATA_TYPE_NUMBER  = "number"
+	METADATA_TYPE_DATE    = "date"
+	METADATA_TYPE_BOOLEAN = "boolean"
+)
+
 // User object containing a user's username and the group they're a part of
 type User struct {
 	Id int64 `json:"-"`
@@ -204,6 +211,9 @@ type SyncConfiguration struct {
 	TargetNamespace string `json:"target_namespace"`
 	// SyncType is the type of sync relationship to configure ('simplex' or 'duplex')
 	SyncType string `json:"sync_type" pg:",use_zero"`
+	// CascadeDelete indicates if deleting a synced dataset in the source namespace should also
+	// schedule the delete of the corresponding dataset in the target namespace
+	CascadeDelete bool `json:"cascade_delete" pg:",use_zero"`
 }
 
 // String prints the sync configuration record
@@ -229,3 +239,345 @@ type SyncConfigurationMeta struct {
 
 	LastUpdate time.Time `json:"last_updated"`
 }
+
+// ReadableDatasetsMeta holds the version of the datasets users can read, which is incremented by database
+// triggers whenever permissions, group memberships, or datasets change
+type ReadableDatasetsMeta struct {
+	tableName struct{} `pg:"readable_datasets_meta"`
+
+	Id int64 `json:"-"`
+
+	Version int64
+}
+
+// SyncInstance is a running Sync Service instance that is participating in shard leasing.
+// An instance is considered dead once ExpiresAt has passed without the lease being renewed
+type SyncInstance struct {
+	InstanceId string `pg:",pk"`
+
+	ExpiresAt time.Time
+}
+
+// SyncLease records which Sync Service instance currently owns a shard of the sync workload
+type SyncLease struct {
+	Shard int `pg:",pk,use_zero"`
+
+	InstanceId string
+}
+
+// MetadataSchema describes the metadata written to the objects in a dataset. Objects whose metadata doesn't
+// conform to the schema are flagged in the search index
+type MetadataSchema struct {
+	DatasetId int64 `json:"-" pg:",pk"`
+
+	// Types maps metadata keys to the type their values are indexed as ('string', 'number', 'date', or 'boolean').
+	// Values of keys that are not in Types have their type inferred
+	Types map[string]string `json:"types" pg:",use_zero"`
+	// Required are the metadata keys every object must have
+	Required []string `json:"required" pg:",array,use_zero"`
+	// AllowedValues maps metadata keys to the only values they can have
+	AllowedValues map[string][]string `json:"allowed_values" pg:",use_zero"`
+	// Patterns maps metadata keys to a regular expression their whole value must match
+	Patterns map[string]string `json:"patterns" pg:",use_zero"`
+	// Enforce rejects metadata edits through the core service that don't conform to the schema
+	Enforce bool `json:"enforce" pg:",use_zero"`
+	// Updated is the UTC datetime when the schema was last changed
+	Updated time.Time `json:"updated"`
+}
+
+// String prints the metadata schema record
+func (ms MetadataSchema) String() string {
+	return fmt.Sprintf("MetadataSchema<%d>", ms.DatasetId)
+}
+
+// MetadataSidecar declares the sidecar files of a dataset. A sidecar file is named after the object it describes,
+// followed by one of the suffixes (e.g. `image.tif.meta.json` describes `image.tif`). Its flattened key-value pairs
+// are indexed as metadata of the object it describes
+type MetadataSidecar struct {
+	DatasetId int64 `json:"-" pg:",pk"`
+
+	// Suffixes are the file name suffixes of sidecar files (e.g. '.meta.json'). JSON and YAML sidecars are supported
+	Suffixes []string `json:"suffixes" pg:",array,use_zero"`
+	// Updated is the UTC datetime when the sidecar suffixes were last changed
+	Updated time.Time `json:"updated"`
+}
+
+// String prints the metadata sidecar record
+func (ms MetadataSidecar) String() string {
+	return fmt.Sprintf("MetadataSidecar<%d>", ms.DatasetId)
+}
+
+// IndexJob is a background job that rebuilds the metadata search index documents of every dataset, a namespace,
+// or a single dataset from the objects in the object store, and removes documents for objects that no longer exist
+type IndexJob struct {
+	Id int64 `json:"id"`
+
+	// Namespace is the namespace the job is limited to, if set
+	Namespace string `json:"namespace" pg:",use_zero"`
+	// Dataset is the dataset the job is limited to, if set
+	Dataset string `json:"dataset" pg:",use_zero"`
+	// IndexVersion is the metadata index version the job reconciles after a migration, if set
+	IndexVersion int `json:"index_version,omitempty" pg:",use_zero"`
+	// Status is the state of the job ('PENDING', 'IN_PROGRESS', 'COMPLETE', or 'ERROR')
+	Status string `json:"status"`
+
+	// DatasetsTotal is the number of datasets the job will index
+	DatasetsTotal int `json:"datasets_total" pg:",use_zero"`
+	// DatasetsComplete is the number of datasets that have been indexed
+	DatasetsComplete int `json:"datasets_complete" pg:",use_zero"`
+	// ObjectsIndexed is the number of objects that have been indexed
+	ObjectsIndexed int64 `json:"objects_indexed" pg:",use_zero"`
+	// ObjectsFailed is the number of objects that couldn't be loaded or indexed
+	ObjectsFailed int64 `json:"objects_failed" pg:",use_zero"`
+	// DocumentsDeleted is the number of documents removed because their object no longer exists
+	DocumentsDeleted int64 `json:"documents_deleted" pg:",use_zero"`
+	// Error is the reason the job failed, if the status is 'ERROR'
+	Error string `json:"error,omitempty" pg:",use_zero"`
+
+	// Created is the UTC datetime when the job was created
+	Created time.Time `json:"created"`
+	// Started is the UTC datetime when the job started running
+	Started *time.Time `json:"started,omitempty"`
+	// Finished is the UTC datetime when the job completed or failed
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// String prints the index job record
+func (j IndexJob) String() string {
+	return fmt.Sprintf("IndexJob<%d %s %s %s>", j.Id, j.Namespace, j.Dataset, j.Status)
+}
+
+// SavedSearch is a search that a user saved so it can be run again, and shared with groups
+type SavedSearch struct {
+	Id int64 `json:"id"`
+
+	OwnerId int64 `json:"-"`
+	// Owner is the user who saved the search
+	Owner *User `json:"owner" pg:"rel:has-one"`
+	// Name is the name of the search, unique for the owner
+	Name string `json:"name"`
+	// Description is a description of the search
+	Description string `json:"description" pg:",use_zero"`
+	// Parameters are the query parameters of the search, in the same format as the `GET /search` query parameters
+	Parameters map[string]string `json:"parameters" pg:",use_zero"`
+
+	// Shares are the groups the search is shared with
+	Shares []*SavedSearchShare `json:"-" pg:"rel:has-many"`
+	// Groups are the names of the groups the search is shared with
+	Groups []string `json:"groups" pg:"-"`
+
+	// Created is the UTC datetime when the search was saved
+	Created time.Time `json:"created"`
+	// Updated is the UTC datetime when the search was last changed
+	Updated time.Time `json:"updated"`
+}
+
+// String prints the saved search record
+func (s SavedSearch) String() string {
+	return fmt.Sprintf("SavedSearch<%d %s>", s.Id, s.Name)
+}
+
+// SavedSearchShare shares a saved search with a group, so the group's members can run and subscribe to it
+type SavedSearchShare struct {
+	SavedSearchId int64  `pg:",pk"`
+	GroupId       int64  `pg:",pk"`
+	Group         *Group `pg:"rel:has-one"`
+}
+
+// SearchSubscription subscribes a user to the new objects that match a saved search
+type SearchSubscription struct {
+	Id int64 `json:"id"`
+
+	SavedSearchId int64 `json:"saved_search_id"`
+	// SavedSearch is the search the user is subscribed to
+	SavedSearch *SavedSearch `json:"-" pg:"rel:has-one"`
+	UserId      int64        `json:"-"`
+	// User is the subscribed user
+	User *User `json:"-" pg:"rel:has-one"`
+	// WebhookURL is the URL notifications are posted to, if set. Notifications are always available from the feed
+	WebhookURL string `json:"webhook_url" pg:"webhook_url,use_zero"`
+
+	// Created is the UTC datetime when the user subscribed
+	Created time.Time `json:"created"`
+}
+
+// String prints the search subscription record
+func (s SearchSubscription) String() string {
+	return fmt.Sprintf("SearchSubscription<%d %d %d>", s.Id, s.SavedSearchId, s.UserId)
+}
+
+// SearchNotification is a newly indexed object that matched the saved search of a subscription
+type SearchNotification struct {
+	Id int64 `json:"id"`
+
+	SubscriptionId int64 `json:"-"`
+	// Namespace is the namespace the object is in
+	Namespace string `json:"namespace"`
+	// Dataset is the dataset the object is in
+	Dataset string `json:"dataset"`
+	// FilePath is the path of the object in the dataset
+	FilePath string `json:"file_path"`
+	// LastModifiedDate is the datetime when the object was last modified
+	LastModifiedDate string `json:"last_modified_date" pg:",use_zero"`
+
+	// Created is the UTC datetime when the notification was created
+	Created time.Time `json:"created"`
+}
+
+// String prints the search notification record
+func (n SearchNotification) String() string {
+	return fmt.Sprintf("SearchNotification<%d %d %s/%s>", n.Id, n.SubscriptionId, n.Dataset, n.FilePath)
+}
+
+// AccessLogging enables recording the object downloads of a dataset. Downloads are recorded by the sync service
+// from the object store's bucket events
+type AccessLogging struct {
+	tableName struct{} `pg:"access_logging"`
+
+	DatasetId int64 `json:"-" pg:",pk"`
+
+	// Created is the UTC datetime when access logging was enabled
+	Created time.Time `json:"created"`
+}
+
+// String prints the access logging record
+func (al AccessLogging) String() string {
+	return fmt.Sprintf("AccessLogging<%d>", al.DatasetId)
+}
+
+// ObjectAccess is a download of an object in a dataset with access logging enabled
+type ObjectAccess struct {
+	Id int64 `json:"-"`
+
+	DatasetId int64 `json:"-"`
+	// FilePath is the path of the object in the dataset
+	FilePath string `json:"file_path"`
+	// Username is the user who downloaded the object, or the object store principal if it isn't a known user
+	Username string `json:"username"`
+	// Accessed is the UTC datetime when the object was downloaded
+	Accessed time.Time `json:"accessed"`
+}
+
+// String prints the object access record
+func (oa ObjectAccess) String() string {
+	return fmt.Sprintf("ObjectAccess<%d %s %s>", oa.DatasetId, oa.FilePath, oa.Username)
+}
+
+// ObjectAccessCount is the number of downloads of an object, or of all objects in a dataset
+type ObjectAccessCount struct {
+	// FilePath is the path of the object in the dataset, empty for the dataset's totals
+	FilePath string `json:"file_path,omitempty"`
+	// Downloads is the number of times the object was downloaded
+	Downloads int64 `json:"downloads"`
+	// Users is the number of different users who downloaded the object
+	Users int64 `json:"users"`
+	// LastAccessed is the UTC datetime of the most recent download, if any
+	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+}
+
+// STSSession maps the access key of temporary object store credentials to the user they were issued to, so
+// bucket events can be attributed to the user
+type STSSession struct {
+	tableName struct{} `pg:"sts_sessions"`
+
+	AccessKeyId string `pg:",pk"`
+	UserId      int64
+	User        *User `pg:"rel:has-one"`
+	// Expiration is the UTC datetime when the credentials expire
+	Expiration time.Time
+}
+
+// DatasetSnapshot is an immutable, named record of the version of every object in a dataset at a point in time
+type DatasetSnapshot struct {
+	Id int64 `json:"-"`
+
+	DatasetId int64 `json:"-"`
+	// Name is the name of the snapshot, unique in the dataset
+	Name string `json:"name"`
+	// Description is a description of the snapshot
+	Description string `json:"description" pg:",use_zero"`
+
+	CreatedById int64 `json:"-"`
+	// CreatedBy is the user who created the snapshot
+	CreatedBy *User `json:"created_by" pg:"rel:has-one"`
+	// Created is the UTC datetime when the snapshot was created
+	Created time.Time `json:"created"`
+
+	// ObjectCount is the number of objects in the snapshot
+	ObjectCount int64 `json:"object_count" pg:",use_zero"`
+	// TotalBytes is the total size of the objects in the snapshot
+	TotalBytes int64 `json:"total_bytes" pg:",use_zero"`
+}
+
+// String prints the dataset snapshot record
+func (s DatasetSnapshot) String() string {
+	return fmt.Sprintf("DatasetSnapshot<%d %s>", s.DatasetId, s.Name)
+}
+
+// SnapshotObject is the version of an object recorded in a dataset snapshot
+type SnapshotObject struct {
+	SnapshotId int64 `json:"-" pg:",pk"`
+	// FilePath is the path of the object in the dataset
+	FilePath string `json:"file_path" pg:",pk"`
+	// VersionId is the object store version of the object when the snapshot was created
+	VersionId string `json:"version_id"`
+	// ETag is the entity tag of the object's content
+	ETag string `json:"etag" pg:"etag,use_zero"`
+	// Size is the size of the object in bytes
+	Size int64 `json:"size" pg:",use_zero"`
+}
+
+// String prints the snapshot object record
+func (so SnapshotObject) String() string {
+	return fmt.Sprintf("SnapshotObject<%d %s %s>", so.SnapshotId, so.FilePath, so.VersionId)
+}
+
+// DatasetJob is a background job that copies a dataset's objects into another dataset, or moves a dataset
+// to a new name or namespace
+type DatasetJob struct {
+	Id int64 `json:"id"`
+
+	// Type is the kind of job ('CLONE' or 'MOVE')
+	Type string `json:"type"`
+	// Namespace is the namespace of the source dataset, or the namespace a moved dataset was in
+	Namespace string `json:"namespace"`
+	// Dataset is the name of the source dataset, or the name a moved dataset had
+	Dataset string `json:"dataset"`
+	// TargetNamespace is the namespace of the dataset the objects are copied into
+	TargetNamespace string `json:"target_namespace"`
+	// TargetDataset is the name of the dataset the objects are copied into
+	TargetDataset string `json:"target_dataset"`
+	// Status is the state of the job ('PENDING', 'IN_PROGRESS', 'COMPLETE', or 'ERROR')
+	Status string `json:"status"`
+	// Phase is the step a move job is in ('COPY', 'SWITCH', or 'CLEANUP'), and is empty for clone jobs
+	Phase string `json:"phase,omitempty" pg:",use_zero"`
+
+	// ObjectsCopied is the number of objects that have been copied
+	ObjectsCopied int64 `json:"objects_copied" pg:",use_zero"`
+	// ObjectsFailed is the number of objects that couldn't be copied
+	ObjectsFailed int64 `json:"objects_failed" pg:",use_zero"`
+	// BytesCopied is the total size of the objects that have been copied
+	BytesCopied int64 `json:"bytes_copied" pg:",use_zero"`
+	// Error is the reason the job failed, if the status is 'ERROR'
+	Error string `json:"error,omitempty" pg:",use_zero"`
+
+	// CreatedBy is the username of the user who started the job
+	CreatedBy string `json:"created_by"`
+	// Created is the UTC datetime when the job was created
+	Created time.Time `json:"created"`
+	// Started is the UTC datetime when the job started running
+	Started *time.Time `json:"started,omitempty"`
+	// Finished is the UTC datetime when the job completed or failed
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// Owner identifies the core service instance running the job, and is empty if the job isn't running
+	Owner string `json:"-" pg:",use_zero"`
+	// Heartbeat is the UTC datetime when the owner last recorded that it is still running the job
+	Heartbeat *time.Time `json:"-"`
+}
+
+// String prints the dataset job record
+func (j DatasetJob) String() string {
+	return fmt.Sprintf("DatasetJob<%d %s %s/%s %s/%s %s>", j.Id, j.Type, j.Namespace, j.Dataset,
+		j.TargetNamespace, j.TargetDataset, j.Status)
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"sync"
+)
+
+// ReadableDataset is a dataset that a user can read, with the location of the dataset's objects
+type ReadableDataset struct {
+	ObjectStoreName string
+	NamespaceName   string
+	BucketName      string
+	DatasetName     string
+	RootDirectory   string
+}
+
+// readableDatasetsCache caches the datasets each user can read, loaded at the version of the readable datasets.
+// The cache is cleared when the version changes, so it never returns datasets from before a change made by any
+// core service instance
+type readableDatasetsCache struct {
+	lock    sync.Mutex
+	version int64
+	entries map[string][]*ReadableDataset
+}
+
+func newReadableDatasetsCache() *readableDatasetsCache {
+	return &readableDatasetsCache{entries: map[string][]*ReadableDataset{}}
+}
+
+// get returns the cached datasets for the user, clearing the cache if the version changed
+func (r *readableDatasetsCache) get(username string, version int64) ([]*ReadableDataset, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if version != r.version {
+		r.version = version
+		r.entries = map[string][]*ReadableDataset{}
+		return nil, false
+	}
+	datasets, ok := r.entries[username]
+	return datasets, ok
+}
+
+// set caches the datasets for the user, if they were loaded at the current version
+func (r *readableDatasetsCache) set(username string, datasets []*ReadableDataset, version int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if version != r.version {
+		return
+	}
+	r.entries[username] = datasets
+}
+
+// getReadableDatasetsVersion returns the current version of the readable datasets, shared by every core service
+// instance. It is read before the datasets are loaded, so a change made while loading them invalidates the result
+func (db *Database) getReadableDatasetsVersion() (int64, error) {
+	var version int64
+	err := db.conn.Model((*ReadableDatasetsMeta)(nil)).
+		Column("version").Limit(1).Select(&version)
+	if err != nil {
+		return 0, ConvertError(err)
+	}
+
+	return version, nil
+}
+
+// GetReadableDatasets gets the datasets the user can read in every object store, excluding datasets that
+// have been marked for delete. The result is cached until permissions, group memberships, or datasets are
+// changed by any core service instance and must not be modified
+func (db *Database) GetReadableDatasets(username string) ([]*ReadableDataset, error) {
+	version, err := db.getReadableDatasetsVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	datasets, ok := db.readableDatasets.get(username, version)
+	if ok {
+		return datasets, nil
+	}
+
+	datasets = []*ReadableDataset{}
+	seen := map[int64]bool{}
+	limit := 10
+	offset := 0
+	for {
+		objStores, err := db.ListObjectStores(limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		if len(objStores) == 0 {
+			break
+		}
+		for _, objStore := range objStores {
+			perms, err := db.GetPermissionsByUser(objStore, username, false)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, perm := range perms {
+				// a user can have access to a dataset through more than one group
+				if seen[perm.Dataset.Id] {
+					continue
+				}
+				seen[perm.Dataset.Id] = true
+
+				datasets = append(datasets, &ReadableDataset{
+					ObjectStoreName: objStore.Name,
+					NamespaceName:   perm.Dataset.Namespace.Name,
+					BucketName:      perm.Dataset.Namespace.BucketName,
+					DatasetName:     perm.Dataset.Name,
+					RootDirectory:   perm.Dataset.RootDirectory,
+				})
+			}
+		}
+
+		offset += limit
+	}
+
+	db.readableDatasets.set(username, datasets, version)
+	return datasets, nil
+}
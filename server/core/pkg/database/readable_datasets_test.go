@@ -0,0 +1,168 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestGetReadableDatasets(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	datasets, err := db.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+
+	if len(datasets) != 1 {
+		t.Fatalf("Expected one readable dataset but got %d", len(datasets))
+	}
+
+	test.AssertEqual(t, datasets[0].ObjectStoreName, "default")
+	test.AssertEqual(t, datasets[0].NamespaceName, "test_namespace")
+	test.AssertEqual(t, datasets[0].BucketName, "data")
+	test.AssertEqual(t, datasets[0].DatasetName, "test_dataset")
+	test.AssertEqual(t, datasets[0].RootDirectory, "/test_dataset")
+}
+
+func TestGetReadableDatasetsInvalidated(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+
+	// load the cache
+	datasets, err := db.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 1 {
+		t.Fatalf("Expected one readable dataset but got %d", len(datasets))
+	}
+
+	// removing the permission should invalidate the cache
+	err = db.RemoveDatasetPermissions(ns, "test_dataset", "test_user-hoss-default-group")
+	if err != nil {
+		t.Fatalf("Expected no error but remove dataset permissions failed: %v", err)
+	}
+
+	datasets, err = db.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 0 {
+		t.Fatalf("Expected no readable datasets after removing permissions but got %d", len(datasets))
+	}
+
+	// adding the user to a group with access should invalidate the cache
+	err = db.UpdateDatasetPermissions(ns, "test_dataset", "test_group1", PERM_READ)
+	if err != nil {
+		t.Fatalf("Expected no error but update dataset permissions failed: %v", err)
+	}
+	datasets, err = db.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 0 {
+		t.Fatalf("Expected no readable datasets before joining the group but got %d", len(datasets))
+	}
+
+	err = db.UpdateGroupMembership("test_user", "test_group1")
+	if err != nil {
+		t.Fatalf("Expected no error but update group membership failed: %v", err)
+	}
+
+	datasets, err = db.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 1 {
+		t.Fatalf("Expected one readable dataset after joining the group but got %d", len(datasets))
+	}
+}
+
+func TestGetReadableDatasetsChangedByAnotherInstance(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	// another core service instance using the same database, with its own cache
+	other := &Database{conn: db.conn, readableDatasets: newReadableDatasetsCache()}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+
+	// load the other instance's cache
+	datasets, err := other.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 1 {
+		t.Fatalf("Expected one readable dataset but got %d", len(datasets))
+	}
+
+	// a change made through this instance is seen by the other instance immediately
+	err = db.RemoveDatasetPermissions(ns, "test_dataset", "test_user-hoss-default-group")
+	if err != nil {
+		t.Fatalf("Expected no error but remove dataset permissions failed: %v", err)
+	}
+
+	datasets, err = other.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 0 {
+		t.Fatalf("Expected no readable datasets after removing permissions but got %d", len(datasets))
+	}
+
+	// as is a change made directly in the database
+	_, err = db.conn.Exec(`INSERT INTO permissions (group_id, dataset_id, permission)
+		SELECT g.id, d.id, 'r' FROM groups g, datasets d
+		WHERE g.group_name = 'test_user-hoss-default-group' AND d.name = 'test_dataset'`)
+	if err != nil {
+		t.Fatalf("Failed to insert permission: %v", err)
+	}
+
+	datasets, err = other.GetReadableDatasets("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but get readable datasets failed: %v", err)
+	}
+	if len(datasets) != 1 {
+		t.Fatalf("Expected one readable dataset after adding permissions but got %d", len(datasets))
+	}
+}
+
+func TestReadableDatasetsCache(t *testing.T) {
+	cache := newReadableDatasetsCache()
+	datasets := []*ReadableDataset{{DatasetName: "test_dataset"}}
+
+	_, ok := cache.get("test_user", 1)
+	test.AssertEqual(t, ok, false)
+
+	cache.set("test_user", datasets, 1)
+	cached, ok := cache.get("test_user", 1)
+	test.AssertEqual(t, ok, true)
+	test.AssertEqual(t, cached[0].DatasetName, "test_dataset")
+
+	// datasets loaded before the version changed are not cached
+	_, ok = cache.get("test_user", 2)
+	test.AssertEqual(t, ok, false)
+	cache.set("test_user", datasets, 1)
+	_, ok = cache.get("test_user", 2)
+	test.AssertEqual(t, ok, false)
+
+	cache.set("test_user", datasets, 2)
+	_, ok = cache.get("test_user", 2)
+	test.AssertEqual(t, ok, true)
+}
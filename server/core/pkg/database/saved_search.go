@@ -0,0 +1,335 @@
+package database
+
+import (
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+)
+
+// CreateSavedSearch saves a search for a user
+// Note: returns ErrInvalidInput if the name is empty, and ErrExists if the user already has a search with the name
+func (db *Database) CreateSavedSearch(username, name, description string, parameters map[string]string) (*SavedSearch, error) {
+	if name == "" {
+		return nil, ErrInvalidInput
+	}
+
+	user, err := db.GetOrCreateUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	search := &SavedSearch{
+		OwnerId:     user.Id,
+		Owner:       user,
+		Name:        name,
+		Description: description,
+		Parameters:  parameters,
+		Groups:      []string{},
+		Created:     now,
+		Updated:     now,
+	}
+	if search.Parameters == nil {
+		search.Parameters = map[string]string{}
+	}
+	_, err = db.conn.Model(search).Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to create saved search"))
+	}
+
+	return search, nil
+}
+
+// GetSavedSearch gets a saved search by its id, with its owner and the groups it is shared with
+func (db *Database) GetSavedSearch(id int64) (*SavedSearch, error) {
+	search := &SavedSearch{Id: id}
+	err := db.conn.Model(search).
+		Relation("Owner").
+		Relation("Shares.Group").
+		WherePK().
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	setSavedSearchGroups(search)
+	return search, nil
+}
+
+// ListSavedSearches lists the searches a user saved or that are shared with one of the user's groups, ordered by
+// name, with limit/offset for pagination
+func (db *Database) ListSavedSearches(username string, limit int, offset int) ([]*SavedSearch, error) {
+	searches := []*SavedSearch{}
+	err := db.conn.Model(&searches).
+		Relation("Owner").
+		Relation("Shares.Group").
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.Where(`"owner"."username" = ?`, username).
+				WhereOr(`"saved_search"."id" IN (SELECT ss.saved_search_id FROM saved_search_shares AS ss
+					JOIN memberships AS m ON m.group_id = ss.group_id
+					JOIN users AS u ON u.id = m.user_id
+					WHERE u.username = ?)`, username)
+			return q, nil
+		}).
+		Order("saved_search.name ASC", "saved_search.id ASC").
+		Limit(limit).
+		Offset(offset).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	for _, search := range searches {
+		setSavedSearchGroups(search)
+	}
+	return searches, nil
+}
+
+// GetAllSavedSearches returns every saved search, without their owners or shares
+func (db *Database) GetAllSavedSearches() ([]*SavedSearch, error) {
+	searches := []*SavedSearch{}
+	err := db.conn.Model(&searches).Order("id ASC").Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return searches, nil
+}
+
+// setSavedSearchGroups sets the names of the groups a saved search is shared with from its shares
+func setSavedSearchGroups(search *SavedSearch) {
+	search.Groups = []string{}
+	for _, share := range search.Shares {
+		if share.Group != nil {
+			search.Groups = append(search.Groups, share.Group.GroupName)
+		}
+	}
+}
+
+// UpdateSavedSearch saves the name, description, and parameters of a saved search
+// Note: returns ErrInvalidInput if the name is empty, and ErrExists if the owner already has a search with the name
+func (db *Database) UpdateSavedSearch(search *SavedSearch) error {
+	if search.Name == "" {
+		return ErrInvalidInput
+	}
+	if search.Parameters == nil {
+		search.Parameters = map[string]string{}
+	}
+
+	search.Updated = time.Now().UTC()
+	_, err := db.conn.Model(search).
+		Column("name", "description", "parameters", "updated").
+		WherePK().
+		Update()
+	if err != nil {
+		return ConvertError(errors.Wrap(err, "failed to update saved search"))
+	}
+
+	return nil
+}
+
+// DeleteSavedSearch removes a saved search, its shares, and its subscriptions
+func (db *Database) DeleteSavedSearch(search *SavedSearch) error {
+	_, err := db.conn.Model((*SavedSearch)(nil)).
+		Where("id = ?", search.Id).
+		Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
+
+// ShareSavedSearch shares a saved search with a group
+// Note: returns ErrNotFound if the group doesn't exist
+func (db *Database) ShareSavedSearch(search *SavedSearch, groupName string) error {
+	group := &Group{}
+	err := db.conn.Model(group).Where(`"group"."group_name" = ?`, groupName).Select()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	share := &SavedSearchShare{SavedSearchId: search.Id, GroupId: group.Id}
+	_, err = db.conn.Model(share).
+		OnConflict("DO NOTHING").
+		Insert()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
+
+// UnshareSavedSearch stops sharing a saved search with a group
+// Note: there is no error if the search isn't shared with the group
+func (db *Database) UnshareSavedSearch(search *SavedSearch, groupName string) error {
+	_, err := db.conn.Model((*SavedSearchShare)(nil)).
+		Where("saved_search_id = ?", search.Id).
+		Where("group_id IN (SELECT id FROM groups WHERE group_name = ?)", groupName).
+		Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
+
+// CanReadSavedSearch returns true if the user owns the saved search or is a member of a group it is shared with
+func (db *Database) CanReadSavedSearch(search *SavedSearch, username string) (bool, error) {
+	if search.Owner != nil && search.Owner.Username == username {
+		return true, nil
+	}
+
+	count, err := db.conn.Model((*SavedSearchShare)(nil)).
+		Join(`JOIN memberships AS m ON m.group_id = "saved_search_share"."group_id"`).
+		Join(`JOIN users AS u ON u.id = m.user_id`).
+		Where(`"saved_search_share"."saved_search_id" = ?`, search.Id).
+		Where(`u.username = ?`, username).
+		Count()
+	if err != nil {
+		return false, ConvertError(err)
+	}
+
+	return count > 0, nil
+}
+
+// SubscribeSavedSearch subscribes a user to a saved search, or updates the webhook URL if the user is already
+// subscribed
+func (db *Database) SubscribeSavedSearch(search *SavedSearch, username, webhookURL string) (*SearchSubscription, error) {
+	user, err := db.GetOrCreateUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := &SearchSubscription{
+		SavedSearchId: search.Id,
+		UserId:        user.Id,
+		WebhookURL:    webhookURL,
+		Created:       time.Now().UTC(),
+	}
+	_, err = db.conn.Model(subscription).
+		OnConflict("(saved_search_id, user_id) DO UPDATE").
+		Set("webhook_url = EXCLUDED.webhook_url").
+		Returning("*").
+		Insert()
+	if err != nil {
+		return nil, ConvertError(errors.Wrap(err, "failed to subscribe to saved search"))
+	}
+
+	return subscription, nil
+}
+
+// GetSearchSubscription gets a user's subscription to a saved search
+// Note: returns ErrNotFound if the user isn't subscribed
+func (db *Database) GetSearchSubscription(search *SavedSearch, username string) (*SearchSubscription, error) {
+	subscription := &SearchSubscription{}
+	err := db.conn.Model(subscription).
+		Join(`JOIN users AS u ON u.id = "search_subscription"."user_id"`).
+		Where(`"search_subscription"."saved_search_id" = ?`, search.Id).
+		Where(`u.username = ?`, username).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return subscription, nil
+}
+
+// UnsubscribeSavedSearch removes a user's subscription to a saved search, and its notifications
+// Note: returns ErrNotFound if the user isn't subscribed
+func (db *Database) UnsubscribeSavedSearch(search *SavedSearch, username string) error {
+	res, err := db.conn.Model((*SearchSubscription)(nil)).
+		Where("saved_search_id = ?", search.Id).
+		Where("user_id IN (SELECT id FROM users WHERE username = ?)", username).
+		Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListSearchSubscriptions lists a user's subscriptions, with the saved search of each subscription
+func (db *Database) ListSearchSubscriptions(username string) ([]*SearchSubscription, error) {
+	subscriptions := []*SearchSubscription{}
+	err := db.conn.Model(&subscriptions).
+		Relation("SavedSearch").
+		Relation("User").
+		Where(`"user"."username" = ?`, username).
+		Order("search_subscription.id ASC").
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return subscriptions, nil
+}
+
+// GetSubscriptionsBySavedSearches returns the subscriptions to any of the saved searches, with the subscribed user
+// and the saved search of each subscription
+func (db *Database) GetSubscriptionsBySavedSearches(ids []int64) ([]*SearchSubscription, error) {
+	subscriptions := []*SearchSubscription{}
+	if len(ids) == 0 {
+		return subscriptions, nil
+	}
+
+	err := db.conn.Model(&subscriptions).
+		Relation("SavedSearch").
+		Relation("SavedSearch.Owner").
+		Relation("User").
+		Where(`"search_subscription"."saved_search_id" IN (?)`, pg.In(ids)).
+		Order("search_subscription.id ASC").
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return subscriptions, nil
+}
+
+// CreateSearchNotifications saves notifications for subscriptions
+func (db *Database) CreateSearchNotifications(notifications []*SearchNotification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	_, err := db.conn.Model(&notifications).Insert()
+	if err != nil {
+		return ConvertError(errors.Wrap(err, "failed to create search notifications"))
+	}
+
+	return nil
+}
+
+// ListSearchNotifications lists the notifications of a subscription with an id greater than after, oldest first
+func (db *Database) ListSearchNotifications(subscription *SearchSubscription, after int64, limit int) ([]*SearchNotification, error) {
+	notifications := []*SearchNotification{}
+	err := db.conn.Model(&notifications).
+		Where("subscription_id = ?", subscription.Id).
+		Where("id > ?", after).
+		Order("id ASC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return notifications, nil
+}
+
+// DeleteSearchNotificationsBefore removes the notifications created before a time, returning how many were removed
+func (db *Database) DeleteSearchNotificationsBefore(before time.Time) (int, error) {
+	res, err := db.conn.Model((*SearchNotification)(nil)).
+		Where("created < ?", before).
+		Delete()
+	if err != nil {
+		return 0, ConvertError(err)
+	}
+
+	return res.RowsAffected(), nil
+}
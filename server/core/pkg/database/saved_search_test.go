@@ -0,0 +1,208 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestSavedSearch(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	search, err := db.CreateSavedSearch("test_user", "calibration", "Calibration files",
+		map[string]string{"q": "type:calibration", "namespace": "test_namespace"})
+	if err != nil {
+		t.Fatalf("Expected no error but create saved search failed: %v", err)
+	}
+
+	_, err = db.CreateSavedSearch("test_user", "calibration", "", nil)
+	if err != ErrExists {
+		t.Fatalf("Expected exists error but got: %v", err)
+	}
+
+	_, err = db.CreateSavedSearch("test_user", "", "", nil)
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+
+	loaded, err := db.GetSavedSearch(search.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get saved search failed: %v", err)
+	}
+	test.AssertEqual(t, loaded.Name, "calibration")
+	test.AssertEqual(t, loaded.Owner.Username, "test_user")
+	test.AssertEqual(t, loaded.Parameters["q"], "type:calibration")
+	test.AssertEqual(t, len(loaded.Groups), 0)
+
+	loaded.Parameters = map[string]string{"q": "type:calibration AND size>1MB"}
+	err = db.UpdateSavedSearch(loaded)
+	if err != nil {
+		t.Fatalf("Expected no error but update saved search failed: %v", err)
+	}
+	loaded, err = db.GetSavedSearch(search.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get saved search failed: %v", err)
+	}
+	test.AssertEqual(t, loaded.Parameters["q"], "type:calibration AND size>1MB")
+	test.AssertEqual(t, len(loaded.Parameters), 1)
+
+	// other users can only read the search once it's shared with one of their groups
+	err = db.UpdateGroupMembership("other_user", "test_group1")
+	if err != nil {
+		t.Fatalf("Expected no error but adding group membership failed: %v", err)
+	}
+
+	canRead, err := db.CanReadSavedSearch(loaded, "other_user")
+	if err != nil {
+		t.Fatalf("Expected no error but checking saved search access failed: %v", err)
+	}
+	test.AssertEqual(t, canRead, false)
+
+	searches, err := db.ListSavedSearches("other_user", 25, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list saved searches failed: %v", err)
+	}
+	test.AssertEqual(t, len(searches), 0)
+
+	err = db.ShareSavedSearch(loaded, "does_not_exist")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	err = db.ShareSavedSearch(loaded, "test_group1")
+	if err != nil {
+		t.Fatalf("Expected no error but share saved search failed: %v", err)
+	}
+	// sharing again is not an error
+	err = db.ShareSavedSearch(loaded, "test_group1")
+	if err != nil {
+		t.Fatalf("Expected no error but share saved search failed: %v", err)
+	}
+
+	canRead, err = db.CanReadSavedSearch(loaded, "other_user")
+	if err != nil {
+		t.Fatalf("Expected no error but checking saved search access failed: %v", err)
+	}
+	test.AssertEqual(t, canRead, true)
+
+	searches, err = db.ListSavedSearches("other_user", 25, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list saved searches failed: %v", err)
+	}
+	test.AssertEqual(t, len(searches), 1)
+	test.AssertEqual(t, searches[0].Id, search.Id)
+	test.AssertEqual(t, len(searches[0].Groups), 1)
+	test.AssertEqual(t, searches[0].Groups[0], "test_group1")
+
+	err = db.UnshareSavedSearch(loaded, "test_group1")
+	if err != nil {
+		t.Fatalf("Expected no error but unshare saved search failed: %v", err)
+	}
+	canRead, err = db.CanReadSavedSearch(loaded, "other_user")
+	if err != nil {
+		t.Fatalf("Expected no error but checking saved search access failed: %v", err)
+	}
+	test.AssertEqual(t, canRead, false)
+
+	err = db.DeleteSavedSearch(loaded)
+	if err != nil {
+		t.Fatalf("Expected no error but delete saved search failed: %v", err)
+	}
+	_, err = db.GetSavedSearch(search.Id)
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+}
+
+func TestSearchSubscription(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	search, err := db.CreateSavedSearch("test_user", "calibration", "", map[string]string{"filename": "calib"})
+	if err != nil {
+		t.Fatalf("Expected no error but create saved search failed: %v", err)
+	}
+
+	_, err = db.GetSearchSubscription(search, "test_user")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	subscription, err := db.SubscribeSavedSearch(search, "test_user", "")
+	if err != nil {
+		t.Fatalf("Expected no error but subscribe failed: %v", err)
+	}
+
+	// subscribing again updates the webhook URL of the existing subscription
+	updated, err := db.SubscribeSavedSearch(search, "test_user", "https://example.com/hook")
+	if err != nil {
+		t.Fatalf("Expected no error but subscribe failed: %v", err)
+	}
+	test.AssertEqual(t, updated.Id, subscription.Id)
+	test.AssertEqual(t, updated.WebhookURL, "https://example.com/hook")
+
+	subscriptions, err := db.ListSearchSubscriptions("test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but list subscriptions failed: %v", err)
+	}
+	test.AssertEqual(t, len(subscriptions), 1)
+	test.AssertEqual(t, subscriptions[0].SavedSearch.Name, "calibration")
+
+	subscriptions, err = db.GetSubscriptionsBySavedSearches([]int64{search.Id})
+	if err != nil {
+		t.Fatalf("Expected no error but get subscriptions failed: %v", err)
+	}
+	test.AssertEqual(t, len(subscriptions), 1)
+	test.AssertEqual(t, subscriptions[0].User.Username, "test_user")
+	test.AssertEqual(t, subscriptions[0].SavedSearch.Owner.Username, "test_user")
+
+	notifications := []*SearchNotification{}
+	for _, path := range []string{"calib_01.tif", "calib_02.tif", "calib_03.tif"} {
+		notifications = append(notifications, &SearchNotification{
+			SubscriptionId: subscription.Id,
+			Namespace:      "test_namespace",
+			Dataset:        "test_dataset",
+			FilePath:       path,
+			Created:        time.Now().UTC(),
+		})
+	}
+	err = db.CreateSearchNotifications(notifications)
+	if err != nil {
+		t.Fatalf("Expected no error but create notifications failed: %v", err)
+	}
+
+	page, err := db.ListSearchNotifications(subscription, 0, 2)
+	if err != nil {
+		t.Fatalf("Expected no error but list notifications failed: %v", err)
+	}
+	test.AssertEqual(t, len(page), 2)
+	test.AssertEqual(t, page[0].FilePath, "calib_01.tif")
+
+	page, err = db.ListSearchNotifications(subscription, page[1].Id, 2)
+	if err != nil {
+		t.Fatalf("Expected no error but list notifications failed: %v", err)
+	}
+	test.AssertEqual(t, len(page), 1)
+	test.AssertEqual(t, page[0].FilePath, "calib_03.tif")
+
+	deleted, err := db.DeleteSearchNotificationsBefore(time.Now().UTC().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Expected no error but delete notifications failed: %v", err)
+	}
+	test.AssertEqual(t, deleted, 3)
+
+	err = db.UnsubscribeSavedSearch(search, "test_user")
+	if err != nil {
+		t.Fatalf("Expected no error but unsubscribe failed: %v", err)
+	}
+	err = db.UnsubscribeSavedSearch(search, "test_user")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+)
+
+// snapshotInsertBatchSize is the number of snapshot objects inserted per statement
+const snapshotInsertBatchSize = 1000
+
+// CreateSnapshot records a snapshot of a dataset with the given object versions
+// Note: returns ErrInvalidInput if the name is empty, and ErrExists if the dataset already has a snapshot with the name
+func (db *Database) CreateSnapshot(dataset *Dataset, username, name, description string, objects []*SnapshotObject) (*DatasetSnapshot, error) {
+	if name == "" {
+		return nil, ErrInvalidInput
+	}
+
+	user, err := db.GetOrCreateUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &DatasetSnapshot{
+		DatasetId:   dataset.Id,
+		Name:        name,
+		Description: description,
+		CreatedById: user.Id,
+		CreatedBy:   user,
+		Created:     time.Now().UTC(),
+		ObjectCount: int64(len(objects)),
+	}
+	for _, object := range objects {
+		snapshot.TotalBytes += object.Size
+	}
+
+	err = db.conn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.Model(snapshot).Insert()
+		if err != nil {
+			return ConvertError(errors.Wrap(err, "failed to create snapshot"))
+		}
+
+		for start := 0; start < len(objects); start += snapshotInsertBatchSize {
+			end := start + snapshotInsertBatchSize
+			if end > len(objects) {
+				end = len(objects)
+			}
+
+			batch := objects[start:end]
+			for _, object := range batch {
+				object.SnapshotId = snapshot.Id
+			}
+			_, err = tx.Model(&batch).Insert()
+			if err != nil {
+				return ConvertError(errors.Wrap(err, "failed to record snapshot objects"))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// GetSnapshot gets a dataset's snapshot by name
+func (db *Database) GetSnapshot(dataset *Dataset, name string) (*DatasetSnapshot, error) {
+	snapshot := &DatasetSnapshot{}
+	err := db.conn.Model(snapshot).
+		Relation("CreatedBy").
+		Where("dataset_id = ?", dataset.Id).
+		Where("dataset_snapshot.name = ?", name).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return snapshot, nil
+}
+
+// ListSnapshots lists a dataset's snapshots, newest first, with limit/offset for pagination
+func (db *Database) ListSnapshots(dataset *Dataset, limit int, offset int) ([]*DatasetSnapshot, error) {
+	snapshots := []*DatasetSnapshot{}
+	err := db.conn.Model(&snapshots).
+		Relation("CreatedBy").
+		Where("dataset_id = ?", dataset.Id).
+		Order("created DESC", "dataset_snapshot.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return snapshots, nil
+}
+
+// DeleteSnapshot removes a snapshot and its object records. The object versions are not changed
+func (db *Database) DeleteSnapshot(snapshot *DatasetSnapshot) error {
+	_, err := db.conn.Model(snapshot).WherePK().Delete()
+	if err != nil {
+		return ConvertError(err)
+	}
+
+	return nil
+}
+
+// GetSnapshotObject gets the version of an object recorded in a snapshot
+// Note: returns ErrNotFound if the object isn't in the snapshot
+func (db *Database) GetSnapshotObject(snapshot *DatasetSnapshot, filePath string) (*SnapshotObject, error) {
+	object := &SnapshotObject{SnapshotId: snapshot.Id, FilePath: filePath}
+	err := db.conn.Model(object).WherePK().Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return object, nil
+}
+
+// ListSnapshotObjects lists the objects in a snapshot whose path starts with the prefix, ordered by path, with
+// limit/offset for pagination
+func (db *Database) ListSnapshotObjects(snapshot *DatasetSnapshot, prefix string, limit int, offset int) ([]*SnapshotObject, error) {
+	objects := []*SnapshotObject{}
+	query := db.conn.Model(&objects).
+		Where("snapshot_id = ?", snapshot.Id)
+	if prefix != "" {
+		query = query.Where("starts_with(file_path, ?)", prefix)
+	}
+	err := query.
+		Order("file_path ASC").
+		Limit(limit).
+		Offset(offset).
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return objects, nil
+}
+
+// GetAllSnapshotObjects gets every object in a snapshot, ordered by path
+func (db *Database) GetAllSnapshotObjects(snapshot *DatasetSnapshot) ([]*SnapshotObject, error) {
+	objects := []*SnapshotObject{}
+	err := db.conn.Model(&objects).
+		Where("snapshot_id = ?", snapshot.Id).
+		Order("file_path ASC").
+		Select()
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return objects, nil
+}
+
+// GetSnapshotsReferencingVersions returns the names of a dataset's snapshots that recorded any of the given versions
+// of an object, ordered by name
+func (db *Database) GetSnapshotsReferencingVersions(dataset *Dataset, filePath string, versionIds []string) ([]string, error) {
+	names := []string{}
+	if len(versionIds) == 0 {
+		return names, nil
+	}
+
+	err := db.conn.Model((*DatasetSnapshot)(nil)).
+		ColumnExpr("DISTINCT dataset_snapshot.name").
+		Join("JOIN snapshot_objects AS so ON so.snapshot_id = dataset_snapshot.id").
+		Where("dataset_snapshot.dataset_id = ?", dataset.Id).
+		Where("so.file_path = ?", filePath).
+		Where("so.version_id IN (?)", pg.In(versionIds)).
+		Order("dataset_snapshot.name ASC").
+		Select(&names)
+	if err != nil {
+		return nil, ConvertError(err)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestSnapshots(t *testing.T) {
+	db, err := SetupDatabaseTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("test_namespace")
+	if err != nil {
+		t.Fatal("Failed to get namespace")
+	}
+	ds, err := db.GetDataset(ns, "test_dataset")
+	if err != nil {
+		t.Fatal("Failed to get dataset")
+	}
+
+	_, err = db.CreateSnapshot(ds, "test_user", "", "", nil)
+	if err != ErrInvalidInput {
+		t.Fatalf("Expected invalid input error but got: %v", err)
+	}
+
+	objects := []*SnapshotObject{
+		{FilePath: "b.tif", VersionId: "v2", ETag: "etag-b", Size: 20},
+		{FilePath: "a/a.tif", VersionId: "v1", ETag: "etag-a", Size: 10},
+	}
+	snapshot, err := db.CreateSnapshot(ds, "test_user", "v1.0", "first release", objects)
+	if err != nil {
+		t.Fatalf("Expected no error but create snapshot failed: %v", err)
+	}
+	test.AssertEqual(t, snapshot.ObjectCount, int64(2))
+	test.AssertEqual(t, snapshot.TotalBytes, int64(30))
+
+	_, err = db.CreateSnapshot(ds, "test_user", "v1.0", "", nil)
+	if err != ErrExists {
+		t.Fatalf("Expected exists error but got: %v", err)
+	}
+
+	_, err = db.CreateSnapshot(ds, "test_user", "empty", "", nil)
+	if err != nil {
+		t.Fatalf("Expected no error but create snapshot failed: %v", err)
+	}
+
+	snapshot, err = db.GetSnapshot(ds, "v1.0")
+	if err != nil {
+		t.Fatalf("Expected no error but get snapshot failed: %v", err)
+	}
+	test.AssertEqual(t, snapshot.Description, "first release")
+	test.AssertEqual(t, snapshot.CreatedBy.Username, "test_user")
+
+	snapshots, err := db.ListSnapshots(ds, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list snapshots failed: %v", err)
+	}
+	test.AssertEqual(t, len(snapshots), 2)
+	test.AssertEqual(t, snapshots[0].Name, "empty")
+
+	object, err := db.GetSnapshotObject(snapshot, "b.tif")
+	if err != nil {
+		t.Fatalf("Expected no error but get snapshot object failed: %v", err)
+	}
+	test.AssertEqual(t, object.VersionId, "v2")
+	test.AssertEqual(t, object.ETag, "etag-b")
+
+	_, err = db.GetSnapshotObject(snapshot, "c.tif")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	listed, err := db.ListSnapshotObjects(snapshot, "a/", 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error but list snapshot objects failed: %v", err)
+	}
+	test.AssertEqual(t, len(listed), 1)
+	test.AssertEqual(t, listed[0].FilePath, "a/a.tif")
+
+	all, err := db.GetAllSnapshotObjects(snapshot)
+	if err != nil {
+		t.Fatalf("Expected no error but get all snapshot objects failed: %v", err)
+	}
+	test.AssertEqual(t, len(all), 2)
+	test.AssertEqual(t, all[0].FilePath, "a/a.tif")
+
+	names, err := db.GetSnapshotsReferencingVersions(ds, "b.tif", []string{"v1", "v2"})
+	if err != nil {
+		t.Fatalf("Expected no error but get snapshots referencing versions failed: %v", err)
+	}
+	test.AssertEqual(t, len(names), 1)
+	test.AssertEqual(t, names[0], "v1.0")
+
+	err = db.DeleteSnapshot(snapshot)
+	if err != nil {
+		t.Fatalf("Expected no error but delete snapshot failed: %v", err)
+	}
+
+	_, err = db.GetSnapshot(ds, "v1.0")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not found error but got: %v", err)
+	}
+
+	names, err = db.GetSnapshotsReferencingVersions(ds, "b.tif", []string{"v2"})
+	if err != nil {
+		t.Fatalf("Expected no error but get snapshots referencing versions failed: %v", err)
+	}
+	test.AssertEqual(t, len(names), 0)
+}
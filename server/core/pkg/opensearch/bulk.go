@@ -0,0 +1,469 @@
+package opensearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gigantum/hoss-service/search"
+	"github.com/pkg/errors"
+)
+
+// walkDocumentsBatchSize is the number of documents loaded at a time by WalkDocuments
+const walkDocumentsBatchSize = 1000
+
+// maxSidecarMergeAttempts is the number of times a sidecar operation is merged and applied, if the document is
+// changed by another request between loading and indexing it
+const maxSidecarMergeAttempts = 5
+
+// bulkAction is the action line of a bulk request
+type bulkAction struct {
+	Index  *bulkActionTarget `json:"index,omitempty"`
+	Delete *bulkActionTarget `json:"delete,omitempty"`
+}
+
+type bulkActionTarget struct {
+	Index string `json:"_index"`
+	Id    string `json:"_id"`
+	// IfSeqNo and IfPrimaryTerm only apply the action if the document hasn't changed since it was loaded
+	IfSeqNo       *int64 `json:"if_seq_no,omitempty"`
+	IfPrimaryTerm *int64 `json:"if_primary_term,omitempty"`
+}
+
+type bulkResponse struct {
+	Items []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Bulk operation actions
+const (
+	BulkActionIndex   = "index"
+	BulkActionDelete  = "delete"
+	BulkActionSidecar = "sidecar"
+)
+
+// BulkOperation is a single document operation in a bulk request
+type BulkOperation struct {
+	// Action is the operation to apply to the document, either `index`, `delete`, or `sidecar`. `sidecar` replaces
+	// the sidecar metadata of an existing document with the document's SidecarMetadata
+	Action string `json:"action" binding:"required"`
+	// Document is the document to index. Only the fields used in the document ID are needed to remove a document,
+	// and only the fields used in the document ID and SidecarMetadata are needed to update sidecar metadata
+	Document *MetadataIndexPayload `json:"document" binding:"required"`
+
+	// sidecar is the document of a sidecar operation that was merged, so it can be merged again on a conflict
+	sidecar *MetadataIndexPayload
+	// version is the version of the indexed document a merged sidecar operation was based on
+	version *documentVersion
+}
+
+// documentVersion identifies a version of a document in the index, used for optimistic concurrency control
+type documentVersion struct {
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// BulkItemResult is the result of a single operation in a bulk request
+type BulkItemResult struct {
+	// Status is the HTTP status code of the operation
+	Status int `json:"status"`
+	// Error is the reason the operation failed, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// BulkDocuments applies index and delete operations to the metadata index with a single bulk request, using the same
+// document IDs as CreateOrUpdateDocument. Operations are applied in order. It returns the result of each operation,
+// in the same order as the operations, and an error if the request failed. Removing a document that doesn't exist is
+// not a failure. `sidecar` operations must be merged with MergeSidecarMetadata first, any that remain are for
+// documents that don't exist and are returned with a 404 status, which is not a failure
+func BulkDocuments(opensearchEndpoint string, operations []*BulkOperation) ([]*BulkItemResult, error) {
+	results := make([]*BulkItemResult, len(operations))
+	sent := []int{}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i, operation := range operations {
+		target := &bulkActionTarget{Index: search.MetadataIndexAlias, Id: getDocumentID(operation.Document)}
+		switch operation.Action {
+		case BulkActionIndex:
+			if operation.version != nil {
+				target.IfSeqNo = &operation.version.SeqNo
+				target.IfPrimaryTerm = &operation.version.PrimaryTerm
+			}
+			if err := encoder.Encode(&bulkAction{Index: target}); err != nil {
+				return nil, errors.Wrap(err, "unable to marshal bulk action JSON")
+			}
+			if err := encoder.Encode(operation.Document); err != nil {
+				return nil, errors.Wrap(err, "unable to marshal payload JSON")
+			}
+		case BulkActionDelete:
+			if err := encoder.Encode(&bulkAction{Delete: target}); err != nil {
+				return nil, errors.Wrap(err, "unable to marshal bulk action JSON")
+			}
+		case BulkActionSidecar:
+			results[i] = &BulkItemResult{Status: http.StatusNotFound}
+			continue
+		default:
+			return nil, errors.New("unsupported bulk action: " + operation.Action)
+		}
+		sent = append(sent, i)
+	}
+
+	if len(sent) == 0 {
+		return results, nil
+	}
+
+	response := bulkResponse{}
+	err := makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/_bulk", "application/x-ndjson", &body, &response)
+	if err != nil {
+		return nil, errors.New("bulk metadata index request failed: " + err.Error())
+	}
+	if len(response.Items) != len(sent) {
+		return nil, fmt.Errorf("bulk metadata index response has %d items, expected %d", len(response.Items), len(sent))
+	}
+
+	for i, item := range response.Items {
+		result := &BulkItemResult{}
+		for _, itemResult := range item {
+			result.Status = itemResult.Status
+			// removing a document that doesn't exist is not a failure
+			if itemResult.Error != nil && itemResult.Status != http.StatusNotFound {
+				result.Error = itemResult.Error.Type + ": " + itemResult.Error.Reason
+			}
+		}
+		results[sent[i]] = result
+	}
+
+	return results, nil
+}
+
+// ApplyBulkOperations merges the sidecar operations with MergeSidecarMetadata, calls prepare with the operations
+// (e.g. to apply the dataset's schema to the merged documents), and applies them with BulkDocuments. Merged sidecar
+// operations are only applied if the document hasn't changed since it was loaded, otherwise they are merged and
+// applied again, up to maxSidecarMergeAttempts times. The results are in the same order as the operations
+func ApplyBulkOperations(opensearchEndpoint string, operations []*BulkOperation,
+	prepare func(operations []*BulkOperation) error) ([]*BulkItemResult, error) {
+
+	results := make([]*BulkItemResult, len(operations))
+	pending := make([]int, len(operations))
+	for i := range operations {
+		pending[i] = i
+	}
+
+	for attempt := 1; ; attempt++ {
+		batch := make([]*BulkOperation, len(pending))
+		for i, index := range pending {
+			batch[i] = operations[index]
+		}
+
+		if err := MergeSidecarMetadata(opensearchEndpoint, batch); err != nil {
+			return nil, err
+		}
+		if err := prepare(batch); err != nil {
+			return nil, err
+		}
+		batchResults, err := BulkDocuments(opensearchEndpoint, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		conflicts := []int{}
+		for i, result := range batchResults {
+			index := pending[i]
+			results[index] = result
+
+			operation := operations[index]
+			if result.Status == http.StatusConflict && operation.sidecar != nil && attempt < maxSidecarMergeAttempts {
+				operation.Action = BulkActionSidecar
+				operation.Document = operation.sidecar
+				operation.sidecar = nil
+				operation.version = nil
+				conflicts = append(conflicts, index)
+			}
+		}
+
+		if len(conflicts) == 0 {
+			return results, nil
+		}
+		pending = conflicts
+	}
+}
+
+// MergeSidecarMetadata converts `sidecar` operations to `index` operations of the documents they describe. The
+// sidecar metadata of each document is removed from its metadata and replaced with the operation's SidecarMetadata.
+// If an earlier operation indexes the same document, its document is used instead of the indexed one. Operations for
+// documents that don't exist are left unchanged. Operations merged with an indexed document are only applied by
+// BulkDocuments if the document hasn't changed since it was loaded
+func MergeSidecarMetadata(opensearchEndpoint string, operations []*BulkOperation) error {
+	ids := []string{}
+	for _, operation := range operations {
+		if operation.Action == BulkActionSidecar {
+			ids = append(ids, getDocumentID(operation.Document))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	documents, err := getDocumentsByID(opensearchEndpoint, ids)
+	if err != nil {
+		return err
+	}
+
+	// the latest version of each document, following the operations in order, and the indexed version it is based
+	// on. Documents replaced by an earlier index operation don't depend on the indexed version
+	latest := map[string]*MetadataIndexPayload{}
+	versions := map[string]*documentVersion{}
+	for id, document := range documents {
+		source := document.Source
+		versions[id] = document.Version
+		latest[id] = &MetadataIndexPayload{
+			CoreServiceEndpoint: source.CoreServiceEndpoint,
+			DatasetExtended:     source.DatasetExtended,
+			ObjectKey:           source.ObjectKey,
+			LastModifiedDate:    source.LastModifiedDate,
+			SizeBytes:           source.SizeBytes,
+			Metadata:            source.Metadata,
+			ContentHash:         source.ContentHash,
+			SidecarMetadata:     source.SidecarMetadata,
+		}
+	}
+
+	for _, operation := range operations {
+		id := getDocumentID(operation.Document)
+		switch operation.Action {
+		case BulkActionIndex:
+			latest[id] = operation.Document
+			delete(versions, id)
+		case BulkActionDelete:
+			delete(latest, id)
+			delete(versions, id)
+		case BulkActionSidecar:
+			document, ok := latest[id]
+			if !ok {
+				continue
+			}
+
+			merged := *document
+			merged.Metadata = replaceSidecarMetadata(document.Metadata, document.SidecarMetadata, operation.Document.SidecarMetadata)
+			merged.SidecarMetadata = operation.Document.SidecarMetadata
+			operation.sidecar = operation.Document
+			operation.version = versions[id]
+			operation.Action = BulkActionIndex
+			operation.Document = &merged
+			latest[id] = &merged
+		}
+	}
+
+	return nil
+}
+
+// replaceSidecarMetadata removes one occurrence of each of the old sidecar key-pairs from metadata, then adds the new ones
+func replaceSidecarMetadata(metadata []string, oldSidecar []string, newSidecar []string) []string {
+	remove := map[string]int{}
+	for _, pair := range oldSidecar {
+		remove[pair]++
+	}
+
+	replaced := []string{}
+	for _, pair := range metadata {
+		if remove[pair] > 0 {
+			remove[pair]--
+			continue
+		}
+		replaced = append(replaced, pair)
+	}
+
+	return append(replaced, newSidecar...)
+}
+
+// BulkIndexDocuments creates or updates documents in the metadata index with a single bulk request. It returns the
+// number of documents that failed to index, and an error if the request failed
+func BulkIndexDocuments(opensearchEndpoint string, documentPayloads []*MetadataIndexPayload) (int, error) {
+	operations := make([]*BulkOperation, len(documentPayloads))
+	for i, payload := range documentPayloads {
+		operations[i] = &BulkOperation{Action: BulkActionIndex, Document: payload}
+	}
+
+	return countBulkFailures(BulkDocuments(opensearchEndpoint, operations))
+}
+
+// BulkDeleteDocuments removes documents from the metadata index with a single bulk request. Documents that don't
+// exist are not counted as failures. It returns the number of documents that failed to be removed, and an error
+// if the request failed
+func BulkDeleteDocuments(opensearchEndpoint string, documentPayloads []*MetadataIndexPayload) (int, error) {
+	operations := make([]*BulkOperation, len(documentPayloads))
+	for i, payload := range documentPayloads {
+		operations[i] = &BulkOperation{Action: BulkActionDelete, Document: payload}
+	}
+
+	return countBulkFailures(BulkDocuments(opensearchEndpoint, operations))
+}
+
+// countBulkFailures counts the failed items of a bulk request
+func countBulkFailures(results []*BulkItemResult, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+type mgetResponse struct {
+	Docs []struct {
+		Id          string      `json:"_id"`
+		Found       bool        `json:"found"`
+		SeqNo       int64       `json:"_seq_no"`
+		PrimaryTerm int64       `json:"_primary_term"`
+		Source      IndexSource `json:"_source"`
+	} `json:"docs"`
+}
+
+// indexedDocument is a document loaded from the metadata index
+type indexedDocument struct {
+	Source  *IndexSource
+	Version *documentVersion
+}
+
+// GetDocuments loads the documents for the given payloads from the metadata index, returning a map of object keys
+// to document sources. Documents that don't exist are not included
+func GetDocuments(opensearchEndpoint string, documentPayloads []*MetadataIndexPayload) (map[string]*IndexSource, error) {
+	ids := make([]string, len(documentPayloads))
+	for i, payload := range documentPayloads {
+		ids[i] = getDocumentID(payload)
+	}
+
+	documents, err := getDocumentsByID(opensearchEndpoint, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*IndexSource{}
+	for _, document := range documents {
+		byKey[document.Source.ObjectKey] = document.Source
+	}
+	return byKey, nil
+}
+
+// getDocumentsByID loads documents from the metadata index, returning a map of document IDs to documents.
+// Documents that don't exist are not included
+func getDocumentsByID(opensearchEndpoint string, ids []string) (map[string]*indexedDocument, error) {
+	documents := map[string]*indexedDocument{}
+	if len(ids) == 0 {
+		return documents, nil
+	}
+
+	payloadBytes, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	response := mgetResponse{}
+	err = makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/"+search.MetadataIndexAlias+"/_mget", "application/json",
+		bytes.NewBuffer(payloadBytes), &response)
+	if err != nil {
+		return nil, errors.New("could not fetch search index documents: " + err.Error())
+	}
+
+	for i := range response.Docs {
+		doc := &response.Docs[i]
+		if doc.Found {
+			documents[doc.Id] = &indexedDocument{
+				Source:  &doc.Source,
+				Version: &documentVersion{SeqNo: doc.SeqNo, PrimaryTerm: doc.PrimaryTerm},
+			}
+		}
+	}
+
+	return documents, nil
+}
+
+type walkDocumentsResponse struct {
+	Hits struct {
+		Hits []struct {
+			Source IndexSource       `json:"_source"`
+			Sort   []json.RawMessage `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// WalkDocuments calls fn for every document of a dataset that was indexed by the core service, ordered by object key.
+// Only the object key and last modified date of the sources are loaded. Walking stops if fn returns an error
+func WalkDocuments(opensearchEndpoint, coreServiceEndpoint, datasetExtended string, fn func(source *IndexSource) error) error {
+	payload := map[string]interface{}{
+		"size":    walkDocumentsBatchSize,
+		"_source": []string{"object_key", "last_modified_date"},
+		"sort":    []interface{}{map[string]string{"object_key": "asc"}},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]string{"core_service_endpoint": coreServiceEndpoint}},
+					map[string]interface{}{"term": map[string]string{"dataset_extended": datasetExtended}},
+				},
+			},
+		},
+	}
+
+	for {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal payload JSON")
+		}
+
+		response := walkDocumentsResponse{}
+		err = makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/"+search.MetadataIndexAlias+"/_search", "application/json",
+			bytes.NewBuffer(payloadBytes), &response)
+		if err != nil {
+			return errors.New("could not search metadata index: " + err.Error())
+		}
+
+		for i := range response.Hits.Hits {
+			if err := fn(&response.Hits.Hits[i].Source); err != nil {
+				return err
+			}
+		}
+
+		if len(response.Hits.Hits) < walkDocumentsBatchSize {
+			return nil
+		}
+		payload["search_after"] = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	}
+}
+
+// makeSearchIndexRequest makes a request to the opensearch service and unpacks the JSON response
+func makeSearchIndexRequest(verb, path, contentType string, body *bytes.Buffer, response interface{}) error {
+	req, err := http.NewRequest(verb, path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to `%s` failed, Status Code %v, Response: %s", path, resp.Status, string(respBody))
+	}
+
+	return json.Unmarshal(respBody, response)
+}
@@ -0,0 +1,192 @@
+package opensearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// fakeIndex is a single document metadata index that supports the requests made by ApplyBulkOperations. The
+// document is changed by another writer (changeBeforeIndex) after it is loaded the first time
+type fakeIndex struct {
+	mu sync.Mutex
+
+	source      IndexSource
+	seqNo       int64
+	conflicts   int
+	bulkActions []bulkActionTarget
+
+	changeBeforeIndex func(source *IndexSource)
+}
+
+func (f *fakeIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_mget"):
+		request := map[string][]string{}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"docs": []map[string]interface{}{{
+				"_id": request["ids"][0], "found": true, "_seq_no": f.seqNo, "_primary_term": 1, "_source": f.source,
+			}},
+		})
+
+		if f.changeBeforeIndex != nil {
+			f.changeBeforeIndex(&f.source)
+			f.changeBeforeIndex = nil
+			f.seqNo++
+		}
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		items := []map[string]interface{}{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			action := bulkAction{}
+			json.Unmarshal(scanner.Bytes(), &action)
+			scanner.Scan()
+			f.bulkActions = append(f.bulkActions, *action.Index)
+
+			if action.Index.IfSeqNo != nil && *action.Index.IfSeqNo != f.seqNo {
+				f.conflicts++
+				items = append(items, map[string]interface{}{"index": map[string]interface{}{
+					"status": http.StatusConflict,
+					"error":  map[string]string{"type": "version_conflict_engine_exception", "reason": "conflict"},
+				}})
+				continue
+			}
+
+			json.Unmarshal(scanner.Bytes(), &f.source)
+			f.seqNo++
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": http.StatusOK}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func sidecarOperation(sidecar ...string) *BulkOperation {
+	return &BulkOperation{
+		Action: BulkActionSidecar,
+		Document: &MetadataIndexPayload{
+			CoreServiceEndpoint: "http://localhost/core/v1",
+			DatasetExtended:     "default|data|dataset",
+			ObjectKey:           "dataset/image.tif",
+			SidecarMetadata:     sidecar,
+		},
+	}
+}
+
+func TestApplyBulkOperationsSidecar(t *testing.T) {
+	index := &fakeIndex{
+		source: IndexSource{
+			ObjectKey:       "dataset/image.tif",
+			Metadata:        []string{"user:a", "subject:1"},
+			SidecarMetadata: []string{"subject:1"},
+		},
+	}
+	server := httptest.NewServer(index)
+	defer server.Close()
+
+	prepared := 0
+	results, err := ApplyBulkOperations(server.URL, []*BulkOperation{sidecarOperation("subject:2")},
+		func(operations []*BulkOperation) error {
+			prepared += len(operations)
+			return nil
+		})
+	test.AssertEqual(t, err, nil)
+	test.AssertEqual(t, len(results), 1)
+	test.AssertEqual(t, results[0].Status, http.StatusOK)
+	test.AssertEqual(t, prepared, 1)
+
+	// The index is conditional on the version of the document that was merged
+	test.AssertEqual(t, len(index.bulkActions), 1)
+	test.AssertEqual(t, *index.bulkActions[0].IfSeqNo, int64(0))
+	test.AssertEqual(t, *index.bulkActions[0].IfPrimaryTerm, int64(1))
+	test.AssertEqual(t, strings.Join(index.source.Metadata, ","), "user:a,subject:2")
+	test.AssertEqual(t, strings.Join(index.source.SidecarMetadata, ","), "subject:2")
+}
+
+func TestApplyBulkOperationsSidecarConflict(t *testing.T) {
+	index := &fakeIndex{
+		source: IndexSource{
+			ObjectKey:       "dataset/image.tif",
+			Metadata:        []string{"user:a", "subject:1"},
+			SidecarMetadata: []string{"subject:1"},
+		},
+		// the object's user metadata is re-indexed between loading and indexing the document
+		changeBeforeIndex: func(source *IndexSource) {
+			source.Metadata = []string{"user:b", "subject:1"}
+		},
+	}
+	server := httptest.NewServer(index)
+	defer server.Close()
+
+	prepared := 0
+	operations := []*BulkOperation{sidecarOperation("subject:2")}
+	results, err := ApplyBulkOperations(server.URL, operations, func(operations []*BulkOperation) error {
+		prepared += len(operations)
+		return nil
+	})
+	test.AssertEqual(t, err, nil)
+	test.AssertEqual(t, results[0].Status, http.StatusOK)
+	test.AssertEqual(t, results[0].Error, "")
+	test.AssertEqual(t, index.conflicts, 1)
+	test.AssertEqual(t, prepared, 2)
+
+	// The sidecar metadata is merged again with the update made by the other writer
+	test.AssertEqual(t, len(index.bulkActions), 2)
+	test.AssertEqual(t, *index.bulkActions[1].IfSeqNo, int64(1))
+	test.AssertEqual(t, strings.Join(index.source.Metadata, ","), "user:b,subject:2")
+	test.AssertEqual(t, operations[0].Action, BulkActionIndex)
+}
+
+func TestApplyBulkOperationsIndexedInBatch(t *testing.T) {
+	index := &fakeIndex{
+		source: IndexSource{ObjectKey: "dataset/image.tif", Metadata: []string{"user:a"}},
+	}
+	server := httptest.NewServer(index)
+	defer server.Close()
+
+	// A sidecar update of a document indexed earlier in the batch doesn't depend on the indexed version
+	indexOperation := sidecarOperation()
+	indexOperation.Action = BulkActionIndex
+	indexOperation.Document.Metadata = []string{"user:c"}
+	results, err := ApplyBulkOperations(server.URL, []*BulkOperation{indexOperation, sidecarOperation("subject:3")},
+		func(operations []*BulkOperation) error { return nil })
+	test.AssertEqual(t, err, nil)
+	test.AssertEqual(t, len(results), 2)
+
+	test.AssertEqual(t, len(index.bulkActions), 2)
+	test.AssertEqual(t, index.bulkActions[0].IfSeqNo == nil, true)
+	test.AssertEqual(t, index.bulkActions[1].IfSeqNo == nil, true)
+	test.AssertEqual(t, strings.Join(index.source.Metadata, ","), "user:c,subject:3")
+}
+
+func TestReplaceSidecarMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		metadata   []string
+		oldSidecar []string
+		newSidecar []string
+		want       []string
+	}{
+		{"replace", []string{"a:1", "b:2"}, []string{"b:2"}, []string{"b:3"}, []string{"a:1", "b:3"}},
+		{"first sidecar", []string{"a:1"}, nil, []string{"b:2"}, []string{"a:1", "b:2"}},
+		{"remove sidecar", []string{"a:1", "b:2"}, []string{"b:2"}, nil, []string{"a:1"}},
+		{"user metadata with the same pair is kept", []string{"b:2", "b:2"}, []string{"b:2"}, nil, []string{"b:2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test.AssertEqual(t, strings.Join(replaceSidecarMetadata(tt.metadata, tt.oldSidecar, tt.newSidecar), ","), strings.Join(tt.want, ","))
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Opensearch authentication types
+const (
+	AuthTypeNone     = ""
+	AuthTypeBasic    = "basic"
+	AuthTypeApiKey   = "api_key"
+	AuthTypeAwsSigV4 = "aws_sigv4"
+)
+
+const (
+	defaultTimeoutSeconds = 30
+	defaultMaxRetries     = 3
+	defaultAwsService     = "es"
+	// defaultRetryDelay is the delay before the first retry, which doubles for each following retry
+	defaultRetryDelay = 500 * time.Millisecond
+)
+
+// Client makes requests to the Opensearch service, adding authentication and retrying requests that fail
+// because the service is unavailable
+type Client struct {
+	httpClient *http.Client
+	maxRetries int
+	retryDelay time.Duration
+
+	authType string
+	username string
+	password string
+	apiKey   string
+
+	signer         *v4.Signer
+	awsCredentials aws.CredentialsProvider
+	awsRegion      string
+	awsService     string
+}
+
+// client is the shared client used for all requests to the Opensearch service
+var client = &Client{
+	httpClient: &http.Client{Timeout: defaultTimeoutSeconds * time.Second},
+	maxRetries: defaultMaxRetries,
+	retryDelay: defaultRetryDelay,
+}
+
+// Configure sets up the shared Opensearch client from the core service configuration. It must be called
+// before any requests are made to the Opensearch service
+func Configure(c *config.OpenSearch) error {
+	newClient, err := NewClient(c)
+	if err != nil {
+		return err
+	}
+
+	client = newClient
+	return nil
+}
+
+// NewClient creates an Opensearch client
+func NewClient(c *config.OpenSearch) (*Client, error) {
+	timeout := c.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = defaultTimeoutSeconds
+	}
+	maxRetries := c.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.InsecureSkipVerify {
+		logrus.Warning("Opensearch TLS certificate verification is disabled")
+	}
+	if c.CACert != "" {
+		pem, err := ioutil.ReadFile(c.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read Opensearch CA bundle")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in Opensearch CA bundle " + c.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	newClient := &Client{
+		httpClient: &http.Client{
+			Timeout:   time.Duration(timeout) * time.Second,
+			Transport: transport,
+		},
+		maxRetries: maxRetries,
+		retryDelay: defaultRetryDelay,
+		authType:   c.AuthType,
+	}
+
+	switch c.AuthType {
+	case AuthTypeNone:
+	case AuthTypeBasic:
+		newClient.username = c.Username
+		newClient.password = os.Getenv("OPENSEARCH_PASSWORD")
+		if newClient.username == "" || newClient.password == "" {
+			return nil, errors.New("Opensearch basic authentication requires `username` and OPENSEARCH_PASSWORD to be set")
+		}
+	case AuthTypeApiKey:
+		newClient.apiKey = os.Getenv("OPENSEARCH_API_KEY")
+		if newClient.apiKey == "" {
+			return nil, errors.New("Opensearch API key authentication requires OPENSEARCH_API_KEY to be set")
+		}
+	case AuthTypeAwsSigV4:
+		if c.AwsRegion == "" {
+			return nil, errors.New("Opensearch AWS SigV4 authentication requires `aws_region` to be set")
+		}
+		options := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(c.AwsRegion)}
+		if c.AwsProfile != "" {
+			options = append(options, awsconfig.WithSharedConfigProfile(c.AwsProfile))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(context.TODO(), options...)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load AWS config for Opensearch")
+		}
+
+		newClient.signer = v4.NewSigner()
+		newClient.awsCredentials = cfg.Credentials
+		newClient.awsRegion = c.AwsRegion
+		newClient.awsService = c.AwsService
+		if newClient.awsService == "" {
+			newClient.awsService = defaultAwsService
+		}
+	default:
+		return nil, errors.New("unsupported Opensearch auth_type: " + c.AuthType)
+	}
+
+	return newClient, nil
+}
+
+// Do sends a request to the Opensearch service with the shared client
+func Do(req *http.Request) (*http.Response, error) {
+	return client.Do(req)
+}
+
+// Do sends a request to the Opensearch service, retrying it if the service can't be reached or is
+// temporarily unavailable
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	// The body is loaded so it can be signed and sent again when retrying
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read Opensearch request body")
+		}
+	}
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(req, body)
+		if attempt >= c.maxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		if err != nil {
+			logrus.Warnf("Opensearch request to %s failed, retrying: %s", req.URL.Path, err.Error())
+		} else {
+			logrus.Warnf("Opensearch request to %s failed with %s, retrying", req.URL.Path, resp.Status)
+			resp.Body.Close()
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send makes a single attempt of a request, adding authentication
+func (c *Client) send(req *http.Request, body []byte) (*http.Response, error) {
+	attempt := req.Clone(req.Context())
+	attempt.Body = http.NoBody
+	attempt.ContentLength = int64(len(body))
+	if len(body) > 0 {
+		attempt.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	switch c.authType {
+	case AuthTypeBasic:
+		attempt.SetBasicAuth(c.username, c.password)
+	case AuthTypeApiKey:
+		attempt.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	case AuthTypeAwsSigV4:
+		credentials, err := c.awsCredentials.Retrieve(req.Context())
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load AWS credentials for Opensearch")
+		}
+		hash := sha256.Sum256(body)
+		err = c.signer.SignHTTP(req.Context(), credentials, attempt, hex.EncodeToString(hash[:]),
+			c.awsService, c.awsRegion, time.Now())
+		if err != nil {
+			return nil, errors.Wrap(err, "could not sign Opensearch request")
+		}
+	}
+
+	return c.httpClient.Do(attempt)
+}
+
+// shouldRetry returns true if a request failed because the Opensearch service couldn't be reached or is
+// temporarily unavailable
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
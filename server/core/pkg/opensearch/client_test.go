@@ -0,0 +1,274 @@
+package opensearch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// testRequest is a request received by the test Opensearch service
+type testRequest struct {
+	header http.Header
+	body   string
+	time   time.Time
+}
+
+// testOpensearch is an Opensearch service that responds to each request with the next of its statuses,
+// and with 200 once they have all been used
+type testOpensearch struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []testRequest
+}
+
+func (s *testOpensearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, testRequest{header: r.Header, body: string(body), time: time.Now()})
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status = s.statuses[0]
+		s.statuses = s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestClient(authType string, maxRetries int) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		maxRetries: maxRetries,
+		retryDelay: 10 * time.Millisecond,
+		authType:   authType,
+	}
+}
+
+func sendTestRequest(t *testing.T, c *Client, url string) *http.Response {
+	req, err := http.NewRequest("POST", url+"/index/_search", strings.NewReader(`{"query": {"match_all": {}}}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestClientAuth(t *testing.T) {
+	basic := newTestClient(AuthTypeBasic, 0)
+	basic.username = "hoss"
+	basic.password = "secret"
+
+	apiKey := newTestClient(AuthTypeApiKey, 0)
+	apiKey.apiKey = "a2V5"
+
+	sigV4 := newTestClient(AuthTypeAwsSigV4, 0)
+	sigV4.signer = v4.NewSigner()
+	sigV4.awsCredentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+	})
+	sigV4.awsRegion = "us-east-1"
+	sigV4.awsService = "es"
+
+	tests := []struct {
+		name   string
+		client *Client
+		prefix string
+	}{
+		{"none", newTestClient(AuthTypeNone, 0), ""},
+		{"basic", basic, "Basic aG9zczpzZWNyZXQ="},
+		{"api key", apiKey, "ApiKey a2V5"},
+		{"aws sigv4", sigV4, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opensearch := &testOpensearch{}
+			server := httptest.NewServer(opensearch)
+			defer server.Close()
+
+			sendTestRequest(t, tt.client, server.URL)
+
+			test.AssertEqual(t, len(opensearch.requests), 1)
+			request := opensearch.requests[0]
+			authorization := request.header.Get("Authorization")
+			if tt.prefix == "" && authorization != "" {
+				t.Errorf("expected no Authorization header, got %s", authorization)
+			}
+			if !strings.HasPrefix(authorization, tt.prefix) {
+				t.Errorf("expected an Authorization header starting with %s, got %s", tt.prefix, authorization)
+			}
+			test.AssertEqual(t, request.body, `{"query": {"match_all": {}}}`)
+		})
+	}
+}
+
+func TestClientAuthAwsSigV4(t *testing.T) {
+	c := newTestClient(AuthTypeAwsSigV4, 1)
+	c.signer = v4.NewSigner()
+	c.awsCredentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}, nil
+	})
+	c.awsRegion = "eu-west-1"
+	c.awsService = "aoss"
+
+	opensearch := &testOpensearch{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(opensearch)
+	defer server.Close()
+
+	sendTestRequest(t, c, server.URL)
+
+	// every attempt is signed for the configured region and service
+	test.AssertEqual(t, len(opensearch.requests), 2)
+	for _, request := range opensearch.requests {
+		authorization := request.header.Get("Authorization")
+		if !strings.Contains(authorization, "/eu-west-1/aoss/aws4_request") {
+			t.Errorf("unexpected credential scope: %s", authorization)
+		}
+		if request.header.Get("X-Amz-Date") == "" {
+			t.Error("expected the X-Amz-Date header to be set")
+		}
+		test.AssertEqual(t, request.header.Get("X-Amz-Security-Token"), "token")
+		test.AssertEqual(t, request.body, `{"query": {"match_all": {}}}`)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		status     int
+		requests   int
+	}{
+		{"success", nil, 3, http.StatusOK, 1},
+		{"too many requests", []int{http.StatusTooManyRequests}, 3, http.StatusOK, 2},
+		{"unavailable", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}, 3, http.StatusOK, 4},
+		{"retries exhausted", []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}, 2, http.StatusServiceUnavailable, 3},
+		{"bad request", []int{http.StatusBadRequest}, 3, http.StatusBadRequest, 1},
+		{"internal server error", []int{http.StatusInternalServerError}, 3, http.StatusInternalServerError, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opensearch := &testOpensearch{statuses: tt.statuses}
+			server := httptest.NewServer(opensearch)
+			defer server.Close()
+
+			resp := sendTestRequest(t, newTestClient(AuthTypeNone, tt.maxRetries), server.URL)
+
+			test.AssertEqual(t, resp.StatusCode, tt.status)
+			test.AssertEqual(t, len(opensearch.requests), tt.requests)
+			// the body is sent again with every retry
+			for _, request := range opensearch.requests {
+				test.AssertEqual(t, request.body, `{"query": {"match_all": {}}}`)
+			}
+		})
+	}
+}
+
+func TestClientRetryBackoff(t *testing.T) {
+	opensearch := &testOpensearch{statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}}
+	server := httptest.NewServer(opensearch)
+	defer server.Close()
+
+	c := newTestClient(AuthTypeNone, 3)
+	c.retryDelay = 20 * time.Millisecond
+	sendTestRequest(t, c, server.URL)
+
+	// the delay doubles after each retry
+	test.AssertEqual(t, len(opensearch.requests), 4)
+	for i := 1; i < len(opensearch.requests); i++ {
+		delay := opensearch.requests[i].time.Sub(opensearch.requests[i-1].time)
+		want := c.retryDelay << uint(i-1)
+		if delay < want {
+			t.Errorf("expected retry %d to wait at least %v, waited %v", i, want, delay)
+		}
+	}
+}
+
+func TestClientRetryUnreachable(t *testing.T) {
+	server := httptest.NewServer(&testOpensearch{})
+	url := server.URL
+	server.Close()
+
+	req, err := http.NewRequest("GET", url+"/index", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	// a service that can't be reached is retried until the retries are used up
+	start := time.Now()
+	if _, err := newTestClient(AuthTypeNone, 2).Do(req); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected the request to be retried twice, returned after %v", elapsed)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	password := os.Getenv("OPENSEARCH_PASSWORD")
+	apiKey := os.Getenv("OPENSEARCH_API_KEY")
+	defer os.Setenv("OPENSEARCH_PASSWORD", password)
+	defer os.Setenv("OPENSEARCH_API_KEY", apiKey)
+	os.Setenv("OPENSEARCH_PASSWORD", "secret")
+	os.Setenv("OPENSEARCH_API_KEY", "a2V5")
+
+	c, err := NewClient(&config.OpenSearch{AuthType: AuthTypeBasic, Username: "hoss"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	test.AssertEqual(t, c.password, "secret")
+	test.AssertEqual(t, c.maxRetries, defaultMaxRetries)
+
+	c, err = NewClient(&config.OpenSearch{AuthType: AuthTypeApiKey, MaxRetries: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	test.AssertEqual(t, c.apiKey, "a2V5")
+	test.AssertEqual(t, c.maxRetries, 5)
+}
+
+func TestNewClientErrors(t *testing.T) {
+	password := os.Getenv("OPENSEARCH_PASSWORD")
+	apiKey := os.Getenv("OPENSEARCH_API_KEY")
+	defer os.Setenv("OPENSEARCH_PASSWORD", password)
+	defer os.Setenv("OPENSEARCH_API_KEY", apiKey)
+	os.Setenv("OPENSEARCH_PASSWORD", "")
+	os.Setenv("OPENSEARCH_API_KEY", "")
+
+	tests := []struct {
+		name   string
+		config config.OpenSearch
+	}{
+		{"basic without password", config.OpenSearch{AuthType: AuthTypeBasic, Username: "hoss"}},
+		{"api key without key", config.OpenSearch{AuthType: AuthTypeApiKey}},
+		{"aws sigv4 without region", config.OpenSearch{AuthType: AuthTypeAwsSigV4}},
+		{"unsupported auth type", config.OpenSearch{AuthType: "token"}},
+		{"missing CA bundle", config.OpenSearch{CACert: "/does/not/exist.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(&tt.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 
 	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-service/search"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -17,7 +19,14 @@ import (
 // IndexSource is the source data for a search index document.
 // Note, only a subset of the available fields are represented or used here.
 type IndexSource struct {
-	Metadata []string `json:"metadata"`
+	CoreServiceEndpoint string   `json:"core_service_endpoint"`
+	DatasetExtended     string   `json:"dataset_extended"`
+	ObjectKey           string   `json:"object_key"`
+	LastModifiedDate    string   `json:"last_modified_date"`
+	SizeBytes           int      `json:"size_bytes"`
+	Metadata            []string `json:"metadata"`
+	ContentHash         string   `json:"content_hash"`
+	SidecarMetadata     []string `json:"sidecar_metadata"`
 }
 
 // DocumentGetResponse is the response from the Opensearch API when doing a GET
@@ -36,26 +45,33 @@ func getDocumentID(p *MetadataIndexPayload) string {
 	return b64.StdEncoding.EncodeToString([]byte(strID))
 }
 
-func CreateOrUpdateDocument(opensearchEndpoint string, documentPayload *MetadataIndexPayload) error {
+// DatasetExtended returns the compound string used in the search index to identify a dataset
+// (<object store name>|<bucket name>|<root directory without the '/'>)
+func DatasetExtended(objectStoreName, bucketName, rootDirectory string) string {
+	return fmt.Sprintf("%s|%s|%s", objectStoreName, bucketName, strings.Replace(rootDirectory, "/", "", 1))
+}
+
+// CreateOrUpdateDocument adds or replaces a document in the metadata index, returning true if the document was created
+func CreateOrUpdateDocument(opensearchEndpoint string, documentPayload *MetadataIndexPayload) (bool, error) {
 	payloadBytes, err := json.Marshal(&documentPayload)
 	if err != nil {
-		return errors.Wrap(err, "unable to marshal payload JSON")
+		return false, errors.Wrap(err, "unable to marshal payload JSON")
 	}
 
 	// update metadata search index
-	path := opensearchEndpoint + "/metadata-index/_doc/" + getDocumentID(documentPayload)
-	err = makeMetadataIndexRequest("PUT", path, payloadBytes)
+	path := opensearchEndpoint + "/" + search.MetadataIndexAlias + "/_doc/" + getDocumentID(documentPayload)
+	status, err := makeMetadataIndexRequest("PUT", path, payloadBytes)
 	if err != nil {
-		return errors.New("could not add or update object in metadata index: " + err.Error())
+		return false, errors.New("could not add or update object in metadata index: " + err.Error())
 	}
 
-	return nil
+	return status == http.StatusCreated, nil
 }
 
 func DeleteDocument(opensearchEndpoint string, documentPayload *MetadataIndexPayload) error {
 	// update metadata search index
-	path := opensearchEndpoint + "/metadata-index/_doc/" + getDocumentID(documentPayload)
-	err := makeMetadataIndexRequest("DELETE", path, nil)
+	path := opensearchEndpoint + "/" + search.MetadataIndexAlias + "/_doc/" + getDocumentID(documentPayload)
+	_, err := makeMetadataIndexRequest("DELETE", path, nil)
 	if err != nil {
 		return errors.New("could not remove object from metadata index: " + err.Error())
 	}
@@ -64,16 +80,15 @@ func DeleteDocument(opensearchEndpoint string, documentPayload *MetadataIndexPay
 }
 
 func GetDocument(opensearchEndpoint string, documentPayload *MetadataIndexPayload) (*DocumentGetResponse, error) {
-	path := opensearchEndpoint + "/metadata-index/_doc/" + getDocumentID(documentPayload)
+	path := opensearchEndpoint + "/" + search.MetadataIndexAlias + "/_doc/" + getDocumentID(documentPayload)
 
-	client := &http.Client{}
 	req, err := http.NewRequest(http.MethodGet, path, nil)
 	if err != nil {
 		return nil, errors.New("could not create request when fetching document: " + err.Error())
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	resp, err := Do(req)
 	if err != nil {
 		return nil, errors.New("could not make request when fetching document: " + err.Error())
 	}
@@ -107,9 +122,9 @@ func GetDocument(opensearchEndpoint string, documentPayload *MetadataIndexPayloa
 	return &docResponse, nil
 }
 
-// makeMetadataIndexRequest is a helper function to make a REST request to the opensearch service
-func makeMetadataIndexRequest(verb string, path string, jsonBytes []byte) error {
-	client := &http.Client{}
+// makeMetadataIndexRequest is a helper function to make a REST request to the opensearch service, returning the
+// response status code
+func makeMetadataIndexRequest(verb string, path string, jsonBytes []byte) (int, error) {
 
 	var req *http.Request
 	var err error
@@ -119,36 +134,36 @@ func makeMetadataIndexRequest(verb string, path string, jsonBytes []byte) error
 		expectedStatus = []int{201, 200}
 		req, err = http.NewRequest(http.MethodPut, path, bytes.NewBuffer(jsonBytes))
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 	case "DELETE":
 		expectedStatus = []int{200}
 		req, err = http.NewRequest(http.MethodDelete, path, nil)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	default:
-		return errors.New("Unsupported request type: " + verb)
+		return 0, errors.New("Unsupported request type: " + verb)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	resp, err := Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	for _, code := range expectedStatus {
 		if code == resp.StatusCode {
-			return nil
+			return resp.StatusCode, nil
 		}
 	}
 
 	d, err := httputil.DumpResponse(resp, true)
 	if err != nil {
-		return errors.New("loading metadata index response after a failure resulted in an error: " + err.Error())
+		return 0, errors.New("loading metadata index response after a failure resulted in an error: " + err.Error())
 	}
 
-	return errors.New(fmt.Sprintf("metadata update request to target `%s` failed, Status Code %v, Response: %s",
+	return 0, errors.New(fmt.Sprintf("metadata update request to target `%s` failed, Status Code %v, Response: %s",
 		path, resp.Status, string(d)))
 }
@@ -2,44 +2,18 @@ package opensearch
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
+	"strings"
+	"time"
 
+	"github.com/gigantum/hoss-service/search"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-const metadataIndexMappings = `
-{
-   "mappings":{
-      "properties":{
-         "core_service_endpoint": {"type": "keyword"},
-		 "dataset_extended": {"type": "keyword"},
-		 "object_key": {"type": "keyword"},
-         "last_modified_date": {"type": "date"},
-         "size_bytes": {"type": "double"},
-		 "metadata": {
-			 "type": "keyword", 
-			 "normalizer": "lowercase",
-			"fields": {
-				"autocomplete": {
-					"type": "completion",
-					"contexts": [
-						{
-							"name": "dataset",
-							"type": "category",
-							"path": "dataset_extended"
-						}
-					]
-				}
-			}
-		}
-      }
-   }
- }
-`
-
 type MetadataIndexPayload struct {
 	// CoreServiceEndpoint is the core service root (e.g. http://localhost/core/v1)
 	CoreServiceEndpoint string `json:"core_service_endpoint"`
@@ -53,8 +27,20 @@ type MetadataIndexPayload struct {
 	SizeBytes int `json:"size_bytes"`
 	// Metadata is a list of strings representing key-pairs separated by ':' (e.g. ["fizz:buzz"])
 	Metadata []string `json:"metadata"`
+	// ContentHash is the hex encoded SHA-256 hash of the object's content
+	ContentHash string `json:"content_hash,omitempty"`
+	// TypedMetadata are the metadata values that are indexed by type, which is set by the core service
+	TypedMetadata []TypedMetadataValue `json:"typed_metadata"`
+	// SidecarMetadata are the key-pairs in Metadata that were loaded from the object's sidecar file, so they can be
+	// replaced when the sidecar file changes
+	SidecarMetadata []string `json:"sidecar_metadata,omitempty"`
+	// SchemaViolations describe how the metadata doesn't conform to the dataset's schema, which is set by the core service
+	SchemaViolations []string `json:"schema_violations,omitempty"`
 }
 
+// reindexPollInterval is how often the status of a reindex task is checked while migrating the metadata index
+const reindexPollInterval = 5 * time.Second
+
 // searchIndexExists Returns true if the specified index exists and false if it does not
 func searchIndexExists(opensearchEndpoint string, indexName string) (bool, error) {
 	req, err := http.NewRequest("HEAD", opensearchEndpoint+"/"+indexName, nil)
@@ -63,8 +49,7 @@ func searchIndexExists(opensearchEndpoint string, indexName string) (bool, error
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := Do(req)
 	if err != nil {
 		return false, errors.Wrap(err, "could not make request to check if index exists")
 	}
@@ -79,36 +64,294 @@ func searchIndexExists(opensearchEndpoint string, indexName string) (bool, error
 	}
 }
 
-// CreateMetadataSearchIndex checks if the metadata search index exists, if not, creates it
-func CreateMetadataSearchIndex(opensearchEndpoint string) error {
-	indexExists, err := searchIndexExists(opensearchEndpoint, "metadata-index")
+// getAliasedIndex returns the name of the index the alias points to, or an empty string if the alias doesn't exist
+func getAliasedIndex(opensearchEndpoint string, alias string) (string, error) {
+	req, err := http.NewRequest("GET", opensearchEndpoint+"/_alias/"+alias, nil)
 	if err != nil {
-		return err
+		return "", errors.Wrap(err, "could not create request to get index alias")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "could not make request to get index alias")
 	}
+	defer resp.Body.Close()
 
-	if !indexExists {
-		logrus.Info("Initializing 'metadata-index' opensearch index...")
-		req, err := http.NewRequest("PUT", opensearchEndpoint+"/metadata-index", bytes.NewBuffer([]byte(metadataIndexMappings)))
+	if resp.StatusCode == 404 {
+		return "", nil
+	} else if resp.StatusCode != 200 {
+		d, err := httputil.DumpResponse(resp, true)
 		if err != nil {
-			return errors.New("could not create metadata index request: " + err.Error())
+			return "", errors.New("failed to parse index alias response: " + err.Error())
 		}
-		req.Header.Set("Content-Type", "application/json")
+		return "", errors.New(fmt.Sprintf("problem with index alias response: StatusCode != 200: %s", string(d)))
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+	indexes := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&indexes); err != nil {
+		return "", errors.Wrap(err, "could not parse index alias response")
+	}
+	if len(indexes) > 1 {
+		return "", errors.New(fmt.Sprintf("alias `%s` points to %d indexes, expected 1", alias, len(indexes)))
+	}
+	for index := range indexes {
+		return index, nil
+	}
+	return "", nil
+}
+
+// metadataIndexVersion returns the mappings version of a versioned metadata index, or 0 if the name isn't versioned
+func metadataIndexVersion(indexName string) int {
+	version := 0
+	if _, err := fmt.Sscanf(indexName, search.MetadataIndexAlias+"-v%d", &version); err != nil {
+		return 0
+	}
+	return version
+}
+
+// createMetadataIndex creates an index with the current metadata index mappings, optionally adding the alias to
+// it. It returns false if the index already exists
+func createMetadataIndex(opensearchEndpoint string, indexName string, withAlias bool) (bool, error) {
+	body := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(search.MetadataIndexMappings), &body); err != nil {
+		return false, errors.Wrap(err, "could not parse metadata index mappings")
+	}
+	if withAlias {
+		body["aliases"] = map[string]interface{}{search.MetadataIndexAlias: map[string]interface{}{}}
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	response := map[string]interface{}{}
+	err = makeSearchIndexRequest(http.MethodPut, opensearchEndpoint+"/"+indexName, "application/json",
+		bytes.NewBuffer(bodyBytes), &response)
+	if err != nil {
+		// another core service instance created the index first
+		if strings.Contains(err.Error(), "resource_already_exists_exception") {
+			return false, nil
+		}
+		return false, errors.New("could not create metadata index: " + err.Error())
+	}
+
+	return true, nil
+}
+
+type reindexTaskResponse struct {
+	Task string `json:"task"`
+}
+
+type taskStatusResponse struct {
+	Completed bool `json:"completed"`
+	Error     *struct {
+		Reason string `json:"reason"`
+	} `json:"error"`
+	Response struct {
+		Created  int               `json:"created"`
+		Failures []json.RawMessage `json:"failures"`
+	} `json:"response"`
+}
+
+// reindexMetadataIndex copies the documents from one index to another, waiting for the copy to complete. Documents
+// that already exist in the destination index are not overwritten, so it's safe to run more than once
+func reindexMetadataIndex(opensearchEndpoint string, sourceIndex string, destIndex string) error {
+	payload := map[string]interface{}{
+		"conflicts": "proceed",
+		"source":    map[string]string{"index": sourceIndex},
+		"dest":      map[string]string{"index": destIndex, "op_type": "create"},
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	// large indexes can take longer than a request to copy, so the reindex runs as a task
+	task := reindexTaskResponse{}
+	err = makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/_reindex?wait_for_completion=false",
+		"application/json", bytes.NewBuffer(payloadBytes), &task)
+	if err != nil {
+		return errors.New("could not start reindex: " + err.Error())
+	}
+
+	for {
+		status := taskStatusResponse{}
+		err := makeSearchIndexRequest(http.MethodGet, opensearchEndpoint+"/_tasks/"+task.Task, "application/json",
+			&bytes.Buffer{}, &status)
 		if err != nil {
-			return errors.New("could not make metadata index request: " + err.Error())
+			return errors.New("could not get reindex status: " + err.Error())
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != 200 {
-			d, err := httputil.DumpResponse(resp, true)
-			if err != nil {
-				return errors.New("failed to parse create metadata index response: " + err.Error())
+		if status.Completed {
+			if status.Error != nil {
+				return errors.New("reindex failed: " + status.Error.Reason)
+			}
+			if len(status.Response.Failures) > 0 {
+				return errors.New(fmt.Sprintf("reindex failed for %d documents: %s",
+					len(status.Response.Failures), string(status.Response.Failures[0])))
 			}
-			return errors.New(fmt.Sprintf("problem with metadata index response: StatusCode != 200: %s", string(d)))
+			logrus.Infof("Copied %d documents from '%s' to '%s'", status.Response.Created, sourceIndex, destIndex)
+			return nil
+		}
+
+		time.Sleep(reindexPollInterval)
+	}
+}
+
+// updateAliases applies alias actions in a single atomic request
+func updateAliases(opensearchEndpoint string, actions []map[string]interface{}) error {
+	payloadBytes, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	response := map[string]interface{}{}
+	err = makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/_aliases", "application/json",
+		bytes.NewBuffer(payloadBytes), &response)
+	if err != nil {
+		return errors.New("could not update index aliases: " + err.Error())
+	}
+	return nil
+}
+
+// CreateMetadataSearchIndex makes sure the metadata index alias points to an index with the current mappings. If
+// the alias doesn't exist, the index is created. If the alias points to an index with older mappings, or the
+// metadata index was created before it was versioned, the documents are migrated to a new index in the background
+// while the old index keeps serving searches and updates, and the alias is switched to the new index when the copy
+// is complete. Updates and deletes made to documents while they are copied are not carried over to the new index,
+// so reconcile is called with the index version whenever this instance sees the alias point to the current
+// version, whether or not it switched the alias. It is called by every instance, on every boot, so it must only
+// rebuild the index once for each version
+func CreateMetadataSearchIndex(opensearchEndpoint string, reconcile func(version int) error) error {
+	targetIndex := search.MetadataIndexName(search.MetadataIndexVersion)
+
+	currentIndex, err := getAliasedIndex(opensearchEndpoint, search.MetadataIndexAlias)
+	if err != nil {
+		return err
+	}
+
+	if currentIndex == targetIndex {
+		// the instance that switched the alias may have stopped before the index was reconciled
+		reconcileMetadataIndex(reconcile)
+		return nil
+	}
+
+	if currentIndex != "" && metadataIndexVersion(currentIndex) > search.MetadataIndexVersion {
+		logrus.Warningf("Metadata index '%s' is newer than this service's version (%d), skipping migration",
+			currentIndex, search.MetadataIndexVersion)
+		return nil
+	}
+
+	// Before the index was versioned, `metadata-index` was a concrete index instead of an alias
+	legacyIndex := false
+	if currentIndex == "" {
+		legacyIndex, err = searchIndexExists(opensearchEndpoint, search.MetadataIndexAlias)
+		if err != nil {
+			return err
 		}
 	}
 
+	if currentIndex == "" && !legacyIndex {
+		logrus.Infof("Initializing '%s' opensearch index...", targetIndex)
+		if _, err := createMetadataIndex(opensearchEndpoint, targetIndex, true); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	go func() {
+		err := migrateMetadataIndex(opensearchEndpoint, currentIndex, targetIndex, legacyIndex)
+		if err != nil {
+			logrus.Errorf("Failed to migrate metadata index to '%s': %v", targetIndex, err.Error())
+		}
+
+		// Another instance may have switched the alias and removed the old index while this instance was copying
+		// it, so the index is reconciled if the alias points to the new index, even if this migration failed
+		aliasedIndex, err := getAliasedIndex(opensearchEndpoint, search.MetadataIndexAlias)
+		if err != nil {
+			logrus.Errorf("Failed to check the metadata index alias after migrating: %v", err.Error())
+			return
+		}
+		if aliasedIndex == targetIndex {
+			reconcileMetadataIndex(reconcile)
+		}
+	}()
+
+	return nil
+}
+
+// reconcileMetadataIndex schedules the rebuild of the current metadata index version
+func reconcileMetadataIndex(reconcile func(version int) error) {
+	if err := reconcile(search.MetadataIndexVersion); err != nil {
+		logrus.Errorf("Failed to schedule a search index rebuild after migrating the metadata index: %v", err.Error())
+	}
+}
+
+// migrateMetadataIndex copies the documents from the current index to the target index, switches the alias to the
+// target index, and removes the current index
+func migrateMetadataIndex(opensearchEndpoint string, currentIndex string, targetIndex string, legacyIndex bool) error {
+	sourceIndex := currentIndex
+	if legacyIndex {
+		sourceIndex = search.MetadataIndexAlias
+	}
+	logrus.Infof("Migrating metadata index from '%s' to '%s', searches use '%s' until the migration is complete...",
+		sourceIndex, targetIndex, sourceIndex)
+
+	// If the index already exists, another core service instance is migrating, or a migration was interrupted.
+	// Reindexing doesn't overwrite documents, so the migration is continued
+	if _, err := createMetadataIndex(opensearchEndpoint, targetIndex, false); err != nil {
+		return err
+	}
+
+	if err := reindexMetadataIndex(opensearchEndpoint, sourceIndex, targetIndex); err != nil {
+		return err
+	}
+
+	var actions []map[string]interface{}
+	if legacyIndex {
+		// The alias can't be added while an index with the same name exists, so the legacy index is removed
+		// in the same request. Documents written to it after the reindex are restored by the rebuild
+		actions = []map[string]interface{}{
+			{"add": map[string]string{"index": targetIndex, "alias": search.MetadataIndexAlias}},
+			{"remove_index": map[string]string{"index": search.MetadataIndexAlias}},
+		}
+	} else {
+		actions = []map[string]interface{}{
+			{"remove": map[string]string{"index": currentIndex, "alias": search.MetadataIndexAlias}},
+			{"add": map[string]string{"index": targetIndex, "alias": search.MetadataIndexAlias}},
+		}
+	}
+	if err := updateAliases(opensearchEndpoint, actions); err != nil {
+		// another core service instance may have switched the alias first
+		aliasedIndex, aliasErr := getAliasedIndex(opensearchEndpoint, search.MetadataIndexAlias)
+		if aliasErr != nil || aliasedIndex != targetIndex {
+			return err
+		}
+	}
+
+	if legacyIndex {
+		logrus.Infof("Migrated metadata index to '%s'", targetIndex)
+		return nil
+	}
+
+	// Copy documents created in the old index while the first reindex was running, then remove it
+	if err := reindexMetadataIndex(opensearchEndpoint, currentIndex, targetIndex); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, opensearchEndpoint+"/"+currentIndex, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not create request to remove the old metadata index")
+	}
+	resp, err := Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not remove the old metadata index")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 404 {
+		return errors.New(fmt.Sprintf("could not remove the old metadata index '%s', Status Code %v", currentIndex, resp.Status))
+	}
+
+	logrus.Infof("Migrated metadata index to '%s'", targetIndex)
 	return nil
 }
@@ -0,0 +1,280 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+	"github.com/gigantum/hoss-service/search"
+)
+
+// fakeCluster supports the requests made to migrate the metadata index. aliasedIndex is the index the alias points
+// to, and legacyIndex is true if `metadata-index` is a concrete index
+type fakeCluster struct {
+	mu sync.Mutex
+
+	aliasedIndex string
+	legacyIndex  bool
+	indexes      map[string]bool
+
+	reindexes      []string
+	aliasActions   []map[string]map[string]string
+	deletedIndexes []string
+
+	// beforeSwitch is called when the alias is switched. If it returns false the request fails, as if another
+	// instance switched the alias first
+	beforeSwitch func(f *fakeCluster) bool
+	// failReindex fails the copy of the old index, as if another instance removed it
+	failReindex bool
+}
+
+func newFakeCluster(aliasedIndex string, legacyIndex bool) *fakeCluster {
+	f := &fakeCluster{aliasedIndex: aliasedIndex, legacyIndex: legacyIndex, indexes: map[string]bool{}}
+	if aliasedIndex != "" {
+		f.indexes[aliasedIndex] = true
+	}
+	return f
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && path == "_alias/"+search.MetadataIndexAlias:
+		if f.aliasedIndex == "" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{f.aliasedIndex: map[string]interface{}{}})
+	case r.Method == http.MethodHead && path == search.MetadataIndexAlias:
+		if !f.legacyIndex {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		if f.indexes[path] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"type": "resource_already_exists_exception"}}`))
+			return
+		}
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.indexes[path] = true
+		if _, ok := body["aliases"]; ok {
+			f.aliasedIndex = path
+		}
+		w.Write([]byte(`{"acknowledged": true}`))
+	case r.Method == http.MethodPost && path == "_reindex":
+		body := struct {
+			Source struct {
+				Index string `json:"index"`
+			} `json:"source"`
+			Dest struct {
+				Index string `json:"index"`
+			} `json:"dest"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if f.failReindex {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"type": "index_not_found_exception"}}`))
+			return
+		}
+		f.reindexes = append(f.reindexes, body.Source.Index+">"+body.Dest.Index)
+		w.Write([]byte(`{"task": "node:1"}`))
+	case r.Method == http.MethodGet && path == "_tasks/node:1":
+		w.Write([]byte(`{"completed": true, "response": {"created": 1, "failures": []}}`))
+	case r.Method == http.MethodPost && path == "_aliases":
+		body := map[string][]map[string]map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.aliasActions = append(f.aliasActions, body["actions"]...)
+		if f.beforeSwitch != nil && !f.beforeSwitch(f) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"type": "aliases_not_found_exception"}}`))
+			return
+		}
+		for _, action := range body["actions"] {
+			if add, ok := action["add"]; ok {
+				f.aliasedIndex = add["index"]
+			}
+			if _, ok := action["remove_index"]; ok {
+				f.legacyIndex = false
+			}
+		}
+		w.Write([]byte(`{"acknowledged": true}`))
+	case r.Method == http.MethodDelete:
+		f.deletedIndexes = append(f.deletedIndexes, path)
+		delete(f.indexes, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// createIndex runs CreateMetadataSearchIndex against the fake cluster, returning the versions that were reconciled.
+// If migrates is true it waits for the background migration to reconcile the index, or to time out
+func createIndex(t *testing.T, f *fakeCluster, migrates bool) []int {
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	mu := sync.Mutex{}
+	reconciled := []int{}
+	done := make(chan struct{}, 1)
+	err := CreateMetadataSearchIndex(server.URL, func(version int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		reconciled = append(reconciled, version)
+		done <- struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create metadata index: %v", err)
+	}
+
+	if migrates {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return reconciled
+}
+
+// joinActions describes the alias actions sent to the cluster
+func joinActions(actions []map[string]map[string]string) string {
+	described := []string{}
+	for _, action := range actions {
+		for name, target := range action {
+			described = append(described, name+":"+target["index"])
+		}
+	}
+	return strings.Join(described, ",")
+}
+
+func TestMetadataIndexVersion(t *testing.T) {
+	test.AssertEqual(t, metadataIndexVersion("metadata-index-v1"), 1)
+	test.AssertEqual(t, metadataIndexVersion("metadata-index-v12"), 12)
+	test.AssertEqual(t, metadataIndexVersion("metadata-index"), 0)
+	test.AssertEqual(t, metadataIndexVersion("other-index-v3"), 0)
+}
+
+func TestCreateMetadataSearchIndexNew(t *testing.T) {
+	f := newFakeCluster("", false)
+
+	reconciled := createIndex(t, f, false)
+
+	target := search.MetadataIndexName(search.MetadataIndexVersion)
+	test.AssertEqual(t, f.aliasedIndex, target)
+	test.AssertEqual(t, len(f.reindexes), 0)
+	test.AssertEqual(t, len(reconciled), 0)
+}
+
+func TestCreateMetadataSearchIndexCurrent(t *testing.T) {
+	target := search.MetadataIndexName(search.MetadataIndexVersion)
+	f := newFakeCluster(target, false)
+
+	// the index is reconciled on every boot, in case the instance that switched the alias stopped first
+	reconciled := createIndex(t, f, false)
+
+	test.AssertEqual(t, len(f.reindexes), 0)
+	test.AssertEqual(t, len(f.aliasActions), 0)
+	test.AssertEqual(t, len(reconciled), 1)
+	test.AssertEqual(t, reconciled[0], search.MetadataIndexVersion)
+}
+
+func TestCreateMetadataSearchIndexNewer(t *testing.T) {
+	newer := search.MetadataIndexName(search.MetadataIndexVersion + 1)
+	f := newFakeCluster(newer, false)
+
+	reconciled := createIndex(t, f, false)
+
+	test.AssertEqual(t, f.aliasedIndex, newer)
+	test.AssertEqual(t, len(f.reindexes), 0)
+	test.AssertEqual(t, len(reconciled), 0)
+}
+
+func TestCreateMetadataSearchIndexMigrate(t *testing.T) {
+	target := search.MetadataIndexName(search.MetadataIndexVersion)
+	old := search.MetadataIndexName(search.MetadataIndexVersion - 1)
+	f := newFakeCluster(old, false)
+
+	reconciled := createIndex(t, f, true)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	test.AssertEqual(t, f.aliasedIndex, target)
+	test.AssertEqual(t, strings.Join(f.reindexes, ","), old+">"+target+","+old+">"+target)
+	test.AssertEqual(t, joinActions(f.aliasActions), "remove:"+old+",add:"+target)
+	test.AssertEqual(t, strings.Join(f.deletedIndexes, ","), old)
+	test.AssertEqual(t, len(reconciled), 1)
+	test.AssertEqual(t, reconciled[0], search.MetadataIndexVersion)
+}
+
+func TestCreateMetadataSearchIndexMigrateLegacy(t *testing.T) {
+	target := search.MetadataIndexName(search.MetadataIndexVersion)
+	f := newFakeCluster("", true)
+
+	reconciled := createIndex(t, f, true)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	test.AssertEqual(t, f.aliasedIndex, target)
+	test.AssertEqual(t, f.legacyIndex, false)
+	test.AssertEqual(t, strings.Join(f.reindexes, ","), search.MetadataIndexAlias+">"+target)
+	test.AssertEqual(t, joinActions(f.aliasActions), "add:"+target+",remove_index:"+search.MetadataIndexAlias)
+	test.AssertEqual(t, len(reconciled), 1)
+}
+
+func TestCreateMetadataSearchIndexSwitchedByAnotherInstance(t *testing.T) {
+	target := search.MetadataIndexName(search.MetadataIndexVersion)
+	old := search.MetadataIndexName(search.MetadataIndexVersion - 1)
+	f := newFakeCluster(old, false)
+	f.beforeSwitch = func(f *fakeCluster) bool {
+		f.aliasedIndex = target
+		return false
+	}
+
+	// the instance that didn't switch the alias still reconciles the index
+	reconciled := createIndex(t, f, true)
+
+	test.AssertEqual(t, len(reconciled), 1)
+	test.AssertEqual(t, reconciled[0], search.MetadataIndexVersion)
+}
+
+func TestCreateMetadataSearchIndexSwitchFailed(t *testing.T) {
+	old := search.MetadataIndexName(search.MetadataIndexVersion - 1)
+	f := newFakeCluster(old, false)
+	f.beforeSwitch = func(f *fakeCluster) bool {
+		return false
+	}
+
+	// the alias still points to the old index, so the new index isn't reconciled yet
+	reconciled := createIndex(t, f, true)
+
+	test.AssertEqual(t, f.aliasedIndex, old)
+	test.AssertEqual(t, len(reconciled), 0)
+}
+
+func TestCreateMetadataSearchIndexOldIndexRemoved(t *testing.T) {
+	target := search.MetadataIndexName(search.MetadataIndexVersion)
+	old := search.MetadataIndexName(search.MetadataIndexVersion - 1)
+	f := newFakeCluster(old, false)
+	f.beforeSwitch = func(f *fakeCluster) bool {
+		// another instance switched the alias and removed the old index before the second copy
+		f.aliasedIndex = target
+		f.failReindex = true
+		return false
+	}
+
+	// the migration fails, but the alias points to the new index, so it is reconciled
+	reconciled := createIndex(t, f, true)
+
+	test.AssertEqual(t, len(reconciled), 1)
+}
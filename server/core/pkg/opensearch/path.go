@@ -0,0 +1,65 @@
+package opensearch
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// minFilenameLength is the length of the shortest filename search, which is the shortest n-gram in the
+// `object_key.filename` field
+const minFilenameLength = 2
+
+// FilenameQuery returns an opensearch query that matches objects whose file name (the last segment of the
+// object key) contains name, case insensitively
+func FilenameQuery(name string) (map[string]interface{}, error) {
+	if len([]rune(name)) < minFilenameLength {
+		return nil, errors.New("filename must be at least 2 characters")
+	}
+	if strings.Contains(name, "/") {
+		return nil, errors.New("filename can't contain `/`, use path to search directories")
+	}
+
+	// every n-gram of the name must be in the file name. N-grams don't preserve order, so this can rarely match
+	// a file name that contains the same n-grams in a different order
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			"object_key.filename": map[string]interface{}{
+				"query":    name,
+				"operator": "and",
+			},
+		},
+	}, nil
+}
+
+// PathSearchQuery returns an opensearch query that matches objects by their path, relative to the dataset root.
+// A path starting with `/` matches the objects under that directory (e.g. `/raw/session_03`), otherwise the path
+// segments match anywhere in the object's path, case insensitively (e.g. `session_03` or `raw/session_03`). A
+// leading `*/` and trailing `/*` are ignored, so `*/session_03/*` is the same as `session_03`
+func PathSearchQuery(path string) (map[string]interface{}, error) {
+	if strings.HasPrefix(path, "/") {
+		dir := strings.Trim(path, "/")
+		if dir == "" {
+			return map[string]interface{}{"match_all": map[string]interface{}{}}, nil
+		}
+		if strings.ContainsAny(dir, "*?") {
+			return nil, errors.New("path can't contain wildcards, use a `path=` term in q for path patterns")
+		}
+		return map[string]interface{}{
+			"term": map[string]interface{}{"object_key.path": dir},
+		}, nil
+	}
+
+	segments := strings.TrimSuffix(strings.TrimPrefix(path, "*/"), "/*")
+	segments = strings.Trim(segments, "/")
+	if segments == "" {
+		return nil, errors.New("path must contain at least one path segment")
+	}
+	if strings.ContainsAny(segments, "*?") {
+		return nil, errors.New("path can't contain wildcards, use a `path=` term in q for path patterns")
+	}
+
+	return map[string]interface{}{
+		"match_phrase": map[string]interface{}{"object_key.segments": segments},
+	}, nil
+}
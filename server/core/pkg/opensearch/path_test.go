@@ -0,0 +1,103 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+	"github.com/gigantum/hoss-service/search"
+)
+
+func TestFilenameQuery(t *testing.T) {
+	query, err := FilenameQuery("Calib")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the name is lower cased and split into n-grams by the field's search analyzer
+	assertQueryJSON(t, query, `{"match": {"object_key.filename": {"query": "Calib", "operator": "and"}}}`)
+
+	for _, name := range []string{"", "a", "raw/calib"} {
+		if _, err := FilenameQuery(name); err == nil {
+			t.Errorf("expected an error for the file name '%s'", name)
+		}
+	}
+}
+
+func TestPathSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		// a leading `/` matches objects under the directory of the dataset
+		{"directory", "/raw/session_03", `{"term": {"object_key.path": "raw/session_03"}}`},
+		{"directory with trailing slash", "/raw/session_03/", `{"term": {"object_key.path": "raw/session_03"}}`},
+		{"dataset root", "/", `{"match_all": {}}`},
+
+		// otherwise the segments match anywhere in the path
+		{"segment", "session_03", `{"match_phrase": {"object_key.segments": "session_03"}}`},
+		{"segments", "raw/session_03", `{"match_phrase": {"object_key.segments": "raw/session_03"}}`},
+		{"glob segment", "*/session_03/*", `{"match_phrase": {"object_key.segments": "session_03"}}`},
+		{"slashes", "raw/session_03/", `{"match_phrase": {"object_key.segments": "raw/session_03"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := PathSearchQuery(tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertQueryJSON(t, query, tt.want)
+		})
+	}
+}
+
+func TestPathSearchQueryErrors(t *testing.T) {
+	for _, path := range []string{"", "*/", "raw/*/data", "/raw/session_*", "session_0?"} {
+		if _, err := PathSearchQuery(path); err == nil {
+			t.Errorf("expected an error for the path '%s'", path)
+		}
+	}
+}
+
+func TestObjectKeyPathMappings(t *testing.T) {
+	index := struct {
+		Settings struct {
+			Analysis struct {
+				Analyzer map[string]json.RawMessage `json:"analyzer"`
+			} `json:"analysis"`
+		} `json:"settings"`
+		Mappings struct {
+			Properties struct {
+				ObjectKey struct {
+					Type   string `json:"type"`
+					Fields map[string]struct {
+						Analyzer       string `json:"analyzer"`
+						SearchAnalyzer string `json:"search_analyzer"`
+					} `json:"fields"`
+				} `json:"object_key"`
+			} `json:"properties"`
+		} `json:"mappings"`
+	}{}
+	if err := json.Unmarshal([]byte(search.MetadataIndexMappings), &index); err != nil {
+		t.Fatalf("invalid index mappings: %v", err)
+	}
+
+	// the object key is still a keyword, so sorting and exact matches are unchanged
+	objectKey := index.Mappings.Properties.ObjectKey
+	test.AssertEqual(t, objectKey.Type, "keyword")
+
+	// every field the path queries search is analyzed with a defined analyzer
+	for _, field := range []string{"path", "segments", "filename"} {
+		mapping, ok := objectKey.Fields[field]
+		if !ok {
+			t.Errorf("expected the object_key.%s field to be mapped", field)
+			continue
+		}
+		for _, analyzer := range []string{mapping.Analyzer, mapping.SearchAnalyzer} {
+			if _, ok := index.Settings.Analysis.Analyzer[analyzer]; !ok && analyzer != "keyword" {
+				t.Errorf("object_key.%s uses the undefined analyzer '%s'", field, analyzer)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package opensearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gigantum/hoss-service/search"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// savedSearchIndexPrefix is the prefix of the percolator index that holds the queries of saved searches, which
+// newly indexed documents are matched against to notify subscribers
+const savedSearchIndexPrefix = "saved-search-index"
+
+// percolateBatchSize is the number of matching saved searches loaded at a time by PercolateDocuments
+const percolateBatchSize = 1000
+
+// savedSearchIndexName returns the name of the saved search index for a version of the metadata index mappings
+func savedSearchIndexName(version int) string {
+	return fmt.Sprintf("%s-v%d", savedSearchIndexPrefix, version)
+}
+
+type savedSearchDocument struct {
+	SavedSearchId int64       `json:"saved_search_id"`
+	Query         interface{} `json:"query"`
+}
+
+type percolateResponse struct {
+	Hits struct {
+		Hits []struct {
+			Source struct {
+				SavedSearchId int64 `json:"saved_search_id"`
+			} `json:"_source"`
+			Fields struct {
+				DocumentSlots []int `json:"_percolator_document_slot"`
+			} `json:"fields"`
+			Sort []json.RawMessage `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// CreateSavedSearchIndex creates the saved search index for the current metadata index mappings if it doesn't exist,
+// and removes the indexes for older mappings. The index has the metadata index mappings, so saved search queries are
+// parsed the same way as searches. It returns true if the index was created, in which case the queries of every
+// saved search must be added to it
+func CreateSavedSearchIndex(opensearchEndpoint string) (bool, error) {
+	indexName := savedSearchIndexName(search.MetadataIndexVersion)
+
+	exists, err := searchIndexExists(opensearchEndpoint, indexName)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	body := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(search.MetadataIndexMappings), &body); err != nil {
+		return false, errors.Wrap(err, "could not parse metadata index mappings")
+	}
+	mappings, _ := body["mappings"].(map[string]interface{})
+	properties, _ := mappings["properties"].(map[string]interface{})
+	if properties == nil {
+		return false, errors.New("metadata index mappings have no properties")
+	}
+	properties["saved_search_id"] = map[string]string{"type": "long"}
+	properties["query"] = map[string]string{"type": "percolator"}
+
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	logrus.Infof("Initializing '%s' opensearch index...", indexName)
+	response := map[string]interface{}{}
+	err = makeSearchIndexRequest(http.MethodPut, opensearchEndpoint+"/"+indexName, "application/json",
+		bytes.NewBuffer(bodyBytes), &response)
+	if err != nil {
+		// another core service instance created the index first
+		if strings.Contains(err.Error(), "resource_already_exists_exception") {
+			return false, nil
+		}
+		return false, errors.New("could not create saved search index: " + err.Error())
+	}
+
+	// the queries in older indexes are added to the new index by the caller
+	for version := 1; version < search.MetadataIndexVersion; version++ {
+		req, err := http.NewRequest(http.MethodDelete, opensearchEndpoint+"/"+savedSearchIndexName(version), nil)
+		if err != nil {
+			return true, errors.Wrap(err, "could not create request to remove old saved search index")
+		}
+		resp, err := Do(req)
+		if err != nil {
+			return true, errors.Wrap(err, "could not remove old saved search index")
+		}
+		resp.Body.Close()
+	}
+
+	return true, nil
+}
+
+// PutSavedSearchQueries adds or replaces the queries of saved searches in the saved search index, keyed by the
+// saved search id. The request waits for the queries to be searchable
+func PutSavedSearchQueries(opensearchEndpoint string, queries map[int64]interface{}) error {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for id, query := range queries {
+		target := &bulkActionTarget{Index: savedSearchIndexName(search.MetadataIndexVersion), Id: strconv.FormatInt(id, 10)}
+		if err := encoder.Encode(&bulkAction{Index: target}); err != nil {
+			return errors.Wrap(err, "unable to marshal bulk action JSON")
+		}
+		if err := encoder.Encode(&savedSearchDocument{SavedSearchId: id, Query: query}); err != nil {
+			return errors.Wrap(err, "unable to marshal payload JSON")
+		}
+	}
+
+	return saveSavedSearchQueries(opensearchEndpoint, &body)
+}
+
+// DeleteSavedSearchQuery removes the query of a saved search from the saved search index. There is no error if the
+// query doesn't exist
+func DeleteSavedSearchQuery(opensearchEndpoint string, id int64) error {
+	var body bytes.Buffer
+	target := &bulkActionTarget{Index: savedSearchIndexName(search.MetadataIndexVersion), Id: strconv.FormatInt(id, 10)}
+	if err := json.NewEncoder(&body).Encode(&bulkAction{Delete: target}); err != nil {
+		return errors.Wrap(err, "unable to marshal bulk action JSON")
+	}
+
+	return saveSavedSearchQueries(opensearchEndpoint, &body)
+}
+
+// saveSavedSearchQueries sends a bulk request to the saved search index, returning an error if any item failed
+func saveSavedSearchQueries(opensearchEndpoint string, body *bytes.Buffer) error {
+	response := bulkResponse{}
+	err := makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/_bulk?refresh=wait_for", "application/x-ndjson",
+		body, &response)
+	if err != nil {
+		return errors.New("saved search index request failed: " + err.Error())
+	}
+
+	for _, item := range response.Items {
+		for _, itemResult := range item {
+			// removing a query that doesn't exist is not a failure
+			if itemResult.Error != nil && itemResult.Status != http.StatusNotFound {
+				return errors.New("could not save saved search query: " + itemResult.Error.Type + ": " + itemResult.Error.Reason)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PercolateDocuments matches documents against the queries in the saved search index, without searching the
+// metadata index, so documents can be matched as soon as they are indexed. It returns a map of the ids of the
+// matching saved searches to the positions of the documents they match
+func PercolateDocuments(opensearchEndpoint string, documentPayloads []*MetadataIndexPayload) (map[int64][]int, error) {
+	matches := map[int64][]int{}
+	if len(documentPayloads) == 0 {
+		return matches, nil
+	}
+
+	payload := map[string]interface{}{
+		"size":    percolateBatchSize,
+		"_source": []string{"saved_search_id"},
+		"sort":    []interface{}{map[string]string{"saved_search_id": "asc"}},
+		"query": map[string]interface{}{
+			"percolate": map[string]interface{}{
+				"field":     "query",
+				"documents": documentPayloads,
+			},
+		},
+	}
+
+	for {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to marshal payload JSON")
+		}
+
+		response := percolateResponse{}
+		err = makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/"+savedSearchIndexName(search.MetadataIndexVersion)+"/_search",
+			"application/json", bytes.NewBuffer(payloadBytes), &response)
+		if err != nil {
+			return nil, errors.New("could not match documents to saved searches: " + err.Error())
+		}
+
+		for _, hit := range response.Hits.Hits {
+			slots := hit.Fields.DocumentSlots
+			// a single document is not given a slot
+			if len(slots) == 0 {
+				slots = []int{0}
+			}
+			matches[hit.Source.SavedSearchId] = slots
+		}
+
+		if len(response.Hits.Hits) < percolateBatchSize {
+			return matches, nil
+		}
+		payload["search_after"] = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	}
+}
@@ -0,0 +1,646 @@
+package opensearch
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+)
+
+// The metadata query language is parsed into an opensearch bool query. The syntax is:
+//
+//	key:value          metadata key-value pair, matched case insensitively
+//	key:val*           metadata value wildcard (`*` matches any characters, `?` matches one character)
+//	key:*              metadata key exists
+//	key>100            typed metadata comparison, using one of = > >= < <= and a number, date, or boolean (= only) value.
+//	                   The value is parsed as the key's type in the dataset's schema, otherwise the type is inferred
+//	size>10MB          object size comparison, using one of = > >= < <= and an optional B, KB, MB, GB, or TB unit
+//	path=raw/**/*.tif  object path (relative to the dataset) pattern, `*` and `?` don't match `/`, `**` matches anything
+//	a AND b, a b       both expressions match
+//	a OR b             either expression matches
+//	NOT a              the expression doesn't match
+//	( ... )            grouping
+//
+// Values containing whitespace or parentheses can be quoted (e.g. key:"some value"), and `\` escapes the next character.
+// AND binds tighter than OR, so `a OR b AND c` is the same as `a OR (b AND c)`.
+
+const (
+	// maxQueryTerms limits the number of terms in a query, to protect the search index from expensive queries
+	maxQueryTerms = 100
+	// maxQueryDepth limits the nesting of a query
+	maxQueryDepth = 32
+)
+
+// QueryError is returned when a metadata query can't be parsed
+type QueryError struct {
+	// Position is the character offset in the query where the error occurred
+	Position int
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Position, e.Message)
+}
+
+// ParseMetadataQuery parses a metadata query into an opensearch query that can be used in a bool filter. Comparisons
+// of keys declared in types (e.g. the searched dataset's schema) use the declared type, the type of other keys is
+// inferred from the compared value
+func ParseMetadataQuery(query string, types map[string]string) (map[string]interface{}, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &QueryError{Position: 0, Message: "query is empty"}
+	}
+
+	terms := 0
+	for _, t := range tokens {
+		if t.kind == tokenTerm {
+			terms++
+		}
+	}
+	if terms > maxQueryTerms {
+		return nil, &QueryError{Position: 0, Message: fmt.Sprintf("query has more than %d terms", maxQueryTerms)}
+	}
+
+	// metadata keys are matched case insensitively
+	declaredTypes := map[string]string{}
+	for key, metadataType := range types {
+		declaredTypes[strings.ToLower(key)] = metadataType
+	}
+
+	p := &queryParser{tokens: tokens, length: len([]rune(query)), types: declaredTypes}
+	q, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if t.kind == tokenRParen {
+			return nil, &QueryError{Position: t.position, Message: "unmatched ')'"}
+		}
+		return nil, &QueryError{Position: t.position, Message: "expected AND, OR, or the end of the query"}
+	}
+
+	return q, nil
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind     tokenKind
+	position int
+
+	// field, operator, and value are only set for tokenTerm
+	field    string
+	operator string
+	value    string
+	// wildcard is true if the value contains an unescaped `*` or `?`
+	wildcard bool
+}
+
+func isQuerySpace(r rune) bool {
+	return unicode.IsSpace(r)
+}
+
+func isOperatorStart(r rune) bool {
+	return r == ':' || r == '=' || r == '<' || r == '>'
+}
+
+// tokenizeQuery splits a query into keywords, parentheses, and `<field><operator><value>` terms
+func tokenizeQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := []queryToken{}
+
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case isQuerySpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, position: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, position: i})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !isQuerySpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && !isOperatorStart(runes[i]) {
+				i++
+			}
+			// technical metadata keys include a ':', which is not an operator
+			if string(runes[start:i])+":" == TechnicalMetadataPrefix && i < len(runes) && runes[i] == ':' {
+				i++
+				for i < len(runes) && !isQuerySpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && !isOperatorStart(runes[i]) {
+					i++
+				}
+			}
+			field := string(runes[start:i])
+
+			// keywords are only recognized when they are not followed by an operator
+			if i >= len(runes) || !isOperatorStart(runes[i]) {
+				switch field {
+				case "AND":
+					tokens = append(tokens, queryToken{kind: tokenAnd, position: start})
+				case "OR":
+					tokens = append(tokens, queryToken{kind: tokenOr, position: start})
+				case "NOT":
+					tokens = append(tokens, queryToken{kind: tokenNot, position: start})
+				default:
+					return nil, &QueryError{Position: start,
+						Message: fmt.Sprintf("expected a term in the format <key>:<value>, found '%s'", field)}
+				}
+				continue
+			}
+			if field == "" {
+				return nil, &QueryError{Position: start, Message: "missing key before operator"}
+			}
+
+			opStart := i
+			operator := string(runes[i])
+			i++
+			if (operator == "<" || operator == ">") && i < len(runes) && runes[i] == '=' {
+				operator += "="
+				i++
+			}
+
+			value, wildcard, next, err := readQueryValue(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			if value == "" {
+				return nil, &QueryError{Position: opStart, Message: fmt.Sprintf("missing value after '%s%s'", field, operator)}
+			}
+			i = next
+
+			tokens = append(tokens, queryToken{
+				kind:     tokenTerm,
+				position: start,
+				field:    field,
+				operator: operator,
+				value:    value,
+				wildcard: wildcard,
+			})
+		}
+	}
+
+	return tokens, nil
+}
+
+// readQueryValue reads a quoted or unquoted value starting at i, returning the value with escapes preserved
+// for wildcard characters, if the value contains a wildcard, and the position after the value
+func readQueryValue(runes []rune, i int) (string, bool, int, error) {
+	var value strings.Builder
+	wildcard := false
+
+	quoted := i < len(runes) && runes[i] == '"'
+	start := i
+	if quoted {
+		i++
+	}
+
+	for i < len(runes) {
+		r := runes[i]
+		if quoted && r == '"' {
+			return value.String(), wildcard, i + 1, nil
+		}
+		if !quoted && (isQuerySpace(r) || r == '(' || r == ')') {
+			break
+		}
+
+		if r == '\\' {
+			if i+1 >= len(runes) {
+				return "", false, 0, &QueryError{Position: i, Message: "escape character at the end of the query"}
+			}
+			// wildcard characters stay escaped so they are matched literally in wildcard queries
+			if runes[i+1] == '*' || runes[i+1] == '?' || runes[i+1] == '\\' {
+				value.WriteRune('\\')
+			}
+			value.WriteRune(runes[i+1])
+			i += 2
+			continue
+		}
+
+		if r == '*' || r == '?' {
+			wildcard = true
+		}
+		value.WriteRune(r)
+		i++
+	}
+
+	if quoted {
+		return "", false, 0, &QueryError{Position: start, Message: "unterminated quoted value"}
+	}
+	return value.String(), wildcard, i, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	length int
+	// types are the declared types of metadata keys, by lowercase key
+	types map[string]string
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *queryParser) endPosition() int {
+	return p.length
+}
+
+func (p *queryParser) parseOr(depth int) (map[string]interface{}, error) {
+	clauses := []interface{}{}
+	for {
+		q, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, q)
+
+		if t := p.peek(); t == nil || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+
+	if len(clauses) == 1 {
+		return clauses[0].(map[string]interface{}), nil
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               clauses,
+			"minimum_should_match": 1,
+		},
+	}, nil
+}
+
+func (p *queryParser) parseAnd(depth int) (map[string]interface{}, error) {
+	clauses := []interface{}{}
+	for {
+		q, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, q)
+
+		// AND is optional between expressions
+		t := p.peek()
+		if t == nil || t.kind == tokenOr || t.kind == tokenRParen {
+			break
+		}
+		if t.kind == tokenAnd {
+			p.pos++
+		}
+	}
+
+	if len(clauses) == 1 {
+		return clauses[0].(map[string]interface{}), nil
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": clauses,
+		},
+	}, nil
+}
+
+func (p *queryParser) parseNot(depth int) (map[string]interface{}, error) {
+	t := p.peek()
+	if depth > maxQueryDepth && t != nil {
+		return nil, &QueryError{Position: t.position, Message: "query is nested too deeply"}
+	}
+
+	if t != nil && t.kind == tokenNot {
+		p.pos++
+		q, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []interface{}{q},
+			},
+		}, nil
+	}
+
+	return p.parsePrimary(depth)
+}
+
+func (p *queryParser) parsePrimary(depth int) (map[string]interface{}, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, &QueryError{Position: p.endPosition(), Message: "unexpected end of query"}
+	}
+
+	switch t.kind {
+	case tokenLParen:
+		p.pos++
+		q, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokenRParen {
+			return nil, &QueryError{Position: t.position, Message: "unmatched '('"}
+		}
+		p.pos++
+		return q, nil
+	case tokenTerm:
+		p.pos++
+		return termQuery(t, p.types)
+	case tokenRParen:
+		return nil, &QueryError{Position: t.position, Message: "unexpected ')'"}
+	default:
+		return nil, &QueryError{Position: t.position, Message: "expected a term or '('"}
+	}
+}
+
+// termQuery converts a single term into an opensearch query
+func termQuery(t *queryToken, types map[string]string) (map[string]interface{}, error) {
+	switch t.operator {
+	case ":":
+		return metadataQuery(t)
+	default:
+		switch t.field {
+		case "size":
+			return sizeQuery(t)
+		case "path":
+			if t.operator != "=" {
+				return nil, &QueryError{Position: t.position, Message: "path only supports the '=' operator"}
+			}
+			return pathQuery(t), nil
+		default:
+			return typedQuery(t, types)
+		}
+	}
+}
+
+// metadataQuery matches the `metadata` field, which stores pairs as lowercase "<key>:<value>" strings
+func metadataQuery(t *queryToken) (map[string]interface{}, error) {
+	key := strings.ToLower(t.field)
+	value := strings.ToLower(t.value)
+
+	if value == "*" {
+		return map[string]interface{}{
+			"prefix": map[string]interface{}{"metadata": key + ":"},
+		}, nil
+	}
+
+	if t.wildcard {
+		return map[string]interface{}{
+			"wildcard": map[string]interface{}{"metadata": escapeWildcard(key) + ":" + value},
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"term": map[string]interface{}{"metadata": key + ":" + unescapeWildcard(value)},
+	}, nil
+}
+
+// typedQuery compares the typed value of a metadata key, stored in the nested `typed_metadata` field. The value is
+// parsed as the key's declared type, or if the key isn't declared the type is inferred from the value
+func typedQuery(t *queryToken, types map[string]string) (map[string]interface{}, error) {
+	metadataType, declared := types[strings.ToLower(t.field)]
+	if !declared {
+		metadataType = InferMetadataType(t.value)
+	}
+
+	var comparison map[string]interface{}
+	switch metadataType {
+	case database.METADATA_TYPE_NUMBER:
+		n, ok := parseMetadataNumber(t.value)
+		if !ok {
+			return nil, declaredTypeError(t, metadataType)
+		}
+		comparison = map[string]interface{}{
+			"range": map[string]interface{}{"typed_metadata.number": rangeBounds(t.operator, n, n, false)},
+		}
+	case database.METADATA_TYPE_DATE:
+		start, end, period, ok := parseQueryDate(t.value)
+		if !ok {
+			return nil, declaredTypeError(t, metadataType)
+		}
+		bounds := rangeBounds(t.operator, start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano), period)
+		comparison = map[string]interface{}{
+			"range": map[string]interface{}{"typed_metadata.date": bounds},
+		}
+	case database.METADATA_TYPE_BOOLEAN:
+		if t.operator != "=" {
+			return nil, &QueryError{Position: t.position, Message: "boolean values only support the '=' operator"}
+		}
+		b, ok := parseMetadataBoolean(t.value)
+		if !ok {
+			return nil, declaredTypeError(t, metadataType)
+		}
+		comparison = map[string]interface{}{
+			"term": map[string]interface{}{"typed_metadata.boolean": b},
+		}
+	default:
+		if declared {
+			return nil, &QueryError{Position: t.position,
+				Message: fmt.Sprintf("%s is a string in the dataset's schema, use %s:<value> to match text", t.field, t.field)}
+		}
+		return nil, &QueryError{Position: t.position,
+			Message: fmt.Sprintf("'%s' is not a number, date, or boolean, use %s:<value> to match text", t.value, t.field)}
+	}
+
+	return map[string]interface{}{
+		"nested": map[string]interface{}{
+			"path": "typed_metadata",
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"filter": []interface{}{
+						map[string]interface{}{
+							"term": map[string]interface{}{"typed_metadata.key": strings.ToLower(t.field)},
+						},
+						comparison,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// declaredTypeError is returned when a compared value can't be parsed as the key's declared type
+func declaredTypeError(t *queryToken, metadataType string) error {
+	return &QueryError{Position: t.position,
+		Message: fmt.Sprintf("'%s' is not a %s, which is the type of %s in the dataset's schema", t.value, metadataType, t.field)}
+}
+
+// rangeBounds converts a comparison into the bounds of a range query. If period is true the value covers the
+// period from start up to (but not including) end, e.g. a whole day, otherwise start and end are the same value
+func rangeBounds(operator string, start, end interface{}, period bool) map[string]interface{} {
+	if !period {
+		switch operator {
+		case "=":
+			return map[string]interface{}{"gte": start, "lte": start}
+		case ">":
+			return map[string]interface{}{"gt": start}
+		case ">=":
+			return map[string]interface{}{"gte": start}
+		case "<":
+			return map[string]interface{}{"lt": start}
+		default:
+			return map[string]interface{}{"lte": start}
+		}
+	}
+
+	switch operator {
+	case "=":
+		return map[string]interface{}{"gte": start, "lt": end}
+	case ">":
+		return map[string]interface{}{"gte": end}
+	case ">=":
+		return map[string]interface{}{"gte": start}
+	case "<":
+		return map[string]interface{}{"lt": start}
+	default:
+		return map[string]interface{}{"lt": end}
+	}
+}
+
+// queryDatePeriods are the formats of compared dates that cover a period rather than an instant, with the
+// length of the period in years, months, and days
+var queryDatePeriods = []struct {
+	layout string
+	years  int
+	months int
+	days   int
+}{
+	{"2006-01-02", 0, 0, 1},
+	{"20060102", 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// parseQueryDate parses a compared date, returning the start and end of the period it covers and true if it
+// covers a period. Timestamps are a single instant, so the start and end are the same
+func parseQueryDate(value string) (time.Time, time.Time, bool, bool) {
+	value = strings.TrimSpace(value)
+	for _, p := range queryDatePeriods {
+		if d, err := time.Parse(p.layout, value); err == nil {
+			return d, d.AddDate(p.years, p.months, p.days), true, true
+		}
+	}
+
+	d, ok := parseMetadataDate(value)
+	return d, d, false, ok
+}
+
+// sizeUnits are the supported size units, using binary multiples
+var sizeUnits = map[string]float64{
+	"":   1,
+	"b":  1,
+	"kb": 1 << 10,
+	"mb": 1 << 20,
+	"gb": 1 << 30,
+	"tb": 1 << 40,
+}
+
+func sizeQuery(t *queryToken) (map[string]interface{}, error) {
+	value := strings.ToLower(t.value)
+	split := strings.IndexFunc(value, unicode.IsLetter)
+	if split < 0 {
+		split = len(value)
+	}
+
+	multiplier, ok := sizeUnits[value[split:]]
+	if !ok {
+		return nil, &QueryError{Position: t.position,
+			Message: fmt.Sprintf("unknown size unit '%s', expected one of B, KB, MB, GB, or TB", t.value[split:])}
+	}
+	number, err := strconv.ParseFloat(value[:split], 64)
+	if err != nil || number < 0 || math.IsInf(number, 0) || math.IsNaN(number) {
+		return nil, &QueryError{Position: t.position, Message: fmt.Sprintf("invalid size '%s'", t.value)}
+	}
+	size := math.Round(number * multiplier)
+
+	if t.operator == "=" {
+		return map[string]interface{}{
+			"term": map[string]interface{}{"size_bytes": size},
+		}, nil
+	}
+
+	operators := map[string]string{">": "gt", ">=": "gte", "<": "lt", "<=": "lte"}
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			"size_bytes": map[string]interface{}{operators[t.operator]: size},
+		},
+	}, nil
+}
+
+// pathQuery converts a path pattern into a regular expression matching the `object_key` field. Object keys
+// start with the dataset directory, so the pattern is matched against the rest of the key
+func pathQuery(t *queryToken) map[string]interface{} {
+	pattern := []rune(strings.TrimPrefix(t.value, "/"))
+
+	var re strings.Builder
+	re.WriteString("[^/]+/")
+	for i := 0; i < len(pattern); i++ {
+		r := pattern[i]
+		switch {
+		case r == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(escapeRegexp(pattern[i]))
+		case r == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			re.WriteString(".*")
+			i++
+		case r == '*':
+			re.WriteString("[^/]*")
+		case r == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(escapeRegexp(r))
+		}
+	}
+
+	return map[string]interface{}{
+		"regexp": map[string]interface{}{"object_key": re.String()},
+	}
+}
+
+// escapeRegexp escapes characters that are reserved in opensearch regular expressions
+func escapeRegexp(r rune) string {
+	if strings.ContainsRune(`.?+*|{}[]()"\#@&<>~`, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
+
+func escapeWildcard(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "*", `\*`)
+	return strings.ReplaceAll(s, "?", `\?`)
+}
+
+func unescapeWildcard(s string) string {
+	var unescaped strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		unescaped.WriteRune(r)
+	}
+	return unescaped.String()
+}
@@ -0,0 +1,289 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// assertQueryJSON checks a generated query matches the expected JSON, ignoring formatting and key order
+func assertQueryJSON(t *testing.T, query map[string]interface{}, want string) {
+	var expected interface{}
+	if err := json.Unmarshal([]byte(want), &expected); err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	expectedBytes, _ := json.Marshal(expected)
+
+	actualBytes, err := json.Marshal(query)
+	if err != nil {
+		t.Fatalf("failed to marshal query: %v", err)
+	}
+
+	test.AssertEqual(t, string(actualBytes), string(expectedBytes))
+}
+
+// typedJSON is the nested query generated for a comparison of a typed metadata value
+func typedJSON(key string, comparison string) string {
+	return `{"nested": {"path": "typed_metadata", "query": {"bool": {"filter": [
+		{"term": {"typed_metadata.key": "` + key + `"}}, ` + comparison + `]}}}}`
+}
+
+func TestParseMetadataQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		// metadata terms
+		{"term", `subject:mouse`, `{"term": {"metadata": "subject:mouse"}}`},
+		{"term is lowercase", `Subject:Mouse`, `{"term": {"metadata": "subject:mouse"}}`},
+		{"quoted value", `note:"two words"`, `{"term": {"metadata": "note:two words"}}`},
+		{"quoted parentheses", `note:"a (b) c"`, `{"term": {"metadata": "note:a (b) c"}}`},
+		{"escaped space", `note:two\ words`, `{"term": {"metadata": "note:two words"}}`},
+		{"escaped quote", `note:\"quoted\"`, `{"term": {"metadata": "note:\"quoted\""}}`},
+		{"value with operators", `url:http://host:80/a=b`, `{"term": {"metadata": "url:http://host:80/a=b"}}`},
+		{"technical metadata", `hoss:mime_type:image/tiff`, `{"term": {"metadata": "hoss:mime_type:image/tiff"}}`},
+		{"keyword as key", `AND:1`, `{"term": {"metadata": "and:1"}}`},
+
+		// wildcards
+		{"wildcard", `subject:mou*`, `{"wildcard": {"metadata": "subject:mou*"}}`},
+		{"single character wildcard", `run:?1`, `{"wildcard": {"metadata": "run:?1"}}`},
+		{"escaped wildcard", `name:a\*b`, `{"term": {"metadata": "name:a*b"}}`},
+		{"escaped and unescaped wildcard", `name:a\*b*`, `{"wildcard": {"metadata": "name:a\\*b*"}}`},
+		{"wildcard key is escaped", `a*b:c*`, `{"wildcard": {"metadata": "a\\*b:c*"}}`},
+		{"key exists", `subject:*`, `{"prefix": {"metadata": "subject:"}}`},
+		{"technical key exists", `hoss:format:*`, `{"prefix": {"metadata": "hoss:format:"}}`},
+
+		// boolean operators and precedence
+		{"implicit and", `a:1 b:2`, `{"bool": {"filter": [{"term": {"metadata": "a:1"}}, {"term": {"metadata": "b:2"}}]}}`},
+		{"and", `a:1 AND b:2`, `{"bool": {"filter": [{"term": {"metadata": "a:1"}}, {"term": {"metadata": "b:2"}}]}}`},
+		{"or", `a:1 OR b:2`, `{"bool": {"should": [{"term": {"metadata": "a:1"}}, {"term": {"metadata": "b:2"}}],
+			"minimum_should_match": 1}}`},
+		{"and binds tighter than or", `a:1 OR b:2 AND c:3`, `{"bool": {"should": [
+			{"term": {"metadata": "a:1"}},
+			{"bool": {"filter": [{"term": {"metadata": "b:2"}}, {"term": {"metadata": "c:3"}}]}}
+		], "minimum_should_match": 1}}`},
+		{"and before or", `a:1 b:2 OR c:3`, `{"bool": {"should": [
+			{"bool": {"filter": [{"term": {"metadata": "a:1"}}, {"term": {"metadata": "b:2"}}]}},
+			{"term": {"metadata": "c:3"}}
+		], "minimum_should_match": 1}}`},
+		{"parentheses", `(a:1 OR b:2) c:3`, `{"bool": {"filter": [
+			{"bool": {"should": [{"term": {"metadata": "a:1"}}, {"term": {"metadata": "b:2"}}], "minimum_should_match": 1}},
+			{"term": {"metadata": "c:3"}}
+		]}}`},
+		{"redundant parentheses", `((a:1))`, `{"term": {"metadata": "a:1"}}`},
+		{"not", `NOT a:1`, `{"bool": {"must_not": [{"term": {"metadata": "a:1"}}]}}`},
+		{"not binds tighter than and", `NOT a:1 b:2`, `{"bool": {"filter": [
+			{"bool": {"must_not": [{"term": {"metadata": "a:1"}}]}},
+			{"term": {"metadata": "b:2"}}
+		]}}`},
+		{"and not", `a:1 AND NOT b:2`, `{"bool": {"filter": [
+			{"term": {"metadata": "a:1"}},
+			{"bool": {"must_not": [{"term": {"metadata": "b:2"}}]}}
+		]}}`},
+		{"not group", `NOT (a:1 OR b:2)`, `{"bool": {"must_not": [
+			{"bool": {"should": [{"term": {"metadata": "a:1"}}, {"term": {"metadata": "b:2"}}], "minimum_should_match": 1}}
+		]}}`},
+		{"double not", `NOT NOT a:1`, `{"bool": {"must_not": [{"bool": {"must_not": [{"term": {"metadata": "a:1"}}]}}]}}`},
+
+		// object size
+		{"size", `size=100`, `{"term": {"size_bytes": 100}}`},
+		{"size bytes", `size>100B`, `{"range": {"size_bytes": {"gt": 100}}}`},
+		{"size megabytes", `size>10MB`, `{"range": {"size_bytes": {"gt": 10485760}}}`},
+		{"size fraction", `size<=1.5kb`, `{"range": {"size_bytes": {"lte": 1536}}}`},
+		{"size gigabytes", `size>=2GB`, `{"range": {"size_bytes": {"gte": 2147483648}}}`},
+		{"size terabytes", `size<1TB`, `{"range": {"size_bytes": {"lt": 1099511627776}}}`},
+		{"size metadata", `size:large`, `{"term": {"metadata": "size:large"}}`},
+
+		// object path
+		{"path", `path=raw/image.tif`, `{"regexp": {"object_key": "[^/]+/raw/image\\.tif"}}`},
+		{"path leading slash", `path=/raw/image.tif`, `{"regexp": {"object_key": "[^/]+/raw/image\\.tif"}}`},
+		{"path globs", `path=raw/**/*.tif`, `{"regexp": {"object_key": "[^/]+/raw/.*/[^/]*\\.tif"}}`},
+		{"path single character", `path=run?.csv`, `{"regexp": {"object_key": "[^/]+/run[^/]\\.csv"}}`},
+		{"path escaped glob", `path=a\*b`, `{"regexp": {"object_key": "[^/]+/a\\*b"}}`},
+		{"path reserved characters", `path="a (1)+b"`, `{"regexp": {"object_key": "[^/]+/a \\(1\\)\\+b"}}`},
+		{"path metadata", `path:raw`, `{"term": {"metadata": "path:raw"}}`},
+
+		// typed metadata
+		{"number", `count>5`, typedJSON("count", `{"range": {"typed_metadata.number": {"gt": 5}}}`)},
+		{"number equals", `Count=5.5`, typedJSON("count", `{"range": {"typed_metadata.number": {"gte": 5.5, "lte": 5.5}}}`)},
+		{"negative number", `offset<=-2`, typedJSON("offset", `{"range": {"typed_metadata.number": {"lte": -2}}}`)},
+		{"date", `acquired>=2024-01-01`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-01-01T00:00:00Z"}}}`)},
+		{"datetime", `acquired<2024-01-01T12:30:00Z`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"lt": "2024-01-01T12:30:00Z"}}}`)},
+		{"boolean", `done=TRUE`, typedJSON("done", `{"term": {"typed_metadata.boolean": true}}`)},
+		{"date equals day", `acquired=2024-01-01`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-01-01T00:00:00Z", "lt": "2024-01-02T00:00:00Z"}}}`)},
+		{"date after day", `acquired>2024-01-01`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-01-02T00:00:00Z"}}}`)},
+		{"date until day", `acquired<=2024-01-01`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"lt": "2024-01-02T00:00:00Z"}}}`)},
+		{"datetime equals", `acquired=2024-01-01T12:30:00+02:00`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-01-01T10:30:00Z", "lte": "2024-01-01T10:30:00Z"}}}`)},
+		{"undeclared year is a number", `acquired>2024`, typedJSON("acquired", `{"range": {"typed_metadata.number": {"gt": 2024}}}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseMetadataQuery(tt.query, nil)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			assertQueryJSON(t, query, tt.want)
+		})
+	}
+}
+
+func TestParseMetadataQueryDeclaredTypes(t *testing.T) {
+	types := map[string]string{
+		"Acquired": "date",
+		"count":    "number",
+		"done":     "boolean",
+		"subject":  "string",
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"compact date", `acquired>20240101`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-01-02T00:00:00Z"}}}`)},
+		{"year", `acquired>2024`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2025-01-01T00:00:00Z"}}}`)},
+		{"year before", `acquired<2024`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"lt": "2024-01-01T00:00:00Z"}}}`)},
+		{"month", `acquired=2024-03`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-03-01T00:00:00Z", "lt": "2024-04-01T00:00:00Z"}}}`)},
+		{"key is case insensitive", `ACQUIRED>=2024`,
+			typedJSON("acquired", `{"range": {"typed_metadata.date": {"gte": "2024-01-01T00:00:00Z"}}}`)},
+		{"number", `count>1e3`, typedJSON("count", `{"range": {"typed_metadata.number": {"gt": 1000}}}`)},
+		{"boolean", `done=false`, typedJSON("done", `{"term": {"typed_metadata.boolean": false}}`)},
+		{"undeclared", `other>2024`, typedJSON("other", `{"range": {"typed_metadata.number": {"gt": 2024}}}`)},
+		{"text", `subject:2024`, `{"term": {"metadata": "subject:2024"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseMetadataQuery(tt.query, types)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			assertQueryJSON(t, query, tt.want)
+		})
+	}
+
+	errorTests := []struct {
+		name     string
+		query    string
+		position int
+		message  string
+	}{
+		{"invalid date", `a:1 acquired>soon`, 4, "'soon' is not a date, which is the type of acquired in the dataset's schema"},
+		{"invalid number", `count>2024-01-01`, 0, "'2024-01-01' is not a number, which is the type of count in the dataset's schema"},
+		{"invalid boolean", `done=yes`, 0, "'yes' is not a boolean, which is the type of done in the dataset's schema"},
+		{"boolean comparison", `done>true`, 0, "boolean values only support the '=' operator"},
+		{"string comparison", `subject>5`, 0, "subject is a string in the dataset's schema, use subject:<value> to match text"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMetadataQuery(tt.query, types)
+			queryErr, ok := err.(*QueryError)
+			if !ok {
+				t.Fatalf("expected a QueryError, got %v", err)
+			}
+			test.AssertEqual(t, queryErr.Position, tt.position)
+			test.AssertEqual(t, queryErr.Message, tt.message)
+		})
+	}
+}
+
+func TestParseMetadataQueryErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		position int
+		message  string
+	}{
+		{"empty", ``, 0, "query is empty"},
+		{"whitespace", `   `, 0, "query is empty"},
+		{"bare word", `mouse`, 0, "expected a term in the format <key>:<value>, found 'mouse'"},
+		{"lowercase keyword", `a:1 and b:2`, 4, "expected a term in the format <key>:<value>, found 'and'"},
+		{"missing key", `:mouse`, 0, "missing key before operator"},
+		{"missing value", `a: b:1`, 1, "missing value after 'a:'"},
+		{"missing comparison value", `count>=`, 5, "missing value after 'count>='"},
+		{"unterminated quote", `a:1 b:"open`, 6, "unterminated quoted value"},
+		{"trailing escape", `a:b\`, 3, "escape character at the end of the query"},
+		{"trailing or", `a:1 OR`, 6, "unexpected end of query"},
+		{"trailing not", `a:1 AND NOT`, 11, "unexpected end of query"},
+		{"double and", `a:1 AND AND b:2`, 8, "expected a term or '('"},
+		{"leading or", `OR a:1`, 0, "expected a term or '('"},
+		{"unmatched open", `a:1 (b:2 OR c:3`, 4, "unmatched '('"},
+		{"unmatched close", `a:1 b:2)`, 7, "unmatched ')'"},
+		{"empty group", `a:1 ()`, 5, "unexpected ')'"},
+		{"unknown size unit", `size>10XB`, 0, "unknown size unit 'XB', expected one of B, KB, MB, GB, or TB"},
+		{"negative size", `a:1 size>-1`, 4, "invalid size '-1'"},
+		{"invalid size", `size>1.2.3MB`, 0, "invalid size '1.2.3MB'"},
+		{"path comparison", `path>raw`, 0, "path only supports the '=' operator"},
+		{"boolean comparison", `a:1 done>true`, 4, "boolean values only support the '=' operator"},
+		{"text comparison", `name>abc`, 0, "'abc' is not a number, date, or boolean, use name:<value> to match text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMetadataQuery(tt.query, nil)
+			queryErr, ok := err.(*QueryError)
+			if !ok {
+				t.Fatalf("expected a QueryError, got %v", err)
+			}
+			test.AssertEqual(t, queryErr.Position, tt.position)
+			test.AssertEqual(t, queryErr.Message, tt.message)
+		})
+	}
+}
+
+func TestParseMetadataQueryLimits(t *testing.T) {
+	terms := func(n int) string {
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = "a:1"
+		}
+		return strings.Join(parts, " OR ")
+	}
+
+	// The term limit counts terms, not operators or parentheses
+	_, err := ParseMetadataQuery(terms(maxQueryTerms), nil)
+	test.AssertEqual(t, err, nil)
+
+	_, err = ParseMetadataQuery(terms(maxQueryTerms+1), nil)
+	queryErr, ok := err.(*QueryError)
+	test.AssertEqual(t, ok, true)
+	test.AssertEqual(t, queryErr.Position, 0)
+	test.AssertEqual(t, queryErr.Message, "query has more than 100 terms")
+
+	// Each group and NOT adds a level of nesting
+	nested := func(open string, n int) string {
+		return strings.Repeat(open, n) + "a:1" + strings.Repeat(")", strings.Count(open, "(")*n)
+	}
+
+	_, err = ParseMetadataQuery(nested("(", maxQueryDepth), nil)
+	test.AssertEqual(t, err, nil)
+	_, err = ParseMetadataQuery(nested("NOT ", maxQueryDepth), nil)
+	test.AssertEqual(t, err, nil)
+
+	_, err = ParseMetadataQuery(nested("(", maxQueryDepth+1), nil)
+	queryErr, ok = err.(*QueryError)
+	test.AssertEqual(t, ok, true)
+	test.AssertEqual(t, queryErr.Position, maxQueryDepth+1)
+	test.AssertEqual(t, queryErr.Message, "query is nested too deeply")
+
+	_, err = ParseMetadataQuery(nested("NOT ", maxQueryDepth+1), nil)
+	queryErr, ok = err.(*QueryError)
+	test.AssertEqual(t, ok, true)
+	test.AssertEqual(t, queryErr.Position, 4*(maxQueryDepth+1))
+	test.AssertEqual(t, queryErr.Message, "query is nested too deeply")
+}
@@ -0,0 +1,150 @@
+package opensearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-service/search"
+	"github.com/pkg/errors"
+)
+
+// SchemaReport is a page of the objects in a dataset whose metadata doesn't conform to the dataset's schema
+type SchemaReport struct {
+	// Total is the number of non-conforming objects in the dataset
+	Total int `json:"total"`
+	// Objects are the non-conforming objects, ordered by object key
+	Objects []*SchemaReportObject `json:"objects"`
+	// NextAfter is passed as `after` to get the next page, it is empty on the last page
+	NextAfter string `json:"next_after,omitempty"`
+}
+
+// SchemaReportObject is an object whose metadata doesn't conform to its dataset's schema
+type SchemaReportObject struct {
+	ObjectKey        string   `json:"object_key"`
+	LastModifiedDate string   `json:"last_modified_date"`
+	SchemaViolations []string `json:"schema_violations"`
+}
+
+type schemaReportResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source SchemaReportObject `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// ApplyMetadataSchema sets the typed metadata and schema violations of a document. The type of metadata values
+// is inferred and no violations are set if schema is nil
+func ApplyMetadataSchema(payload *MetadataIndexPayload, schema *database.MetadataSchema) {
+	if schema == nil {
+		payload.TypedMetadata = TypedMetadata(payload.Metadata, nil)
+		payload.SchemaViolations = nil
+		return
+	}
+
+	payload.TypedMetadata = TypedMetadata(payload.Metadata, schema.Types)
+
+	metadata := map[string]string{}
+	for _, pair := range payload.Metadata {
+		key, value := SplitMetadataPair(pair)
+		metadata[key] = value
+	}
+	payload.SchemaViolations = CheckMetadata(metadata, schema)
+}
+
+// CheckMetadata returns a description of each way the metadata doesn't conform to the schema, in the format
+// "<key>: <reason>", or an empty list if it conforms
+func CheckMetadata(metadata map[string]string, schema *database.MetadataSchema) []string {
+	violations := []string{}
+
+	for _, key := range schema.Required {
+		if _, ok := metadata[key]; !ok {
+			violations = append(violations, fmt.Sprintf("%s: required key is missing", key))
+		}
+	}
+
+	for key, value := range metadata {
+		if metadataType, ok := schema.Types[key]; ok && metadataType != database.METADATA_TYPE_STRING {
+			if _, ok := NewTypedMetadataValue(key, value, metadataType); !ok {
+				violations = append(violations, fmt.Sprintf("%s: value is not a %s", key, metadataType))
+			}
+		}
+
+		if allowed, ok := schema.AllowedValues[key]; ok {
+			found := false
+			for _, v := range allowed {
+				if v == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				violations = append(violations, fmt.Sprintf("%s: value is not one of the allowed values", key))
+			}
+		}
+
+		if pattern, ok := schema.Patterns[key]; ok {
+			// patterns are validated when the schema is set, an invalid pattern never matches
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil || !re.MatchString(value) {
+				violations = append(violations, fmt.Sprintf("%s: value doesn't match the pattern `%s`", key, pattern))
+			}
+		}
+	}
+
+	sort.Strings(violations)
+	return violations
+}
+
+// GetSchemaReport returns a page of the documents of a dataset that have schema violations, ordered by object key
+// and starting after the given object key
+func GetSchemaReport(opensearchEndpoint, coreServiceEndpoint, datasetExtended string, size int, after string) (*SchemaReport, error) {
+	payload := map[string]interface{}{
+		"size":             size,
+		"track_total_hits": true,
+		"_source":          []string{"object_key", "last_modified_date", "schema_violations"},
+		"sort":             []interface{}{map[string]string{"object_key": "asc"}},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]string{"core_service_endpoint": coreServiceEndpoint}},
+					map[string]interface{}{"term": map[string]string{"dataset_extended": datasetExtended}},
+					map[string]interface{}{"exists": map[string]string{"field": "schema_violations"}},
+				},
+			},
+		},
+	}
+	if after != "" {
+		payload["search_after"] = []string{after}
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	response := schemaReportResponse{}
+	err = makeSearchIndexRequest(http.MethodPost, opensearchEndpoint+"/"+search.MetadataIndexAlias+"/_search", "application/json",
+		bytes.NewBuffer(payloadBytes), &response)
+	if err != nil {
+		return nil, errors.New("could not search metadata index: " + err.Error())
+	}
+
+	report := &SchemaReport{Total: response.Hits.Total.Value, Objects: []*SchemaReportObject{}}
+	for i := range response.Hits.Hits {
+		report.Objects = append(report.Objects, &response.Hits.Hits[i].Source)
+	}
+	if len(report.Objects) == size {
+		report.NextAfter = report.Objects[len(report.Objects)-1].ObjectKey
+	}
+
+	return report, nil
+}
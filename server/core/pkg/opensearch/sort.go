@@ -0,0 +1,109 @@
+package opensearch
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MetadataSortPrefix is the prefix of sort fields that sort by the typed value of a metadata key
+const MetadataSortPrefix = "metadata."
+
+// sortFields are the object properties that search results can be sorted by
+var sortFields = map[string]string{
+	"modified": "last_modified_date",
+	"size":     "size_bytes",
+	"key":      "object_key",
+}
+
+// ErrInvalidCursor is returned when a search cursor can't be decoded or was created for a different sort
+var ErrInvalidCursor = errors.New("invalid cursor, cursors can only be used with the sort they were returned for")
+
+// ParseSearchSort parses a sort parameter in the format `<field>[:asc|desc]` into opensearch sort clauses. The
+// field is one of `modified`, `size`, or `key` (the object key), or `metadata.<key>` to sort by the typed value of a
+// metadata key. Metadata fields sort by the key's number values first, then its date values, and objects without a
+// typed value for the key are sorted last. The clauses always end with tiebreakers that uniquely order every
+// object, so they can be used with `search_after`. An empty sort only returns the tiebreakers
+func ParseSearchSort(sort string) ([]interface{}, error) {
+	clauses := []interface{}{}
+
+	if sort != "" {
+		field, order := SplitSearchSort(sort)
+
+		if indexField, ok := sortFields[field]; ok {
+			clauses = append(clauses, map[string]interface{}{
+				indexField: map[string]interface{}{"order": order},
+			})
+		} else if strings.HasPrefix(field, MetadataSortPrefix) && len(field) > len(MetadataSortPrefix) {
+			key := strings.ToLower(strings.TrimPrefix(field, MetadataSortPrefix))
+			for _, typedField := range []string{"typed_metadata.number", "typed_metadata.date"} {
+				clauses = append(clauses, map[string]interface{}{
+					typedField: map[string]interface{}{
+						"order":   order,
+						"missing": "_last",
+						"nested": map[string]interface{}{
+							"path": "typed_metadata",
+							"filter": map[string]interface{}{
+								"term": map[string]interface{}{"typed_metadata.key": key},
+							},
+						},
+					},
+				})
+			}
+		} else {
+			return nil, fmt.Errorf("invalid sort field '%s', expected 'modified', 'size', 'key', or '%s<key>'",
+				field, MetadataSortPrefix)
+		}
+	}
+
+	// Searches are always filtered to a single core service, so the dataset and object key are unique
+	clauses = append(clauses,
+		map[string]interface{}{"dataset_extended": map[string]interface{}{"order": "asc"}},
+		map[string]interface{}{"object_key": map[string]interface{}{"order": "asc"}},
+	)
+
+	return clauses, nil
+}
+
+// SplitSearchSort splits a sort parameter in the format `<field>[:asc|desc]` into the field and order
+func SplitSearchSort(sort string) (string, string) {
+	if i := strings.LastIndex(sort, ":"); i >= 0 {
+		switch strings.ToLower(sort[i+1:]) {
+		case "asc", "desc":
+			return sort[:i], strings.ToLower(sort[i+1:])
+		}
+	}
+	return sort, "asc"
+}
+
+type searchCursor struct {
+	Sort  string            `json:"sort"`
+	After []json.RawMessage `json:"after"`
+}
+
+// EncodeSearchCursor encodes the sort values of the last search hit into an opaque cursor
+// Note: the sort values are kept as raw JSON, as date sort values can't be represented exactly as a float64
+func EncodeSearchCursor(sort string, after []json.RawMessage) (string, error) {
+	cursorBytes, err := json.Marshal(searchCursor{Sort: sort, After: after})
+	if err != nil {
+		return "", err
+	}
+	return b64.RawURLEncoding.EncodeToString(cursorBytes), nil
+}
+
+// DecodeSearchCursor decodes a cursor into the `search_after` values, checking it was created for the same sort
+func DecodeSearchCursor(sort string, cursor string) ([]json.RawMessage, error) {
+	cursorBytes, err := b64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var decoded searchCursor
+	if err := json.Unmarshal(cursorBytes, &decoded); err != nil || len(decoded.After) == 0 || decoded.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	return decoded.After, nil
+}
@@ -0,0 +1,117 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+// tiebreakersJSON are the sort clauses that end every search sort
+const tiebreakersJSON = `{"dataset_extended": {"order": "asc"}}, {"object_key": {"order": "asc"}}`
+
+// metadataSortJSON is a sort clause for a typed metadata field, filtered to the key's values
+func metadataSortJSON(field, key, order string) string {
+	return `{"` + field + `": {"order": "` + order + `", "missing": "_last", "nested": {"path": "typed_metadata",
+		"filter": {"term": {"typed_metadata.key": "` + key + `"}}}}}`
+}
+
+func TestParseSearchSort(t *testing.T) {
+	tests := []struct {
+		name string
+		sort string
+		want string
+	}{
+		{"empty", ``, `[` + tiebreakersJSON + `]`},
+		{"modified", `modified`, `[{"last_modified_date": {"order": "asc"}}, ` + tiebreakersJSON + `]`},
+		{"size descending", `size:desc`, `[{"size_bytes": {"order": "desc"}}, ` + tiebreakersJSON + `]`},
+		{"key ascending", `key:ASC`, `[{"object_key": {"order": "asc"}}, ` + tiebreakersJSON + `]`},
+		{"metadata", `metadata.Acquired:desc`, `[` +
+			metadataSortJSON("typed_metadata.number", "acquired", "desc") + `, ` +
+			metadataSortJSON("typed_metadata.date", "acquired", "desc") + `, ` + tiebreakersJSON + `]`},
+		{"technical metadata", `metadata.hoss:width`, `[` +
+			metadataSortJSON("typed_metadata.number", "hoss:width", "asc") + `, ` +
+			metadataSortJSON("typed_metadata.date", "hoss:width", "asc") + `, ` + tiebreakersJSON + `]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clauses, err := ParseSearchSort(tt.sort)
+			if err != nil {
+				t.Fatalf("failed to parse sort: %v", err)
+			}
+
+			var expected interface{}
+			if err := json.Unmarshal([]byte(tt.want), &expected); err != nil {
+				t.Fatalf("invalid expected JSON: %v", err)
+			}
+			expectedBytes, _ := json.Marshal(expected)
+			actualBytes, _ := json.Marshal(clauses)
+			test.AssertEqual(t, string(actualBytes), string(expectedBytes))
+		})
+	}
+}
+
+func TestParseSearchSortErrors(t *testing.T) {
+	for _, sort := range []string{`name`, `metadata.`, `size:up`, `Modified`} {
+		t.Run(sort, func(t *testing.T) {
+			_, err := ParseSearchSort(sort)
+			if err == nil {
+				t.Fatalf("expected an error for sort '%s'", sort)
+			}
+		})
+	}
+}
+
+func TestSplitSearchSort(t *testing.T) {
+	tests := []struct {
+		sort  string
+		field string
+		order string
+	}{
+		{"size", "size", "asc"},
+		{"size:desc", "size", "desc"},
+		{"size:DESC", "size", "desc"},
+		{"metadata.hoss:width", "metadata.hoss:width", "asc"},
+		{"metadata.hoss:width:desc", "metadata.hoss:width", "desc"},
+		{"size:", "size:", "asc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			field, order := SplitSearchSort(tt.sort)
+			test.AssertEqual(t, field, tt.field)
+			test.AssertEqual(t, order, tt.order)
+		})
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	after := []json.RawMessage{json.RawMessage(`1704067200123`), json.RawMessage(`"minio-bucket-dataset"`)}
+
+	cursor, err := EncodeSearchCursor("modified:desc", after)
+	if err != nil {
+		t.Fatalf("failed to encode cursor: %v", err)
+	}
+
+	decoded, err := DecodeSearchCursor("modified:desc", cursor)
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+	test.AssertEqual(t, len(decoded), 2)
+	test.AssertEqual(t, string(decoded[0]), `1704067200123`)
+	test.AssertEqual(t, string(decoded[1]), `"minio-bucket-dataset"`)
+
+	// a cursor can only be used with the sort it was returned for
+	_, err = DecodeSearchCursor("size", cursor)
+	test.AssertEqual(t, err, ErrInvalidCursor)
+
+	empty, err := EncodeSearchCursor("", []json.RawMessage{})
+	if err != nil {
+		t.Fatalf("failed to encode cursor: %v", err)
+	}
+	for _, invalid := range []string{"", "not a cursor!", "bm90IGpzb24", empty} {
+		_, err = DecodeSearchCursor("", invalid)
+		test.AssertEqual(t, err, ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,141 @@
+package opensearch
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+)
+
+// TechnicalMetadataPrefix is the reserved metadata namespace that the sync service indexes technical
+// metadata (e.g. MIME type, image dimensions) under. It is part of the metadata key
+const TechnicalMetadataPrefix = "hoss:"
+
+// metadataDateLayouts are the date formats that metadata values are parsed as
+var metadataDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// TypedMetadataValue is a metadata value indexed by type, so it can be used in range queries and sorting.
+// Only one of the value fields is set
+type TypedMetadataValue struct {
+	// Key is the metadata key
+	Key string `json:"key"`
+	// Number is set for numeric values
+	Number *float64 `json:"number,omitempty"`
+	// Date is set for date values, in RFC3339 format
+	Date string `json:"date,omitempty"`
+	// Boolean is set for boolean values
+	Boolean *bool `json:"boolean,omitempty"`
+}
+
+// SplitMetadataPair splits an indexed "key:value" metadata string into its key and value
+func SplitMetadataPair(pair string) (string, string) {
+	prefix := ""
+	if strings.HasPrefix(pair, TechnicalMetadataPrefix) {
+		prefix = TechnicalMetadataPrefix
+		pair = strings.TrimPrefix(pair, TechnicalMetadataPrefix)
+	}
+
+	parts := strings.SplitN(pair, ":", 2)
+	if len(parts) < 2 {
+		return prefix + parts[0], ""
+	}
+	return prefix + parts[0], parts[1]
+}
+
+// TypedMetadata converts "key:value" metadata strings into typed values. Keys in types are converted
+// to the declared type, and skipped if the value doesn't match. The type of other keys is inferred
+func TypedMetadata(metadata []string, types map[string]string) []TypedMetadataValue {
+	typed := []TypedMetadataValue{}
+	for _, pair := range metadata {
+		key, value := SplitMetadataPair(pair)
+
+		metadataType, declared := types[key]
+		if !declared {
+			metadataType = InferMetadataType(value)
+		}
+
+		if v, ok := NewTypedMetadataValue(key, value, metadataType); ok {
+			typed = append(typed, v)
+		}
+	}
+
+	return typed
+}
+
+// InferMetadataType returns the type of a metadata value, based on whether it can be parsed as a boolean, number, or date
+func InferMetadataType(value string) string {
+	if _, ok := parseMetadataBoolean(value); ok {
+		return database.METADATA_TYPE_BOOLEAN
+	}
+	if _, ok := parseMetadataNumber(value); ok {
+		return database.METADATA_TYPE_NUMBER
+	}
+	if _, ok := parseMetadataDate(value); ok {
+		return database.METADATA_TYPE_DATE
+	}
+	return database.METADATA_TYPE_STRING
+}
+
+// NewTypedMetadataValue parses a metadata value as the given type, returning false if the value
+// doesn't match the type or the type is not indexed as a typed value
+func NewTypedMetadataValue(key, value, metadataType string) (TypedMetadataValue, bool) {
+	typed := TypedMetadataValue{Key: key}
+	switch metadataType {
+	case database.METADATA_TYPE_NUMBER:
+		n, ok := parseMetadataNumber(value)
+		if !ok {
+			return typed, false
+		}
+		typed.Number = &n
+	case database.METADATA_TYPE_DATE:
+		d, ok := parseMetadataDate(value)
+		if !ok {
+			return typed, false
+		}
+		typed.Date = d.UTC().Format(time.RFC3339Nano)
+	case database.METADATA_TYPE_BOOLEAN:
+		b, ok := parseMetadataBoolean(value)
+		if !ok {
+			return typed, false
+		}
+		typed.Boolean = &b
+	default:
+		return typed, false
+	}
+
+	return typed, true
+}
+
+func parseMetadataBoolean(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+func parseMetadataNumber(value string) (float64, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseMetadataDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range metadataDateLayouts {
+		if d, err := time.Parse(layout, value); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
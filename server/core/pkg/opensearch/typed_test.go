@@ -0,0 +1,135 @@
+package opensearch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestSplitMetadataPair(t *testing.T) {
+	tests := []struct {
+		pair  string
+		key   string
+		value string
+	}{
+		{"subject:mouse", "subject", "mouse"},
+		{"url:http://host:80", "url", "http://host:80"},
+		{"empty:", "empty", ""},
+		{"novalue", "novalue", ""},
+		{"hoss:mime_type:image/tiff", "hoss:mime_type", "image/tiff"},
+		{"hoss:width", "hoss:width", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pair, func(t *testing.T) {
+			key, value := SplitMetadataPair(tt.pair)
+			test.AssertEqual(t, key, tt.key)
+			test.AssertEqual(t, value, tt.value)
+		})
+	}
+}
+
+func TestInferMetadataType(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"true", database.METADATA_TYPE_BOOLEAN},
+		{" FALSE ", database.METADATA_TYPE_BOOLEAN},
+		{"42", database.METADATA_TYPE_NUMBER},
+		{"-1.5e3", database.METADATA_TYPE_NUMBER},
+		{"20240101", database.METADATA_TYPE_NUMBER},
+		{"NaN", database.METADATA_TYPE_STRING},
+		{"Inf", database.METADATA_TYPE_STRING},
+		{"2024-01-01", database.METADATA_TYPE_DATE},
+		{"2024-01-01T12:30:00", database.METADATA_TYPE_DATE},
+		{"2024-01-01T12:30:00.5+02:00", database.METADATA_TYPE_DATE},
+		{"2024-01", database.METADATA_TYPE_STRING},
+		{"mouse", database.METADATA_TYPE_STRING},
+		{"", database.METADATA_TYPE_STRING},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			test.AssertEqual(t, InferMetadataType(tt.value), tt.want)
+		})
+	}
+}
+
+func TestTypedMetadata(t *testing.T) {
+	metadata := []string{
+		"count:42",
+		"acquired:2024-01-01T12:30:00+02:00",
+		"done:true",
+		"subject:mouse",
+		"run:007",
+		"code:12",
+		"weight:heavy",
+		"hoss:width:512",
+	}
+	types := map[string]string{
+		"run":    database.METADATA_TYPE_STRING,
+		"code":   database.METADATA_TYPE_BOOLEAN,
+		"weight": database.METADATA_TYPE_NUMBER,
+	}
+
+	// declared keys use their declared type and are skipped if the value doesn't match it
+	typedBytes, err := json.Marshal(TypedMetadata(metadata, types))
+	if err != nil {
+		t.Fatalf("failed to marshal typed metadata: %v", err)
+	}
+	test.AssertEqual(t, string(typedBytes), `[`+
+		`{"key":"count","number":42},`+
+		`{"key":"acquired","date":"2024-01-01T10:30:00Z"},`+
+		`{"key":"done","boolean":true},`+
+		`{"key":"hoss:width","number":512}]`)
+
+	// without a schema every type is inferred
+	typedBytes, err = json.Marshal(TypedMetadata(metadata, nil))
+	if err != nil {
+		t.Fatalf("failed to marshal typed metadata: %v", err)
+	}
+	test.AssertEqual(t, string(typedBytes), `[`+
+		`{"key":"count","number":42},`+
+		`{"key":"acquired","date":"2024-01-01T10:30:00Z"},`+
+		`{"key":"done","boolean":true},`+
+		`{"key":"run","number":7},`+
+		`{"key":"code","number":12},`+
+		`{"key":"hoss:width","number":512}]`)
+}
+
+func TestNewTypedMetadataValue(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		metadataType string
+		want         string
+		ok           bool
+	}{
+		{"number", "1.5", database.METADATA_TYPE_NUMBER, `{"key":"k","number":1.5}`, true},
+		{"invalid number", "one", database.METADATA_TYPE_NUMBER, "", false},
+		{"date", "2024-01-01", database.METADATA_TYPE_DATE, `{"key":"k","date":"2024-01-01T00:00:00Z"}`, true},
+		{"local datetime", "2024-01-01T12:30:00", database.METADATA_TYPE_DATE, `{"key":"k","date":"2024-01-01T12:30:00Z"}`, true},
+		{"invalid date", "2024-13-01", database.METADATA_TYPE_DATE, "", false},
+		{"boolean", "False", database.METADATA_TYPE_BOOLEAN, `{"key":"k","boolean":false}`, true},
+		{"invalid boolean", "0", database.METADATA_TYPE_BOOLEAN, "", false},
+		{"string", "text", database.METADATA_TYPE_STRING, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typed, ok := NewTypedMetadataValue("k", tt.value, tt.metadataType)
+			test.AssertEqual(t, ok, tt.ok)
+			if !ok {
+				return
+			}
+			typedBytes, err := json.Marshal(typed)
+			if err != nil {
+				t.Fatalf("failed to marshal typed value: %v", err)
+			}
+			test.AssertEqual(t, string(typedBytes), tt.want)
+		})
+	}
+}
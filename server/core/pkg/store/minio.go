@@ -41,7 +41,7 @@ const policyTemplateMinio = `
 
 const readTemplateMinio = `{
     "Effect": "Allow",
-    "Action": ["s3:GetObject"],
+    "Action": ["s3:GetObject", "s3:GetObjectVersion"],
     "Resource": ["arn:aws:s3:::{{.Bucket}}/{{.DatasetName}}/*"]
 },
 {
@@ -258,6 +258,325 @@ func (m *MinioStore) DeleteDataset(prefix string, n *database.Namespace) error {
 	return nil
 }
 
+// WalkObjects calls fn for every object under the prefix in the namespace's bucket, with the object's user metadata
+func (m *MinioStore) WalkObjects(n *database.Namespace, prefix string, fn func(object *ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for obj := range m.client.ListObjects(ctx, n.BucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return errors.Wrap(obj.Err, "failed to list objects")
+		}
+
+		stat, err := m.client.StatObject(ctx, n.BucketName, obj.Key, minio.StatObjectOptions{})
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				continue
+			}
+			return errors.Wrapf(err, "failed to load object `%s`", obj.Key)
+		}
+
+		// minio canonicalizes metadata keys, while the sync service indexes the lowercase keys returned by S3
+		metadata := map[string]string{}
+		for key, value := range stat.UserMetadata {
+			metadata[strings.ToLower(key)] = value
+		}
+
+		err = fn(&ObjectInfo{
+			Key:          stat.Key,
+			Size:         stat.Size,
+			LastModified: stat.LastModified,
+			Metadata:     metadata,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetObjectMetadata returns an object's user metadata
+func (m *MinioStore) GetObjectMetadata(n *database.Namespace, key string) (map[string]string, error) {
+	stat, err := m.statObject(n, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return lowercaseMetadata(stat.UserMetadata), nil
+}
+
+// UpdateObjectMetadata replaces an object's user metadata by copying the object onto itself
+func (m *MinioStore) UpdateObjectMetadata(n *database.Namespace, key string, fn func(metadata map[string]string) (map[string]string, error)) (map[string]string, error) {
+	stat, err := m.statObject(n, key)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size > maxCopySize {
+		return nil, ErrObjectTooLarge
+	}
+
+	metadata, err := fn(lowercaseMetadata(stat.UserMetadata))
+	if err != nil {
+		return nil, err
+	}
+
+	// the standard headers are replaced with the user metadata, so they are set again from the current object
+	headers := map[string]string{}
+	for key, value := range metadata {
+		headers[key] = value
+	}
+	for _, header := range []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Type"} {
+		if value := stat.Metadata.Get(header); value != "" {
+			headers[header] = value
+		}
+	}
+
+	_, err = m.client.CopyObject(context.Background(),
+		minio.CopyDestOptions{
+			Bucket:          n.BucketName,
+			Object:          key,
+			UserMetadata:    headers,
+			ReplaceMetadata: true,
+		},
+		minio.CopySrcOptions{
+			Bucket: n.BucketName,
+			Object: key,
+			// only copy the version of the object that the metadata was loaded from
+			MatchETag: stat.ETag,
+		})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			return nil, ErrObjectModified
+		}
+		return nil, errors.Wrapf(err, "failed to update metadata of object `%s`", key)
+	}
+
+	return metadata, nil
+}
+
+// statObject loads an object's properties, returning database.ErrNotFound if the object doesn't exist
+func (m *MinioStore) statObject(n *database.Namespace, key string) (*minio.ObjectInfo, error) {
+	stat, err := m.client.StatObject(context.Background(), n.BucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, database.ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to load object `%s`", key)
+	}
+
+	return &stat, nil
+}
+
+// ListObjectVersions returns the versions and delete markers of an object, newest first
+func (m *MinioStore) ListObjectVersions(n *database.Namespace, key string) ([]*ObjectVersion, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	versions := []*ObjectVersion{}
+	for obj := range m.client.ListObjects(ctx, n.BucketName, minio.ListObjectsOptions{
+		Prefix:       key,
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		if obj.Err != nil {
+			return nil, errors.Wrap(obj.Err, "failed to list object versions")
+		}
+		// other objects can start with the key
+		if obj.Key != key {
+			continue
+		}
+
+		version := &ObjectVersion{
+			VersionId:      obj.VersionID,
+			IsLatest:       obj.IsLatest,
+			IsDeleteMarker: obj.IsDeleteMarker,
+			Size:           obj.Size,
+			ETag:           obj.ETag,
+			LastModified:   obj.LastModified,
+		}
+		if !obj.IsDeleteMarker {
+			stat, err := m.client.StatObject(ctx, n.BucketName, key, minio.StatObjectOptions{VersionID: obj.VersionID})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load version `%s` of object `%s`", obj.VersionID, key)
+			}
+			version.Metadata = lowercaseMetadata(stat.UserMetadata)
+		}
+		versions = append(versions, version)
+	}
+
+	if len(versions) == 0 {
+		return nil, database.ErrNotFound
+	}
+	return versions, nil
+}
+
+// RestoreObjectVersion makes a prior version of an object the latest version
+func (m *MinioStore) RestoreObjectVersion(n *database.Namespace, key string, versionId string) (string, error) {
+	versions, err := m.ListObjectVersions(n, key)
+	if err != nil {
+		return "", err
+	}
+
+	method, version, markers, err := planRestore(versions, versionId)
+	if err != nil {
+		return "", err
+	}
+
+	switch method {
+	case RestoreMethodRemoveDeleteMarker:
+		for _, marker := range markers {
+			err := m.client.RemoveObject(context.Background(), n.BucketName, key, minio.RemoveObjectOptions{VersionID: marker})
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to remove delete marker of object `%s`", key)
+			}
+		}
+	case RestoreMethodCopy:
+		if version.Size > maxCopySize {
+			return "", ErrObjectTooLarge
+		}
+		_, err := m.client.CopyObject(context.Background(),
+			minio.CopyDestOptions{
+				Bucket: n.BucketName,
+				Object: key,
+			},
+			minio.CopySrcOptions{
+				Bucket:    n.BucketName,
+				Object:    key,
+				VersionID: versionId,
+			})
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to restore version `%s` of object `%s`", versionId, key)
+		}
+	}
+
+	return method, nil
+}
+
+// DeleteObjectVersion permanently removes a version or delete marker of an object
+func (m *MinioStore) DeleteObjectVersion(n *database.Namespace, key string, versionId string) error {
+	err := m.client.RemoveObject(context.Background(), n.BucketName, key, minio.RemoveObjectOptions{VersionID: versionId})
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove version `%s` of object `%s`", versionId, key)
+	}
+
+	return nil
+}
+
+// VersioningEnabled returns true if versioning is enabled for the namespace's bucket
+func (m *MinioStore) VersioningEnabled(n *database.Namespace) (bool, error) {
+	versioning, err := m.client.GetBucketVersioning(context.Background(), n.BucketName)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get bucket versioning configuration")
+	}
+
+	return versioning.Status == "Enabled", nil
+}
+
+// WalkLatestVersions calls fn with the key and latest version of every object under the prefix
+func (m *MinioStore) WalkLatestVersions(n *database.Namespace, prefix string, fn func(key string, version *ObjectVersion) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for obj := range m.client.ListObjects(ctx, n.BucketName, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		if obj.Err != nil {
+			return errors.Wrap(obj.Err, "failed to list object versions")
+		}
+		if !obj.IsLatest || obj.IsDeleteMarker {
+			continue
+		}
+
+		err := fn(obj.Key, &ObjectVersion{
+			VersionId:    obj.VersionID,
+			IsLatest:     true,
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyObject copies an object and its metadata to another key in the object store
+func (m *MinioStore) CopyObject(src *database.Namespace, srcKey string, dst *database.Namespace, dstKey string) error {
+	stat, err := m.statObject(src, srcKey)
+	if err != nil {
+		return err
+	}
+	if stat.Size > maxCopySize {
+		return ErrObjectTooLarge
+	}
+
+	_, err = m.client.CopyObject(context.Background(),
+		minio.CopyDestOptions{
+			Bucket: dst.BucketName,
+			Object: dstKey,
+		},
+		minio.CopySrcOptions{
+			Bucket:    src.BucketName,
+			Object:    srcKey,
+			MatchETag: stat.ETag,
+		})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			return ErrObjectModified
+		}
+		return errors.Wrapf(err, "failed to copy object `%s`", srcKey)
+	}
+
+	return nil
+}
+
+// GetObject opens an object for reading
+func (m *MinioStore) GetObject(n *database.Namespace, key string) (*ObjectContent, error) {
+	obj, err := m.client.GetObject(context.Background(), n.BucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get object `%s`", key)
+	}
+
+	// the request is sent when the object is first used
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, database.ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to get object `%s`", key)
+	}
+
+	return &ObjectContent{
+		Body:        obj,
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		Metadata:    lowercaseMetadata(stat.UserMetadata),
+	}, nil
+}
+
+// PutObject writes an object from the content's body
+func (m *MinioStore) PutObject(n *database.Namespace, key string, content *ObjectContent) error {
+	_, err := m.client.PutObject(context.Background(), n.BucketName, key, content.Body, content.Size,
+		minio.PutObjectOptions{
+			ContentType:  content.ContentType,
+			UserMetadata: content.Metadata,
+		})
+	if err != nil {
+		return errors.Wrapf(err, "failed to put object `%s`", key)
+	}
+
+	return nil
+}
+
 // SetUserPolicy re-renders a user's policy and applies it to the store
 func (m *MinioStore) SetUserPolicy(username string, permissions []*database.Permission) error {
 	// Render policy
@@ -335,3 +335,105 @@ func TestPatchEventsEnabled(t *testing.T) {
 		t.Fatalf("Expected events to be enabled after patch.")
 	}
 }
+
+func TestUpdateObjectMetadata(t *testing.T) {
+	_, currentStore, db, err := SetupMinioTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("default")
+	if err != nil {
+		t.Fatalf("failed to load namespace: %v", err)
+	}
+
+	key := NewMetadataFile("test-ds-1").Key()
+	_, err = currentStore.UpdateObjectMetadata(ns, key, func(metadata map[string]string) (map[string]string, error) {
+		metadata["subject"] = "mouse-1"
+		return metadata, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to update object metadata: %v", err)
+	}
+
+	metadata, err := currentStore.GetObjectMetadata(ns, key)
+	if err != nil {
+		t.Fatalf("Failed to get object metadata: %v", err)
+	}
+	if metadata["subject"] != "mouse-1" {
+		t.Fatalf("Expected metadata to be updated, got %v", metadata)
+	}
+
+	_, err = currentStore.GetObjectMetadata(ns, "test-ds-1/missing.txt")
+	if err != database.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a missing object, got %v", err)
+	}
+}
+
+func TestListObjectVersions(t *testing.T) {
+	_, currentStore, db, err := SetupMinioTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("default")
+	if err != nil {
+		t.Fatalf("failed to load namespace: %v", err)
+	}
+
+	key := NewMetadataFile("test-ds-1").Key()
+	versions, err := currentStore.ListObjectVersions(ns, key)
+	if err != nil {
+		t.Fatalf("Failed to list object versions: %v", err)
+	}
+	test.AssertEqual(t, len(versions), 1)
+	test.AssertEqual(t, versions[0].IsLatest, true)
+	test.AssertEqual(t, versions[0].IsDeleteMarker, false)
+
+	// Restoring the latest version doesn't change the object
+	method, err := currentStore.RestoreObjectVersion(ns, key, versions[0].VersionId)
+	if err != nil {
+		t.Fatalf("Failed to restore object version: %v", err)
+	}
+	test.AssertEqual(t, method, RestoreMethodNone)
+
+	_, err = currentStore.RestoreObjectVersion(ns, key, "missing-version")
+	if err != database.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a missing version, got %v", err)
+	}
+
+	_, err = currentStore.ListObjectVersions(ns, "test-ds-1/missing.txt")
+	if err != database.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a missing object, got %v", err)
+	}
+}
+
+func TestWalkLatestVersions(t *testing.T) {
+	_, currentStore, db, err := SetupMinioTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("default")
+	if err != nil {
+		t.Fatalf("failed to load namespace: %v", err)
+	}
+
+	_, err = currentStore.VersioningEnabled(ns)
+	if err != nil {
+		t.Fatalf("Failed to get bucket versioning: %v", err)
+	}
+
+	keys := []string{}
+	err = currentStore.WalkLatestVersions(ns, "test-ds-1/", func(key string, version *ObjectVersion) error {
+		keys = append(keys, key)
+		test.AssertEqual(t, version.IsLatest, true)
+		test.AssertEqual(t, version.ETag != "", true)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk latest versions: %v", err)
+	}
+	test.AssertEqual(t, len(keys), 1)
+	test.AssertEqual(t, keys[0], NewMetadataFile("test-ds-1").Key())
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,6 +18,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
@@ -38,7 +42,7 @@ type S3Store struct {
 
 const policyTemplateS3 = `{"Version": "2012-10-17","Statement": [{{STATEMENTS}}]}`
 
-const readTemplateS3 = `{"Effect": "Allow","Action": "s3:GetObject","Resource": "arn:aws:s3:::{{.Bucket}}/{{.DatasetName}}/*"},{"Effect": "Allow","Action": "s3:ListBucket","Resource": "arn:aws:s3:::{{.Bucket}}","Condition": {"StringLike": {"s3:prefix": "{{.DatasetName}}/*"}}}`
+const readTemplateS3 = `{"Effect": "Allow","Action": ["s3:GetObject","s3:GetObjectVersion"],"Resource": "arn:aws:s3:::{{.Bucket}}/{{.DatasetName}}/*"},{"Effect": "Allow","Action": "s3:ListBucket","Resource": "arn:aws:s3:::{{.Bucket}}","Condition": {"StringLike": {"s3:prefix": "{{.DatasetName}}/*"}}}`
 
 // TODO: Lock down the read/write template more
 const readWriteTemplateS3 = `{"Effect": "Allow","Action": "s3:*","Resource": "arn:aws:s3:::{{.Bucket}}/{{.DatasetName}}/*"},{"Effect": "Allow","Action": "s3:ListBucket","Resource": "arn:aws:s3:::{{.Bucket}}","Condition": {"StringLike": {"s3:prefix": "{{.DatasetName}}/*"}}}`
@@ -201,6 +205,374 @@ func (s *S3Store) DeleteDataset(rootDir string, n *database.Namespace) error {
 	return nil
 }
 
+// WalkObjects calls fn for every object under the prefix in the namespace's bucket, with the object's user metadata
+func (s *S3Store) WalkObjects(n *database.Namespace, prefix string, fn func(object *ObjectInfo) error) error {
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(n.BucketName),
+		Prefix: aws.String(prefix),
+	}
+	p := s3.NewListObjectsV2Paginator(s.client, params, func(o *s3.ListObjectsV2PaginatorOptions) {
+		o.Limit = 1000
+	})
+
+	for p.HasMorePages() {
+		page, err := p.NextPage(context.TODO())
+		if err != nil {
+			return errors.Wrap(err, "failed to list objects")
+		}
+
+		for _, obj := range page.Contents {
+			head, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+				Bucket: aws.String(n.BucketName),
+				Key:    obj.Key,
+			})
+			if err != nil {
+				var notFound *s3types.NotFound
+				if errors.As(err, &notFound) {
+					continue
+				}
+				return errors.Wrapf(err, "failed to load object `%s`", aws.ToString(obj.Key))
+			}
+
+			object := &ObjectInfo{
+				Key:      aws.ToString(obj.Key),
+				Size:     head.ContentLength,
+				Metadata: head.Metadata,
+			}
+			if head.LastModified != nil {
+				object.LastModified = *head.LastModified
+			}
+			if object.Metadata == nil {
+				object.Metadata = map[string]string{}
+			}
+
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetObjectMetadata returns an object's user metadata
+func (s *S3Store) GetObjectMetadata(n *database.Namespace, key string) (map[string]string, error) {
+	head, err := s.headObject(n, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return lowercaseMetadata(head.Metadata), nil
+}
+
+// UpdateObjectMetadata replaces an object's user metadata by copying the object onto itself
+func (s *S3Store) UpdateObjectMetadata(n *database.Namespace, key string, fn func(metadata map[string]string) (map[string]string, error)) (map[string]string, error) {
+	head, err := s.headObject(n, key)
+	if err != nil {
+		return nil, err
+	}
+	if head.ContentLength > maxCopySize {
+		return nil, ErrObjectTooLarge
+	}
+
+	metadata, err := fn(lowercaseMetadata(head.Metadata))
+	if err != nil {
+		return nil, err
+	}
+
+	source := url.URL{Path: n.BucketName + "/" + key}
+	_, err = s.client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(n.BucketName),
+		Key:        aws.String(key),
+		CopySource: aws.String(source.EscapedPath()),
+		// only copy the version of the object that the metadata was loaded from
+		CopySourceIfMatch:    head.ETag,
+		MetadataDirective:    s3types.MetadataDirectiveReplace,
+		Metadata:             metadata,
+		CacheControl:         head.CacheControl,
+		ContentDisposition:   head.ContentDisposition,
+		ContentEncoding:      head.ContentEncoding,
+		ContentLanguage:      head.ContentLanguage,
+		ContentType:          head.ContentType,
+		StorageClass:         s3types.StorageClass(head.StorageClass),
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+	})
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed {
+			return nil, ErrObjectModified
+		}
+		return nil, errors.Wrapf(err, "failed to update metadata of object `%s`", key)
+	}
+
+	return metadata, nil
+}
+
+// headObject loads an object's properties, returning database.ErrNotFound if the object doesn't exist
+func (s *S3Store) headObject(n *database.Namespace, key string) (*s3.HeadObjectOutput, error) {
+	head, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(n.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, database.ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to load object `%s`", key)
+	}
+
+	return head, nil
+}
+
+// ListObjectVersions returns the versions and delete markers of an object, newest first
+func (s *S3Store) ListObjectVersions(n *database.Namespace, key string) ([]*ObjectVersion, error) {
+	versions := []*ObjectVersion{}
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(n.BucketName),
+		Prefix: aws.String(key),
+	}
+	for {
+		page, err := s.client.ListObjectVersions(context.TODO(), input)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list object versions")
+		}
+
+		// other objects can start with the key
+		for _, obj := range page.Versions {
+			if aws.ToString(obj.Key) != key {
+				continue
+			}
+			head, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+				Bucket:    aws.String(n.BucketName),
+				Key:       aws.String(key),
+				VersionId: obj.VersionId,
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load version `%s` of object `%s`", aws.ToString(obj.VersionId), key)
+			}
+			versions = append(versions, &ObjectVersion{
+				VersionId:    aws.ToString(obj.VersionId),
+				IsLatest:     obj.IsLatest,
+				Size:         obj.Size,
+				ETag:         strings.Trim(aws.ToString(obj.ETag), `"`),
+				LastModified: aws.ToTime(obj.LastModified),
+				Metadata:     lowercaseMetadata(head.Metadata),
+			})
+		}
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToString(marker.Key) != key {
+				continue
+			}
+			versions = append(versions, &ObjectVersion{
+				VersionId:      aws.ToString(marker.VersionId),
+				IsLatest:       marker.IsLatest,
+				IsDeleteMarker: true,
+				LastModified:   aws.ToTime(marker.LastModified),
+			})
+		}
+
+		// keys are listed in order, so there are no more versions of the object once a later key is listed
+		if !page.IsTruncated || aws.ToString(page.NextKeyMarker) > key {
+			break
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+
+	if len(versions) == 0 {
+		return nil, database.ErrNotFound
+	}
+
+	// versions and delete markers are listed separately
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+// RestoreObjectVersion makes a prior version of an object the latest version
+func (s *S3Store) RestoreObjectVersion(n *database.Namespace, key string, versionId string) (string, error) {
+	versions, err := s.ListObjectVersions(n, key)
+	if err != nil {
+		return "", err
+	}
+
+	method, version, markers, err := planRestore(versions, versionId)
+	if err != nil {
+		return "", err
+	}
+
+	switch method {
+	case RestoreMethodRemoveDeleteMarker:
+		for _, marker := range markers {
+			if err := s.DeleteObjectVersion(n, key, marker); err != nil {
+				return "", err
+			}
+		}
+	case RestoreMethodCopy:
+		if version.Size > maxCopySize {
+			return "", ErrObjectTooLarge
+		}
+		source := url.URL{Path: n.BucketName + "/" + key}
+		_, err := s.client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:     aws.String(n.BucketName),
+			Key:        aws.String(key),
+			CopySource: aws.String(source.EscapedPath() + "?versionId=" + url.QueryEscape(versionId)),
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to restore version `%s` of object `%s`", versionId, key)
+		}
+	}
+
+	return method, nil
+}
+
+// DeleteObjectVersion permanently removes a version or delete marker of an object
+func (s *S3Store) DeleteObjectVersion(n *database.Namespace, key string, versionId string) error {
+	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(n.BucketName),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionId),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove version `%s` of object `%s`", versionId, key)
+	}
+
+	return nil
+}
+
+// VersioningEnabled returns true if versioning is enabled for the namespace's bucket
+func (s *S3Store) VersioningEnabled(n *database.Namespace) (bool, error) {
+	versioning, err := s.client.GetBucketVersioning(context.TODO(), &s3.GetBucketVersioningInput{
+		Bucket: aws.String(n.BucketName),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get bucket versioning configuration")
+	}
+
+	return versioning.Status == s3types.BucketVersioningStatusEnabled, nil
+}
+
+// WalkLatestVersions calls fn with the key and latest version of every object under the prefix
+func (s *S3Store) WalkLatestVersions(n *database.Namespace, prefix string, fn func(key string, version *ObjectVersion) error) error {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(n.BucketName),
+		Prefix: aws.String(prefix),
+	}
+	for {
+		page, err := s.client.ListObjectVersions(context.TODO(), input)
+		if err != nil {
+			return errors.Wrap(err, "failed to list object versions")
+		}
+
+		// delete markers are listed separately, so deleted objects don't have a latest version in Versions
+		for _, obj := range page.Versions {
+			if !obj.IsLatest {
+				continue
+			}
+			err := fn(aws.ToString(obj.Key), &ObjectVersion{
+				VersionId:    aws.ToString(obj.VersionId),
+				IsLatest:     true,
+				Size:         obj.Size,
+				ETag:         strings.Trim(aws.ToString(obj.ETag), `"`),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !page.IsTruncated {
+			return nil
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+}
+
+// CopyObject copies an object and its metadata to another key in the object store
+func (s *S3Store) CopyObject(src *database.Namespace, srcKey string, dst *database.Namespace, dstKey string) error {
+	head, err := s.headObject(src, srcKey)
+	if err != nil {
+		return err
+	}
+	if head.ContentLength > maxCopySize {
+		return ErrObjectTooLarge
+	}
+
+	source := url.URL{Path: src.BucketName + "/" + srcKey}
+	_, err = s.client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:            aws.String(dst.BucketName),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(source.EscapedPath()),
+		CopySourceIfMatch: head.ETag,
+		MetadataDirective: s3types.MetadataDirectiveCopy,
+	})
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed {
+			return ErrObjectModified
+		}
+		return errors.Wrapf(err, "failed to copy object `%s`", srcKey)
+	}
+
+	return nil
+}
+
+// GetObject opens an object for reading
+func (s *S3Store) GetObject(n *database.Namespace, key string) (*ObjectContent, error) {
+	obj, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(n.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, database.ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to get object `%s`", key)
+	}
+
+	return &ObjectContent{
+		Body:        obj.Body,
+		Size:        obj.ContentLength,
+		ContentType: aws.ToString(obj.ContentType),
+		Metadata:    lowercaseMetadata(obj.Metadata),
+	}, nil
+}
+
+// PutObject writes an object from the content's body. Objects larger than 5GB can't be written with a single
+// request, so ErrObjectTooLarge is returned for them
+func (s *S3Store) PutObject(n *database.Namespace, key string, content *ObjectContent) error {
+	if content.Size > maxCopySize {
+		return ErrObjectTooLarge
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(n.BucketName),
+		Key:           aws.String(key),
+		Body:          content.Body,
+		ContentLength: content.Size,
+		Metadata:      content.Metadata,
+	}
+	if content.ContentType != "" {
+		input.ContentType = aws.String(content.ContentType)
+	}
+
+	// the body is streamed from another object store, so it can't be read twice to sign the payload
+	_, err := s.client.PutObject(context.TODO(), input, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	if err != nil {
+		return errors.Wrapf(err, "failed to put object `%s`", key)
+	}
+
+	return nil
+}
+
 // SetUserPolicy re-renders a user's policy and applies it to the store
 func (s *S3Store) SetUserPolicy(username string, permissions []*database.Permission) error {
 	// Render policy
@@ -1,13 +1,40 @@
 package store
 
 import (
+	"io"
 	"log"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/gigantum/hoss-core/pkg/config"
 	"github.com/gigantum/hoss-core/pkg/database"
 )
 
+// maxCopySize is the largest object that can be copied with a single CopyObject request
+const maxCopySize = 5 * 1024 * 1024 * 1024
+
+var (
+	// ErrObjectTooLarge is returned when an object is too large to update its metadata in place
+	ErrObjectTooLarge = errors.New("objects larger than 5GB can't be updated in place")
+	// ErrObjectModified is returned when an object is modified while its metadata is being updated
+	ErrObjectModified = errors.New("object was modified while updating its metadata")
+	// ErrDeleteMarker is returned when restoring a delete marker instead of a version of an object
+	ErrDeleteMarker = errors.New("a delete marker can't be restored")
+)
+
+// Object version restore methods
+const (
+	// RestoreMethodNone is used when the version is already the latest version
+	RestoreMethodNone = "none"
+	// RestoreMethodRemoveDeleteMarker is used when the object was deleted, and the version was the latest version
+	// before it was deleted. The delete markers above the version are removed
+	RestoreMethodRemoveDeleteMarker = "remove_delete_marker"
+	// RestoreMethodCopy is used for other versions, which are copied to become the latest version
+	RestoreMethodCopy = "copy"
+)
+
 type Credentials struct {
 	AccessKeyId     string `json:"access_key_id"`
 	SecretAccessKey string `json:"secret_access_key"`
@@ -17,6 +44,48 @@ type Credentials struct {
 	Region          string `json:"region"`
 }
 
+// ObjectInfo is the information about an object that is indexed in the metadata search index
+type ObjectInfo struct {
+	// Key is the object key in the bucket
+	Key string
+	// Size is the size of the object in bytes
+	Size int64
+	// LastModified is when the object was last modified
+	LastModified time.Time
+	// Metadata is the object's user metadata, with lowercase keys
+	Metadata map[string]string
+}
+
+// ObjectContent is the content and properties of an object read from an object store
+type ObjectContent struct {
+	// Body is the object's content, which must be closed by the caller
+	Body io.ReadCloser
+	// Size is the size of the object in bytes
+	Size int64
+	// ContentType is the object's content type
+	ContentType string
+	// Metadata is the object's user metadata, with lowercase keys
+	Metadata map[string]string
+}
+
+// ObjectVersion is a version or delete marker of an object in a versioned bucket
+type ObjectVersion struct {
+	// VersionId identifies the version of the object
+	VersionId string `json:"version_id"`
+	// IsLatest is true if this is the current version of the object
+	IsLatest bool `json:"is_latest"`
+	// IsDeleteMarker is true if the object was deleted in this version
+	IsDeleteMarker bool `json:"is_delete_marker"`
+	// Size is the size of the version in bytes
+	Size int64 `json:"size"`
+	// ETag is the entity tag of the version's content. Delete markers don't have an ETag
+	ETag string `json:"etag,omitempty"`
+	// LastModified is when the version was created
+	LastModified time.Time `json:"last_modified"`
+	// Metadata is the version's user metadata, with lowercase keys. Delete markers don't have metadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
 // ObjectStore interface defines functions required for an object store implementation
 type ObjectStore interface {
 	// Load returns an object store based on a namespace's configuration
@@ -57,6 +126,50 @@ type ObjectStore interface {
 
 	// DisableEvents turns off Bucket Notifications for the given dataset
 	DisableEvents(namespace *database.Namespace, dataset *database.Dataset) error
+
+	// WalkObjects calls fn for every object under the prefix in the namespace's bucket, loading each
+	// object's user metadata with a HEAD request. Walking stops if fn returns an error. Objects that are
+	// removed while walking are skipped
+	WalkObjects(n *database.Namespace, prefix string, fn func(object *ObjectInfo) error) error
+
+	// GetObjectMetadata returns an object's user metadata, with lowercase keys. Returns database.ErrNotFound
+	// if the object doesn't exist
+	GetObjectMetadata(n *database.Namespace, key string) (map[string]string, error)
+
+	// UpdateObjectMetadata replaces an object's user metadata with the result of fn, which is passed the current
+	// metadata, by copying the object onto itself. Other object properties (e.g. content type) are kept.
+	// Returns ErrObjectModified if the object changes before it is copied
+	UpdateObjectMetadata(n *database.Namespace, key string, fn func(metadata map[string]string) (map[string]string, error)) (map[string]string, error)
+
+	// ListObjectVersions returns the versions and delete markers of an object, newest first, with the user metadata
+	// of each version. Returns database.ErrNotFound if the object doesn't have any versions
+	ListObjectVersions(n *database.Namespace, key string) ([]*ObjectVersion, error)
+
+	// RestoreObjectVersion makes a prior version of an object the latest version, returning the restore method
+	// that was used. Returns database.ErrNotFound if the version doesn't exist, and ErrDeleteMarker if the version
+	// is a delete marker
+	RestoreObjectVersion(n *database.Namespace, key string, versionId string) (string, error)
+
+	// DeleteObjectVersion permanently removes a version or delete marker of an object
+	DeleteObjectVersion(n *database.Namespace, key string, versionId string) error
+
+	// VersioningEnabled returns true if versioning is enabled for the namespace's bucket
+	VersioningEnabled(n *database.Namespace) (bool, error)
+
+	// WalkLatestVersions calls fn with the key and latest version of every object under the prefix in the
+	// namespace's bucket, skipping deleted objects. Versions don't include user metadata. Walking stops if fn
+	// returns an error
+	WalkLatestVersions(n *database.Namespace, prefix string, fn func(key string, version *ObjectVersion) error) error
+
+	// CopyObject copies an object and its metadata to another key, which can be in another namespace of the same
+	// object store, without downloading it. Returns ErrObjectTooLarge for objects larger than 5GB
+	CopyObject(src *database.Namespace, srcKey string, dst *database.Namespace, dstKey string) error
+
+	// GetObject opens an object for reading. Returns database.ErrNotFound if the object doesn't exist
+	GetObject(n *database.Namespace, key string) (*ObjectContent, error)
+
+	// PutObject writes an object from the content's body, with its size, content type, and metadata
+	PutObject(n *database.Namespace, key string, content *ObjectContent) error
 }
 
 // LoadObjectStores is a helper method to load all object stores. Since things are pretty broken if object stores fail
@@ -101,3 +214,39 @@ func trimWhitespace(s string) string {
 	s4 := strings.ReplaceAll(s3, " ", "")
 	return s4
 }
+
+// lowercaseMetadata returns a copy of an object's user metadata with lowercase keys, as indexed by the sync service
+func lowercaseMetadata(metadata map[string]string) map[string]string {
+	lowercase := map[string]string{}
+	for key, value := range metadata {
+		lowercase[strings.ToLower(key)] = value
+	}
+	return lowercase
+}
+
+// planRestore decides how a version of an object is restored, given the object's versions newest first. It returns
+// the restore method, the version to restore, and the delete markers to remove for RestoreMethodRemoveDeleteMarker
+func planRestore(versions []*ObjectVersion, versionId string) (string, *ObjectVersion, []string, error) {
+	for i, version := range versions {
+		if version.VersionId != versionId {
+			continue
+		}
+		if version.IsDeleteMarker {
+			return "", nil, nil, ErrDeleteMarker
+		}
+		if i == 0 {
+			return RestoreMethodNone, version, nil, nil
+		}
+
+		markers := []string{}
+		for _, newer := range versions[:i] {
+			if !newer.IsDeleteMarker {
+				return RestoreMethodCopy, version, nil, nil
+			}
+			markers = append(markers, newer.VersionId)
+		}
+		return RestoreMethodRemoveDeleteMarker, version, markers, nil
+	}
+
+	return "", nil, nil, database.ErrNotFound
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/test"
+)
+
+func TestPlanRestore(t *testing.T) {
+	versions := []*ObjectVersion{
+		{VersionId: "marker-2", IsLatest: true, IsDeleteMarker: true},
+		{VersionId: "marker-1", IsDeleteMarker: true},
+		{VersionId: "v2"},
+		{VersionId: "v1"},
+	}
+
+	method, version, markers, err := planRestore(versions, "v2")
+	if err != nil {
+		t.Fatalf("Failed to plan restore: %v", err)
+	}
+	test.AssertEqual(t, method, RestoreMethodRemoveDeleteMarker)
+	test.AssertEqual(t, version.VersionId, "v2")
+	test.AssertEqual(t, len(markers), 2)
+	test.AssertEqual(t, markers[0], "marker-2")
+
+	method, _, _, err = planRestore(versions, "v1")
+	if err != nil {
+		t.Fatalf("Failed to plan restore: %v", err)
+	}
+	test.AssertEqual(t, method, RestoreMethodCopy)
+
+	method, _, _, err = planRestore(versions[2:], "v2")
+	if err != nil {
+		t.Fatalf("Failed to plan restore: %v", err)
+	}
+	test.AssertEqual(t, method, RestoreMethodNone)
+
+	_, _, _, err = planRestore(versions, "marker-1")
+	if err != ErrDeleteMarker {
+		t.Fatalf("Expected ErrDeleteMarker, got %v", err)
+	}
+
+	_, _, _, err = planRestore(versions, "v3")
+	if err != database.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
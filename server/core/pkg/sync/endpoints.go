@@ -17,6 +17,7 @@ const EVENT_DELETE_DATASET_PERMS = "delete-ds-perm"
 const EVENT_PUT_DATASET_SYNC = "put-ds-sync"
 const EVENT_PUT_DATASET_DUPLEX = "put-ds-duplex"
 const EVENT_CREATE_NAMESPACE = "create-namespace"
+const EVENT_DELETE_DATASET = "delete-ds"
 
 type ApiEventMsg struct {
 	EventType      string `json:"event_type"`
@@ -34,6 +35,7 @@ type ApiEventMsg struct {
 	// Namespace Duplex
 	TargetCoreService string `json:"target_core_service,omitempty"`
 	TargetNamespace   string `json:"target_namespace,omitempty"`
+	CascadeDelete     bool   `json:"cascade_delete,omitempty"`
 
 	// Create Namespace
 	// We must explicitly send the object store name because
@@ -189,7 +191,7 @@ func SyncDatasetHandler(c *gin.Context,
 // SyncNamespaceHandler is a function that will emit a message to duplex sync
 // the a namespace when duplex syncing is enabled.
 func SyncNamespaceHandler(c *gin.Context,
-	objStore store.ObjectStore, namespace *database.Namespace, targetCoreService, targetNamespace string) error {
+	objStore store.ObjectStore, namespace *database.Namespace, targetCoreService, targetNamespace string, cascadeDelete bool) error {
 	var msg ApiEventMsg
 	if c.Request.Method == "PUT" {
 		msg = ApiEventMsg{
@@ -198,6 +200,7 @@ func SyncNamespaceHandler(c *gin.Context,
 			Namespace:         namespace.Name,
 			TargetCoreService: targetCoreService,
 			TargetNamespace:   targetNamespace,
+			CascadeDelete:     cascadeDelete,
 		}
 	} else {
 		// Not a request that is synced
@@ -239,6 +242,85 @@ func CreateNamespaceHandler(c *gin.Context, objStore store.ObjectStore, namespac
 	return nil
 }
 
+// SyncDatasetDeleteHandler is a function that will emit a message to cascade the delete of a dataset
+// to its sync targets. It is called by the background dataset delete worker, which has no request
+// context, so the exchange for the namespace's object store is provided directly. The sync service
+// will only forward the delete to targets whose sync configuration has cascading deletes enabled and
+// the target core service will schedule the delete using its own delete delay.
+func SyncDatasetDeleteHandler(ase ApiSyncExchange, namespace *database.Namespace, dataset *database.Dataset) error {
+	msg := ApiEventMsg{
+		EventType:      EVENT_DELETE_DATASET,
+		SourceEndpoint: msgSourceEndpoint(),
+		Namespace:      namespace.Name,
+		Dataset:        dataset.Name,
+	}
+
+	err := ase.SendMessage(&msg)
+	if err != nil {
+		return errors.Wrap(err, "Failed to publish api sync message (dataset delete)")
+	}
+
+	return nil
+}
+
+// SyncDatasetMoveHandler is a function that will emit the messages to re-establish the sync of a dataset
+// that was renamed or moved to another namespace. It is called by the background dataset job worker, which has
+// no request context, so the exchange for the dataset's object store is provided directly. The messages are the
+// same as when sync is enabled for the first time, so the sync service creates the dataset in the target under
+// its new name, copies the existing objects, and sets the dataset's permissions.
+func SyncDatasetMoveHandler(ase ApiSyncExchange, namespace *database.Namespace, dataset *database.Dataset) error {
+	msg := ApiEventMsg{
+		EventType:      EVENT_PUT_DATASET_SYNC,
+		SourceEndpoint: msgSourceEndpoint(),
+		Namespace:      namespace.Name,
+		Dataset:        dataset.Name,
+		Description:    dataset.Description,
+	}
+
+	err := ase.SendMessage(&msg)
+	if err != nil {
+		return errors.Wrap(err, "Failed to publish api sync message (dataset create)")
+	}
+
+	if dataset.SyncType == database.SYNC_TYPE_DUPLEX {
+		// Hack...should process within 2 seconds to ensure ordering
+		time.Sleep(2 * time.Second)
+
+		msg = ApiEventMsg{
+			EventType:      EVENT_PUT_DATASET_DUPLEX,
+			SourceEndpoint: msgSourceEndpoint(),
+			Namespace:      namespace.Name,
+			Dataset:        dataset.Name,
+			SyncPolicy:     dataset.SyncPolicy,
+		}
+
+		err = ase.SendMessage(&msg)
+		if err != nil {
+			return errors.Wrap(err, "Failed to publish api sync message (dataset enable duplex)")
+		}
+	}
+
+	// Hack...should process within 2 seconds to ensure ordering
+	time.Sleep(2 * time.Second)
+	for _, perm := range dataset.Permissions {
+		msg = ApiEventMsg{
+			EventType:      EVENT_PUT_DATASET_PERMS,
+			SourceEndpoint: msgSourceEndpoint(),
+			Namespace:      namespace.Name,
+			Dataset:        dataset.Name,
+			Group:          perm.Group.GroupName,
+			Permission:     perm.Permission,
+		}
+
+		err = ase.SendMessage(&msg)
+		if err != nil {
+			return errors.Wrap(err, "Failed to publish api sync message (dataset create permission)")
+		}
+	}
+
+	return nil
+}
+
 func msgSourceEndpoint() string {
 	return os.Getenv("EXTERNAL_HOSTNAME") + "/core/v1"
 }
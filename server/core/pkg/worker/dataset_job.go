@@ -0,0 +1,260 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/store"
+	"github.com/gigantum/hoss-core/pkg/sync"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultDatasetJobPeriodSeconds is used if `dataset_job_period_seconds` is not configured
+	defaultDatasetJobPeriodSeconds = 30
+	// datasetJobProgressInterval is the number of objects copied between saves of a job's progress
+	datasetJobProgressInterval = 100
+	// datasetJobHeartbeatInterval is how often an instance records that it is still running a job
+	datasetJobHeartbeatInterval = 30 * time.Second
+	// datasetJobStaleAfter is how long a running job can go without a heartbeat before it is requeued, because the
+	// instance running it stopped
+	datasetJobStaleAfter = 5 * time.Minute
+)
+
+// DatasetJobWorker runs pending dataset jobs, one at a time. Jobs are claimed before they run, so when several core
+// service instances are running each job is only run by one of them
+func DatasetJobWorker(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore,
+	exchanges map[string]sync.ApiSyncExchange, exit <-chan bool) {
+	logrus.Info("[DATASET JOB WORKER] STARTING WORKER")
+
+	period := c.Server.DatasetJobPeriodSeconds
+	if period <= 0 {
+		period = defaultDatasetJobPeriodSeconds
+	}
+	owner := datasetJobOwner()
+
+	for {
+		select {
+		case <-exit:
+			logrus.Info("[DATASET JOB WORKER] Shutting down.")
+			return
+		default:
+			// Clone jobs whose instance stopped while they were running are restarted from the beginning. Copying
+			// an object overwrites the target object, so copying the objects that had already been copied again is
+			// safe. Move jobs resume from the phase they were in. A dataset that failed to move before it was
+			// switched is still read from its old location, but one that failed after it was switched may still
+			// have objects in its old location, so failed move jobs are also retried every period until the cause
+			// of the failure is fixed
+			requeued, err := db.RequeueDatasetJobs(datasetJobStaleAfter)
+			if err != nil {
+				logrus.Errorf("[DATASET JOB WORKER] Failed to requeue interrupted and failed jobs: %s", err.Error())
+			} else if requeued > 0 {
+				logrus.Infof("[DATASET JOB WORKER] Requeued %d interrupted or failed jobs", requeued)
+			}
+
+			jobs, err := db.GetDatasetJobsByStatus(database.DATASET_JOB_PENDING)
+			if err != nil {
+				logrus.Errorf("[DATASET JOB WORKER] Failed to list pending jobs: %s", err.Error())
+			}
+
+			for _, job := range jobs {
+				runDatasetJob(c, db, stores, exchanges, job, owner)
+			}
+
+			time.Sleep(time.Duration(period) * time.Second)
+		}
+	}
+}
+
+// datasetJobOwner returns a unique name for this core service instance, which is recorded on the jobs it runs
+func datasetJobOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "core"
+	}
+	return fmt.Sprintf("%s-%s", hostname, uuid.New().String())
+}
+
+// runDatasetJob claims and runs a clone or move job, saving the job's progress as it goes. The job isn't run if
+// another instance claimed it first
+func runDatasetJob(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore,
+	exchanges map[string]sync.ApiSyncExchange, job *database.DatasetJob, owner string) {
+
+	claimed, err := db.ClaimDatasetJob(job, owner)
+	if err != nil {
+		logrus.Errorf("[DATASET JOB WORKER] Failed to claim %s: %s", job, err.Error())
+		return
+	} else if !claimed {
+		logrus.Debugf("[DATASET JOB WORKER] Skipping %s, it was claimed by another instance", job)
+		return
+	}
+
+	logrus.Infof("[DATASET JOB WORKER] Starting %s", job)
+
+	// Move jobs resume from their phase, and only copy the objects that weren't copied yet, so their progress is kept
+	if job.Type != string(database.DATASET_JOB_MOVE) {
+		job.ObjectsCopied = 0
+		job.ObjectsFailed = 0
+		job.BytesCopied = 0
+		if err := db.UpdateDatasetJob(job); err != nil {
+			logrus.Errorf("[DATASET JOB WORKER] Failed to reset progress of %s: %s", job, err.Error())
+			return
+		}
+	}
+
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	go heartbeatDatasetJob(db, job, owner, stopHeartbeat)
+
+	if job.Type == string(database.DATASET_JOB_MOVE) {
+		err = runMoveJob(c, db, stores, exchanges, job)
+	} else {
+		err = runCloneJob(db, stores, job)
+	}
+	if err != nil {
+		logrus.Errorf("[DATASET JOB WORKER] %s failed: %s", job, err.Error())
+		finished := time.Now().UTC()
+		job.Status = string(database.DATASET_JOB_ERROR)
+		job.Error = err.Error()
+		job.Finished = &finished
+		if err := db.UpdateDatasetJob(job); err != nil {
+			logrus.Errorf("[DATASET JOB WORKER] Failed to set %s to ERROR: %s", job, err.Error())
+		}
+		return
+	}
+
+	finished := time.Now().UTC()
+	job.Status = string(database.DATASET_JOB_COMPLETE)
+	job.Finished = &finished
+	if err := db.UpdateDatasetJob(job); err != nil {
+		logrus.Errorf("[DATASET JOB WORKER] Failed to set %s to COMPLETE: %s", job, err.Error())
+	}
+
+	logrus.Infof("[DATASET JOB WORKER] Completed %s: %d objects copied, %d failed", job, job.ObjectsCopied, job.ObjectsFailed)
+}
+
+// heartbeatDatasetJob records that the job is still running every datasetJobHeartbeatInterval, until stop is closed
+func heartbeatDatasetJob(db *database.Database, job *database.DatasetJob, owner string, stop <-chan struct{}) {
+	ticker := time.NewTicker(datasetJobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			running, err := db.HeartbeatDatasetJob(job, owner)
+			if err != nil {
+				logrus.Errorf("[DATASET JOB WORKER] Failed to record heartbeat of %s: %s", job, err.Error())
+			} else if !running {
+				logrus.Warnf("[DATASET JOB WORKER] %s was requeued while running, its progress will not be saved", job)
+				return
+			}
+		}
+	}
+}
+
+// runCloneJob copies the objects of a clone job's source dataset into its target dataset
+func runCloneJob(db *database.Database, stores map[string]store.ObjectStore, job *database.DatasetJob) error {
+	source, err := getDatasetJobDataset(db, job.Namespace, job.Dataset)
+	if err != nil {
+		return fmt.Errorf("failed to load source dataset `%s/%s`: %s", job.Namespace, job.Dataset, err.Error())
+	}
+	target, err := getDatasetJobDataset(db, job.TargetNamespace, job.TargetDataset)
+	if err != nil {
+		return fmt.Errorf("failed to load target dataset `%s/%s`: %s", job.TargetNamespace, job.TargetDataset, err.Error())
+	}
+
+	sourceStore, ok := stores[source.Namespace.ObjectStore.Name]
+	if !ok {
+		return fmt.Errorf("object store `%s` not found for dataset %s. Try restarting the server", source.Namespace.ObjectStore.Name, source)
+	}
+	targetStore, ok := stores[target.Namespace.ObjectStore.Name]
+	if !ok {
+		return fmt.Errorf("object store `%s` not found for dataset %s. Try restarting the server", target.Namespace.ObjectStore.Name, target)
+	}
+
+	return copyDatasetObjects(db, job, source, sourceStore, target, targetStore)
+}
+
+// getDatasetJobDataset loads a dataset used by a job, which must not be marked for delete
+func getDatasetJobDataset(db *database.Database, namespaceName, datasetName string) (*database.Dataset, error) {
+	namespace, err := db.GetNamespace(namespaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := db.GetDataset(namespace, datasetName)
+	if err != nil {
+		return nil, err
+	}
+	if ds.DeleteStatus != string(database.NOT_SCHEDULED) {
+		return nil, fmt.Errorf("dataset is marked for delete")
+	}
+
+	return ds, nil
+}
+
+// copyDatasetObjects copies every object in the source dataset into the target dataset, with its metadata.
+// Objects are copied by the object store if both datasets are in the same object store, and streamed through the
+// core service otherwise. The dataset's metadata file is not copied, as the target dataset has its own
+func copyDatasetObjects(db *database.Database, job *database.DatasetJob, source *database.Dataset, sourceStore store.ObjectStore,
+	target *database.Dataset, targetStore store.ObjectStore) error {
+
+	metadataFile := store.NewMetadataFile(strings.TrimSuffix(source.RootDirectory, "/")).Key()
+	sameStore := source.Namespace.ObjectStore.Name == target.Namespace.ObjectStore.Name
+
+	err := sourceStore.WalkObjects(source.Namespace, source.RootDirectory, func(object *store.ObjectInfo) error {
+		if object.Key == metadataFile {
+			return nil
+		}
+		targetKey := target.RootDirectory + strings.TrimPrefix(object.Key, source.RootDirectory)
+
+		var err error
+		if sameStore {
+			err = sourceStore.CopyObject(source.Namespace, object.Key, target.Namespace, targetKey)
+		}
+		// objects that are too large to copy in a single request are streamed instead
+		if !sameStore || err == store.ErrObjectTooLarge {
+			err = streamObject(sourceStore, source.Namespace, object.Key, targetStore, target.Namespace, targetKey)
+		}
+
+		if err != nil {
+			logrus.Warnf("[DATASET JOB WORKER] Failed to copy `%s` for %s: %s", object.Key, job, err.Error())
+			job.ObjectsFailed++
+		} else {
+			job.ObjectsCopied++
+			job.BytesCopied += object.Size
+		}
+
+		if (job.ObjectsCopied+job.ObjectsFailed)%datasetJobProgressInterval == 0 {
+			if err := db.UpdateDatasetJob(job); err != nil {
+				logrus.Errorf("[DATASET JOB WORKER] Failed to update progress of %s: %s", job, err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list objects in dataset `%s/%s`: %s", source.Namespace.Name, source.Name, err.Error())
+	}
+
+	return nil
+}
+
+// streamObject copies an object by reading it from the source object store and writing it to the target
+func streamObject(sourceStore store.ObjectStore, sourceNamespace *database.Namespace, sourceKey string,
+	targetStore store.ObjectStore, targetNamespace *database.Namespace, targetKey string) error {
+
+	content, err := sourceStore.GetObject(sourceNamespace, sourceKey)
+	if err != nil {
+		return err
+	}
+	defer content.Body.Close()
+
+	return targetStore.PutObject(targetNamespace, targetKey, content)
+}
@@ -0,0 +1,338 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+	"github.com/gigantum/hoss-core/pkg/store"
+	"github.com/gigantum/hoss-core/pkg/sync"
+	"github.com/sirupsen/logrus"
+)
+
+// runMoveJob relocates the objects of a dataset that is being renamed or moved to another namespace. The dataset
+// keeps its name and is read from its old location while its objects are copied, and is only switched to its new
+// name and namespace once every object has been copied. Each phase can be run again if the job is interrupted, and
+// the job's phase is saved once a phase completes, so a restarted job resumes from the phase it was in
+func runMoveJob(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore,
+	exchanges map[string]sync.ApiSyncExchange, job *database.DatasetJob) error {
+
+	oldNamespace, err := db.GetNamespace(job.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to load namespace `%s`: %s", job.Namespace, err.Error())
+	}
+	newNamespace, err := db.GetNamespace(job.TargetNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to load namespace `%s`: %s", job.TargetNamespace, err.Error())
+	}
+
+	// The dataset is under its old name until it is switched
+	namespaceName, datasetName := job.Namespace, job.Dataset
+	if job.Phase != string(database.DATASET_JOB_PHASE_COPY) {
+		namespaceName, datasetName = job.TargetNamespace, job.TargetDataset
+	}
+	ds, err := getDatasetJobDataset(db, namespaceName, datasetName)
+	if err != nil {
+		return fmt.Errorf("failed to load dataset `%s/%s`: %s", namespaceName, datasetName, err.Error())
+	}
+
+	// The dataset before and after the move, using the same root directory convention as CreateDataset
+	old := movedDataset(ds, oldNamespace, job.Dataset)
+	moved := movedDataset(ds, newNamespace, job.TargetDataset)
+
+	oldStore, ok := stores[oldNamespace.ObjectStore.Name]
+	if !ok {
+		return fmt.Errorf("object store `%s` not found for dataset %s. Try restarting the server", oldNamespace.ObjectStore.Name, old)
+	}
+	newStore, ok := stores[newNamespace.ObjectStore.Name]
+	if !ok {
+		return fmt.Errorf("object store `%s` not found for dataset %s. Try restarting the server", newNamespace.ObjectStore.Name, moved)
+	}
+
+	if job.Phase == string(database.DATASET_JOB_PHASE_COPY) {
+		if err := prepareMovedDataset(moved, newStore); err != nil {
+			return err
+		}
+		if err := copyMovedObjects(db, job, old, oldStore, moved, newStore); err != nil {
+			return err
+		}
+		if err := db.SwitchMovedDataset(job, ds, newNamespace); err != nil {
+			return fmt.Errorf("failed to switch the dataset to its new location: %s", err.Error())
+		}
+		logrus.Infof("[DATASET JOB WORKER] %s entered phase %s", job, database.DATASET_JOB_PHASE_SWITCH)
+	}
+
+	if job.Phase == string(database.DATASET_JOB_PHASE_SWITCH) {
+		if err := switchMovedDataset(db, exchanges, old, oldStore, moved, newStore); err != nil {
+			return err
+		}
+		// Objects written to the old location before its policies were rendered again are copied as well
+		if err := copyMovedObjects(db, job, old, oldStore, moved, newStore); err != nil {
+			return err
+		}
+		if err := setMoveJobPhase(db, job, database.DATASET_JOB_PHASE_CLEANUP); err != nil {
+			return err
+		}
+	}
+
+	if job.Phase == string(database.DATASET_JOB_PHASE_CLEANUP) {
+		if err := cleanupMovedDataset(c, db, exchanges, old, oldStore, moved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// movedDataset returns a dataset as it is under a name and namespace
+func movedDataset(ds *database.Dataset, namespace *database.Namespace, name string) *database.Dataset {
+	moved := *ds
+	moved.NamespaceId = namespace.Id
+	moved.Namespace = namespace
+	moved.Name = name
+	moved.RootDirectory = name + "/"
+	return &moved
+}
+
+// setMoveJobPhase saves the phase a move job resumes from if it is interrupted
+func setMoveJobPhase(db *database.Database, job *database.DatasetJob, phase database.DatasetJobPhase) error {
+	job.Phase = string(phase)
+	if err := db.UpdateDatasetJob(job); err != nil {
+		return fmt.Errorf("failed to save the move phase `%s`: %s", phase, err.Error())
+	}
+
+	logrus.Infof("[DATASET JOB WORKER] %s entered phase %s", job, phase)
+	return nil
+}
+
+// prepareMovedDataset creates the dataset's new location, so the objects copied into it are indexed by the sync
+// service. Users can't access the new location until the dataset is switched and their policies are rendered again
+func prepareMovedDataset(ds *database.Dataset, newStore store.ObjectStore) error {
+	// Create the dataset's metadata file, unless it was created before the job was interrupted
+	_, err := newStore.GetObjectMetadata(ds.Namespace, store.NewMetadataFile(ds.Name).Key())
+	if err == database.ErrNotFound {
+		err = newStore.CreateDataset(ds.Name, ds.Namespace)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create the dataset in the object store: %s", err.Error())
+	}
+
+	isEnabled, err := newStore.EventsEnabled(ds.Namespace, ds)
+	if err != nil {
+		return fmt.Errorf("failed to check if bucket notifications are enabled: %s", err.Error())
+	}
+	if !isEnabled {
+		if err := newStore.EnableEvents(ds.Namespace, ds); err != nil {
+			return fmt.Errorf("failed to enable bucket notifications: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// switchMovedDataset gives users access to the dataset's new location once the dataset has been switched to it,
+// and removes their access to the old location. The dataset is created in the sync targets under its new name
+func switchMovedDataset(db *database.Database, exchanges map[string]sync.ApiSyncExchange,
+	old *database.Dataset, oldStore store.ObjectStore, ds *database.Dataset, newStore store.ObjectStore) error {
+
+	// Policies are rendered from the dataset's root directory, so they are rendered again in the object store the
+	// dataset is now in, and in the object store it was in, to remove access to the old location
+	usernames, err := db.GetUsersWithPermissionsToDataset(ds.Namespace, ds.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list the users with access to the dataset: %s", err.Error())
+	}
+	renderPolicies := func(objStore store.ObjectStore, objectStore *database.ObjectStore) error {
+		for _, username := range usernames {
+			perms, err := db.GetPermissionsByUser(objectStore, username, false)
+			if err != nil {
+				return fmt.Errorf("failed to load the permissions of `%s`: %s", username, err.Error())
+			}
+			if err := objStore.SetUserPolicy(username, perms); err != nil {
+				return fmt.Errorf("failed to set the policy of `%s`: %s", username, err.Error())
+			}
+		}
+		return nil
+	}
+	if err := renderPolicies(newStore, &ds.Namespace.ObjectStore); err != nil {
+		return err
+	}
+	if oldStore.GetName() != newStore.GetName() {
+		if err := renderPolicies(oldStore, &old.Namespace.ObjectStore); err != nil {
+			return err
+		}
+	}
+
+	// The sync service reloads its configuration when the dataset is moved. Create the dataset in the sync targets
+	// under its new name, which also syncs the objects that are already in the new location
+	if ds.SyncEnabled {
+		exchange, ok := exchanges[ds.Namespace.ObjectStore.Name]
+		if !ok {
+			// Failing to sync should not block moving the dataset
+			logrus.Errorf("[DATASET JOB WORKER] No API sync exchange defined for the namespace of %s, sync targets were not updated", ds)
+		} else if err := sync.SyncDatasetMoveHandler(exchange, ds.Namespace, ds); err != nil {
+			logrus.Errorf("[DATASET JOB WORKER] Failed to update sync targets for %s: %s", ds, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// copyMovedObjects copies the objects in the dataset's old location that are missing from the new location, or
+// were modified after the object in the new location. Objects written to the new location after the move are kept,
+// and objects that were already copied are skipped if the job is interrupted
+func copyMovedObjects(db *database.Database, job *database.DatasetJob, old *database.Dataset, oldStore store.ObjectStore,
+	ds *database.Dataset, newStore store.ObjectStore) error {
+
+	existing := map[string]time.Time{}
+	err := newStore.WalkObjects(ds.Namespace, ds.RootDirectory, func(object *store.ObjectInfo) error {
+		existing[object.Key] = object.LastModified
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list objects in dataset `%s/%s`: %s", ds.Namespace.Name, ds.Name, err.Error())
+	}
+
+	// Only the objects that failed in this pass are retried, the objects copied before are skipped
+	job.ObjectsFailed = 0
+	metadataFile := store.NewMetadataFile(old.Name).Key()
+	sameStore := oldStore.GetName() == newStore.GetName()
+
+	err = oldStore.WalkObjects(old.Namespace, old.RootDirectory, func(object *store.ObjectInfo) error {
+		if object.Key == metadataFile {
+			return nil
+		}
+		targetKey := ds.RootDirectory + strings.TrimPrefix(object.Key, old.RootDirectory)
+		if modified, ok := existing[targetKey]; ok && !object.LastModified.After(modified) {
+			return nil
+		}
+
+		var err error
+		if sameStore {
+			err = oldStore.CopyObject(old.Namespace, object.Key, ds.Namespace, targetKey)
+		}
+		// objects that are too large to copy in a single request are streamed instead
+		if !sameStore || err == store.ErrObjectTooLarge {
+			err = streamObject(oldStore, old.Namespace, object.Key, newStore, ds.Namespace, targetKey)
+		}
+
+		if err != nil {
+			logrus.Warnf("[DATASET JOB WORKER] Failed to copy `%s` for %s: %s", object.Key, job, err.Error())
+			job.ObjectsFailed++
+		} else {
+			job.ObjectsCopied++
+			job.BytesCopied += object.Size
+		}
+
+		if (job.ObjectsCopied+job.ObjectsFailed)%datasetJobProgressInterval == 0 {
+			if err := db.UpdateDatasetJob(job); err != nil {
+				logrus.Errorf("[DATASET JOB WORKER] Failed to update progress of %s: %s", job, err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list objects in dataset `%s/%s`: %s", old.Namespace.Name, old.Name, err.Error())
+	}
+
+	// The old location is deleted during cleanup, so the move can't continue until every object was copied
+	if job.ObjectsFailed > 0 {
+		return fmt.Errorf("%d objects couldn't be copied, the move is retried when the service restarts", job.ObjectsFailed)
+	}
+
+	return nil
+}
+
+// cleanupMovedDataset removes the dataset's old location from the object store and the search index, and removes
+// the dataset from the sync targets under its old name if they have cascading deletes enabled. A search index
+// rebuild job is created for the dataset, to index any objects the sync service missed while they were copied
+func cleanupMovedDataset(c *config.Configuration, db *database.Database, exchanges map[string]sync.ApiSyncExchange,
+	old *database.Dataset, oldStore store.ObjectStore, ds *database.Dataset) error {
+
+	// Another dataset can't use the old name until the move is complete, but make sure its objects are never removed
+	_, err := db.GetDataset(old.Namespace, old.Name)
+	if err == nil {
+		return fmt.Errorf("the dataset `%s/%s` exists, so the old location was not removed", old.Namespace.Name, old.Name)
+	} else if err != database.ErrNotFound {
+		return err
+	}
+
+	// Disable bucket notifications first, so deleting the old objects doesn't delete objects in the sync targets
+	isEnabled, err := oldStore.EventsEnabled(old.Namespace, old)
+	if err != nil {
+		return fmt.Errorf("failed to check if bucket notifications are enabled for the old location: %s", err.Error())
+	}
+	if isEnabled {
+		if err := oldStore.DisableEvents(old.Namespace, old); err != nil {
+			return fmt.Errorf("failed to disable bucket notifications for the old location: %s", err.Error())
+		}
+	}
+
+	if err := oldStore.DeleteDataset(old.RootDirectory, old.Namespace); err != nil {
+		return fmt.Errorf("failed to delete the old location: %s", err.Error())
+	}
+
+	// Failing to remove the old search index documents should not fail the move, as they are only returned in
+	// search results for the dataset's old name, which no user can read
+	if err := removeDatasetDocuments(c, old); err != nil {
+		logrus.Warnf("[DATASET JOB WORKER] Failed to remove the search index documents of %s: %s", old, err.Error())
+	}
+
+	if old.SyncEnabled {
+		exchange, ok := exchanges[old.Namespace.ObjectStore.Name]
+		if !ok {
+			logrus.Errorf("[DATASET JOB WORKER] No API sync exchange defined for the namespace of %s, sync targets were not updated", old)
+		} else if err := sync.SyncDatasetDeleteHandler(exchange, old.Namespace, old); err != nil {
+			logrus.Errorf("[DATASET JOB WORKER] Failed to cascade delete for %s to sync targets: %s", old, err.Error())
+		}
+	}
+
+	if _, err := db.CreateIndexJob(ds.Namespace.Name, ds.Name); err != nil {
+		return fmt.Errorf("failed to create the search index rebuild job: %s", err.Error())
+	}
+
+	return nil
+}
+
+// removeDatasetDocuments deletes the search index documents of a dataset
+func removeDatasetDocuments(c *config.Configuration, ds *database.Dataset) error {
+	if c.Server.ElasticsearchEndpoint == "" {
+		return errors.New("no search index endpoint is configured")
+	}
+
+	coreServiceEndpoint := os.Getenv("EXTERNAL_HOSTNAME") + "/core/v1"
+	datasetExtended := opensearch.DatasetExtended(ds.Namespace.ObjectStore.Name, ds.Namespace.BucketName, ds.RootDirectory)
+
+	documents := []*opensearch.MetadataIndexPayload{}
+	remove := func() error {
+		if len(documents) == 0 {
+			return nil
+		}
+		if _, err := opensearch.BulkDeleteDocuments(c.Server.ElasticsearchEndpoint, documents); err != nil {
+			return err
+		}
+		documents = []*opensearch.MetadataIndexPayload{}
+		return nil
+	}
+
+	err := opensearch.WalkDocuments(c.Server.ElasticsearchEndpoint, coreServiceEndpoint, datasetExtended, func(source *opensearch.IndexSource) error {
+		documents = append(documents, &opensearch.MetadataIndexPayload{
+			CoreServiceEndpoint: coreServiceEndpoint,
+			DatasetExtended:     datasetExtended,
+			ObjectKey:           source.ObjectKey,
+		})
+		if len(documents) >= indexBatchSize {
+			return remove()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return remove()
+}
@@ -77,7 +77,7 @@ func SetupWorkerTest(t *testing.T) (*config.Configuration, store.ObjectStore, *d
 
 // TeardownMinioTest gracefully tries to remove all data created by a test
 func TeardownWorkerTest(t *testing.T, c *config.Configuration, db *database.Database) {
-	possibleDatasets := [...]string{"delete-test-1"}
+	possibleDatasets := [...]string{"delete-test-1", "clone-test-1", "move-test-1"}
 	for _, name := range possibleDatasets {
 		p := filepath.Join(test.DefaultBucketDir(t, c.Namespaces[0].Bucket), name)
 		os.RemoveAll(p)
@@ -88,8 +88,10 @@ func TeardownWorkerTest(t *testing.T, c *config.Configuration, db *database.Data
 	if err != nil {
 		t.Fatalf("failed to load namespace during cleanup: %v", err)
 	}
-	_, err = db.GetDataset(ns, "delete-test-1")
-	if err == nil {
-		db.DeleteDataset(ns, "delete-test-1")
+	for _, name := range possibleDatasets {
+		_, err = db.GetDataset(ns, name)
+		if err == nil {
+			db.DeleteDataset(ns, name)
+		}
 	}
 }
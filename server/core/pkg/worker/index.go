@@ -0,0 +1,346 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gigantum/hoss-core/pkg/config"
+	"github.com/gigantum/hoss-core/pkg/database"
+	"github.com/gigantum/hoss-core/pkg/opensearch"
+	"github.com/gigantum/hoss-core/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// indexBatchSize is the number of objects indexed with each bulk request
+	indexBatchSize = 1000
+	// defaultIndexJobPeriodSeconds is used if `index_job_period_seconds` is not configured
+	defaultIndexJobPeriodSeconds = 30
+	// indexModifiedDateLayout matches the event time format used by the sync service for `last_modified_date`
+	indexModifiedDateLayout = "2006-01-02T15:04:05.000Z"
+	// technicalMetadataTolerance is how much earlier than the object's last modified time an existing document can
+	// have been indexed and still be considered to describe the current object. The sync service indexes objects
+	// with the event time, which can differ slightly from the object's last modified time
+	technicalMetadataTolerance = 1 * time.Minute
+)
+
+// IndexJobWorker runs pending search index rebuild jobs, one at a time
+func IndexJobWorker(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore, exit <-chan bool) {
+	logrus.Info("[INDEX JOB WORKER] STARTING WORKER")
+
+	period := c.Server.IndexJobPeriodSeconds
+	if period <= 0 {
+		period = defaultIndexJobPeriodSeconds
+	}
+
+	// Jobs that were running when the service stopped are restarted from the beginning. Indexing is idempotent,
+	// so re-indexing the datasets that had already completed is safe
+	jobs, err := db.GetIndexJobsByStatus(database.INDEX_JOB_IN_PROGRESS)
+	if err != nil {
+		logrus.Errorf("[INDEX JOB WORKER] Failed to list in progress jobs on start up: %s", err.Error())
+	}
+	for _, job := range jobs {
+		job.Status = string(database.INDEX_JOB_PENDING)
+		if err := db.UpdateIndexJob(job); err != nil {
+			logrus.Errorf("[INDEX JOB WORKER] Failed to reset %s to PENDING: %s", job, err.Error())
+			continue
+		}
+		logrus.Infof("[INDEX JOB WORKER] Reset interrupted job to PENDING: %s", job)
+	}
+
+	for {
+		select {
+		case <-exit:
+			logrus.Info("[INDEX JOB WORKER] Shutting down.")
+			return
+		default:
+			jobs, err := db.GetIndexJobsByStatus(database.INDEX_JOB_PENDING)
+			if err != nil {
+				logrus.Errorf("[INDEX JOB WORKER] Failed to list pending jobs: %s", err.Error())
+			}
+
+			for _, job := range jobs {
+				runIndexJob(c, db, stores, job)
+			}
+
+			time.Sleep(time.Duration(period) * time.Second)
+		}
+	}
+}
+
+// runIndexJob re-indexes the datasets of a job, saving the job's progress as it goes
+func runIndexJob(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore, job *database.IndexJob) {
+	logrus.Infof("[INDEX JOB WORKER] Starting %s", job)
+
+	started := time.Now().UTC()
+	job.Status = string(database.INDEX_JOB_IN_PROGRESS)
+	job.Started = &started
+	job.Finished = nil
+	job.DatasetsTotal = 0
+	job.DatasetsComplete = 0
+	job.ObjectsIndexed = 0
+	job.ObjectsFailed = 0
+	job.DocumentsDeleted = 0
+	job.Error = ""
+	if err := db.UpdateIndexJob(job); err != nil {
+		logrus.Errorf("[INDEX JOB WORKER] Failed to set %s to IN_PROGRESS: %s", job, err.Error())
+		return
+	}
+
+	failJob := func(err error) {
+		logrus.Errorf("[INDEX JOB WORKER] %s failed: %s", job, err.Error())
+		finished := time.Now().UTC()
+		job.Status = string(database.INDEX_JOB_ERROR)
+		job.Error = err.Error()
+		job.Finished = &finished
+		if err := db.UpdateIndexJob(job); err != nil {
+			logrus.Errorf("[INDEX JOB WORKER] Failed to set %s to ERROR: %s", job, err.Error())
+		}
+	}
+
+	datasets, err := getIndexJobDatasets(db, job)
+	if err != nil {
+		failJob(err)
+		return
+	}
+	job.DatasetsTotal = len(datasets)
+	if err := db.UpdateIndexJob(job); err != nil {
+		logrus.Errorf("[INDEX JOB WORKER] Failed to update progress of %s: %s", job, err.Error())
+	}
+
+	for _, ds := range datasets {
+		objStore, ok := stores[ds.Namespace.ObjectStore.Name]
+		if !ok {
+			failJob(fmt.Errorf("object store `%s` not found for dataset %s. Try restarting the server", ds.Namespace.ObjectStore.Name, ds))
+			return
+		}
+
+		if err := reindexDataset(c, db, objStore, job, ds); err != nil {
+			failJob(fmt.Errorf("failed to index dataset `%s/%s`: %s", ds.Namespace.Name, ds.Name, err.Error()))
+			return
+		}
+
+		job.DatasetsComplete++
+		if err := db.UpdateIndexJob(job); err != nil {
+			logrus.Errorf("[INDEX JOB WORKER] Failed to update progress of %s: %s", job, err.Error())
+		}
+	}
+
+	finished := time.Now().UTC()
+	job.Status = string(database.INDEX_JOB_COMPLETE)
+	job.Finished = &finished
+	if err := db.UpdateIndexJob(job); err != nil {
+		logrus.Errorf("[INDEX JOB WORKER] Failed to set %s to COMPLETE: %s", job, err.Error())
+	}
+
+	logrus.Infof("[INDEX JOB WORKER] Completed %s: %d objects indexed, %d failed, %d documents removed",
+		job, job.ObjectsIndexed, job.ObjectsFailed, job.DocumentsDeleted)
+}
+
+// getIndexJobDatasets returns the datasets a job indexes, excluding datasets that are marked for delete
+func getIndexJobDatasets(db *database.Database, job *database.IndexJob) ([]*database.Dataset, error) {
+	var namespaces []*database.Namespace
+	if job.Namespace != "" {
+		namespace, err := db.GetNamespace(job.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, namespace)
+	} else {
+		limit := 100
+		offset := 0
+		for {
+			page, err := db.ListNamespaces(limit, offset)
+			if err != nil {
+				return nil, err
+			}
+			if len(page) == 0 {
+				break
+			}
+			namespaces = append(namespaces, page...)
+			offset += limit
+		}
+	}
+
+	datasets := []*database.Dataset{}
+	for _, namespace := range namespaces {
+		if job.Dataset != "" {
+			ds, err := db.GetDataset(namespace, job.Dataset)
+			if err != nil {
+				return nil, err
+			}
+			datasets = append(datasets, ds)
+			continue
+		}
+
+		namespaceDatasets, err := db.ListDatasetsInNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, namespaceDatasets...)
+	}
+
+	active := []*database.Dataset{}
+	for _, ds := range datasets {
+		if ds.DeleteStatus == string(database.NOT_SCHEDULED) {
+			active = append(active, ds)
+		}
+	}
+
+	return active, nil
+}
+
+// reindexDataset indexes every object in a dataset, then removes the documents of objects that no longer exist
+func reindexDataset(c *config.Configuration, db *database.Database, objStore store.ObjectStore,
+	job *database.IndexJob, ds *database.Dataset) error {
+
+	logrus.Infof("[INDEX JOB WORKER] Indexing %s", ds)
+	started := time.Now().UTC()
+	coreServiceEndpoint := os.Getenv("EXTERNAL_HOSTNAME") + "/core/v1"
+	datasetExtended := opensearch.DatasetExtended(ds.Namespace.ObjectStore.Name, ds.Namespace.BucketName, ds.RootDirectory)
+
+	schema, err := db.GetMetadataSchema(ds)
+	if err == database.ErrNotFound {
+		schema = nil
+	} else if err != nil {
+		return err
+	}
+
+	// Track the object keys that exist, so documents for other keys can be removed
+	existing := map[string]bool{}
+	batch := []*opensearch.MetadataIndexPayload{}
+	objects := map[string]*store.ObjectInfo{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// Technical metadata and content hashes are computed by the sync service from the object content, which isn't
+		// read here. Keep them from the existing document if it describes the current version of the object.
+		// Sidecar metadata is loaded by the sync service from the object's sidecar files, and is always kept
+		documents, err := opensearch.GetDocuments(c.Server.ElasticsearchEndpoint, batch)
+		if err != nil {
+			return err
+		}
+		for _, payload := range batch {
+			document, ok := documents[payload.ObjectKey]
+			if ok && documentIsCurrent(document, objects[payload.ObjectKey]) {
+				for _, pair := range document.Metadata {
+					if strings.HasPrefix(pair, opensearch.TechnicalMetadataPrefix) {
+						payload.Metadata = append(payload.Metadata, pair)
+					}
+				}
+				payload.ContentHash = document.ContentHash
+			}
+			if ok && len(document.SidecarMetadata) > 0 {
+				payload.Metadata = append(payload.Metadata, document.SidecarMetadata...)
+				payload.SidecarMetadata = document.SidecarMetadata
+			}
+			opensearch.ApplyMetadataSchema(payload, schema)
+		}
+
+		failed, err := opensearch.BulkIndexDocuments(c.Server.ElasticsearchEndpoint, batch)
+		if err != nil {
+			return err
+		}
+		job.ObjectsIndexed += int64(len(batch) - failed)
+		job.ObjectsFailed += int64(failed)
+		if err := db.UpdateIndexJob(job); err != nil {
+			logrus.Errorf("[INDEX JOB WORKER] Failed to update progress of %s: %s", job, err.Error())
+		}
+
+		batch = []*opensearch.MetadataIndexPayload{}
+		objects = map[string]*store.ObjectInfo{}
+		return nil
+	}
+
+	err = objStore.WalkObjects(ds.Namespace, ds.RootDirectory, func(object *store.ObjectInfo) error {
+		existing[object.Key] = true
+
+		// the sync service doesn't index dataset metadata files
+		if strings.HasSuffix(object.Key, ".dataset.yaml") {
+			return nil
+		}
+
+		metadata := []string{}
+		for key, value := range object.Metadata {
+			metadata = append(metadata, fmt.Sprintf("%s:%s", key, value))
+		}
+		batch = append(batch, &opensearch.MetadataIndexPayload{
+			CoreServiceEndpoint: coreServiceEndpoint,
+			DatasetExtended:     datasetExtended,
+			ObjectKey:           object.Key,
+			LastModifiedDate:    object.LastModified.UTC().Format(indexModifiedDateLayout),
+			SizeBytes:           int(object.Size),
+			Metadata:            metadata,
+		})
+		objects[object.Key] = object
+
+		if len(batch) >= indexBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// Remove documents for objects that no longer exist. Documents modified after the walk started were indexed
+	// by the sync service for objects created while walking, so they are kept
+	orphans := []*opensearch.MetadataIndexPayload{}
+	removeOrphans := func() error {
+		if len(orphans) == 0 {
+			return nil
+		}
+		failed, err := opensearch.BulkDeleteDocuments(c.Server.ElasticsearchEndpoint, orphans)
+		if err != nil {
+			return err
+		}
+		job.DocumentsDeleted += int64(len(orphans) - failed)
+		orphans = []*opensearch.MetadataIndexPayload{}
+		return nil
+	}
+
+	err = opensearch.WalkDocuments(c.Server.ElasticsearchEndpoint, coreServiceEndpoint, datasetExtended, func(source *opensearch.IndexSource) error {
+		if existing[source.ObjectKey] {
+			return nil
+		}
+		if modified, err := time.Parse(time.RFC3339Nano, source.LastModifiedDate); err == nil && modified.After(started) {
+			return nil
+		}
+
+		orphans = append(orphans, &opensearch.MetadataIndexPayload{
+			CoreServiceEndpoint: coreServiceEndpoint,
+			DatasetExtended:     datasetExtended,
+			ObjectKey:           source.ObjectKey,
+		})
+		if len(orphans) >= indexBatchSize {
+			return removeOrphans()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return removeOrphans()
+}
+
+// documentIsCurrent returns true if an existing search index document was indexed for the current version of the object
+func documentIsCurrent(document *opensearch.IndexSource, object *store.ObjectInfo) bool {
+	if object == nil || document.SizeBytes != int(object.Size) {
+		return false
+	}
+
+	indexed, err := time.Parse(time.RFC3339Nano, document.LastModifiedDate)
+	if err != nil {
+		return false
+	}
+	return !indexed.Before(object.LastModified.Add(-technicalMetadataTolerance))
+}
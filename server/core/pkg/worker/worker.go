@@ -1,15 +1,18 @@
 package worker
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gigantum/hoss-core/pkg/config"
 	"github.com/gigantum/hoss-core/pkg/database"
 	"github.com/gigantum/hoss-core/pkg/store"
+	"github.com/gigantum/hoss-core/pkg/sync"
 	"github.com/sirupsen/logrus"
 )
 
-func DeleteDatasetWorker(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore, exit <-chan bool) {
+func DeleteDatasetWorker(c *config.Configuration, db *database.Database, stores map[string]store.ObjectStore,
+	exchanges map[string]sync.ApiSyncExchange, exit <-chan bool) {
 	// On first boot, if any datasets are in an ERROR state we reset them to SCHEDULED. This gives an
 	// easy path for admins to attempt to fix a failed delete and then trigger the delete again.
 	// If the same error occurs it will just go back into ERROR state and continue to be skipped until
@@ -59,12 +62,23 @@ func DeleteDatasetWorker(c *config.Configuration, db *database.Database, stores
 						continue
 					}
 
+					// If any of the namespace's sync configurations have cascading deletes enabled, emit a single
+					// API notification so the sync service can schedule the delete of the target dataset. The target
+					// core service applies its own delete delay, so the target can still be restored independently.
+					if ds.SyncEnabled {
+						err = cascadeDatasetDelete(db, exchanges, ds)
+						if err != nil {
+							// Failing to cascade should not block deleting the source dataset
+							logrus.Errorf("[DATASET DELETE WORKER] Failed to cascade delete for dataset %s to sync targets: %s", ds, err.Error())
+						}
+					}
+
 					// Disable sync before deleting the dataset in the object store
 					// When the object store delete op runs, it will emit delete object events that
 					// the sync service will see. This is important because the search index will then
 					// update and remove the data related to these objects. We don't, however, want to
-					// remove the target data. Future work will provide a proper way to configure "cascading"
-					// the delete operation to a target dataset via a single API notification
+					// remove the target data object by object. Deleting the target dataset is handled
+					// by the cascading delete notification above, if configured.
 					if ds.SyncEnabled {
 						// Note: This will mutate the sync_configuration_meta.last_updated cell with the current timestamp, if the query succeeds
 						// This will trigger the configuration reload delay inside the sync service.
@@ -146,3 +160,31 @@ func DeleteDatasetWorker(c *config.Configuration, db *database.Database, stores
 		}
 	}
 }
+
+// cascadeDatasetDelete sends the dataset delete API notification if at least one of the dataset's
+// namespace sync configurations has cascading deletes enabled
+func cascadeDatasetDelete(db *database.Database, exchanges map[string]sync.ApiSyncExchange, ds *database.Dataset) error {
+	syncTargets, err := db.GetNamespaceSyncTargets(ds.Namespace)
+	if err != nil {
+		return err
+	}
+
+	cascade := false
+	for _, target := range syncTargets {
+		if target.CascadeDelete {
+			cascade = true
+			break
+		}
+	}
+	if !cascade {
+		return nil
+	}
+
+	exchange, ok := exchanges[ds.Namespace.ObjectStore.Name]
+	if !ok {
+		return errors.New("no API sync exchange defined for the namespace")
+	}
+
+	logrus.Infof("[DATASET DELETE WORKER] Cascading delete of dataset %s to sync targets", ds)
+	return sync.SyncDatasetDeleteHandler(exchange, ds.Namespace, ds)
+}
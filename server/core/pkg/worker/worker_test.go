@@ -1,8 +1,11 @@
 package worker
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -75,7 +78,7 @@ func TestDeleteDataset(t *testing.T) {
 	objMap := map[string]store.ObjectStore{}
 	objMap[currentStore.GetName()] = currentStore
 	exitCh := make(chan bool)
-	go DeleteDatasetWorker(config, db, objMap, exitCh)
+	go DeleteDatasetWorker(config, db, objMap, nil, exitCh)
 
 	time.Sleep(55 * time.Second)
 
@@ -158,7 +161,7 @@ func TestDeleteDatasetInErrorState(t *testing.T) {
 	objMap := map[string]store.ObjectStore{}
 	objMap[currentStore.GetName()] = currentStore
 	exitCh := make(chan bool)
-	go DeleteDatasetWorker(config, db, objMap, exitCh)
+	go DeleteDatasetWorker(config, db, objMap, nil, exitCh)
 
 	time.Sleep(5 * time.Second)
 
@@ -175,3 +178,234 @@ func TestDeleteDatasetInErrorState(t *testing.T) {
 	exitCh <- true
 	time.Sleep(5 * time.Second)
 }
+
+func TestCloneDataset(t *testing.T) {
+	config, currentStore, db, err := SetupWorkerTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("default")
+	if err != nil {
+		t.Fatalf("failed to load namespace: %v", err)
+	}
+	source, err := db.GetDataset(ns, "delete-test-1")
+	if err != nil {
+		t.Fatal("Expected no error but get dataset failed: ", err.Error())
+	}
+
+	err = db.CreateDataset(ns, "clone-test-1", "my cloned dataset", "clone-test-1/", "testuser")
+	if err != nil {
+		t.Fatalf("failed to create clone dataset in db: %v", err)
+	}
+	err = currentStore.CreateDataset("clone-test-1", ns)
+	if err != nil {
+		t.Fatalf("failed to create clone dataset in object store: %v", err)
+	}
+	target, err := db.GetDataset(ns, "clone-test-1")
+	if err != nil {
+		t.Fatal("Expected no error but get dataset failed: ", err.Error())
+	}
+
+	job, err := db.CreateDatasetJob(database.DATASET_JOB_CLONE, source, target, "testuser")
+	if err != nil {
+		t.Fatalf("Expected no error but create dataset job failed: %v", err)
+	}
+
+	objMap := map[string]store.ObjectStore{}
+	objMap[currentStore.GetName()] = currentStore
+	runDatasetJob(config, db, objMap, nil, job, "test-worker")
+
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(database.DATASET_JOB_COMPLETE))
+	test.AssertEqual(t, job.ObjectsCopied, int64(200))
+	test.AssertEqual(t, job.ObjectsFailed, int64(0))
+
+	// The target keeps its own dataset metadata file
+	metadata, err := currentStore.GetObject(ns, "clone-test-1/.dataset.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error but get object failed: %v", err)
+	}
+	defer metadata.Body.Close()
+	contents, err := ioutil.ReadAll(metadata.Body)
+	if err != nil {
+		t.Fatalf("Expected no error but reading object failed: %v", err)
+	}
+	test.AssertEqual(t, strings.Contains(string(contents), "clone-test-1"), true)
+}
+
+func TestMoveDataset(t *testing.T) {
+	config, currentStore, db, err := SetupWorkerTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("default")
+	if err != nil {
+		t.Fatalf("failed to load namespace: %v", err)
+	}
+	ds, err := db.GetDataset(ns, "delete-test-1")
+	if err != nil {
+		t.Fatal("Expected no error but get dataset failed: ", err.Error())
+	}
+
+	job, err := db.MoveDataset(ds, ns, "move-test-1", "testuser")
+	if err != nil {
+		t.Fatalf("Expected no error but move dataset failed: %v", err)
+	}
+
+	objMap := map[string]store.ObjectStore{}
+	objMap[currentStore.GetName()] = currentStore
+	runDatasetJob(config, db, objMap, nil, job, "test-worker")
+
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(database.DATASET_JOB_COMPLETE))
+	test.AssertEqual(t, job.Phase, string(database.DATASET_JOB_PHASE_CLEANUP))
+	test.AssertEqual(t, job.ObjectsCopied, int64(200))
+	test.AssertEqual(t, job.ObjectsFailed, int64(0))
+
+	// The objects are only in the new location
+	_, err = currentStore.GetObject(ns, "delete-test-1/0.txt")
+	test.AssertEqual(t, err, database.ErrNotFound)
+	object, err := currentStore.GetObject(ns, "move-test-1/0.txt")
+	if err != nil {
+		t.Fatalf("Expected no error but get object failed: %v", err)
+	}
+	object.Body.Close()
+
+	metadata, err := currentStore.GetObject(ns, "move-test-1/.dataset.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error but get object failed: %v", err)
+	}
+	defer metadata.Body.Close()
+	contents, err := ioutil.ReadAll(metadata.Body)
+	if err != nil {
+		t.Fatalf("Expected no error but reading object failed: %v", err)
+	}
+	test.AssertEqual(t, strings.Contains(string(contents), "move-test-1"), true)
+
+	// A completed job isn't claimed again
+	claimed, err := db.ClaimDatasetJob(job, "test-worker")
+	if err != nil {
+		t.Fatalf("Expected no error but claim dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, claimed, false)
+
+	// Running the job again, e.g. if its instance stopped before saving it as complete, doesn't remove the dataset
+	job.Status = string(database.DATASET_JOB_PENDING)
+	if err := db.UpdateDatasetJob(job); err != nil {
+		t.Fatalf("Expected no error but update dataset job failed: %v", err)
+	}
+	runDatasetJob(config, db, objMap, nil, job, "test-worker")
+	_, err = currentStore.GetObject(ns, "move-test-1/.dataset.yaml")
+	test.AssertEqual(t, err, nil)
+}
+
+// failingCopyStore is an object store that fails to copy one object
+type failingCopyStore struct {
+	store.ObjectStore
+	failKey string
+}
+
+func (s *failingCopyStore) CopyObject(src *database.Namespace, srcKey string, dst *database.Namespace, dstKey string) error {
+	if srcKey == s.failKey {
+		return errors.New("copy failed")
+	}
+	return s.ObjectStore.CopyObject(src, srcKey, dst, dstKey)
+}
+
+func TestMoveDatasetFailed(t *testing.T) {
+	config, currentStore, db, err := SetupWorkerTest(t)
+	if err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	ns, err := db.GetNamespace("default")
+	if err != nil {
+		t.Fatalf("failed to load namespace: %v", err)
+	}
+	ds, err := db.GetDataset(ns, "delete-test-1")
+	if err != nil {
+		t.Fatal("Expected no error but get dataset failed: ", err.Error())
+	}
+
+	job, err := db.MoveDataset(ds, ns, "move-test-1", "testuser")
+	if err != nil {
+		t.Fatalf("Expected no error but move dataset failed: %v", err)
+	}
+
+	// The dataset is read from its old location while the move is in progress, or if it fails
+	assertNotMoved := func() {
+		t.Helper()
+		current, err := db.GetDataset(ns, "delete-test-1")
+		if err != nil {
+			t.Fatal("Expected no error but get dataset failed: ", err.Error())
+		}
+		test.AssertEqual(t, current.RootDirectory, "delete-test-1/")
+		_, err = db.GetDataset(ns, "move-test-1")
+		test.AssertEqual(t, err, database.ErrNotFound)
+
+		object, err := currentStore.GetObject(current.Namespace, current.RootDirectory+"0.txt")
+		if err != nil {
+			t.Fatalf("Expected no error but get object failed: %v", err)
+		}
+		object.Body.Close()
+	}
+	assertNotMoved()
+
+	failingMap := map[string]store.ObjectStore{}
+	failingMap[currentStore.GetName()] = &failingCopyStore{ObjectStore: currentStore, failKey: "delete-test-1/7.txt"}
+	runDatasetJob(config, db, failingMap, nil, job, "test-worker")
+
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(database.DATASET_JOB_ERROR))
+	test.AssertEqual(t, job.Phase, string(database.DATASET_JOB_PHASE_COPY))
+	test.AssertEqual(t, job.ObjectsCopied, int64(199))
+	test.AssertEqual(t, job.ObjectsFailed, int64(1))
+	assertNotMoved()
+
+	// The failed move is retried, and only copies the object that failed
+	requeued, err := db.RequeueDatasetJobs(time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error but requeue dataset jobs failed: %v", err)
+	}
+	test.AssertEqual(t, requeued, 1)
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+
+	objMap := map[string]store.ObjectStore{}
+	objMap[currentStore.GetName()] = currentStore
+	runDatasetJob(config, db, objMap, nil, job, "test-worker")
+
+	job, err = db.GetDatasetJob(job.Id)
+	if err != nil {
+		t.Fatalf("Expected no error but get dataset job failed: %v", err)
+	}
+	test.AssertEqual(t, job.Status, string(database.DATASET_JOB_COMPLETE))
+	test.AssertEqual(t, job.ObjectsCopied, int64(200))
+	test.AssertEqual(t, job.ObjectsFailed, int64(0))
+
+	moved, err := db.GetDataset(ns, "move-test-1")
+	if err != nil {
+		t.Fatal("Expected no error but get dataset failed: ", err.Error())
+	}
+	test.AssertEqual(t, moved.RootDirectory, "move-test-1/")
+	_, err = currentStore.GetObject(ns, "delete-test-1/0.txt")
+	test.AssertEqual(t, err, database.ErrNotFound)
+	object, err := currentStore.GetObject(ns, "move-test-1/7.txt")
+	if err != nil {
+		t.Fatalf("Expected no error but get object failed: %v", err)
+	}
+	object.Body.Close()
+}
@@ -0,0 +1,96 @@
+package search
+
+import "fmt"
+
+// MetadataIndexAlias is the alias used to read and write the metadata search index. It points to the
+// versioned index with the current mappings, so the mappings can be changed without downtime
+const MetadataIndexAlias = "metadata-index"
+
+// MetadataIndexVersion is the version of MetadataIndexMappings. It must be incremented whenever the mappings
+// are changed, which causes the core service to migrate the documents to a new index on start up
+const MetadataIndexVersion = 1
+
+// MetadataIndexName returns the name of the index that holds a version of the metadata index mappings
+func MetadataIndexName(version int) string {
+	return fmt.Sprintf("%s-v%d", MetadataIndexAlias, version)
+}
+
+// MetadataIndexMappings is the request body used to create the metadata search index
+const MetadataIndexMappings = `
+{
+   "settings":{
+      "analysis":{
+         "char_filter":{
+            "strip_dataset":{"type": "pattern_replace", "pattern": "^[^/]*/", "replacement": ""},
+            "basename":{"type": "pattern_replace", "pattern": "^.*/", "replacement": ""}
+         },
+         "tokenizer":{
+            "path_hierarchy":{"type": "path_hierarchy", "delimiter": "/"},
+            "path_segments":{"type": "pattern", "pattern": "/"},
+            "filename_ngram":{"type": "ngram", "min_gram": 2, "max_gram": 3}
+         },
+         "analyzer":{
+            "object_key_path":{"type": "custom", "char_filter": ["strip_dataset"], "tokenizer": "path_hierarchy"},
+            "object_key_segments":{
+               "type": "custom",
+               "char_filter": ["strip_dataset"],
+               "tokenizer": "path_segments",
+               "filter": ["lowercase"]
+            },
+            "path_segments":{"type": "custom", "tokenizer": "path_segments", "filter": ["lowercase"]},
+            "object_key_filename":{
+               "type": "custom",
+               "char_filter": ["basename"],
+               "tokenizer": "filename_ngram",
+               "filter": ["lowercase"]
+            },
+            "filename":{"type": "custom", "tokenizer": "filename_ngram", "filter": ["lowercase"]}
+         }
+      }
+   },
+   "mappings":{
+      "properties":{
+         "core_service_endpoint": {"type": "keyword"},
+         "dataset_extended": {"type": "keyword"},
+         "object_key": {
+            "type": "keyword",
+            "fields": {
+               "path": {"type": "text", "analyzer": "object_key_path", "search_analyzer": "keyword"},
+               "segments": {"type": "text", "analyzer": "object_key_segments", "search_analyzer": "path_segments"},
+               "filename": {"type": "text", "analyzer": "object_key_filename", "search_analyzer": "filename"}
+            }
+         },
+         "last_modified_date": {"type": "date"},
+         "size_bytes": {"type": "double"},
+         "content_hash": {"type": "keyword"},
+         "sidecar_metadata": {"type": "keyword"},
+         "schema_violations": {"type": "keyword"},
+         "typed_metadata": {
+            "type": "nested",
+            "properties": {
+               "key": {"type": "keyword", "normalizer": "lowercase"},
+               "number": {"type": "double"},
+               "date": {"type": "date"},
+               "boolean": {"type": "boolean"}
+            }
+         },
+         "metadata": {
+            "type": "keyword",
+            "normalizer": "lowercase",
+            "fields": {
+               "autocomplete": {
+                  "type": "completion",
+                  "contexts": [
+                     {
+                        "name": "dataset",
+                        "type": "category",
+                        "path": "dataset_extended"
+                     }
+                  ]
+               }
+            }
+         }
+      }
+   }
+}
+`
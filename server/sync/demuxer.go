@@ -20,7 +20,7 @@ import (
 // Demuxer loads the notification queues defined in the configuration file and routes the
 // messages from them to the appropriate worker queues for execution. The Demuxer is responsible
 // for creating / deleting the workers using the WorkerManager interface
-func Demuxer(ctx context.Context, configuration *config.Configuration, tokens service.RenewingTokens, populatedConfigs *PopulatedCoreServiceConfigurations) {
+func Demuxer(ctx context.Context, configuration *config.Configuration, tokens service.RenewingTokens, populatedConfigs *PopulatedCoreServiceConfigurations, leases *ShardLeases) {
 	// Load the different notification queues
 	notifications := make(chan config.Message)
 
@@ -33,7 +33,7 @@ func Demuxer(ctx context.Context, configuration *config.Configuration, tokens se
 		for _, notificationQueueSettings := range queues {
 			logrus.Infof("Starting to monitor notification queue: %+v", notificationQueueSettings)
 
-			notificationQueue, err := queue.LoadNotificationQueue(configuration, &notificationQueueSettings)
+			notificationQueue, err := queue.LoadNotificationQueue(configuration, &notificationQueueSettings, leases)
 			if err != nil {
 				logrus.Fatal("Could not get notification queue: " + err.Error())
 			}
@@ -82,6 +82,8 @@ func Demuxer(ctx context.Context, configuration *config.Configuration, tokens se
 				if is_match {
 					if !should_ignore {
 						populatedConfig.WorkerQueue <- msg
+					} else {
+						config.ReleaseMessage(msg)
 					}
 					dispatched = true
 					break
@@ -90,6 +92,7 @@ func Demuxer(ctx context.Context, configuration *config.Configuration, tokens se
 
 			if !dispatched {
 				logrus.Error("Could not find core service configuration for message: " + msg.String())
+				config.ReleaseMessage(msg)
 			}
 		case <-ctx.Done():
 			logrus.Infof("Demuxer stopping...")
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	errors "github.com/gigantum/hoss-error"
+	service "github.com/gigantum/hoss-service"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// ShardLeases tracks the shards of the sync workload that are leased to this Sync Service instance.
+// Messages are assigned to a shard by hashing their ShardKey, and only the instance that owns the
+// shard processes the message. Leases are stored by a Core Service, which balances the shards between
+// all running instances and reassigns the shards of instances that stop renewing their leases.
+// When the Core Service rebalances a shard to another instance, this instance stops taking messages for
+// the shard and gives up the lease once the messages it is processing for the shard are done.
+type ShardLeases struct {
+	mu sync.RWMutex
+
+	settings config.Sharding
+
+	owned      map[int]bool
+	validUntil time.Time
+
+	// releasing are the shards the Core Service asked this instance to give up
+	releasing map[int]bool
+	// inFlight is the number of claimed messages of each shard that are still being processed
+	inFlight map[int]int
+	// drained is signaled when the last in flight message of a releasing shard is done, so the lease
+	// is given up without waiting for the next renewal
+	drained chan struct{}
+}
+
+// NewShardLeases creates the ShardLeases for this instance, no shards are owned until Acquire is called
+func NewShardLeases(settings config.Sharding) *ShardLeases {
+	return &ShardLeases{
+		settings:  settings,
+		owned:     map[int]bool{},
+		releasing: map[int]bool{},
+		inFlight:  map[int]int{},
+		drained:   make(chan struct{}, 1),
+	}
+}
+
+// Enabled returns true if the sync workload is sharded between multiple Sync Service instances
+func (sl *ShardLeases) Enabled() bool {
+	return sl.settings.ShardCount > 0
+}
+
+// shard returns the shard a message is assigned to, or -1 if any instance can process it
+func (sl *ShardLeases) shard(msg config.Message) int {
+	key := msg.ShardKey()
+	if key == "" {
+		return -1
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(sl.settings.ShardCount))
+}
+
+// ownsShard returns true if this instance can take new messages for the shard, the lock must be held
+func (sl *ShardLeases) ownsShard(shard int) bool {
+	// If the leases could not be renewed in time another instance may now own the shard
+	return sl.owned[shard] && time.Now().Before(sl.validUntil)
+}
+
+// Owns returns true if this instance should process the given message
+func (sl *ShardLeases) Owns(msg config.Message) bool {
+	if !sl.Enabled() {
+		return true
+	}
+
+	shard := sl.shard(msg)
+	if shard < 0 {
+		return true
+	}
+
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	return sl.ownsShard(shard)
+}
+
+// Claim returns true if this instance should process the given message, and counts it as in flight until
+// release is called, so that the lease on its shard isn't given up while it is processed
+func (sl *ShardLeases) Claim(msg config.Message) (func(), bool) {
+	if !sl.Enabled() {
+		return nil, true
+	}
+
+	shard := sl.shard(msg)
+	if shard < 0 {
+		return nil, true
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if !sl.ownsShard(shard) {
+		return nil, false
+	}
+	sl.inFlight[shard]++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			sl.mu.Lock()
+			defer sl.mu.Unlock()
+
+			sl.inFlight[shard]--
+			if sl.inFlight[shard] > 0 {
+				return
+			}
+			delete(sl.inFlight, shard)
+
+			if sl.releasing[shard] {
+				select {
+				case sl.drained <- struct{}{}:
+				default:
+				}
+			}
+		})
+	}
+	return release, true
+}
+
+// released returns the releasing shards that have no messages in flight, which can be given up
+func (sl *ShardLeases) released() []int {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	released := []int{}
+	for shard := range sl.releasing {
+		if sl.inFlight[shard] == 0 {
+			released = append(released, shard)
+		}
+	}
+	sort.Ints(released)
+	return released
+}
+
+// Acquire registers this instance with the Core Service, renews the leases on the shards it owns, and gives up
+// the leases on the shards it was asked to release that have no messages in flight
+func (sl *ShardLeases) Acquire(tokens service.RenewingTokens) error {
+	// The lease is valid from when the request was made, not when the response was received
+	start := time.Now()
+
+	shards, releasing, err := AcquireShardLeases(tokens, sl.settings, sl.released())
+	if err != nil {
+		return err
+	}
+
+	owned := map[int]bool{}
+	for _, shard := range shards {
+		owned[shard] = true
+	}
+	releasingShards := map[int]bool{}
+	for _, shard := range releasing {
+		releasingShards[shard] = true
+	}
+
+	sl.mu.Lock()
+	changed := len(owned) != len(sl.owned)
+	for shard := range owned {
+		if !sl.owned[shard] {
+			changed = true
+		}
+	}
+	sl.owned = owned
+	sl.releasing = releasingShards
+	sl.validUntil = start.Add(sl.settings.LeaseDuration)
+	sl.mu.Unlock()
+
+	if changed {
+		logrus.Infof("Instance %s now owns %d of %d shards: %v", sl.settings.InstanceId, len(shards), sl.settings.ShardCount, shards)
+	}
+	if len(releasing) > 0 {
+		logrus.Infof("Instance %s is releasing %d shards once their messages are processed: %v", sl.settings.InstanceId, len(releasing), releasing)
+	}
+
+	return nil
+}
+
+// Monitor periodically renews the shard leases, picking up any shards that were rebalanced to this instance,
+// and gives up the shards rebalanced to other instances as soon as their messages are processed
+func (sl *ShardLeases) Monitor(ctx context.Context, tokens service.RenewingTokens) {
+	interval := sl.settings.LeaseDuration / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logrus.Infof("Starting to renew shard leases for instance %s (interval: %v)", sl.settings.InstanceId, interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := sl.Acquire(tokens); err != nil {
+				logrus.Warnf("Could not renew shard leases: %s", err.Error())
+			}
+		case <-sl.drained:
+			if err := sl.Acquire(tokens); err != nil {
+				logrus.Warnf("Could not release drained shard leases: %s", err.Error())
+			}
+		case <-ctx.Done():
+			logrus.Info("Shard lease monitor stopping...")
+			return
+		}
+	}
+}
+
+// AcquireShardLeases makes the HTTP request to the Core Service to acquire or renew the shard leases, giving up the
+// leases on the released shards. It returns the owned shards and the shards that must be released
+func AcquireShardLeases(tokens service.RenewingTokens, settings config.Sharding, released []int) ([]int, []int, error) {
+	// Hack to support running on localhost
+	coreService := strings.Replace(settings.LeaseCoreService, "localhost/core", "core:8080", 1)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"instance_id":    settings.InstanceId,
+		"shard_count":    settings.ShardCount,
+		"lease_duration": int(settings.LeaseDuration.Seconds()),
+		"released":       released,
+	})
+	if err != nil {
+		return nil, nil, errors.New("could not encode shard lease request: " + err.Error())
+	}
+
+	req, err := http.NewRequest("PUT", coreService+"/configuration/sync/lease", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, nil, errors.New("could not create shard lease request: " + err.Error())
+	}
+
+	idToken, err := tokens.GetIDToken()
+	if err != nil {
+		return nil, nil, errors.New("could not get service ID Token for authentication: " + err.Error())
+	}
+
+	req.Header.Set("Authorization", "Bearer "+idToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, errors.New("could not make shard lease request: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		d, err := httputil.DumpResponse(resp, true)
+		if err != nil {
+			return nil, nil, errors.New("problem with shard lease response: " + err.Error())
+		}
+
+		logrus.Debug(string(d))
+		return nil, nil, errors.New("problem with shard lease response: StatusCode != 200")
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.New("problem with reading shard lease response: " + err.Error())
+	}
+
+	leases := struct {
+		Shards    []int `json:"shards"`
+		Releasing []int `json:"releasing"`
+	}{}
+	if err := json.Unmarshal(respBody, &leases); err != nil {
+		return nil, nil, errors.New("problem unmarshaling the shard lease response: " + err.Error())
+	}
+
+	return leases.Shards, leases.Releasing, nil
+}
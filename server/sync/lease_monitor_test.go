@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+	"github.com/gigantum/hoss-sync/pkg/message"
+)
+
+// fakeTokens returns a fixed service token
+type fakeTokens struct{}
+
+func (fakeTokens) GetAccessToken() (string, error) { return "access-token", nil }
+func (fakeTokens) GetIDToken() (string, error)     { return "id-token", nil }
+func (fakeTokens) RefreshRoutine()                 {}
+
+// fakeLeaseCore is a core service lease endpoint that returns the configured shards, recording the shards released
+// in each request
+type fakeLeaseCore struct {
+	mu        sync.Mutex
+	shards    []int
+	releasing []int
+	released  [][]int
+}
+
+func (f *fakeLeaseCore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	request := struct {
+		Released []int `json:"released"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&request)
+	f.released = append(f.released, request.Released)
+
+	json.NewEncoder(w).Encode(map[string][]int{"shards": f.shards, "releasing": f.releasing})
+}
+
+// newTestLeases creates shard leases that are acquired from a fake core service
+func newTestLeases(t *testing.T, core *fakeLeaseCore) *ShardLeases {
+	server := httptest.NewServer(core)
+	t.Cleanup(server.Close)
+
+	return NewShardLeases(config.Sharding{
+		ShardCount:       4,
+		LeaseDuration:    time.Minute,
+		InstanceId:       "instance-1",
+		LeaseCoreService: server.URL,
+	})
+}
+
+// recordInShard returns a bucket notification for an object that is assigned to the shard
+func recordInShard(sl *ShardLeases, shard int) *message.BucketNotificationRecord {
+	for i := 0; ; i++ {
+		record := &message.BucketNotificationRecord{Endpoint: "http://minio:9000"}
+		record.S3.Bucket.Name = "bucket"
+		record.S3.Object.Key = fmt.Sprintf("dataset/object-%d", i)
+		if sl.shard(record) == shard {
+			return record
+		}
+	}
+}
+
+func TestShardLeasesOwnsDisabled(t *testing.T) {
+	sl := NewShardLeases(config.Sharding{})
+
+	// every message is processed by the only instance
+	record := &message.BucketNotificationRecord{}
+	if !sl.Owns(record) {
+		t.Error("expected every message to be owned when sharding is disabled")
+	}
+	release, owned := sl.Claim(record)
+	if !owned || release != nil {
+		t.Error("expected messages to be claimed without tracking when sharding is disabled")
+	}
+}
+
+func TestShardLeasesOwns(t *testing.T) {
+	core := &fakeLeaseCore{shards: []int{0, 1}, releasing: []int{2}}
+	sl := newTestLeases(t, core)
+
+	// no shards are owned until the leases are acquired
+	if sl.Owns(recordInShard(sl, 0)) {
+		t.Error("expected no shards to be owned before acquiring the leases")
+	}
+
+	if err := sl.Acquire(fakeTokens{}); err != nil {
+		t.Fatalf("failed to acquire leases: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		msg   config.Message
+		owned bool
+	}{
+		{"owned shard", recordInShard(sl, 0), true},
+		{"second owned shard", recordInShard(sl, 1), true},
+		{"releasing shard", recordInShard(sl, 2), false},
+		{"another instance's shard", recordInShard(sl, 3), false},
+		{"any instance", &message.ApiSyncNotification{EventType: "create-namespace"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sl.Owns(tt.msg) != tt.owned {
+				t.Errorf("expected owned to be %t", tt.owned)
+			}
+			if _, owned := sl.Claim(tt.msg); owned != tt.owned {
+				t.Errorf("expected claimed to be %t", tt.owned)
+			}
+		})
+	}
+
+	// the leases expire if they aren't renewed in time
+	sl.mu.Lock()
+	sl.validUntil = time.Now().Add(-time.Second)
+	sl.mu.Unlock()
+	if sl.Owns(recordInShard(sl, 0)) {
+		t.Error("expected no shards to be owned after the leases expired")
+	}
+}
+
+func TestShardLeasesObjectShards(t *testing.T) {
+	sl := NewShardLeases(config.Sharding{ShardCount: 16})
+
+	// the objects of a bucket are spread across the shards, and each object is always in the same shard
+	shards := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		record := &message.BucketNotificationRecord{Endpoint: "http://minio:9000"}
+		record.S3.Bucket.Name = "bucket"
+		record.S3.Object.Key = fmt.Sprintf("dataset/object-%d", i)
+		shards[sl.shard(record)] = true
+
+		if sl.shard(record) != sl.shard(record) {
+			t.Fatal("expected an object to always be assigned to the same shard")
+		}
+	}
+	if len(shards) < 2 {
+		t.Errorf("expected the objects of a bucket to be spread across shards, got %d", len(shards))
+	}
+}
+
+func TestShardLeasesRelease(t *testing.T) {
+	core := &fakeLeaseCore{shards: []int{0, 1}}
+	sl := newTestLeases(t, core)
+	if err := sl.Acquire(fakeTokens{}); err != nil {
+		t.Fatalf("failed to acquire leases: %v", err)
+	}
+
+	record := recordInShard(sl, 1)
+	release, owned := sl.Claim(record)
+	if !owned {
+		t.Fatal("expected the message to be claimed")
+	}
+
+	// shard 1 is rebalanced, so no new messages are taken for it
+	core.mu.Lock()
+	core.shards = []int{0}
+	core.releasing = []int{1}
+	core.mu.Unlock()
+	if err := sl.Acquire(fakeTokens{}); err != nil {
+		t.Fatalf("failed to renew leases: %v", err)
+	}
+	if _, owned := sl.Claim(recordInShard(sl, 1)); owned {
+		t.Error("expected no new messages to be claimed for a releasing shard")
+	}
+
+	// the lease isn't given up while a message is in flight
+	if err := sl.Acquire(fakeTokens{}); err != nil {
+		t.Fatalf("failed to renew leases: %v", err)
+	}
+	core.mu.Lock()
+	test := fmt.Sprint(core.released)
+	core.mu.Unlock()
+	if test != "[[] [] []]" {
+		t.Errorf("expected no shards to be released while a message is in flight, got %s", test)
+	}
+
+	// once the message is done the monitor is signaled to give up the lease
+	release()
+	release()
+	select {
+	case <-sl.drained:
+	default:
+		t.Fatal("expected the monitor to be signaled when the shard is drained")
+	}
+	if err := sl.Acquire(fakeTokens{}); err != nil {
+		t.Fatalf("failed to renew leases: %v", err)
+	}
+	core.mu.Lock()
+	defer core.mu.Unlock()
+	if released := fmt.Sprint(core.released[len(core.released)-1]); released != "[1]" {
+		t.Errorf("expected shard 1 to be released, got %s", released)
+	}
+}
+
+func TestClaimMessages(t *testing.T) {
+	released := 0
+	first := &message.BucketNotificationRecord{}
+	second := &message.BucketNotificationRecord{}
+	msgs := config.ClaimMessages([]config.Message{first, second}, func() { released++ })
+
+	// the claim is released once every message of the notification is executed or dropped
+	config.ReleaseMessage(msgs[0])
+	config.ReleaseMessage(msgs[0])
+	if released != 0 {
+		t.Fatal("expected the claim to be held until every message is done")
+	}
+	config.ReleaseMessage(msgs[1])
+	if released != 1 {
+		t.Fatalf("expected the claim to be released once, got %d", released)
+	}
+
+	// messages that weren't claimed are not wrapped
+	unclaimed := config.ClaimMessages([]config.Message{first}, nil)
+	if unclaimed[0] != first {
+		t.Error("expected messages without a claim to be returned as is")
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/gigantum/hoss-sync/pkg/config"
+	"github.com/gigantum/hoss-sync/pkg/message"
 
 	service "github.com/gigantum/hoss-service"
 )
@@ -25,18 +28,57 @@ func main() {
 	configuration := config.Load("")
 	CheckForServices(configuration)
 
-	ctx := context.TODO() // TODO create signal handler
+	// Stop receiving messages when the service is asked to stop. The search index updates and downloads that
+	// are still buffered are sent using a separate context, after the workers have finished their messages
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logrus.Infof("Received %s, stopping...", sig)
+		cancel()
+	}()
+	flushCtx, stopFlushing := context.WithCancel(context.Background())
 
 	// Get the service JWT and start the refresh routine
 	tokens := service.GetRenewingServiceJWT(configuration.AuthEndpoint, configuration.RefreshIntervals.AuthToken)
 	go tokens.RefreshRoutine()
 
+	// Periodically log the metrics of the bucket notification processors
+	go message.MonitorProcessorMetrics(ctx, 10*time.Minute)
+
+	// Limit the size of the objects that are read to compute their content hash
+	message.ConfigureContentHash(configuration.ContentHash)
+
+	// Start sending buffered search index updates to the core services in batches
+	metadataIndexerDone := message.StartMetadataIndexer(flushCtx, configuration.MetadataIndex)
+
+	// Start sending buffered object downloads to the core services, for datasets with access logging enabled
+	accessLoggerDone := message.StartAccessLogger(flushCtx, configuration.AccessLog)
+
 	// Start the UpdateMuxer for monitoring SyncConfiguration changes
 	populatedConfigs := &PopulatedCoreServiceConfigurations{}
 	go populatedConfigs.UpdateMuxer(ctx, configuration, tokens)
 
-	// Start monitoring for bucket events
-	Demuxer(ctx, configuration, tokens, populatedConfigs)
+	// Acquire the shard leases before receiving any messages, so that this instance only processes
+	// the messages that belong to its shards when running multiple Sync Service instances
+	leases := NewShardLeases(configuration.Sharding)
+	if leases.Enabled() {
+		if err := leases.Acquire(tokens); err != nil {
+			logrus.Fatalf("Could not acquire shard leases: %s", err.Error())
+		}
+		go leases.Monitor(ctx, tokens)
+	}
+
+	// Start monitoring for bucket events, until the service is stopped
+	Demuxer(ctx, configuration, tokens, populatedConfigs, leases)
+
+	// Wait for the messages being processed to finish, then send the buffered updates before exiting
+	populatedConfigs.WaitForWorkers()
+	stopFlushing()
+	<-metadataIndexerDone
+	<-accessLoggerDone
+	logrus.Info("Stopped")
 }
 
 // CheckForServices verifies that the dependent services have started and are accepting connections
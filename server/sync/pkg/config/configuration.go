@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"time"
 
 	"github.com/ghodss/yaml"
@@ -47,6 +49,41 @@ func Load(path string) *Configuration {
 		log.Fatal("worker_instance_count: At least one worker per monitored Core Service must be defined")
 	}
 
+	if config.Sharding.ShardCount > 0 {
+		if config.Sharding.LeaseDurationString == "" {
+			config.Sharding.LeaseDurationString = "30s"
+		}
+		config.Sharding.LeaseDuration, err = time.ParseDuration(config.Sharding.LeaseDurationString)
+		if err != nil {
+			log.Fatalf("could not parse sharding lease_duration: %s", err.Error())
+		}
+		if config.Sharding.LeaseDuration < 3*time.Second {
+			log.Fatal("sharding.lease_duration: The lease duration must be at least 3s")
+		}
+
+		if config.Sharding.InstanceId == "" {
+			config.Sharding.InstanceId, err = os.Hostname()
+			if err != nil {
+				log.Fatalf("could not get hostname for sharding instance_id: %s", err.Error())
+			}
+		}
+
+		if config.Sharding.LeaseCoreService == "" {
+			config.Sharding.LeaseCoreService = config.CoreServices[0]
+		}
+	}
+
+	if err := config.MetadataIndex.setDefaults("metadata_index"); err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := config.AccessLog.setDefaults("access_log"); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if config.ContentHash.MaxSizeBytes == 0 {
+		config.ContentHash.MaxSizeBytes = DefaultContentHashMaxSize
+	}
+
 	return config
 }
 
@@ -71,6 +108,88 @@ type Configuration struct {
 
 	WorkerBufferSize    int `json:"worker_buffer_size"`
 	WorkerInstanceCount int `json:"worker_instance_count"` // per core service
+
+	Sharding Sharding `json:"sharding"`
+
+	MetadataIndex MetadataIndex `json:"metadata_index"`
+
+	AccessLog AccessLog `json:"access_log"`
+
+	ContentHash ContentHash `json:"content_hash"`
+}
+
+// DefaultContentHashMaxSize is the default ContentHash.MaxSizeBytes (1 GiB)
+const DefaultContentHashMaxSize = 1024 * 1024 * 1024
+
+// ContentHash defines which created objects are read to compute their content hash
+type ContentHash struct {
+	// MaxSizeBytes is the size of the largest object that is hashed, defaults to 1 GiB. Set to -1 to disable hashing
+	MaxSizeBytes int64 `json:"max_size_bytes"`
+}
+
+// Batching defines how updates are buffered before they are sent to the Core Service in batches
+type Batching struct {
+	// BatchSize is the number of buffered updates that triggers a flush, defaults to 500
+	BatchSize int `json:"batch_size"`
+	// FlushInterval is the longest an update is buffered before it is sent, defaults to 1s
+	FlushIntervalString string        `json:"flush_interval"`
+	FlushInterval       time.Duration `json:"-"`
+	// MaxAttempts is the number of times an update is sent before it is dropped, defaults to 5
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// setDefaults sets the defaults of unset batching settings, returning an error if a setting is invalid. name is
+// the key of the settings in the config file
+func (b *Batching) setDefaults(name string) error {
+	var err error
+	if b.BatchSize == 0 {
+		b.BatchSize = 500
+	}
+	if b.BatchSize < 1 || b.BatchSize > 1000 {
+		return fmt.Errorf("%s.batch_size: The batch size must be between 1 and 1000", name)
+	}
+	if b.FlushIntervalString == "" {
+		b.FlushIntervalString = "1s"
+	}
+	b.FlushInterval, err = time.ParseDuration(b.FlushIntervalString)
+	if err != nil {
+		return fmt.Errorf("could not parse %s flush_interval: %s", name, err.Error())
+	}
+	if b.FlushInterval <= 0 {
+		return fmt.Errorf("%s.flush_interval: The flush interval must be greater than 0", name)
+	}
+	if b.MaxAttempts == 0 {
+		b.MaxAttempts = 5
+	}
+	if b.MaxAttempts < 1 {
+		return fmt.Errorf("%s.max_attempts: The maximum number of attempts must be at least 1", name)
+	}
+
+	return nil
+}
+
+// MetadataIndex defines how search index updates are batched before they are sent to the Core Service
+type MetadataIndex struct {
+	Batching
+}
+
+// AccessLog defines how object downloads are batched before they are sent to the Core Service
+type AccessLog struct {
+	Batching
+}
+
+// Sharding defines how the sync workload is divided between multiple Sync Service instances
+// If ShardCount is 0 sharding is disabled and this instance processes every message it receives
+type Sharding struct {
+	// ShardCount is the number of shards the workload is divided into, must be the same for all instances
+	ShardCount int `json:"shard_count"`
+	// InstanceId uniquely identifies this instance, defaults to the hostname
+	InstanceId string `json:"instance_id"`
+	// LeaseDuration is how long shard leases are valid without being renewed, defaults to 30s
+	LeaseDurationString string        `json:"lease_duration"`
+	LeaseDuration       time.Duration `json:"-"`
+	// LeaseCoreService is the Core Service that stores the shard leases, defaults to the first Core Service
+	LeaseCoreService string `json:"lease_core_service"`
 }
 
 // RefreshIntervals defines the refresh intervals for various credentials needed by the sync service
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchingSetDefaults(t *testing.T) {
+	batching := Batching{}
+	if err := batching.setDefaults("metadata_index"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if batching.BatchSize != 500 || batching.FlushInterval != time.Second || batching.MaxAttempts != 5 {
+		t.Errorf("unexpected defaults: %+v", batching)
+	}
+
+	batching = Batching{BatchSize: 1000, FlushIntervalString: "250ms", MaxAttempts: 1}
+	if err := batching.setDefaults("metadata_index"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if batching.BatchSize != 1000 || batching.FlushInterval != 250*time.Millisecond || batching.MaxAttempts != 1 {
+		t.Errorf("unexpected settings: %+v", batching)
+	}
+}
+
+func TestBatchingSetDefaultsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		batching Batching
+		want     string
+	}{
+		{"negative batch size", Batching{BatchSize: -1}, "access_log.batch_size: The batch size must be between 1 and 1000"},
+		{"batch size too large", Batching{BatchSize: 1001}, "access_log.batch_size: The batch size must be between 1 and 1000"},
+		{"invalid flush interval", Batching{FlushIntervalString: "soon"}, `could not parse access_log flush_interval: time: invalid duration "soon"`},
+		{"zero flush interval", Batching{FlushIntervalString: "0s"}, "access_log.flush_interval: The flush interval must be greater than 0"},
+		{"negative flush interval", Batching{FlushIntervalString: "-1s"}, "access_log.flush_interval: The flush interval must be greater than 0"},
+		{"negative max attempts", Batching{MaxAttempts: -1}, "access_log.max_attempts: The maximum number of attempts must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.batching.setDefaults("access_log")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("unexpected error: %s", err.Error())
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "sync"
+
 // NOTE: This interface is in the config package due to a circular dependency if it is in the message package
 
 // Message provides the generic interface to the different notification messages that the Sync Service can handle
@@ -18,6 +20,78 @@ type Message interface {
 	// resulted in a true response.
 	Execute(populatedConfig *PopulatedCoreServiceConfiguration)
 
+	// ShardKey returns the key used to assign the message to a shard of the sync workload, so that
+	// related messages are processed by the same Sync Service instance
+	// Note: An empty key means the message can be processed by any instance
+	ShardKey() string
+
 	// String provides a string representation of the message, used for log messages
 	String() string
 }
+
+// ShardOwner determines if this Sync Service instance is responsible for processing a message
+type ShardOwner interface {
+	// Claim returns false if the message's shard is not currently leased by this instance. Otherwise the message
+	// is counted as in flight until release is called, so the lease on its shard is not given up while the
+	// message is processed. release is nil if in flight messages are not tracked
+	Claim(msg Message) (release func(), owned bool)
+}
+
+// ClaimedMessage is a message that was claimed from a ShardOwner. The claim is released once the message has been
+// executed, or when Release is called if the message is dropped without being executed
+type ClaimedMessage struct {
+	Message
+
+	release func()
+}
+
+// ClaimMessages wraps the messages decoded from a single claimed notification, so that the claim is released once
+// all of them have been executed or dropped
+func ClaimMessages(msgs []Message, release func()) []Message {
+	if release == nil {
+		return msgs
+	}
+	if len(msgs) == 0 {
+		release()
+		return msgs
+	}
+
+	var mu sync.Mutex
+	remaining := len(msgs)
+	claimed := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		var once sync.Once
+		claimed[i] = &ClaimedMessage{
+			Message: msg,
+			release: func() {
+				once.Do(func() {
+					mu.Lock()
+					defer mu.Unlock()
+					remaining--
+					if remaining == 0 {
+						release()
+					}
+				})
+			},
+		}
+	}
+	return claimed
+}
+
+// Execute executes the message, then releases its claim
+func (m *ClaimedMessage) Execute(populatedConfig *PopulatedCoreServiceConfiguration) {
+	defer m.Release()
+	m.Message.Execute(populatedConfig)
+}
+
+// Release releases the claim on the message without executing it
+func (m *ClaimedMessage) Release() {
+	m.release()
+}
+
+// ReleaseMessage releases the claim on a message that is dropped without being executed, if it was claimed
+func ReleaseMessage(msg Message) {
+	if claimed, ok := msg.(*ClaimedMessage); ok {
+		claimed.Release()
+	}
+}
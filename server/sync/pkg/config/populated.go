@@ -24,6 +24,9 @@ type SyncKey struct {
 type SyncTarget struct {
 	SyncType string
 
+	// CascadeDelete indicates if dataset deletes in the source should be applied to the target
+	CascadeDelete bool
+
 	Target *PopulatedNamespaceConfiguration
 }
 
@@ -21,6 +21,8 @@ type SyncConfiguration struct {
 
 	TargetCoreService string `json:"target_core_service"`
 	TargetNamespace   string `json:"target_namespace"`
+
+	CascadeDelete bool `json:"cascade_delete"`
 }
 
 // Hash is a unique string for a SyncConfiguration and can be used as a key or way to compare SyncConfigurations
@@ -35,6 +37,7 @@ func (sc *SyncConfiguration) Hash() string {
 	}
 	h.Write([]byte(sc.TargetCoreService))
 	h.Write([]byte(sc.TargetNamespace))
+	h.Write([]byte(fmt.Sprintf("%t", sc.CascadeDelete)))
 	hash := fmt.Sprintf("%x", h.Sum(nil))
 	return hash
 }
@@ -6,43 +6,17 @@ import (
 	"net/http/httputil"
 	"strings"
 
+	"github.com/gigantum/hoss-service/search"
 	"github.com/sirupsen/logrus"
 
 	errors "github.com/gigantum/hoss-error"
 )
 
-const metadataIndexMappings = `
-{
-   "mappings":{
-      "properties":{
-         "core_service_endpoint": {"type": "keyword"},
-		 "dataset_extended": {"type": "keyword"},
-		 "object_key": {"type": "keyword"},
-         "last_modified_date": {"type": "date"},
-         "size_bytes": {"type": "double"},
-		 "metadata": {
-			 "type": "keyword", 
-			 "normalizer": "lowercase",
-			"fields": {
-				"autocomplete": {
-					"type": "completion",
-					"contexts": [
-						{
-							"name": "dataset",
-							"type": "category",
-							"path": "dataset_extended"
-						}
-					]
-				}
-			}
-		}
-      }
-   }
- }
-`
-
+// CreateMetadataSearchIndex creates the current version of the metadata search index with the shared mappings, and
+// points the metadata index alias at it. Migrating existing indexes to a new version is done by the core service
 func CreateMetadataSearchIndex(esService string) error {
-	req, err := http.NewRequest("PUT", esService+"/metadata-index", bytes.NewBuffer([]byte(metadataIndexMappings)))
+	indexName := search.MetadataIndexName(search.MetadataIndexVersion)
+	req, err := http.NewRequest("PUT", esService+"/"+indexName, bytes.NewBuffer([]byte(search.MetadataIndexMappings)))
 	if err != nil {
 		return errors.New("could not create metadata index request: " + err.Error())
 	}
@@ -55,10 +29,6 @@ func CreateMetadataSearchIndex(esService string) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 304 {
-		return nil
-	}
-
 	if resp.StatusCode != 200 {
 		d, err := httputil.DumpResponse(resp, true)
 		if err != nil {
@@ -74,5 +44,26 @@ func CreateMetadataSearchIndex(esService string) error {
 		return errors.New("problem with metadata index response: StatusCode != 200")
 	}
 
+	aliasReq, err := http.NewRequest("PUT", esService+"/"+indexName+"/_alias/"+search.MetadataIndexAlias, nil)
+	if err != nil {
+		return errors.New("could not create metadata index alias request: " + err.Error())
+	}
+
+	aliasResp, err := client.Do(aliasReq)
+	if err != nil {
+		return errors.New("could not make metadata index alias request: " + err.Error())
+	}
+	defer aliasResp.Body.Close()
+
+	if aliasResp.StatusCode != 200 {
+		d, err := httputil.DumpResponse(aliasResp, true)
+		if err != nil {
+			return errors.New("problem with metadata index alias response: " + err.Error())
+		}
+
+		logrus.Error(string(d))
+		return errors.New("problem with metadata index alias response: StatusCode != 200")
+	}
+
 	return nil
 }
@@ -0,0 +1,54 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// delimitedExtractor reads the column names from the header row of CSV and TSV files
+type delimitedExtractor struct{}
+
+func (e *delimitedExtractor) Name() string {
+	return "delimited"
+}
+
+func (e *delimitedExtractor) Applies(obj *Object) bool {
+	return obj.MimeType == "text/csv" || obj.MimeType == "text/tab-separated-values"
+}
+
+func (e *delimitedExtractor) Extract(obj *Object) (map[string]string, error) {
+	metadata := map[string]string{"format": "csv"}
+	comma := ','
+	if obj.MimeType == "text/tab-separated-values" {
+		metadata["format"] = "tsv"
+		comma = '\t'
+	}
+
+	line := bytes.TrimPrefix(obj.Header, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	} else if int64(len(obj.Header)) < obj.Size {
+		return metadata, errors.New("header row is longer than the bytes read")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(line))
+	reader.Comma = comma
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	columns, err := reader.Read()
+	if err != nil {
+		return metadata, err
+	}
+
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+
+	metadata["column_count"] = strconv.Itoa(len(columns))
+	metadata["columns"] = strings.Join(columns, ",")
+
+	return metadata, nil
+}
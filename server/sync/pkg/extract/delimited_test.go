@@ -0,0 +1,70 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDelimitedExtractor(t *testing.T) {
+	csv := func(columns string, count string) map[string]string {
+		return map[string]string{
+			"mime_type":    "text/csv",
+			"extension":    "csv",
+			"format":       "csv",
+			"columns":      columns,
+			"column_count": count,
+		}
+	}
+
+	runExtractTests(t, []extractTest{
+		{
+			name: "csv",
+			key:  "data.csv",
+			data: "id, name ,value\n1,a,2\n",
+			want: csv("id,name,value", "3"),
+		},
+		{
+			name: "tsv",
+			key:  "data.tsv",
+			data: "id\tname\tvalue\r\n1\ta\t2\r\n",
+			want: map[string]string{
+				"mime_type":    "text/tab-separated-values",
+				"extension":    "tsv",
+				"format":       "tsv",
+				"columns":      "id,name,value",
+				"column_count": "3",
+			},
+		},
+		{
+			name: "byte order mark",
+			key:  "data.csv",
+			data: "\xef\xbb\xbfid,name\n1,a\n",
+			want: csv("id,name", "2"),
+		},
+		{
+			name: "quoted columns",
+			key:  "data.csv",
+			data: "\"last, first\",\"age\"\n",
+			want: csv("last, first,age", "2"),
+		},
+		{
+			name: "header row only",
+			key:  "data.csv",
+			data: "id,name",
+			want: csv("id,name", "2"),
+		},
+		{
+			name: "unterminated quote",
+			key:  "data.csv",
+			data: "id,\"name\n1,a\n",
+			want: csv("id,name", "2"),
+		},
+		{
+			name:    "header row longer than the bytes read",
+			key:     "data.csv",
+			data:    strings.Repeat("a,", HeaderSize),
+			want:    map[string]string{"mime_type": "text/csv", "extension": "csv", "format": "csv"},
+			wantErr: "header row is longer than the bytes read",
+		},
+	})
+}
@@ -0,0 +1,194 @@
+package extract
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// MetadataPrefix is the reserved metadata namespace that technical metadata is indexed under.
+// User metadata can't use this prefix, as ':' is not a valid character in an object metadata key
+const MetadataPrefix = "hoss:"
+
+// HeaderSize is the number of bytes read from the start of an object to detect its type
+const HeaderSize = 64 * 1024
+
+// maxValueLength is the maximum length of an extracted metadata value
+const maxValueLength = 256
+
+// Object is the information about an object that is given to each Extractor
+type Object struct {
+	// Key is the object key
+	Key string
+	// Extension is the lowercase file extension, without the leading '.'
+	Extension string
+	// MimeType is the MIME type detected from the object's magic bytes or extension
+	MimeType string
+	// Size is the size of the object in bytes
+	Size int64
+	// Header is the first HeaderSize bytes of the object (or the entire object if smaller)
+	Header []byte
+	// Reader provides random access to the object, reads within the Header don't access the object store
+	Reader io.ReaderAt
+}
+
+// Extractor reads technical metadata from the content of a specific type of file
+type Extractor interface {
+	// Name identifies the extractor in log messages
+	Name() string
+
+	// Applies returns true if the extractor can read the object
+	Applies(obj *Object) bool
+
+	// Extract returns the metadata fields read from the object. Keys should not include the MetadataPrefix
+	Extract(obj *Object) (map[string]string, error)
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   []Extractor
+)
+
+func init() {
+	Register(&tiffExtractor{})
+	Register(&hdf5Extractor{})
+	Register(&delimitedExtractor{})
+}
+
+// Register adds an extractor that is run for every created object
+func Register(extractor Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	extractors = append(extractors, extractor)
+}
+
+// ExtractorError is returned by Extract when one or more extractors failed. The metadata
+// returned with the error contains everything that could be extracted
+type ExtractorError struct {
+	Errors map[string]error
+}
+
+func (e *ExtractorError) Error() string {
+	msgs := []string{}
+	for name, err := range e.Errors {
+		msgs = append(msgs, name+": "+err.Error())
+	}
+	return "extractor(s) failed: " + strings.Join(msgs, "; ")
+}
+
+// Extract detects the type of the object and runs all of the applicable extractors. The returned
+// metadata always contains the MIME type, and the file extension if the key has one
+func Extract(key string, size int64, r io.ReaderAt) (map[string]string, error) {
+	headerLen := int64(HeaderSize)
+	if size < headerLen {
+		headerLen = size
+	}
+
+	header := make([]byte, headerLen)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && !(err == io.EOF && int64(n) == headerLen) {
+		return nil, err
+	}
+
+	obj := &Object{
+		Key:       key,
+		Extension: strings.ToLower(strings.TrimPrefix(path.Ext(key), ".")),
+		Size:      size,
+		Header:    header,
+		Reader:    &headerReaderAt{header: header, r: r},
+	}
+	obj.MimeType = DetectMimeType(obj.Header, obj.Extension)
+
+	metadata := map[string]string{
+		"mime_type": obj.MimeType,
+	}
+	if obj.Extension != "" {
+		metadata["extension"] = obj.Extension
+	}
+
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	failed := map[string]error{}
+	for _, extractor := range extractors {
+		if !extractor.Applies(obj) {
+			continue
+		}
+
+		fields, err := extractor.Extract(obj)
+		for k, v := range fields {
+			metadata[k] = truncate(v)
+		}
+		if err != nil {
+			failed[extractor.Name()] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return metadata, &ExtractorError{Errors: failed}
+	}
+	return metadata, nil
+}
+
+// DetectMimeType returns the MIME type of an object based on its magic bytes, falling back to the file extension
+func DetectMimeType(header []byte, extension string) string {
+	if isTIFF(header) {
+		return "image/tiff"
+	}
+	if findHDF5Superblock(header) >= 0 {
+		return "application/x-hdf5"
+	}
+
+	mimeType := strings.Split(http.DetectContentType(header), ";")[0]
+	if mimeType == "text/plain" || mimeType == "application/octet-stream" {
+		// Text formats don't have magic bytes, so they are identified by their extension
+		switch extension {
+		case "csv":
+			return "text/csv"
+		case "tsv":
+			return "text/tab-separated-values"
+		}
+
+		if byExtension := mime.TypeByExtension("." + extension); extension != "" && byExtension != "" {
+			return strings.Split(byExtension, ";")[0]
+		}
+	}
+
+	return mimeType
+}
+
+// headerReaderAt serves reads from the cached header, only reading from the object store when needed
+type headerReaderAt struct {
+	header []byte
+	r      io.ReaderAt
+}
+
+func (h *headerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= 0 && off+int64(len(p)) <= int64(len(h.header)) {
+		return copy(p, h.header[off:]), nil
+	}
+	return h.r.ReadAt(p, off)
+}
+
+// readAt reads exactly n bytes at the given offset, or fewer if the end of the object is reached
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, off)
+	if err != nil && !(err == io.EOF && read > 0) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+func truncate(value string) string {
+	value = string(bytes.ToValidUTF8([]byte(value), []byte("")))
+	if len(value) > maxValueLength {
+		return value[:maxValueLength]
+	}
+	return value
+}
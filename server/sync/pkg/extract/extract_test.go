@@ -0,0 +1,143 @@
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// extractTest is a test case for Extract, modify (if set) is applied to a copy of the fixture before extracting
+type extractTest struct {
+	name    string
+	key     string
+	fixture string
+	data    string
+	modify  func(data []byte) []byte
+	want    map[string]string
+	wantErr string
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture %s: %v", name, err)
+	}
+	return data
+}
+
+func runExtractTests(t *testing.T, tests []extractTest) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.fixture != "" {
+				data = readFixture(t, tt.fixture)
+			}
+			if tt.modify != nil {
+				data = tt.modify(data)
+			}
+
+			metadata, err := Extract(tt.key, int64(len(data)), bytes.NewReader(data))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q", tt.wantErr)
+				}
+				if _, ok := err.(*ExtractorError); !ok {
+					t.Fatalf("expected an ExtractorError, got %T: %v", err, err)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %q", tt.wantErr, err.Error())
+				}
+			}
+
+			if !reflect.DeepEqual(metadata, tt.want) {
+				t.Fatalf("unexpected metadata\nexpected: %v\nactual:   %v", tt.want, metadata)
+			}
+		})
+	}
+}
+
+func TestDetectMimeType(t *testing.T) {
+	userBlock := make([]byte, 1024)
+	copy(userBlock[512:], hdf5Signature)
+
+	tests := []struct {
+		name      string
+		header    []byte
+		extension string
+		want      string
+	}{
+		{"tiff little endian", []byte("II*\x00\x08\x00\x00\x00"), "", "image/tiff"},
+		{"tiff big endian", []byte("MM\x00*\x00\x00\x00\x08"), "dat", "image/tiff"},
+		{"bigtiff", []byte("II+\x00\x08\x00\x00\x00"), "btf", "image/tiff"},
+		{"hdf5", hdf5Signature, "", "application/x-hdf5"},
+		{"hdf5 after user block", userBlock, "nwb", "application/x-hdf5"},
+		{"png ignores extension", []byte("\x89PNG\r\n\x1a\n"), "csv", "image/png"},
+		{"csv by extension", []byte("a,b,c\n"), "csv", "text/csv"},
+		{"tsv by extension", []byte("a\tb\tc\n"), "tsv", "text/tab-separated-values"},
+		{"json by extension", []byte(`{"a": 1}`), "json", "application/json"},
+		{"unknown text", []byte("hello"), "", "text/plain"},
+		{"unknown binary", []byte{0x00, 0x01, 0x02, 0x03}, "", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := DetectMimeType(tt.header, tt.extension); actual != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, actual)
+			}
+		})
+	}
+}
+
+func TestExtractObject(t *testing.T) {
+	long := strings.Repeat("x", maxValueLength+10)
+
+	runExtractTests(t, []extractTest{
+		{
+			name: "extension is lowercase",
+			key:  "dir/README.TXT",
+			data: "hello",
+			want: map[string]string{"mime_type": "text/plain", "extension": "txt"},
+		},
+		{
+			name: "no extension",
+			key:  "dir/file",
+			data: "hello",
+			want: map[string]string{"mime_type": "text/plain"},
+		},
+		{
+			name: "values are truncated",
+			key:  "long.csv",
+			data: long + "\n",
+			want: map[string]string{
+				"mime_type":    "text/csv",
+				"extension":    "csv",
+				"format":       "csv",
+				"column_count": "1",
+				"columns":      long[:maxValueLength],
+			},
+		},
+	})
+}
+
+type failingReader struct{}
+
+func (r *failingReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestExtractReadError(t *testing.T) {
+	metadata, err := Extract("file.tif", 100, &failingReader{})
+	if err == nil || err.Error() != "read failed" {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	if metadata != nil {
+		t.Fatalf("expected no metadata, got %v", metadata)
+	}
+}
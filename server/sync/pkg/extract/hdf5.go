@@ -0,0 +1,531 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The HDF5 reader only implements enough of the file format specification to read the attributes of the
+// root group, which is where NWB (and many other formats built on HDF5) store file level information.
+// See https://docs.hdfgroup.org/hdf5/develop/_f_m_t3.html
+
+var hdf5Signature = []byte{0x89, 'H', 'D', 'F', '\r', '\n', 0x1a, '\n'}
+
+const (
+	// maxHDF5Attributes limits the number of root attributes that are indexed
+	maxHDF5Attributes = 50
+	// maxHDF5Elements limits the number of elements read from an array attribute
+	maxHDF5Elements = 16
+	// maxHDF5BlockSize limits the size of any single structure read from the file
+	maxHDF5BlockSize = 1024 * 1024
+	// maxHDF5HeaderBlocks limits the number of object header continuation blocks followed
+	maxHDF5HeaderBlocks = 64
+
+	hdf5MsgAttribute    = 0x000C
+	hdf5MsgContinuation = 0x0010
+)
+
+// findHDF5Superblock returns the offset of the HDF5 superblock in the header, or -1 if it isn't found.
+// The superblock is at offset 0 or, if the file has a user block, at 512, 1024, 2048, ...
+func findHDF5Superblock(header []byte) int64 {
+	for offset := int64(0); offset+int64(len(hdf5Signature)) <= int64(len(header)); {
+		if bytes.Equal(header[offset:offset+int64(len(hdf5Signature))], hdf5Signature) {
+			return offset
+		}
+
+		if offset == 0 {
+			offset = 512
+		} else {
+			offset *= 2
+		}
+	}
+
+	return -1
+}
+
+// hdf5Extractor reads the attributes of the root group of HDF5 files, including NWB files
+type hdf5Extractor struct{}
+
+func (e *hdf5Extractor) Name() string {
+	return "hdf5"
+}
+
+func (e *hdf5Extractor) Applies(obj *Object) bool {
+	return obj.MimeType == "application/x-hdf5"
+}
+
+func (e *hdf5Extractor) Extract(obj *Object) (map[string]string, error) {
+	metadata := map[string]string{"format": "hdf5"}
+	if obj.Extension == "nwb" {
+		metadata["format"] = "nwb"
+	}
+
+	file, rootAddress, err := openHDF5(obj.Reader, findHDF5Superblock(obj.Header))
+	if err != nil {
+		return metadata, err
+	}
+
+	attributes, err := file.attributes(rootAddress)
+	for name, value := range attributes {
+		metadata["hdf5."+name] = value
+	}
+
+	// NWB files identify themselves with a root attribute
+	if _, ok := attributes["nwb_version"]; ok {
+		metadata["format"] = "nwb"
+	}
+
+	return metadata, err
+}
+
+type hdf5File struct {
+	r io.ReaderAt
+
+	base       int64
+	offsetSize int
+	lengthSize int
+
+	heaps map[uint64][]byte
+}
+
+type hdf5Message struct {
+	msgType uint16
+	data    []byte
+}
+
+type hdf5Block struct {
+	address int64
+	length  uint64
+	version int
+
+	continuation bool
+}
+
+// openHDF5 reads the superblock and returns the file and the object header address of the root group
+func openHDF5(r io.ReaderAt, superblockOffset int64) (*hdf5File, uint64, error) {
+	if superblockOffset < 0 {
+		return nil, 0, errors.New("HDF5 superblock not found")
+	}
+
+	sb, err := readAt(r, superblockOffset, 256)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(sb) < 16 {
+		return nil, 0, errors.New("truncated HDF5 superblock")
+	}
+
+	f := &hdf5File{r: r, heaps: map[uint64][]byte{}}
+	var pos int
+	version := sb[8]
+	switch version {
+	case 0, 1:
+		f.offsetSize, f.lengthSize = int(sb[13]), int(sb[14])
+		pos = 24
+		if version == 1 {
+			pos = 28
+		}
+	case 2, 3:
+		f.offsetSize, f.lengthSize = int(sb[9]), int(sb[10])
+		pos = 12
+	default:
+		return nil, 0, fmt.Errorf("unsupported HDF5 superblock version %d", version)
+	}
+	if !validHDF5Size(f.offsetSize) || !validHDF5Size(f.lengthSize) {
+		return nil, 0, errors.New("invalid HDF5 offset or length size")
+	}
+
+	// The base address is followed by 3 addresses, and then the root group symbol table entry for versions 0 and 1,
+	// which starts with the link name offset and then the object header address. Versions 2 and 3 store the root
+	// group object header address directly after the superblock extension and end of file addresses.
+	o := f.offsetSize
+	if len(sb) < pos+6*o {
+		return nil, 0, errors.New("truncated HDF5 superblock")
+	}
+	base := f.uint(sb[pos:], o)
+	var root uint64
+	if version < 2 {
+		root = f.uint(sb[pos+5*o:], o)
+	} else {
+		root = f.uint(sb[pos+3*o:], o)
+	}
+
+	f.base = int64(base)
+	return f, root, nil
+}
+
+func validHDF5Size(size int) bool {
+	return size == 2 || size == 4 || size == 8
+}
+
+// uint decodes a little endian unsigned integer of the given size
+func (f *hdf5File) uint(b []byte, size int) uint64 {
+	switch size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(b))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b))
+	default:
+		return binary.LittleEndian.Uint64(b)
+	}
+}
+
+func (f *hdf5File) read(address uint64, length uint64) ([]byte, error) {
+	if length > maxHDF5BlockSize {
+		return nil, errors.New("HDF5 structure is too large to read")
+	}
+	return readAt(f.r, f.base+int64(address), int(length))
+}
+
+// attributes returns the compact attributes stored in the object header at the given address.
+// Attributes stored densely (in a fractal heap, used by objects with many attributes) are not read.
+func (f *hdf5File) attributes(address uint64) (map[string]string, error) {
+	messages, err := f.objectHeaderMessages(address)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{}
+	for _, msg := range messages {
+		if msg.msgType != hdf5MsgAttribute {
+			continue
+		}
+
+		name, value, err := f.parseAttribute(msg.data)
+		if err != nil || name == "" {
+			continue
+		}
+
+		attributes[name] = value
+		if len(attributes) >= maxHDF5Attributes {
+			break
+		}
+	}
+
+	return attributes, nil
+}
+
+// objectHeaderMessages reads all of the messages in an object header, following continuation blocks
+func (f *hdf5File) objectHeaderMessages(address uint64) ([]hdf5Message, error) {
+	prefix, err := f.read(address, 32)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) < 16 {
+		return nil, errors.New("truncated HDF5 object header")
+	}
+
+	var blocks []hdf5Block
+	var creationOrder bool
+	if bytes.HasPrefix(prefix, []byte("OHDR")) {
+		if prefix[4] != 2 {
+			return nil, fmt.Errorf("unsupported HDF5 object header version %d", prefix[4])
+		}
+
+		flags := prefix[5]
+		pos := 6
+		if flags&0x20 != 0 { // access, modification, change and birth times
+			pos += 16
+		}
+		if flags&0x10 != 0 { // max compact and min dense attribute counts
+			pos += 4
+		}
+		creationOrder = flags&0x04 != 0
+
+		sizeBytes := 1 << (flags & 0x03)
+		if len(prefix) < pos+sizeBytes {
+			return nil, errors.New("truncated HDF5 object header")
+		}
+		chunkSize := f.uint(prefix[pos:], sizeBytes)
+		blocks = append(blocks, hdf5Block{address: int64(address) + int64(pos+sizeBytes), length: chunkSize, version: 2})
+	} else if prefix[0] == 1 {
+		// Version 1 prefix is 12 bytes, padded to 16 so the messages are 8 byte aligned
+		headerSize := uint64(binary.LittleEndian.Uint32(prefix[8:]))
+		blocks = append(blocks, hdf5Block{address: int64(address) + 16, length: headerSize, version: 1})
+	} else {
+		return nil, errors.New("unsupported HDF5 object header")
+	}
+
+	var messages []hdf5Message
+	for i := 0; i < len(blocks) && i < maxHDF5HeaderBlocks; i++ {
+		block := blocks[i]
+		data, err := f.read(uint64(block.address), block.length)
+		if err != nil {
+			return messages, err
+		}
+
+		if block.version == 2 && block.continuation {
+			// Version 2 continuation blocks start with a signature and end with a checksum, which are included
+			// in the block length. The checksum of the first chunk is not included in the chunk size.
+			if !bytes.HasPrefix(data, []byte("OCHK")) || len(data) < 8 {
+				return messages, errors.New("invalid HDF5 object header continuation block")
+			}
+			data = data[4 : len(data)-4]
+		}
+
+		for pos := 0; ; {
+			var msgType uint16
+			var size int
+			if block.version == 1 {
+				if pos+8 > len(data) {
+					break
+				}
+				msgType = binary.LittleEndian.Uint16(data[pos:])
+				size = int(binary.LittleEndian.Uint16(data[pos+2:]))
+				pos += 8
+			} else {
+				headerLen := 4
+				if creationOrder {
+					headerLen += 2
+				}
+				if pos+headerLen > len(data) {
+					break
+				}
+				msgType = uint16(data[pos])
+				size = int(binary.LittleEndian.Uint16(data[pos+1:]))
+				pos += headerLen
+			}
+			if pos+size > len(data) {
+				break
+			}
+
+			body := data[pos : pos+size]
+			pos += size
+
+			if msgType == hdf5MsgContinuation {
+				if len(body) < f.offsetSize+f.lengthSize {
+					continue
+				}
+				blocks = append(blocks, hdf5Block{
+					address: int64(f.uint(body, f.offsetSize)),
+					length:  f.uint(body[f.offsetSize:], f.lengthSize),
+					version: block.version,
+
+					continuation: true,
+				})
+			} else {
+				messages = append(messages, hdf5Message{msgType: msgType, data: body})
+			}
+		}
+	}
+
+	return messages, nil
+}
+
+// parseAttribute decodes an attribute message into the attribute's name and value
+func (f *hdf5File) parseAttribute(msg []byte) (string, string, error) {
+	if len(msg) < 8 {
+		return "", "", errors.New("truncated attribute message")
+	}
+
+	version := msg[0]
+	nameSize := int(binary.LittleEndian.Uint16(msg[2:]))
+	datatypeSize := int(binary.LittleEndian.Uint16(msg[4:]))
+	dataspaceSize := int(binary.LittleEndian.Uint16(msg[6:]))
+
+	pos := 8
+	pad := func(n int) int { return n }
+	switch version {
+	case 1:
+		// Version 1 pads each field to a multiple of 8 bytes
+		pad = func(n int) int { return (n + 7) &^ 7 }
+	case 2:
+	case 3:
+		pos = 9 // name character set encoding
+	default:
+		return "", "", fmt.Errorf("unsupported attribute message version %d", version)
+	}
+
+	if pos+pad(nameSize)+pad(datatypeSize)+pad(dataspaceSize) > len(msg) {
+		return "", "", errors.New("truncated attribute message")
+	}
+
+	name := strings.TrimRight(string(msg[pos:pos+nameSize]), "\x00")
+	pos += pad(nameSize)
+	datatype := msg[pos : pos+datatypeSize]
+	pos += pad(datatypeSize)
+	dataspace := msg[pos : pos+dataspaceSize]
+	pos += pad(dataspaceSize)
+
+	count, err := f.dataspaceCount(dataspace)
+	if err != nil {
+		return name, "", err
+	}
+
+	value, err := f.decodeValue(datatype, msg[pos:], count)
+	return name, value, err
+}
+
+// dataspaceCount returns the number of elements in a dataspace
+func (f *hdf5File) dataspaceCount(dataspace []byte) (uint64, error) {
+	if len(dataspace) < 4 {
+		return 0, errors.New("truncated dataspace")
+	}
+
+	rank := int(dataspace[1])
+	pos := 8
+	switch dataspace[0] {
+	case 1:
+	case 2:
+		pos = 4
+		switch dataspace[3] {
+		case 0: // scalar
+			return 1, nil
+		case 2: // null
+			return 0, nil
+		}
+	default:
+		return 0, fmt.Errorf("unsupported dataspace version %d", dataspace[0])
+	}
+
+	if rank == 0 {
+		return 1, nil
+	}
+	if len(dataspace) < pos+rank*f.lengthSize {
+		return 0, errors.New("truncated dataspace")
+	}
+
+	count := uint64(1)
+	for i := 0; i < rank; i++ {
+		count *= f.uint(dataspace[pos+i*f.lengthSize:], f.lengthSize)
+	}
+	return count, nil
+}
+
+// decodeValue converts attribute data to a string. Arrays are joined with ','
+func (f *hdf5File) decodeValue(datatype []byte, data []byte, count uint64) (string, error) {
+	if len(datatype) < 8 {
+		return "", errors.New("truncated datatype")
+	}
+
+	class := datatype[0] & 0x0F
+	bits := datatype[1]
+	size := int(binary.LittleEndian.Uint32(datatype[4:]))
+
+	if class == 9 {
+		// Variable length strings are stored in the global heap, the data holds a reference to each string
+		if bits&0x0F != 1 {
+			return "", errors.New("unsupported variable length sequence")
+		}
+		size = 4 + f.offsetSize + 4
+	}
+	if size <= 0 {
+		return "", errors.New("invalid datatype size")
+	}
+
+	if count > maxHDF5Elements {
+		count = maxHDF5Elements
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if bits&0x01 != 0 {
+		order = binary.BigEndian
+	}
+
+	values := []string{}
+	for i := 0; i < int(count); i++ {
+		if (i+1)*size > len(data) {
+			break
+		}
+		element := data[i*size : (i+1)*size]
+
+		switch class {
+		case 0: // fixed-point
+			signed := bits&0x08 != 0
+			var u uint64
+			switch size {
+			case 1:
+				u = uint64(element[0])
+			case 2:
+				u = uint64(order.Uint16(element))
+			case 4:
+				u = uint64(order.Uint32(element))
+			case 8:
+				u = order.Uint64(element)
+			default:
+				return "", errors.New("unsupported integer size")
+			}
+
+			if signed {
+				shift := uint(64 - 8*size)
+				values = append(values, strconv.FormatInt(int64(u<<shift)>>shift, 10))
+			} else {
+				values = append(values, strconv.FormatUint(u, 10))
+			}
+		case 1: // floating-point
+			switch size {
+			case 4:
+				values = append(values, strconv.FormatFloat(float64(math.Float32frombits(order.Uint32(element))), 'g', -1, 32))
+			case 8:
+				values = append(values, strconv.FormatFloat(math.Float64frombits(order.Uint64(element)), 'g', -1, 64))
+			default:
+				return "", errors.New("unsupported float size")
+			}
+		case 3: // fixed length string
+			values = append(values, strings.TrimRight(string(element), "\x00 "))
+		case 9: // variable length string
+			length := binary.LittleEndian.Uint32(element)
+			collection := f.uint(element[4:], f.offsetSize)
+			index := binary.LittleEndian.Uint32(element[4+f.offsetSize:])
+
+			s, err := f.globalHeapObject(collection, index)
+			if err != nil {
+				return "", err
+			}
+			if uint64(len(s)) > uint64(length) {
+				s = s[:length]
+			}
+			values = append(values, strings.TrimRight(string(s), "\x00"))
+		default:
+			return "", fmt.Errorf("unsupported datatype class %d", class)
+		}
+	}
+
+	return strings.Join(values, ","), nil
+}
+
+// globalHeapObject returns the data of an object in a global heap collection
+func (f *hdf5File) globalHeapObject(collection uint64, index uint32) ([]byte, error) {
+	heap, ok := f.heaps[collection]
+	if !ok {
+		header, err := f.read(collection, uint64(8+f.lengthSize))
+		if err != nil {
+			return nil, err
+		}
+		if len(header) < 8+f.lengthSize || !bytes.HasPrefix(header, []byte("GCOL")) {
+			return nil, errors.New("invalid global heap collection")
+		}
+
+		heap, err = f.read(collection, f.uint(header[8:], f.lengthSize))
+		if err != nil {
+			return nil, err
+		}
+		f.heaps[collection] = heap
+	}
+
+	// Each object is an index, reference count, reserved bytes and size, followed by the data padded to 8 bytes
+	pos := 8 + f.lengthSize
+	for pos+8+f.lengthSize <= len(heap) {
+		objIndex := binary.LittleEndian.Uint16(heap[pos:])
+		objSize := f.uint(heap[pos+8:], f.lengthSize)
+		dataStart := pos + 8 + f.lengthSize
+		if objIndex == 0 || objSize > uint64(len(heap)-dataStart) { // free space or corrupt
+			break
+		}
+
+		if uint32(objIndex) == index {
+			return heap[dataStart : dataStart+int(objSize)], nil
+		}
+		pos = dataStart + int((objSize+7)&^7)
+	}
+
+	return nil, errors.New("global heap object not found")
+}
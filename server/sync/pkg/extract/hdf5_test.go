@@ -0,0 +1,147 @@
+package extract
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestHDF5Extractor(t *testing.T) {
+	hdf5 := func(extension string, attributes map[string]string) map[string]string {
+		metadata := map[string]string{"mime_type": "application/x-hdf5", "extension": extension, "format": "hdf5"}
+		if extension == "nwb" {
+			metadata["format"] = "nwb"
+		}
+		for k, v := range attributes {
+			metadata[k] = v
+		}
+		return metadata
+	}
+
+	runExtractTests(t, []extractTest{
+		{
+			name:    "root attributes",
+			key:     "session.nwb",
+			fixture: "session.nwb",
+			want: hdf5("nwb", map[string]string{
+				"hdf5.nwb_version": "2.5.0",
+				"hdf5.channels":    "-1,2,3",
+				"hdf5.gain":        "0.5",
+				"hdf5.identifier":  "abc-123",
+			}),
+		},
+		{
+			name:    "nwb detected from attributes",
+			key:     "user_block.h5",
+			fixture: "user_block.h5",
+			want: map[string]string{
+				"mime_type":        "application/x-hdf5",
+				"extension":        "h5",
+				"format":           "nwb",
+				"hdf5.nwb_version": "2.5.0",
+				"hdf5.channels":    "-1,2,3",
+				"hdf5.gain":        "0.5",
+				"hdf5.identifier":  "abc-123",
+			},
+		},
+		{
+			name:    "truncated superblock",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify:  func(data []byte) []byte { return data[:12] },
+			want:    hdf5("h5", nil),
+			wantErr: "truncated HDF5 superblock",
+		},
+		{
+			name:    "truncated superblock addresses",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify:  func(data []byte) []byte { return data[:40] },
+			want:    hdf5("h5", nil),
+			wantErr: "truncated HDF5 superblock",
+		},
+		{
+			name:    "unsupported superblock version",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify: func(data []byte) []byte {
+				data[8] = 7
+				return data
+			},
+			want:    hdf5("h5", nil),
+			wantErr: "unsupported HDF5 superblock version 7",
+		},
+		{
+			name:    "invalid offset size",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify: func(data []byte) []byte {
+				data[9] = 3
+				return data
+			},
+			want:    hdf5("h5", nil),
+			wantErr: "invalid HDF5 offset or length size",
+		},
+		{
+			name:    "truncated object header",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify:  func(data []byte) []byte { return data[:63] },
+			want:    hdf5("h5", nil),
+			wantErr: "truncated HDF5 object header",
+		},
+		{
+			name:    "unsupported object header",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify: func(data []byte) []byte {
+				data[48] = 'X'
+				return data
+			},
+			want:    hdf5("h5", nil),
+			wantErr: "unsupported HDF5 object header",
+		},
+		{
+			name:    "root object header past the end",
+			key:     "session.h5",
+			fixture: "session.nwb",
+			modify: func(data []byte) []byte {
+				binary.LittleEndian.PutUint64(data[36:], 1<<20)
+				return data
+			},
+			want:    hdf5("h5", nil),
+			wantErr: "EOF",
+		},
+		{
+			name:    "truncated messages keep complete attributes",
+			key:     "session.nwb",
+			fixture: "session.nwb",
+			modify:  func(data []byte) []byte { return data[:120] },
+			want:    hdf5("nwb", map[string]string{"hdf5.nwb_version": "2.5.0"}),
+		},
+		{
+			name:    "missing global heap skips variable length strings",
+			key:     "session.nwb",
+			fixture: "session.nwb",
+			modify:  func(data []byte) []byte { return data[:300] },
+			want: hdf5("nwb", map[string]string{
+				"hdf5.nwb_version": "2.5.0",
+				"hdf5.channels":    "-1,2,3",
+				"hdf5.gain":        "0.5",
+			}),
+		},
+		{
+			name:    "corrupt global heap skips variable length strings",
+			key:     "session.nwb",
+			fixture: "session.nwb",
+			modify: func(data []byte) []byte {
+				data[512] = 'X'
+				return data
+			},
+			want: hdf5("nwb", map[string]string{
+				"hdf5.nwb_version": "2.5.0",
+				"hdf5.channels":    "-1,2,3",
+				"hdf5.gain":        "0.5",
+			}),
+		},
+	})
+}
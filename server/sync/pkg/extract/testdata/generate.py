@@ -0,0 +1,106 @@
+#!/usr/bin/env python3
+"""Writes the minimal TIFF and HDF5 files used by the extract package tests.
+
+The files are built by hand, rather than with an imaging or HDF5 library, so they only contain the structures the
+extractors read. Truncated and malformed variants are derived from these files in the tests.
+"""
+import os
+import struct
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+
+
+def write(name, data):
+    with open(os.path.join(HERE, name), "wb") as f:
+        f.write(data)
+
+
+def tiff(order):
+    """640x480 RGB TIFF, bits per sample stored out of line as it doesn't fit in the entry"""
+    e = "<" if order == "II" else ">"
+    magic = b"II*\x00" if order == "II" else b"MM\x00*"
+    entries = [
+        (256, 3, 1, struct.pack(e + "HH", 640, 0)),  # ImageWidth, SHORT
+        (257, 4, 1, struct.pack(e + "I", 480)),  # ImageLength, LONG
+        (258, 3, 3, struct.pack(e + "I", 8 + 2 + 4 * 12 + 4)),  # BitsPerSample, SHORT[3] at offset
+        (277, 3, 1, struct.pack(e + "HH", 3, 0)),  # SamplesPerPixel, SHORT
+    ]
+    data = magic + struct.pack(e + "I", 8)
+    data += struct.pack(e + "H", len(entries))
+    for tag, field_type, count, value in entries:
+        data += struct.pack(e + "HHI", tag, field_type, count) + value
+    data += struct.pack(e + "I", 0)  # next IFD
+    data += struct.pack(e + "HHH", 8, 8, 8)
+    return data
+
+
+def bigtiff():
+    """1024x768 single channel BigTIFF"""
+    entries = [
+        (256, 16, 1, struct.pack("<Q", 1024)),  # ImageWidth, LONG8
+        (257, 4, 1, struct.pack("<Ixxxx", 768)),  # ImageLength, LONG
+        (258, 3, 1, struct.pack("<Hxxxxxx", 16)),  # BitsPerSample, SHORT
+    ]
+    data = b"II+\x00" + struct.pack("<HHQ", 8, 0, 16)
+    data += struct.pack("<Q", len(entries))
+    for tag, field_type, count, value in entries:
+        data += struct.pack("<HHQ", tag, field_type, count) + value
+    data += struct.pack("<Q", 0)  # next IFD
+    return data
+
+
+def hdf5_attribute(name, datatype, dataspace, value):
+    """Version 3 attribute message"""
+    name = name.encode() + b"\x00"
+    body = struct.pack("<BBHHHB", 3, 0, len(name), len(datatype), len(dataspace), 0)
+    return body + name + datatype + dataspace + value
+
+
+def hdf5(user_block=0):
+    """Version 2 superblock and object header, with root group attributes of each supported datatype class"""
+    scalar = struct.pack("<BBBB", 2, 0, 0, 0)
+    heap_address = 512
+
+    # Fixed length string, signed 32-bit integer array, 64-bit float, and variable length string
+    string_type = struct.pack("<BBBBI", 0x13, 0, 0, 0, 5)
+    int_type = struct.pack("<BBBBIHH", 0x10, 0x08, 0, 0, 4, 0, 32)
+    float_type = struct.pack("<BBBBIHHBBBBI", 0x11, 0x20, 63, 0, 8, 0, 64, 52, 11, 0, 52, 1023)
+    vlen_type = struct.pack("<BBBBI", 0x19, 0x01, 0, 0, 16) + struct.pack("<BBBBI", 0x13, 0, 0, 0, 1)
+
+    attributes = [
+        hdf5_attribute("nwb_version", string_type, scalar, b"2.5.0"),
+        hdf5_attribute("channels", int_type, struct.pack("<BBBBQ", 2, 1, 0, 1, 3), struct.pack("<iii", -1, 2, 3)),
+        hdf5_attribute("gain", float_type, scalar, struct.pack("<d", 0.5)),
+        hdf5_attribute("identifier", vlen_type, scalar, struct.pack("<IQI", 7, heap_address, 1)),
+    ]
+
+    messages = b""
+    for attribute in attributes:
+        messages += struct.pack("<BHB", 0x0C, len(attribute), 0) + attribute
+
+    # Flags 0x01 stores the chunk size in 2 bytes, the chunk checksum isn't checked by the extractor
+    header = b"OHDR" + struct.pack("<BBH", 2, 0x01, len(messages)) + messages + b"\x00\x00\x00\x00"
+
+    root_address = 48
+    end = heap_address + 40
+    superblock = b"\x89HDF\r\n\x1a\n" + struct.pack("<BBBB", 2, 8, 8, 0)
+    superblock += struct.pack("<QQQQ", user_block, 0xFFFFFFFFFFFFFFFF, end, root_address) + b"\x00\x00\x00\x00"
+
+    heap = b"GCOL" + struct.pack("<Bxxx", 1) + struct.pack("<Q", 40)
+    heap += struct.pack("<HHxxxxQ", 1, 1, 7) + b"abc-123\x00"
+
+    data = superblock + header
+    data += b"\x00" * (heap_address - len(data)) + heap
+    return b"\x00" * user_block + data
+
+
+def main():
+    write("image.tif", tiff("II"))
+    write("image_be.tif", tiff("MM"))
+    write("image.btf", bigtiff())
+    write("session.nwb", hdf5())
+    write("user_block.h5", hdf5(user_block=512))
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,158 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// maxTIFFEntries limits the number of IFD entries read, to protect against corrupt files
+const maxTIFFEntries = 4096
+
+// tiffTags are the TIFF tags that are extracted, and the metadata key they are indexed as
+var tiffTags = map[uint16]string{
+	256: "image_width",
+	257: "image_height",
+	258: "bits_per_sample",
+	277: "samples_per_pixel",
+}
+
+func isTIFF(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")) || // TIFF
+		bytes.HasPrefix(header, []byte("II+\x00")) || bytes.HasPrefix(header, []byte("MM\x00+")) // BigTIFF
+}
+
+// tiffExtractor reads the image dimensions from the first image file directory (IFD) of a TIFF file
+type tiffExtractor struct{}
+
+func (e *tiffExtractor) Name() string {
+	return "tiff"
+}
+
+func (e *tiffExtractor) Applies(obj *Object) bool {
+	return obj.MimeType == "image/tiff"
+}
+
+func (e *tiffExtractor) Extract(obj *Object) (map[string]string, error) {
+	metadata := map[string]string{"format": "tiff"}
+
+	header, err := readAt(obj.Reader, 0, 16)
+	if err != nil {
+		return metadata, err
+	}
+	if len(header) < 8 {
+		return metadata, errors.New("truncated TIFF header")
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+	bigTIFF := order.Uint16(header[2:]) == 43
+
+	// Regular TIFF uses 4 byte offsets and 12 byte IFD entries, BigTIFF uses 8 byte offsets and 20 byte entries
+	var ifdOffset uint64
+	countSize, entrySize, valueSize := 2, 12, 4
+	if bigTIFF {
+		if len(header) < 16 {
+			return metadata, errors.New("truncated BigTIFF header")
+		}
+		ifdOffset = order.Uint64(header[8:])
+		countSize, entrySize, valueSize = 8, 20, 8
+	} else {
+		ifdOffset = uint64(order.Uint32(header[4:]))
+	}
+
+	countBytes, err := readAt(obj.Reader, int64(ifdOffset), countSize)
+	if err != nil {
+		return metadata, err
+	}
+	if len(countBytes) < countSize {
+		return metadata, errors.New("truncated TIFF image file directory")
+	}
+
+	var count uint64
+	if bigTIFF {
+		count = order.Uint64(countBytes)
+	} else {
+		count = uint64(order.Uint16(countBytes))
+	}
+	if count > maxTIFFEntries {
+		return metadata, errors.New("too many TIFF image file directory entries")
+	}
+
+	entries, err := readAt(obj.Reader, int64(ifdOffset)+int64(countSize), int(count)*entrySize)
+	if err != nil {
+		return metadata, err
+	}
+
+	for i := 0; i+entrySize <= len(entries); i += entrySize {
+		entry := entries[i : i+entrySize]
+		name, ok := tiffTags[order.Uint16(entry)]
+		if !ok {
+			continue
+		}
+
+		fieldType := order.Uint16(entry[2:])
+		var valueCount uint64
+		if bigTIFF {
+			valueCount = order.Uint64(entry[4:])
+		} else {
+			valueCount = uint64(order.Uint32(entry[4:]))
+		}
+		field := entry[entrySize-valueSize:]
+
+		value, err := tiffFirstValue(obj, order, fieldType, valueCount, field, bigTIFF)
+		if err != nil {
+			continue
+		}
+		metadata[name] = strconv.FormatUint(value, 10)
+	}
+
+	return metadata, nil
+}
+
+// tiffFirstValue returns the first value of an integer IFD entry. Values are stored inline in the
+// entry if they fit, otherwise the entry holds the offset of the values
+func tiffFirstValue(obj *Object, order binary.ByteOrder, fieldType uint16, count uint64, field []byte, bigTIFF bool) (uint64, error) {
+	var size int
+	switch fieldType {
+	case 3: // SHORT
+		size = 2
+	case 4: // LONG
+		size = 4
+	case 16: // LONG8 (BigTIFF)
+		size = 8
+	default:
+		return 0, errors.New("unsupported TIFF field type")
+	}
+
+	data := field
+	if count*uint64(size) > uint64(len(field)) {
+		var offset uint64
+		if bigTIFF {
+			offset = order.Uint64(field)
+		} else {
+			offset = uint64(order.Uint32(field))
+		}
+
+		var err error
+		data, err = readAt(obj.Reader, int64(offset), size)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(data) < size {
+		return 0, errors.New("truncated TIFF field")
+	}
+
+	switch size {
+	case 2:
+		return uint64(order.Uint16(data)), nil
+	case 4:
+		return uint64(order.Uint32(data)), nil
+	default:
+		return order.Uint64(data), nil
+	}
+}
@@ -0,0 +1,134 @@
+package extract
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestTIFFExtractor(t *testing.T) {
+	image := map[string]string{
+		"mime_type":         "image/tiff",
+		"extension":         "tif",
+		"format":            "tiff",
+		"image_width":       "640",
+		"image_height":      "480",
+		"bits_per_sample":   "8",
+		"samples_per_pixel": "3",
+	}
+
+	runExtractTests(t, []extractTest{
+		{
+			name:    "little endian",
+			key:     "image.tif",
+			fixture: "image.tif",
+			want:    image,
+		},
+		{
+			name:    "big endian",
+			key:     "image.tif",
+			fixture: "image_be.tif",
+			want:    image,
+		},
+		{
+			name:    "bigtiff",
+			key:     "image.btf",
+			fixture: "image.btf",
+			want: map[string]string{
+				"mime_type":       "image/tiff",
+				"extension":       "btf",
+				"format":          "tiff",
+				"image_width":     "1024",
+				"image_height":    "768",
+				"bits_per_sample": "16",
+			},
+		},
+		{
+			name:    "truncated header",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify:  func(data []byte) []byte { return data[:6] },
+			want:    map[string]string{"mime_type": "image/tiff", "extension": "tif", "format": "tiff"},
+			wantErr: "truncated TIFF header",
+		},
+		{
+			name:    "truncated bigtiff header",
+			key:     "image.btf",
+			fixture: "image.btf",
+			modify:  func(data []byte) []byte { return data[:12] },
+			want:    map[string]string{"mime_type": "image/tiff", "extension": "btf", "format": "tiff"},
+			wantErr: "truncated BigTIFF header",
+		},
+		{
+			name:    "truncated image file directory",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify:  func(data []byte) []byte { return data[:9] },
+			want:    map[string]string{"mime_type": "image/tiff", "extension": "tif", "format": "tiff"},
+			wantErr: "truncated TIFF image file directory",
+		},
+		{
+			name:    "truncated entries keep complete entries",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify:  func(data []byte) []byte { return data[:8+2+12+6] },
+			want:    map[string]string{"mime_type": "image/tiff", "extension": "tif", "format": "tiff", "image_width": "640"},
+		},
+		{
+			name:    "image file directory past the end",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify: func(data []byte) []byte {
+				binary.LittleEndian.PutUint32(data[4:], 4096)
+				return data
+			},
+			want:    map[string]string{"mime_type": "image/tiff", "extension": "tif", "format": "tiff"},
+			wantErr: "EOF",
+		},
+		{
+			name:    "too many entries",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify: func(data []byte) []byte {
+				binary.LittleEndian.PutUint16(data[8:], maxTIFFEntries+1)
+				return data
+			},
+			want:    map[string]string{"mime_type": "image/tiff", "extension": "tif", "format": "tiff"},
+			wantErr: "too many TIFF image file directory entries",
+		},
+		{
+			name:    "value offset past the end is skipped",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify: func(data []byte) []byte {
+				// The third entry is bits per sample, its values are stored at an offset
+				binary.LittleEndian.PutUint32(data[8+2+2*12+8:], 4096)
+				return data
+			},
+			want: map[string]string{
+				"mime_type":         "image/tiff",
+				"extension":         "tif",
+				"format":            "tiff",
+				"image_width":       "640",
+				"image_height":      "480",
+				"samples_per_pixel": "3",
+			},
+		},
+		{
+			name:    "unsupported field type is skipped",
+			key:     "image.tif",
+			fixture: "image.tif",
+			modify: func(data []byte) []byte {
+				binary.LittleEndian.PutUint16(data[8+2+2:], 2) // ASCII
+				return data
+			},
+			want: map[string]string{
+				"mime_type":         "image/tiff",
+				"extension":         "tif",
+				"format":            "tiff",
+				"image_height":      "480",
+				"bits_per_sample":   "8",
+				"samples_per_pixel": "3",
+			},
+		},
+	})
+}
@@ -0,0 +1,222 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// accessLoggingCacheTTL is how long a dataset's access logging state is cached before it is loaded again
+const accessLoggingCacheTTL = time.Minute
+
+type accessLoggingCacheEntry struct {
+	enabled bool
+	loaded  time.Time
+}
+
+// accessLoggingCache caches whether access logging is enabled for each dataset
+var accessLoggingCache = struct {
+	sync.Mutex
+	entries map[string]*accessLoggingCacheEntry
+}{entries: map[string]*accessLoggingCacheEntry{}}
+
+// accessLoggingEnabled returns true if the downloads of a dataset's objects should be recorded
+func accessLoggingEnabled(coreService *config.PopulatedCoreServiceConfiguration, datasetExtended string) (bool, error) {
+	key := coreService.Endpoint + "|" + datasetExtended
+
+	accessLoggingCache.Lock()
+	entry, ok := accessLoggingCache.entries[key]
+	accessLoggingCache.Unlock()
+	if ok && time.Since(entry.loaded) < accessLoggingCacheTTL {
+		return entry.enabled, nil
+	}
+
+	enabled, err := makeAccessLoggingRequest(coreService, datasetExtended)
+	if err != nil {
+		return false, err
+	}
+
+	accessLoggingCache.Lock()
+	accessLoggingCache.entries[key] = &accessLoggingCacheEntry{enabled: enabled, loaded: time.Now()}
+	accessLoggingCache.Unlock()
+
+	return enabled, nil
+}
+
+// makeAccessLoggingRequest is a helper function to load a dataset's access logging state from the core service
+func makeAccessLoggingRequest(coreService *config.PopulatedCoreServiceConfiguration, datasetExtended string) (bool, error) {
+	// Hack to support running on localhost
+	endpoint := strings.Replace(coreService.Endpoint, "localhost/core", "core:8080", 1)
+	path := endpoint + "/access/logging?dataset_extended=" + url.QueryEscape(datasetExtended)
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+
+	token, err := coreService.Tokens.GetIDToken()
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("User-Agent", "exec-env/hoss-sync-service")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, errors.Wrap(err, "could not read access logging response")
+	}
+
+	// access logging isn't enabled for the dataset
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.New(fmt.Sprintf("access logging request to `%s` failed, Status Code %v, Response: %s",
+			path, resp.Status, string(body)))
+	}
+
+	return true, nil
+}
+
+// objectAccess is a download of an object, which is recorded by the core service
+type objectAccess struct {
+	DatasetExtended string `json:"dataset_extended"`
+	ObjectKey       string `json:"object_key"`
+	Principal       string `json:"principal"`
+	Accessed        string `json:"accessed"`
+}
+
+// batchKey is empty, as every download is recorded
+func (oa *objectAccess) batchKey() string {
+	return ""
+}
+
+func (oa *objectAccess) String() string {
+	return fmt.Sprintf("download of %s", oa.ObjectKey)
+}
+
+type objectAccessBulkInput struct {
+	Accesses []*objectAccess `json:"accesses"`
+}
+
+// accessLogger buffers object downloads and sends them to the core services in batches
+type accessLogger struct {
+	queue *batchQueue
+}
+
+var accessLog = &accessLogger{
+	queue: newBatchQueue("object downloads", sendObjectAccesses),
+}
+
+// StartAccessLogger starts sending buffered object downloads to the core services. The buffer is flushed when the
+// context is done, and the returned channel is closed once the flush has finished
+func StartAccessLogger(ctx context.Context, settings config.AccessLog) <-chan struct{} {
+	return accessLog.queue.start(ctx, settings.Batching)
+}
+
+// add buffers an object download
+func (al *accessLogger) add(coreService *config.PopulatedCoreServiceConfiguration, access *objectAccess) {
+	al.queue.push(coreService, access)
+}
+
+// sendObjectAccesses sends a batch of object downloads to a core service
+func sendObjectAccesses(coreService *config.PopulatedCoreServiceConfiguration, items []batchItem) error {
+	accesses := make([]*objectAccess, len(items))
+	for i, item := range items {
+		accesses[i] = item.(*objectAccess)
+	}
+	return makeBulkAccessRequest(coreService, accesses)
+}
+
+// makeBulkAccessRequest is a helper function to send a batch of object downloads to a core service
+func makeBulkAccessRequest(coreService *config.PopulatedCoreServiceConfiguration, accesses []*objectAccess) error {
+	payloadBytes, err := json.Marshal(&objectAccessBulkInput{Accesses: accesses})
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	// Hack to support running on localhost
+	endpoint := strings.Replace(coreService.Endpoint, "localhost/core", "core:8080", 1)
+	path := endpoint + "/access/bulk"
+
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+
+	token, err := coreService.Tokens.GetIDToken()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", "exec-env/hoss-sync-service")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &coreUnavailableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return coreResponseError(resp.StatusCode, errors.New(fmt.Sprintf(
+			"bulk access request to `%s` failed, Status Code %v, Response: %s", path, resp.Status, string(body))))
+	}
+
+	return nil
+}
+
+// accessLogProcessor records the downloads of objects in datasets with access logging enabled. Downloads made by
+// the sync service are not recorded
+type accessLogProcessor struct{}
+
+func (ap *accessLogProcessor) Name() string {
+	return "access"
+}
+
+func (ap *accessLogProcessor) Applies(event *Event) bool {
+	return event.Type() == EventAccessed && !event.FromSyncService
+}
+
+func (ap *accessLogProcessor) Process(event *Event) error {
+	record := event.Record
+	datasetExtended := record.DatasetExtended(event.ObjectStore.Name)
+
+	enabled, err := accessLoggingEnabled(event.ObjectStore.CoreService, datasetExtended)
+	if err != nil {
+		return errors.Wrap(err, "unable to load access logging configuration for "+datasetExtended)
+	}
+	if !enabled {
+		return nil
+	}
+
+	accessLog.add(event.ObjectStore.CoreService, &objectAccess{
+		DatasetExtended: datasetExtended,
+		ObjectKey:       record.FileKey(),
+		Principal:       record.UserIdentity.PrincipalId,
+		Accessed:        record.FileModifiedTime(),
+	})
+	return nil
+}
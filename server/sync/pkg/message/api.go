@@ -30,10 +30,20 @@ type ApiSyncNotification struct {
 	TargetCoreService string `json:"target_core_service"`
 	TargetNamespace   string `json:"target_namespace"`
 	SyncPolicy        string `json:"sync_policy,omitempty"`
+	CascadeDelete     bool   `json:"cascade_delete,omitempty"`
 
 	HasReloaded bool `json:"-"` // Flag used so that RequireReload only returns true once
 }
 
+// ShardKey returns the key used to assign the notification to a shard, which is the source Namespace
+func (asn *ApiSyncNotification) ShardKey() string {
+	if asn.EventType == "create-namespace" {
+		// Only refreshes the local S3 client, so any instance can process it
+		return ""
+	}
+	return asn.SourceEndpoint + "/" + asn.Namespace
+}
+
 func (asn *ApiSyncNotification) String() string {
 	return fmt.Sprintf("<ApiSyncNotification %s %s/%s>", asn.EventType, asn.Namespace, asn.Dataset)
 }
@@ -120,6 +130,11 @@ func (asn *ApiSyncNotification) Execute(populatedConfig *config.PopulatedCoreSer
 			}
 		}
 
+		// Dataset deletes are only applied to targets that have opted into cascading deletes
+		if asn.EventType == "delete-ds" && !target.CascadeDelete {
+			continue
+		}
+
 		wg.Add(1)
 		go func(t *config.SyncTarget) {
 			defer wg.Done()
@@ -220,9 +235,13 @@ func (asn *ApiSyncNotification) handleSync(sourceNamespace,
 		err = asn.makeSyncApiRequest("PUT", path, jsonBytes, targetNamespace)
 	case "put-ns-duplex":
 		// Enable duplex sync in the target namespace
-		var jsonBytes = []byte(fmt.Sprintf(`{"target_core_service":"%s","target_namespace":"%s","sync_type":"%s"}`, asn.SourceEndpoint, asn.Namespace, config.DuplexSyncType))
+		var jsonBytes = []byte(fmt.Sprintf(`{"target_core_service":"%s","target_namespace":"%s","sync_type":"%s","cascade_delete":%t}`, asn.SourceEndpoint, asn.Namespace, config.DuplexSyncType, asn.CascadeDelete))
 		path := fmt.Sprintf("/namespace/%s/sync", asn.TargetNamespace)
 		err = asn.makeSyncApiRequest("PUT", path, jsonBytes, targetNamespace)
+	case "delete-ds":
+		// Schedule the delete of the dataset in the target, which is subject to the target's delete delay
+		path := fmt.Sprintf("/namespace/%s/dataset/%s", targetNamespace.Name, asn.Dataset)
+		err = asn.makeSyncApiRequest("DELETE", path, nil, targetNamespace)
 	default:
 		return errors.New("Unhandled API Sync event type " + asn.String())
 	}
@@ -267,7 +286,9 @@ func (asn *ApiSyncNotification) makeSyncApiRequest(verb string, path string, jso
 		}
 
 	case "DELETE":
-		expectedStatus = []int{204}
+		// Deleted or Not Found (Already Deleted). In a duplex pair the target's delete is sent back to the
+		// source, where the dataset has already been deleted
+		expectedStatus = []int{204, 404}
 		req, err = http.NewRequest(http.MethodDelete, targetCoreService+path, nil)
 		if err != nil {
 			return err
@@ -0,0 +1,148 @@
+package message
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// fakeTokens returns a fixed service token
+type fakeTokens struct{}
+
+func (fakeTokens) GetAccessToken() (string, error) { return "access-token", nil }
+func (fakeTokens) GetIDToken() (string, error)     { return "id-token", nil }
+func (fakeTokens) RefreshRoutine()                 {}
+
+// fakeCore records the requests made to a core service and responds with the status set for the request's path,
+// or 204 if it isn't set
+type fakeCore struct {
+	mu       sync.Mutex
+	requests []string
+	status   map[string]int
+}
+
+func (f *fakeCore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if status, ok := f.status[r.URL.Path]; ok {
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newCoreService starts a fake core service, returning its configuration with a namespace
+func newCoreService(t *testing.T, core *fakeCore, namespace string) *config.PopulatedNamespaceConfiguration {
+	server := httptest.NewServer(core)
+	t.Cleanup(server.Close)
+
+	coreService := &config.PopulatedCoreServiceConfiguration{
+		Tokens:     fakeTokens{},
+		Endpoint:   server.URL,
+		Namespaces: map[string]*config.PopulatedNamespaceConfiguration{},
+	}
+	ns := &config.PopulatedNamespaceConfiguration{
+		CoreService: coreService,
+		Name:        namespace,
+		SyncTargets: map[config.SyncKey]*config.SyncTarget{},
+	}
+	coreService.Namespaces[namespace] = ns
+	return ns
+}
+
+func TestExecuteDeleteDatasetCascade(t *testing.T) {
+	source := newCoreService(t, &fakeCore{}, "source")
+	cascadeCore := &fakeCore{}
+	cascade := newCoreService(t, cascadeCore, "cascade")
+	keepCore := &fakeCore{}
+	keep := newCoreService(t, keepCore, "keep")
+
+	source.SyncTargets[config.SyncKey{CoreService: cascade.CoreService.Endpoint, Namespace: "cascade"}] =
+		&config.SyncTarget{SyncType: config.DuplexSyncType, CascadeDelete: true, Target: cascade}
+	source.SyncTargets[config.SyncKey{CoreService: keep.CoreService.Endpoint, Namespace: "keep"}] =
+		&config.SyncTarget{SyncType: config.SimplexSyncType, Target: keep}
+
+	asn := &ApiSyncNotification{
+		EventType:      "delete-ds",
+		SourceEndpoint: source.CoreService.Endpoint,
+		Namespace:      "source",
+		Dataset:        "dataset",
+	}
+	asn.Execute(source.CoreService)
+
+	// only targets that opted into cascading deletes delete the dataset
+	if got := strings.Join(cascadeCore.requests, ","); got != "DELETE /namespace/cascade/dataset/dataset" {
+		t.Errorf("unexpected requests to the cascading target: %s", got)
+	}
+	if len(keepCore.requests) != 0 {
+		t.Errorf("expected no requests to the target without cascading deletes, got %v", keepCore.requests)
+	}
+}
+
+func TestHandleSyncDeleteDataset(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"deleted", http.StatusNoContent, false},
+		// in a duplex pair the target's delete is sent back to the source, which already deleted the dataset
+		{"already deleted", http.StatusNotFound, false},
+		{"forbidden", http.StatusForbidden, true},
+		{"failed", http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := &fakeCore{status: map[string]int{"/namespace/target/dataset/dataset": tt.status}}
+			target := newCoreService(t, core, "target")
+
+			asn := &ApiSyncNotification{EventType: "delete-ds", Namespace: "source", Dataset: "dataset"}
+			err := asn.handleSync(nil, target, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHandleSyncDeleteDatasetDuplexEcho(t *testing.T) {
+	// a and b are a duplex pair that cascade deletes. When a's dataset is deleted, the delete is applied to b,
+	// whose core service then sends the delete back to a, where the dataset is already delete-marked
+	aCore := &fakeCore{status: map[string]int{"/namespace/a/dataset/dataset": http.StatusNotFound}}
+	a := newCoreService(t, aCore, "a")
+	bCore := &fakeCore{}
+	b := newCoreService(t, bCore, "b")
+
+	a.SyncTargets[config.SyncKey{CoreService: b.CoreService.Endpoint, Namespace: "b"}] =
+		&config.SyncTarget{SyncType: config.DuplexSyncType, CascadeDelete: true, Target: b}
+	b.SyncTargets[config.SyncKey{CoreService: a.CoreService.Endpoint, Namespace: "a"}] =
+		&config.SyncTarget{SyncType: config.DuplexSyncType, CascadeDelete: true, Target: a}
+
+	for _, source := range []*config.PopulatedNamespaceConfiguration{a, b} {
+		for _, target := range source.SyncTargets {
+			asn := &ApiSyncNotification{
+				EventType:      "delete-ds",
+				SourceEndpoint: source.CoreService.Endpoint,
+				Namespace:      source.Name,
+				Dataset:        "dataset",
+			}
+			if err := asn.handleSync(source, target.Target, nil); err != nil {
+				t.Errorf("expected the delete from '%s' to succeed, got %v", source.Name, err)
+			}
+		}
+	}
+
+	requests := append(aCore.requests, bCore.requests...)
+	sort.Strings(requests)
+	if got := strings.Join(requests, ","); got != "DELETE /namespace/a/dataset/dataset,DELETE /namespace/b/dataset/dataset" {
+		t.Errorf("unexpected requests: %s", got)
+	}
+}
@@ -0,0 +1,328 @@
+package message
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+const (
+	// maxRetryBackoff limits how long an item waits before it is retried while the core service is unavailable
+	maxRetryBackoff = time.Minute
+	// shutdownFlushTimeout is how long the buffered items are retried for when the service stops
+	shutdownFlushTimeout = 30 * time.Second
+)
+
+// coreUnavailableError is returned when a request couldn't be handled by the core service because it couldn't be
+// reached or is restarting. Requests that fail this way are retried until the core service is available again
+type coreUnavailableError struct {
+	err error
+}
+
+func (e *coreUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+// isCoreUnavailable returns true if the error means the core service couldn't handle the request
+func isCoreUnavailable(err error) bool {
+	_, ok := err.(*coreUnavailableError)
+	return ok
+}
+
+// coreRejectedError is returned when the core service rejected a request as invalid (a 4xx response), so sending
+// it again will fail the same way
+type coreRejectedError struct {
+	err error
+}
+
+func (e *coreRejectedError) Error() string {
+	return e.err.Error()
+}
+
+// isCoreRejected returns true if the error means the core service rejected the request
+func isCoreRejected(err error) bool {
+	_, ok := err.(*coreRejectedError)
+	return ok
+}
+
+// coreUnavailableStatus returns true if the response status means the core service (or the proxy in front of
+// it) is restarting or overloaded
+func coreUnavailableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// coreResponseError wraps the error of a failed core service response based on its status, so the batch queue
+// knows whether to retry it
+func coreResponseError(status int, err error) error {
+	if coreUnavailableStatus(status) {
+		return &coreUnavailableError{err: err}
+	}
+	if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+		return &coreRejectedError{err: err}
+	}
+	return err
+}
+
+// retryBackoff returns how long to wait before the next retry, backing off exponentially from the flush interval
+func retryBackoff(interval time.Duration, retries int) time.Duration {
+	backoff := maxRetryBackoff
+	if retries < 16 && interval*time.Duration(1<<uint(retries)) < maxRetryBackoff {
+		backoff = interval * time.Duration(1<<uint(retries))
+	}
+	return backoff
+}
+
+// batchItem is an item buffered by a batchQueue
+type batchItem interface {
+	// batchKey identifies the item, only the latest buffered item with a key is kept. Items with an empty key are
+	// always buffered
+	batchKey() string
+	// String describes the item in log messages
+	String() string
+}
+
+// batchSender sends a batch of items to a core service. If only some of the items failed with a retryable error it
+// returns a *batchItemsError listing them
+type batchSender func(coreService *config.PopulatedCoreServiceConfiguration, items []batchItem) error
+
+// batchItemsError is returned by a batchSender when some of the items in a batch failed and can be retried
+type batchItemsError struct {
+	// indexes are the positions of the failed items in the batch
+	indexes []int
+	reason  string
+}
+
+func (e *batchItemsError) Error() string {
+	return e.reason
+}
+
+// batchEntry is a buffered item with the core service it is sent to and its retry state
+type batchEntry struct {
+	item        batchItem
+	coreService *config.PopulatedCoreServiceConfiguration
+	// attempts is the number of times the item failed, not counting times the core service couldn't be reached
+	attempts int
+	// retries is the number of times the item has been retried, used to back off
+	retries    int
+	retryAfter time.Time
+}
+
+// batchQueue buffers items and sends them to the core services in batches, when the buffer reaches the batch size
+// or at the flush interval. Items that fail with a retryable error are buffered again with a backoff, unless a newer
+// item with the same key was buffered in the meantime. Items are kept until the core service can be reached, only
+// failed responses count towards the maximum number of attempts, and items the core service rejects are dropped
+type batchQueue struct {
+	// name describes the items in log messages
+	name string
+	send batchSender
+
+	mu      sync.Mutex
+	pending []*batchEntry
+	// latest is the buffered entry for each item key
+	latest map[string]*batchEntry
+
+	settings config.Batching
+	flushCh  chan struct{}
+}
+
+func newBatchQueue(name string, send batchSender) *batchQueue {
+	return &batchQueue{
+		name:    name,
+		send:    send,
+		latest:  map[string]*batchEntry{},
+		flushCh: make(chan struct{}, 1),
+	}
+}
+
+// start starts sending the buffered items with the given settings. When the context is done all of the buffered
+// items are sent, and the returned channel is closed once they have been sent or dropped
+func (q *batchQueue) start(ctx context.Context, settings config.Batching) <-chan struct{} {
+	q.mu.Lock()
+	q.settings = settings
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.run(ctx)
+	}()
+	return done
+}
+
+// push buffers an item to send to a core service, replacing any buffered item with the same key
+func (q *batchQueue) push(coreService *config.PopulatedCoreServiceConfiguration, item batchItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := item.batchKey()
+	if existing, ok := q.latest[key]; ok && key != "" {
+		existing.item = item
+		existing.coreService = coreService
+		existing.attempts = 0
+		existing.retries = 0
+		existing.retryAfter = time.Time{}
+		return
+	}
+
+	entry := &batchEntry{item: item, coreService: coreService}
+	q.pending = append(q.pending, entry)
+	if key != "" {
+		q.latest[key] = entry
+	}
+
+	if q.settings.BatchSize > 0 && len(q.pending) >= q.settings.BatchSize {
+		select {
+		case q.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (q *batchQueue) run(ctx context.Context) {
+	ticker := time.NewTicker(q.settings.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.flush()
+		case <-q.flushCh:
+			q.flush()
+		case <-ctx.Done():
+			q.drain()
+			return
+		}
+	}
+}
+
+// flush sends the buffered items that are ready to their core services
+func (q *batchQueue) flush() {
+	for coreService, entries := range q.take(false) {
+		q.sendBatches(coreService, entries)
+	}
+}
+
+// drain sends all of the buffered items, ignoring their backoff, until the buffer is empty or the shutdown
+// timeout is reached
+func (q *batchQueue) drain() {
+	deadline := time.Now().Add(shutdownFlushTimeout)
+	for {
+		for coreService, entries := range q.take(true) {
+			q.sendBatches(coreService, entries)
+		}
+
+		q.mu.Lock()
+		remaining := len(q.pending)
+		q.mu.Unlock()
+		if remaining == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			logrus.Errorf("Dropping %d %s that couldn't be sent before stopping", remaining, q.name)
+			return
+		}
+
+		time.Sleep(q.settings.FlushInterval)
+	}
+}
+
+// take removes the items that are ready to send from the buffer, grouped by core service. If all is true items
+// that are waiting to be retried are also returned
+func (q *batchQueue) take(all bool) map[*config.PopulatedCoreServiceConfiguration][]*batchEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	ready := map[*config.PopulatedCoreServiceConfiguration][]*batchEntry{}
+	waiting := []*batchEntry{}
+	for _, entry := range q.pending {
+		if !all && entry.retryAfter.After(now) {
+			waiting = append(waiting, entry)
+			continue
+		}
+		ready[entry.coreService] = append(ready[entry.coreService], entry)
+		if key := entry.item.batchKey(); key != "" {
+			delete(q.latest, key)
+		}
+	}
+	q.pending = waiting
+
+	return ready
+}
+
+// retry buffers failed items again, unless they have been attempted too many times or a newer item with the
+// same key has been buffered. If failed is false the core service couldn't be reached, so the attempt isn't counted
+func (q *batchQueue) retry(entries []*batchEntry, reason string, failed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, entry := range entries {
+		if failed {
+			entry.attempts++
+		}
+		if entry.attempts >= q.settings.MaxAttempts {
+			logrus.Errorf("Dropping %s after %d attempts: %s", entry.item, entry.attempts, reason)
+			continue
+		}
+		key := entry.item.batchKey()
+		if _, ok := q.latest[key]; ok && key != "" {
+			continue
+		}
+
+		// back off exponentially, so the core service isn't flooded while it is unavailable
+		entry.retries++
+		entry.retryAfter = time.Now().Add(retryBackoff(q.settings.FlushInterval, entry.retries))
+		q.pending = append(q.pending, entry)
+		if key != "" {
+			q.latest[key] = entry
+		}
+	}
+}
+
+// sendBatches sends items to a core service, split into batches of the configured size
+func (q *batchQueue) sendBatches(coreService *config.PopulatedCoreServiceConfiguration, entries []*batchEntry) {
+	for start := 0; start < len(entries); start += q.settings.BatchSize {
+		end := start + q.settings.BatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		q.sendBatch(coreService, entries[start:end])
+	}
+}
+
+// sendBatch sends a batch of items to a core service, retrying the items that fail with a retryable error
+func (q *batchQueue) sendBatch(coreService *config.PopulatedCoreServiceConfiguration, entries []*batchEntry) {
+	items := make([]batchItem, len(entries))
+	for i, entry := range entries {
+		items[i] = entry.item
+	}
+
+	err := q.send(coreService, items)
+	if err == nil {
+		return
+	}
+
+	if itemsErr, ok := err.(*batchItemsError); ok {
+		failed := make([]*batchEntry, 0, len(itemsErr.indexes))
+		for _, i := range itemsErr.indexes {
+			failed = append(failed, entries[i])
+		}
+		logrus.Warnf("%d of %d %s sent to %s failed, retrying", len(failed), len(entries), q.name, coreService.Endpoint)
+		q.retry(failed, itemsErr.reason, true)
+		return
+	}
+
+	if isCoreRejected(err) {
+		logrus.Errorf("Dropping %d %s rejected by %s: %s", len(entries), q.name, coreService.Endpoint, err.Error())
+		return
+	}
+
+	logrus.Errorf("Failed to send %d %s to %s: %s", len(entries), q.name, coreService.Endpoint, err.Error())
+	q.retry(entries, err.Error(), !isCoreUnavailable(err))
+}
@@ -0,0 +1,262 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// testItem is a batch item with a key and a value, so replaced items can be told apart
+type testItem struct {
+	key   string
+	value string
+}
+
+func (i *testItem) batchKey() string {
+	return i.key
+}
+
+func (i *testItem) String() string {
+	return i.key + "=" + i.value
+}
+
+// testSender records the batches it is sent, failing each call with the next of its errors
+type testSender struct {
+	mu      sync.Mutex
+	batches []string
+	errs    []error
+	// during is called while a batch is being sent
+	during func()
+}
+
+func (s *testSender) send(coreService *config.PopulatedCoreServiceConfiguration, items []batchItem) error {
+	if s.during != nil {
+		s.during()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	described := []string{}
+	for _, item := range items {
+		described = append(described, item.String())
+	}
+	s.batches = append(s.batches, strings.Join(described, ","))
+
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *testSender) sent() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.batches, " ")
+}
+
+var testCoreService = &config.PopulatedCoreServiceConfiguration{Endpoint: "http://core"}
+
+// newTestBatchQueue returns a batch queue that isn't started, so it is only flushed when the test calls flush
+func newTestBatchQueue(sender *testSender, batchSize int) *batchQueue {
+	q := newBatchQueue("test items", sender.send)
+	q.settings = config.Batching{BatchSize: batchSize, FlushInterval: 10 * time.Millisecond, MaxAttempts: 3}
+	return q
+}
+
+// describePending describes the buffered items
+func (q *batchQueue) describePending() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	described := []string{}
+	for _, entry := range q.pending {
+		described = append(described, entry.item.String())
+	}
+	return strings.Join(described, ",")
+}
+
+func TestBatchQueueDedupe(t *testing.T) {
+	sender := &testSender{}
+	q := newTestBatchQueue(sender, 2)
+
+	// only the latest item with a key is kept, in the position of the first, and items without a key are all kept
+	q.push(testCoreService, &testItem{key: "a", value: "1"})
+	q.push(testCoreService, &testItem{value: "x"})
+	q.push(testCoreService, &testItem{key: "a", value: "2"})
+	q.push(testCoreService, &testItem{value: "y"})
+	q.push(testCoreService, &testItem{key: "b", value: "1"})
+
+	q.flush()
+
+	if got := sender.sent(); got != "a=2,=x =y,b=1" {
+		t.Errorf("unexpected batches: %s", got)
+	}
+	if pending := q.describePending(); pending != "" {
+		t.Errorf("expected no buffered items, got %s", pending)
+	}
+
+	// a sent item no longer replaces new items with its key
+	q.push(testCoreService, &testItem{key: "a", value: "3"})
+	q.flush()
+	if got := sender.sent(); got != "a=2,=x =y,b=1 a=3" {
+		t.Errorf("unexpected batches: %s", got)
+	}
+}
+
+func TestBatchQueueRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		pending string
+	}{
+		{"failed", errors.New("failed"), "a=1,b=1"},
+		{"unavailable", &coreUnavailableError{err: errors.New("unavailable")}, "a=1,b=1"},
+		{"rejected", &coreRejectedError{err: errors.New("rejected")}, ""},
+		{"failed items", &batchItemsError{indexes: []int{1}, reason: "busy"}, "b=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &testSender{errs: []error{tt.err}}
+			q := newTestBatchQueue(sender, 10)
+			q.push(testCoreService, &testItem{key: "a", value: "1"})
+			q.push(testCoreService, &testItem{key: "b", value: "1"})
+
+			start := time.Now()
+			q.flush()
+
+			if pending := q.describePending(); pending != tt.pending {
+				t.Fatalf("expected %s to be retried, got %s", tt.pending, pending)
+			}
+			if tt.pending == "" {
+				return
+			}
+
+			// retried items back off, so they aren't sent again right away
+			for _, entry := range q.pending {
+				if entry.retries != 1 || entry.retryAfter.Before(start.Add(2*q.settings.FlushInterval)) {
+					t.Errorf("expected %s to back off, retries %d retry after %v", entry.item, entry.retries, entry.retryAfter.Sub(start))
+				}
+			}
+			q.flush()
+			if got := sender.sent(); got != "a=1,b=1" {
+				t.Errorf("expected no items to be sent during the backoff, got %s", got)
+			}
+		})
+	}
+}
+
+func TestBatchQueueMaxAttempts(t *testing.T) {
+	failed := errors.New("failed")
+	unavailable := &coreUnavailableError{err: errors.New("unavailable")}
+
+	// failed responses count towards the maximum attempts, the core service being unreachable doesn't
+	sender := &testSender{errs: []error{failed, unavailable, unavailable, failed, unavailable, failed}}
+	q := newTestBatchQueue(sender, 10)
+	q.push(testCoreService, &testItem{key: "a", value: "1"})
+
+	for i := 0; i < 6; i++ {
+		if q.describePending() == "" {
+			t.Fatalf("expected the item to be kept after %d sends", i)
+		}
+		q.sendBatches(testCoreService, q.take(true)[testCoreService])
+	}
+
+	if pending := q.describePending(); pending != "" {
+		t.Errorf("expected the item to be dropped after 3 failed attempts, got %s", pending)
+	}
+}
+
+func TestBatchQueueRetryReplaced(t *testing.T) {
+	sender := &testSender{errs: []error{errors.New("failed")}}
+	q := newTestBatchQueue(sender, 10)
+	q.push(testCoreService, &testItem{key: "a", value: "1"})
+
+	// a newer item is buffered while the batch is being sent, so the failed item isn't retried
+	sender.during = func() {
+		sender.during = nil
+		q.push(testCoreService, &testItem{key: "a", value: "2"})
+	}
+	q.flush()
+
+	if pending := q.describePending(); pending != "a=2" {
+		t.Errorf("expected only the newer item to be buffered, got %s", pending)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retries int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{6, maxRetryBackoff},
+		{40, maxRetryBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := retryBackoff(time.Second, tt.retries); got != tt.want {
+			t.Errorf("expected a backoff of %v after %d retries, got %v", tt.want, tt.retries, got)
+		}
+	}
+}
+
+func TestBatchQueueBatchSize(t *testing.T) {
+	sender := &testSender{}
+	q := newBatchQueue("test items", sender.send)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := q.start(ctx, config.Batching{BatchSize: 2, FlushInterval: time.Hour, MaxAttempts: 3})
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// reaching the batch size sends the batch without waiting for the flush interval
+	q.push(testCoreService, &testItem{key: "a", value: "1"})
+	q.push(testCoreService, &testItem{key: "b", value: "1"})
+
+	deadline := time.Now().Add(time.Second)
+	for sender.sent() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := sender.sent(); got != "a=1,b=1" {
+		t.Errorf("unexpected batches: %s", got)
+	}
+}
+
+func TestBatchQueueDrain(t *testing.T) {
+	sender := &testSender{errs: []error{errors.New("failed")}}
+	q := newBatchQueue("test items", sender.send)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := q.start(ctx, config.Batching{BatchSize: 10, FlushInterval: 10 * time.Millisecond, MaxAttempts: 3})
+
+	q.push(testCoreService, &testItem{key: "a", value: "1"})
+	q.push(testCoreService, &testItem{key: "b", value: "1"})
+
+	// stopping the queue sends every buffered item, including items waiting to be retried
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queue to be drained")
+	}
+
+	if got := sender.sent(); got != "a=1,b=1 a=1,b=1" {
+		t.Errorf("unexpected batches: %s", got)
+	}
+	if pending := q.describePending(); pending != "" {
+		t.Errorf("expected no buffered items, got %s", pending)
+	}
+}
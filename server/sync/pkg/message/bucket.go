@@ -1,18 +1,16 @@
 package message
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	b64 "encoding/base64"
-	"encoding/json"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
 	"strings"
-	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -23,6 +21,14 @@ import (
 
 	"github.com/gigantum/hoss-service/policy"
 	"github.com/gigantum/hoss-sync/pkg/config"
+	"github.com/gigantum/hoss-sync/pkg/extract"
+)
+
+const (
+	// extractionBlockSize is the size of the aligned blocks read from an object when extracting technical metadata
+	extractionBlockSize = 1024 * 1024
+	// maxExtractionBytes limits the number of bytes read from an object when extracting technical metadata
+	maxExtractionBytes = 4 * extractionBlockSize
 )
 
 // LookupPrefix determines if the given string starts with any of the given prefixes
@@ -52,12 +58,18 @@ type BucketNotificationRecord struct {
 		Object struct {
 			Key  string `json:"key"`
 			Size int    `json:"size"`
+			// VersionId is the version of the object the event is for, empty if the bucket isn't versioned
+			VersionId string `json:"versionId"`
 		} `json:"object"`
 	} `json:"s3"`
 	Source struct {
 		Host      string `json:"host"`
 		UserAgent string `json:"userAgent"`
 	} `json:"source"`
+	UserIdentity struct {
+		// PrincipalId is the access key or user that made the request
+		PrincipalId string `json:"principalId"`
+	} `json:"userIdentity"`
 
 	Endpoint string `json:"-"`
 }
@@ -75,6 +87,10 @@ type MetadataIndexPayload struct {
 	SizeBytes int `json:"size_bytes"`
 	// Metadata is a list of strings representing key-pairs separated by ':' (e.g. ["fizz:buzz"])
 	Metadata []string `json:"metadata"`
+	// ContentHash is the hex encoded SHA-256 hash of the object's content
+	ContentHash string `json:"content_hash,omitempty"`
+	// SidecarMetadata is the subset of Metadata read from the object's sidecar files
+	SidecarMetadata []string `json:"sidecar_metadata"`
 }
 
 // RequireReload returns true if this message requires the latest sync configuration information to Match() and Execute()
@@ -107,6 +123,31 @@ func (bnr *BucketNotificationRecord) DatasetExtended(objStoreName string) string
 	return fmt.Sprintf("%s|%s|%s", objStoreName, bnr.FileBucket(), bnr.FileDataset())
 }
 
+// EventType returns the category of the event
+func (bnr *BucketNotificationRecord) EventType() EventType {
+	switch bnr.FileOperation() {
+	case "s3:ObjectCreated:Put",
+		"s3:ObjectCreated:Copy",
+		"s3:ObjectCreated:CompleteMultipartUpload",
+		"ObjectCreated:Put", // AWS doesn't include the 's3:' prefix
+		"ObjectCreated:Copy",
+		"ObjectCreated:CompleteMultipartUpload":
+		return EventCreated
+	case "s3:ObjectRemoved:Delete",
+		"ObjectRemoved:Delete",
+		"ObjectRemoved:DeleteMarkerCreated",
+		"s3:ObjectRemoved:DeleteMarkerCreated":
+		return EventRemoved
+	case "s3:ObjectAccessed:Get",
+		"s3:ObjectAccessed:Head",
+		"ObjectAccessed:Get",
+		"ObjectAccessed:Head":
+		return EventAccessed
+	default:
+		return EventUnknown
+	}
+}
+
 // FileSize returns the file size of the originating file
 func (bnr *BucketNotificationRecord) FileSize() int {
 	return bnr.S3.Object.Size
@@ -128,6 +169,12 @@ func (bnr *BucketNotificationRecord) FileID(populatedConfig *config.PopulatedObj
 	return b64.StdEncoding.EncodeToString([]byte(strID))
 }
 
+// ShardKey returns the key used to assign the notification to a shard, which is the object. The events of an
+// object are processed in order by one instance, while the objects of a busy bucket are spread across all of them
+func (bnr *BucketNotificationRecord) ShardKey() string {
+	return bnr.Endpoint + "/" + bnr.FileBucket() + "/" + bnr.FileKey()
+}
+
 // String returns the string representation of the notification
 func (bnr *BucketNotificationRecord) String() string {
 	return fmt.Sprintf("<BucketNotification %s %s/%s>", bnr.FileOperation(), bnr.FileBucket(), bnr.FileKey())
@@ -157,15 +204,21 @@ func (bnr *BucketNotificationRecord) findNamespace(populatedConfig *config.Popul
 // Match checks to see if the message should be passed on to the worker based on the provided config
 func (bnr *BucketNotificationRecord) Match(populatedConfig *config.PopulatedCoreServiceConfiguration) (bool, bool) {
 	switch bnr.FileOperation() {
-	case "s3:ObjectAccessed:Get",
-		"s3:ObjectAccessed:Head",
-		"ObjectAccessed:Get",
+	case "s3:ObjectAccessed:Head",
 		"ObjectAccessed:Head":
-		// We currently do not do anything for HEAD or GET operations in the sync service, so just return
+		// We currently do not do anything for HEAD operations in the sync service, so just return
 		// isMatch=true and ignore=true so the event is immediately ignored. If in the future this changes and this check is removed so
 		// events proceed to the Execute() function, you must be sure to properly protect against "echoing"
 		// HEAD operations when duplex syncing is enabled.
 		return true, true
+	case "s3:ObjectAccessed:Get",
+		"ObjectAccessed:Get":
+		// GET operations are only used to record downloads for datasets with access logging enabled. The sync
+		// service reads objects while syncing and indexing them, so its own downloads are ignored immediately.
+		// GET events are never synced, so they can't "echo" when duplex syncing is enabled.
+		if strings.Contains(bnr.Source.UserAgent, "exec-env/hoss-sync-service") {
+			return true, true
+		}
 	}
 
 	populatedConfig.L.RLock()
@@ -230,56 +283,43 @@ func (bnr *BucketNotificationRecord) Execute(populatedConfig *config.PopulatedCo
 		}
 	}
 
-	// Handle all meta and sync targets in parallel but wait for the message to finish processing before returning
-	var wg sync.WaitGroup
+	event := &Event{
+		Record:      bnr,
+		ObjectStore: objStore,
+		Metadata:    metadata,
 
-	wg.Add(1)
-	go func(o *config.PopulatedObjectStoreConfiguration, m map[string]string) {
-		defer wg.Done()
-		err := bnr.handleMeta(o, m)
-		if err != nil {
-			logrus.Error(err)
+		// Flag messages caused by the sync service, so processors can filter them. The sync processor skips
+		// them, but all messages are sent through to the metadata processor to support multi-search index updating.
+		// Uses AWS_EXECUTION_ENV (https://docs.aws.amazon.com/sdk-for-go/api/aws/corehandlers/)
+		//   to add a custom suffix to the user agent
+		FromSyncService: strings.Contains(bnr.Source.UserAgent, "exec-env/hoss-sync-service"),
+	}
+
+	event.Namespace = bnr.findNamespace(populatedConfig)
+	if event.Namespace != nil {
+		key := LookupPrefix(bnr.FileKey(), event.Namespace.SyncPolicies)
+		filter := event.Namespace.SyncFilters[key]
+
+		msgInfo := &policy.MessageInformation{
+			EventOperation: bnr.FileOperation(),
+			ObjectKey:      bnr.FileKey(),
+			ObjectSize:     bnr.S3.Object.Size,
+			ObjectMetadata: metadata,
 		}
-	}(objStore, metadata)
-
-	// filter messages caused by the sync service. We do this for the sync handler, but we send
-	// all messages through to the metadata handler to support multi-search index updating.
-	// Uses AWS_EXECUTION_ENV (https://docs.aws.amazon.com/sdk-for-go/api/aws/corehandlers/)
-	//   to add a custom suffix to the user agent
-	if strings.Contains(bnr.Source.UserAgent, "exec-env/hoss-sync-service") {
-		logrus.Debugf("Skipping notification caused by the sync service: %s", bnr)
-	} else {
-		namespace := bnr.findNamespace(populatedConfig)
-		if namespace != nil {
-			key := LookupPrefix(bnr.FileKey(), namespace.SyncPolicies)
-			filter := namespace.SyncFilters[key]
-
-			msgInfo := &policy.MessageInformation{
-				EventOperation: bnr.FileOperation(),
-				ObjectKey:      bnr.FileKey(),
-				ObjectSize:     bnr.S3.Object.Size,
-				ObjectMetadata: metadata,
-			}
-			passed, err := filter(msgInfo)
-			if err != nil {
-				logrus.Errorf("Cannot apply policy filter to message %s: %v", bnr.String(), err)
-				// ??? should this fail open?
-			} else if passed {
-				for _, target := range namespace.SyncTargets {
-					wg.Add(1)
-					go func(t *config.SyncTarget, m map[string]string) {
-						defer wg.Done()
-						err := bnr.handleSync(namespace, t.Target, m)
-						if err != nil {
-							logrus.Error(err)
-						}
-					}(target, metadata)
-				}
-			}
+		passed, err := filter(msgInfo)
+		if err != nil {
+			logrus.Errorf("Cannot apply policy filter to message %s: %v", bnr.String(), err)
+			// ??? should this fail open?
 		}
+		event.PolicyPassed = err == nil && passed
 	}
 
-	wg.Wait()
+	if event.FromSyncService {
+		logrus.Debugf("Notification caused by the sync service: %s", bnr)
+	}
+
+	// Run all processors in parallel but wait for the message to finish processing before returning
+	runProcessors(event)
 }
 
 func (bnr *BucketNotificationRecord) handleSync(sourceNamespace,
@@ -345,8 +385,8 @@ func (bnr *BucketNotificationRecord) handleSync(sourceNamespace,
 		"s3:ObjectAccessed:Head",
 		"ObjectAccessed:Get",
 		"ObjectAccessed:Head":
-		// Operations that don't have an action to take. These currently are dropped in the Match method.
-		// If you need to do something with them, you'll have to allow them through the Match method.
+		// Operations that don't have an action to take. HEAD operations are dropped in the Match method, and
+		// GET operations are skipped by the sync processor.
 	default:
 		return errors.New("Unhandled " + bnr.String())
 	}
@@ -388,6 +428,134 @@ func (bnr *BucketNotificationRecord) Delete(client *s3.Client, bucket, key strin
 	return err
 }
 
+// FileVersionId returns the version of the object the event is for, or nil if the bucket isn't versioned
+func (bnr *BucketNotificationRecord) FileVersionId() *string {
+	if bnr.S3.Object.VersionId == "" {
+		return nil
+	}
+	return aws.String(bnr.S3.Object.VersionId)
+}
+
+// getContentHash streams the object's content to compute its SHA-256 hash. The version of the object the event
+// is for is read, so the hash doesn't describe a newer version if the object was overwritten since the event
+func (bnr *BucketNotificationRecord) getContentHash(client *s3.Client) (string, error) {
+	output, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:    aws.String(bnr.FileBucket()),
+		Key:       aws.String(bnr.FileKey()),
+		VersionId: bnr.FileVersionId(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting object")
+	}
+	defer output.Body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, output.Body); err != nil {
+		return "", errors.Wrap(err, "error reading object")
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getTechnicalMetadata reads the start of the object to detect its type and extract technical metadata
+func (bnr *BucketNotificationRecord) getTechnicalMetadata(client *s3.Client) (map[string]string, error) {
+	if bnr.FileSize() == 0 {
+		return nil, nil
+	}
+
+	reader := &objectReaderAt{
+		size:      int64(bnr.FileSize()),
+		remaining: maxExtractionBytes,
+		blocks:    map[int64][]byte{},
+		fetch: func(off, n int64) ([]byte, error) {
+			return bnr.getObjectRange(client, off, n)
+		},
+	}
+
+	return extract.Extract(bnr.FileKey(), reader.size, reader)
+}
+
+// getObjectRange reads n bytes of the object starting at the offset
+func (bnr *BucketNotificationRecord) getObjectRange(client *s3.Client, off, n int64) ([]byte, error) {
+	byteRange := fmt.Sprintf("bytes=%d-%d", off, off+n-1)
+	output, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:    aws.String(bnr.FileBucket()),
+		Key:       aws.String(bnr.FileKey()),
+		VersionId: bnr.FileVersionId(),
+		Range:     &byteRange,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error requesting object range")
+	}
+	defer output.Body.Close()
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(output.Body, data); err != nil {
+		return nil, errors.Wrap(err, "error reading object range")
+	}
+	return data, nil
+}
+
+// objectReaderAt reads an object in aligned blocks of extractionBlockSize, serving reads from the blocks that were
+// already read. Extractors make many small reads near each other, so each block only needs to be requested once.
+// The total number of bytes requested from the object store is limited
+type objectReaderAt struct {
+	fetch func(off, n int64) ([]byte, error)
+	size  int64
+
+	remaining int64
+	blocks    map[int64][]byte
+}
+
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	n := int64(len(p))
+	if off+n > r.size {
+		n = r.size - off
+	}
+
+	read := int64(0)
+	for read < n {
+		block, err := r.block((off + read) / extractionBlockSize)
+		if err != nil {
+			return int(read), err
+		}
+		read += int64(copy(p[read:n], block[(off+read)%extractionBlockSize:]))
+	}
+
+	if n < int64(len(p)) {
+		return int(read), io.EOF
+	}
+	return int(read), nil
+}
+
+// block returns the block with the given index, requesting it from the object store if it wasn't read yet
+func (r *objectReaderAt) block(index int64) ([]byte, error) {
+	if block, ok := r.blocks[index]; ok {
+		return block, nil
+	}
+
+	off := index * extractionBlockSize
+	n := int64(extractionBlockSize)
+	if off+n > r.size {
+		n = r.size - off
+	}
+	if n > r.remaining {
+		return nil, errors.New("reached the read limit for extracting technical metadata")
+	}
+	r.remaining -= n
+
+	block, err := r.fetch(off, n)
+	if err != nil {
+		return nil, err
+	}
+	r.blocks[index] = block
+	return block, nil
+}
+
 func (bnr *BucketNotificationRecord) getObjectMetadata(client *s3.Client) (map[string]string, error) {
 	metadata := map[string]string{}
 
@@ -408,7 +576,9 @@ func (bnr *BucketNotificationRecord) getObjectMetadata(client *s3.Client) (map[s
 	return metadataOutput.Metadata, nil
 }
 
-func (bnr *BucketNotificationRecord) handleMeta(populatedConfig *config.PopulatedObjectStoreConfiguration, metadata map[string]string) error {
+func (bnr *BucketNotificationRecord) handleMeta(event *Event) error {
+	populatedConfig := event.ObjectStore
+
 	// update metadata index depending on which operation the file has experienced
 	switch bnr.FileOperation() {
 	case "s3:ObjectCreated:Put",
@@ -420,10 +590,16 @@ func (bnr *BucketNotificationRecord) handleMeta(populatedConfig *config.Populate
 		logrus.Infof("Processing Metadata Event: %s", bnr)
 
 		formattedMetadata := []string{}
-		for key, value := range metadata {
+		for key, value := range event.Metadata {
 			formattedMetadata = append(formattedMetadata, fmt.Sprintf("%s:%s", key, value))
 		}
 
+		// Technical metadata is indexed under the reserved metadata namespace, so it can be searched
+		// and suggested like user metadata without colliding with user metadata keys
+		for key, value := range event.TechnicalMetadata {
+			formattedMetadata = append(formattedMetadata, fmt.Sprintf("%s%s:%s", extract.MetadataPrefix, key, value))
+		}
+
 		// fill payload with object metadata, size, metadata
 		payload := MetadataIndexPayload{
 			ObjectKey:           bnr.FileKey(),
@@ -432,13 +608,23 @@ func (bnr *BucketNotificationRecord) handleMeta(populatedConfig *config.Populate
 			LastModifiedDate:    bnr.FileModifiedTime(),
 			SizeBytes:           bnr.FileSize(),
 			Metadata:            formattedMetadata,
+			ContentHash:         event.ContentHash,
 		}
 
-		err := bnr.makeMetadataIndexRequest(populatedConfig, "PUT", &payload)
+		// Metadata from the object's sidecar files is indexed with the object's own metadata. If the object is
+		// a sidecar file the object it describes is updated instead. If the sidecar metadata can't be loaded the
+		// object isn't indexed, since indexing it without the sidecar metadata would remove it from the index
+		sidecarMetadata, isSidecar, err := bnr.handleSidecar(populatedConfig, &payload)
 		if err != nil {
-			return errors.New("could not add or update object in metadata index: " + err.Error())
+			return err
+		}
+		if !isSidecar && sidecarMetadata != nil {
+			payload.Metadata = append(payload.Metadata, sidecarMetadata...)
+			payload.SidecarMetadata = sidecarMetadata
 		}
 
+		metadataIndex.add(populatedConfig.CoreService, indexActionIndex, &payload)
+
 	case "s3:ObjectRemoved:Delete",
 		"ObjectRemoved:Delete",
 		"ObjectRemoved:DeleteMarkerCreated",
@@ -455,9 +641,11 @@ func (bnr *BucketNotificationRecord) handleMeta(populatedConfig *config.Populate
 			Metadata:            emptyMeta,
 		}
 
-		err := bnr.makeMetadataIndexRequest(populatedConfig, "DELETE", &payload)
-		if err != nil {
-			return errors.New("could not remove object from metadata index: " + err.Error())
+		metadataIndex.add(populatedConfig.CoreService, indexActionDelete, &payload)
+
+		// Removing a sidecar file removes its metadata from the object it describes
+		if _, _, err := bnr.handleSidecar(populatedConfig, &payload); err != nil {
+			return err
 		}
 	case "s3:ObjectAccessed:Get",
 		"s3:ObjectAccessed:Head",
@@ -472,61 +660,45 @@ func (bnr *BucketNotificationRecord) handleMeta(populatedConfig *config.Populate
 	return nil
 }
 
-// makeMetadataIndexRequest is a helper function to make a REST request to the elasticsearch service
-func (bnr *BucketNotificationRecord) makeMetadataIndexRequest(populatedConfig *config.PopulatedObjectStoreConfiguration,
-	verb string, payload *MetadataIndexPayload) error {
+// handleSidecar loads the sidecar file metadata for an indexed object. If the object is a sidecar file, the
+// combined metadata of all sidecar files of the object it describes is sent to the search index and true is
+// returned. Otherwise the metadata of the object's own sidecar files is returned, nil if the dataset doesn't
+// use sidecar files
+func (bnr *BucketNotificationRecord) handleSidecar(populatedConfig *config.PopulatedObjectStoreConfiguration,
+	payload *MetadataIndexPayload) ([]string, bool, error) {
 
-	client := &http.Client{}
-
-	payloadBytes, err := json.Marshal(payload)
+	suffixes, err := getSidecarSuffixes(populatedConfig.CoreService, payload.DatasetExtended)
 	if err != nil {
-		return errors.Wrap(err, "unable to marshal payload JSON")
+		return nil, false, errors.Wrap(err, "unable to load sidecar configuration for "+payload.DatasetExtended)
 	}
-
-	// Hack to support running on localhost
-	coreService := strings.Replace(populatedConfig.CoreService.Endpoint, "localhost/core", "core:8080", 1)
-	path := coreService + "/search/document/metadata"
-
-	var req *http.Request
-	switch verb {
-	case "PUT":
-		req, err = http.NewRequest(http.MethodPut, path, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			return err
-		}
-
-	case "DELETE":
-		req, err = http.NewRequest(http.MethodDelete, path, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			return err
-		}
-	default:
-		return errors.New("Unsupported request type: " + verb)
+	if len(suffixes) == 0 {
+		return nil, false, nil
 	}
 
-	token, err := populatedConfig.CoreService.Tokens.GetIDToken()
+	client, err := populatedConfig.Client.GetClient()
 	if err != nil {
-		return err
+		return nil, false, errors.Wrap(err, "unable to get objectstore client")
 	}
 
-	req.Header.Set("User-Agent", "exec-env/hoss-sync-service")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	target, isSidecar := sidecarTarget(payload.ObjectKey, suffixes)
+	if !isSidecar {
+		target = payload.ObjectKey
 	}
 
-	if resp.StatusCode == 204 {
-		return nil
+	sidecarMetadata, err := loadSidecarMetadata(client, bnr.FileBucket(), target, suffixes)
+	if err != nil {
+		return nil, isSidecar, errors.Wrap(err, "unable to load sidecar metadata for "+target)
 	}
 
-	d, err := httputil.DumpResponse(resp, true)
-	if err != nil {
-		return errors.New("problem with metadata index response: " + err.Error())
+	if isSidecar {
+		metadataIndex.add(populatedConfig.CoreService, indexActionSidecar, &MetadataIndexPayload{
+			CoreServiceEndpoint: payload.CoreServiceEndpoint,
+			DatasetExtended:     payload.DatasetExtended,
+			ObjectKey:           target,
+			Metadata:            []string{},
+			SidecarMetadata:     sidecarMetadata,
+		})
 	}
-	logrus.Error(string(d))
 
-	return errors.New(fmt.Sprintf("Failed to make metadata update request to target `%s`, Status Code %v",
-		path, resp.Status))
+	return sidecarMetadata, isSidecar, nil
 }
@@ -0,0 +1,144 @@
+package message
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newTestReader returns an objectReaderAt for content of the given size, recording the ranges that are fetched
+func newTestReader(size int64, remaining int64) (*objectReaderAt, *[]string) {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	fetched := []string{}
+	reader := &objectReaderAt{
+		size:      size,
+		remaining: remaining,
+		blocks:    map[int64][]byte{},
+		fetch: func(off, n int64) ([]byte, error) {
+			fetched = append(fetched, fmt.Sprintf("%d-%d", off, off+n-1))
+			data := make([]byte, n)
+			copy(data, content[off:off+n])
+			return data, nil
+		},
+	}
+	return reader, &fetched
+}
+
+func TestObjectReaderAt(t *testing.T) {
+	size := int64(3*extractionBlockSize + 100)
+	reader, fetched := newTestReader(size, maxExtractionBytes)
+
+	tests := []struct {
+		name    string
+		off     int64
+		n       int
+		read    int
+		eof     bool
+		fetched string
+	}{
+		{"start", 0, 16, 16, false, "0-1048575"},
+		{"same block", 4096, 512, 512, false, "0-1048575"},
+		{"across blocks", extractionBlockSize - 8, 16, 16, false, "0-1048575,1048576-2097151"},
+		{"cached block", extractionBlockSize + 8, 8, 8, false, "0-1048575,1048576-2097151"},
+		{"end of object", size - 10, 20, 10, true, "0-1048575,1048576-2097151,3145728-3145827"},
+		{"past end of object", size, 10, 0, true, "0-1048575,1048576-2097151,3145728-3145827"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.n)
+			read, err := reader.ReadAt(p, tt.off)
+			if read != tt.read {
+				t.Errorf("expected %d bytes read, got %d", tt.read, read)
+			}
+			if (err == io.EOF) != tt.eof || (err != nil && err != io.EOF) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for i := 0; i < read; i++ {
+				if p[i] != byte((tt.off+int64(i))%251) {
+					t.Fatalf("unexpected byte at offset %d", tt.off+int64(i))
+				}
+			}
+			if got := strings.Join(*fetched, ","); got != tt.fetched {
+				t.Errorf("unexpected ranges fetched: %s", got)
+			}
+		})
+	}
+}
+
+func TestObjectReaderAtLimit(t *testing.T) {
+	reader, fetched := newTestReader(4*extractionBlockSize, 2*extractionBlockSize)
+
+	p := make([]byte, 16)
+	for _, off := range []int64{0, extractionBlockSize} {
+		if _, err := reader.ReadAt(p, off); err != nil {
+			t.Fatalf("unexpected error reading at %d: %v", off, err)
+		}
+	}
+
+	// a third block exceeds the limit, but blocks that were already read are still served
+	if _, err := reader.ReadAt(p, 2*extractionBlockSize); err == nil {
+		t.Error("expected reading past the limit to fail")
+	}
+	if _, err := reader.ReadAt(p, 100); err != nil {
+		t.Errorf("unexpected error reading a cached block: %v", err)
+	}
+	if len(*fetched) != 2 {
+		t.Errorf("expected 2 blocks to be fetched, got %d", len(*fetched))
+	}
+}
+
+// newTestS3Client returns an S3 client for a fake object store that serves the content of a single object,
+// recording the queries of the requests made
+func newTestS3Client(t *testing.T, content string) (*s3.Client, *[]string) {
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		if r.URL.Path != "/bucket/dataset/file.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		EndpointResolver: s3.EndpointResolverFromURL(server.URL),
+		UsePathStyle:     true,
+		Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return client, &queries
+}
+
+func TestGetContentHash(t *testing.T) {
+	client, queries := newTestS3Client(t, "hello world")
+
+	record := &BucketNotificationRecord{}
+	record.S3.Bucket.Name = "bucket"
+	record.S3.Object.Key = "dataset/file.txt"
+	record.S3.Object.VersionId = "v1"
+
+	hash, err := record.getContentHash(client)
+	if err != nil {
+		t.Fatalf("failed to compute content hash: %v", err)
+	}
+	if hash != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected content hash: %s", hash)
+	}
+
+	// the version the event is for is read, not the latest version
+	if len(*queries) != 1 || !strings.Contains((*queries)[0], "versionId=v1") {
+		t.Errorf("expected the event's version to be read, got %v", *queries)
+	}
+}
@@ -0,0 +1,170 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// Bulk operation actions, matching the actions accepted by the core service
+const (
+	indexActionIndex  = "index"
+	indexActionDelete = "delete"
+	// indexActionSidecar replaces the sidecar file metadata of an indexed document
+	indexActionSidecar = "sidecar"
+)
+
+// indexOperation is a pending search index update for a single document
+type indexOperation struct {
+	Action   string                `json:"action"`
+	Document *MetadataIndexPayload `json:"document"`
+}
+
+// batchKey identifies the document the operation updates, so only the latest update of a document is buffered.
+// Sidecar updates are keyed separately, so they don't replace a buffered index or delete of the same document
+func (op *indexOperation) batchKey() string {
+	key := fmt.Sprintf("%s|%s|%s", op.Document.CoreServiceEndpoint, op.Document.DatasetExtended, op.Document.ObjectKey)
+	if op.Action == indexActionSidecar {
+		key = indexActionSidecar + "|" + key
+	}
+	return key
+}
+
+func (op *indexOperation) String() string {
+	return fmt.Sprintf("search index update (%s) for %s", op.Action, op.Document.ObjectKey)
+}
+
+type bulkIndexInput struct {
+	Operations []*indexOperation `json:"operations"`
+}
+
+type bulkIndexResponse struct {
+	Errors bool `json:"errors"`
+	Items  []struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	} `json:"items"`
+}
+
+// metadataIndexer buffers search index updates and sends them to the core services in batches. Only the latest
+// update of a document is kept while it is buffered, so an object that is written repeatedly is indexed once
+type metadataIndexer struct {
+	queue *batchQueue
+}
+
+var metadataIndex = &metadataIndexer{
+	queue: newBatchQueue("search index updates", sendIndexOperations),
+}
+
+// StartMetadataIndexer starts sending buffered search index updates to the core services, flushing the buffer
+// when it reaches the configured batch size or flush interval. When the context is done all of the buffered
+// updates are sent, and the returned channel is closed once they have been sent or dropped
+func StartMetadataIndexer(ctx context.Context, settings config.MetadataIndex) <-chan struct{} {
+	return metadataIndex.queue.start(ctx, settings.Batching)
+}
+
+// add buffers a search index update, replacing any buffered update of the same document
+func (mi *metadataIndexer) add(coreService *config.PopulatedCoreServiceConfiguration, action string, payload *MetadataIndexPayload) {
+	mi.queue.push(coreService, &indexOperation{Action: action, Document: payload})
+}
+
+// sendIndexOperations sends a batch of search index updates to a core service. Updates that were rejected because
+// the search index is busy or unavailable are returned to be retried, other errors (e.g. a document that doesn't
+// match the mappings) will fail again so they are logged and dropped
+func sendIndexOperations(coreService *config.PopulatedCoreServiceConfiguration, items []batchItem) error {
+	ops := make([]*indexOperation, len(items))
+	for i, item := range items {
+		ops[i] = item.(*indexOperation)
+	}
+
+	response, err := makeBulkMetadataIndexRequest(coreService, ops)
+	if err != nil {
+		return err
+	}
+	if !response.Errors {
+		return nil
+	}
+
+	failed := []int{}
+	for i, item := range response.Items {
+		if item.Error == "" {
+			continue
+		}
+
+		if item.Status == http.StatusTooManyRequests || item.Status >= http.StatusInternalServerError {
+			failed = append(failed, i)
+		} else {
+			logrus.Errorf("Search index update (%s) for %s failed: %s", ops[i].Action, ops[i].Document.ObjectKey, item.Error)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &batchItemsError{indexes: failed, reason: "search index unavailable"}
+	}
+	return nil
+}
+
+// makeBulkMetadataIndexRequest is a helper function to send a batch of search index updates to a core service
+func makeBulkMetadataIndexRequest(coreService *config.PopulatedCoreServiceConfiguration,
+	ops []*indexOperation) (*bulkIndexResponse, error) {
+
+	payloadBytes, err := json.Marshal(&bulkIndexInput{Operations: ops})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal payload JSON")
+	}
+
+	// Hack to support running on localhost
+	endpoint := strings.Replace(coreService.Endpoint, "localhost/core", "core:8080", 1)
+	path := endpoint + "/search/document/metadata/bulk"
+
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := coreService.Tokens.GetIDToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "exec-env/hoss-sync-service")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &coreUnavailableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &coreUnavailableError{err: errors.Wrap(err, "could not read bulk metadata index response")}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, coreResponseError(resp.StatusCode, errors.New(fmt.Sprintf(
+			"bulk metadata index request to `%s` failed, Status Code %v, Response: %s", path, resp.Status, string(body))))
+	}
+
+	response := &bulkIndexResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, errors.Wrap(err, "could not parse bulk metadata index response")
+	}
+	if len(response.Items) != len(ops) {
+		return nil, errors.New(fmt.Sprintf("bulk metadata index response has %d items, expected %d",
+			len(response.Items), len(ops)))
+	}
+
+	return response, nil
+}
@@ -0,0 +1,323 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// EventType is the category of a bucket event, independent of how the object store names the event
+type EventType string
+
+const (
+	EventCreated  EventType = "created"
+	EventRemoved  EventType = "removed"
+	EventAccessed EventType = "accessed"
+	EventUnknown  EventType = "unknown"
+)
+
+// Event holds the information about a single bucket notification that is given to each Processor
+type Event struct {
+	Record *BucketNotificationRecord
+
+	// ObjectStore is the object store the event originated from
+	ObjectStore *config.PopulatedObjectStoreConfiguration
+	// Namespace is the sync enabled namespace containing the object, nil if the object is not being synced
+	Namespace *config.PopulatedNamespaceConfiguration
+	// Metadata is the object's user metadata, only populated for EventCreated events
+	Metadata map[string]string
+	// TechnicalMetadata is the metadata extracted from the object's content (e.g. MIME type, image dimensions),
+	// populated by the extraction enrichment processor. It is indexed under the reserved extract.MetadataPrefix
+	TechnicalMetadata map[string]string
+	// ContentHash is the hex encoded SHA-256 hash of the object's content, populated by the content hash
+	// enrichment processor for objects up to the configured maximum size
+	ContentHash string
+
+	// PolicyPassed is true if the event passed the sync policy of the Namespace
+	PolicyPassed bool
+	// FromSyncService is true if the event was caused by the sync service writing to the object store
+	FromSyncService bool
+}
+
+// Type returns the category of the event
+func (e *Event) Type() EventType {
+	return e.Record.EventType()
+}
+
+// Processor is an action that is taken for bucket notification events. Processors are run in parallel
+// for each event and are independent, an error in one processor does not stop the others.
+//
+// Enrichment processors add information read from the object store to the event (e.g. TechnicalMetadata). They
+// run in parallel before all other processors, so each enrichment processor must only set its own Event fields.
+type Processor interface {
+	// Name identifies the processor in log messages and metrics
+	Name() string
+
+	// Applies returns true if the processor should handle the event, based on the event type,
+	// sync policy result, or any other information in the event
+	Applies(event *Event) bool
+
+	// Process handles the event
+	Process(event *Event) error
+}
+
+// ProcessorMetrics are the counters kept for each registered Processor
+type ProcessorMetrics struct {
+	Processed uint64
+	Failed    uint64
+	Duration  time.Duration
+}
+
+type registeredProcessor struct {
+	processor  Processor
+	enrichment bool
+
+	mu      sync.Mutex
+	metrics ProcessorMetrics
+}
+
+var (
+	processorsMu sync.RWMutex
+	processors   []*registeredProcessor
+)
+
+func init() {
+	RegisterEnrichmentProcessor(&extractionProcessor{})
+	RegisterEnrichmentProcessor(contentHash)
+
+	RegisterProcessor(&metadataProcessor{})
+	RegisterProcessor(&syncProcessor{})
+	RegisterProcessor(&accessLogProcessor{})
+}
+
+// RegisterProcessor adds a processor to the pipeline that is run for every bucket notification
+// Note: Processors should be registered before the service starts processing messages
+func RegisterProcessor(processor Processor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+
+	processors = append(processors, &registeredProcessor{processor: processor})
+}
+
+// RegisterEnrichmentProcessor adds a processor that adds information to the event before the other processors run
+// Note: Processors should be registered before the service starts processing messages
+func RegisterEnrichmentProcessor(processor Processor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+
+	processors = append(processors, &registeredProcessor{processor: processor, enrichment: true})
+}
+
+// GetProcessorMetrics returns a copy of the current metrics for each registered processor
+func GetProcessorMetrics() map[string]ProcessorMetrics {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+
+	metrics := map[string]ProcessorMetrics{}
+	for _, rp := range processors {
+		rp.mu.Lock()
+		metrics[rp.processor.Name()] = rp.metrics
+		rp.mu.Unlock()
+	}
+	return metrics
+}
+
+// MonitorProcessorMetrics periodically logs the metrics for each registered processor
+func MonitorProcessorMetrics(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for name, metrics := range GetProcessorMetrics() {
+				logrus.Infof("Processor %s: processed %d, failed %d, total time %v",
+					name, metrics.Processed, metrics.Failed, metrics.Duration)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runProcessors runs the enrichment processors and then all of the other processors that apply to the event.
+// The processors in each stage are run in parallel, and each stage waits for its processors to finish
+func runProcessors(event *Event) {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+
+	runStage(event, true)
+	runStage(event, false)
+}
+
+// runStage runs either the enrichment or the other processors that apply to the event in parallel
+func runStage(event *Event, enrichment bool) {
+	var wg sync.WaitGroup
+	for _, rp := range processors {
+		if rp.enrichment != enrichment || !rp.processor.Applies(event) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(rp *registeredProcessor) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := rp.run(event)
+
+			rp.mu.Lock()
+			rp.metrics.Processed++
+			rp.metrics.Duration += time.Since(start)
+			if err != nil {
+				rp.metrics.Failed++
+			}
+			rp.mu.Unlock()
+
+			if err != nil {
+				logrus.Errorf("[%s] %s", rp.processor.Name(), err.Error())
+			}
+		}(rp)
+	}
+
+	wg.Wait()
+}
+
+// run calls the processor, converting a panic into an error so that one processor cannot stop the others
+func (rp *registeredProcessor) run(event *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("processor panicked while processing %s: %v", event.Record, r)
+		}
+	}()
+
+	return rp.processor.Process(event)
+}
+
+// extractionProcessor reads the start of created objects to detect their type and extract technical metadata.
+// Objects written by the sync service are read as well, as the search index of each core service is only updated
+// by the events of its own object store
+type extractionProcessor struct{}
+
+func (ep *extractionProcessor) Name() string {
+	return "extraction"
+}
+
+func (ep *extractionProcessor) Applies(event *Event) bool {
+	return event.Type() == EventCreated
+}
+
+func (ep *extractionProcessor) Process(event *Event) error {
+	client, err := event.ObjectStore.Client.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "unable to get objectstore client")
+	}
+
+	// Any metadata that was extracted is still indexed if one of the extractors failed
+	event.TechnicalMetadata, err = event.Record.getTechnicalMetadata(client)
+	if err != nil {
+		return errors.Wrapf(err, "problem extracting technical metadata from %s", event.Record)
+	}
+	return nil
+}
+
+// contentHash is the registered contentHashProcessor, so its settings can be configured when the service starts
+var contentHash = &contentHashProcessor{
+	settings: config.ContentHash{MaxSizeBytes: config.DefaultContentHashMaxSize},
+}
+
+// ConfigureContentHash sets which objects the content hash is computed for
+// Note: This should be called before the service starts processing messages
+func ConfigureContentHash(settings config.ContentHash) {
+	contentHash.settings = settings
+}
+
+// contentHashProcessor computes the SHA-256 hash of created objects, used to find duplicate objects. The whole
+// object is read, so objects larger than the configured maximum size are indexed without a hash. Objects written
+// by the sync service are hashed as well, so synced copies are found as duplicates in the target core service
+type contentHashProcessor struct {
+	settings config.ContentHash
+}
+
+func (hp *contentHashProcessor) Name() string {
+	return "content_hash"
+}
+
+func (hp *contentHashProcessor) Applies(event *Event) bool {
+	return event.Type() == EventCreated && int64(event.Record.FileSize()) <= hp.settings.MaxSizeBytes
+}
+
+func (hp *contentHashProcessor) Process(event *Event) error {
+	client, err := event.ObjectStore.Client.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "unable to get objectstore client")
+	}
+
+	// The object is still indexed without a hash if it can't be read, it will not be listed as a duplicate
+	event.ContentHash, err = event.Record.getContentHash(client)
+	if err != nil {
+		return errors.Wrapf(err, "problem computing the content hash of %s", event.Record)
+	}
+	return nil
+}
+
+// metadataProcessor updates the search index for every created or removed object, including objects written
+// by the sync service, so that the search index of every core service is updated. Updates are buffered and sent
+// in batches by the metadataIndexer, so failures to update the index are logged by the indexer
+type metadataProcessor struct{}
+
+func (mp *metadataProcessor) Name() string {
+	return "metadata"
+}
+
+func (mp *metadataProcessor) Applies(event *Event) bool {
+	return event.Type() == EventCreated || event.Type() == EventRemoved
+}
+
+func (mp *metadataProcessor) Process(event *Event) error {
+	return event.Record.handleMeta(event)
+}
+
+// syncProcessor copies created or removed objects to each of the Namespace's sync targets
+type syncProcessor struct{}
+
+func (sp *syncProcessor) Name() string {
+	return "sync"
+}
+
+func (sp *syncProcessor) Applies(event *Event) bool {
+	// Events caused by the sync service are skipped to prevent "echoing" changes back to the source, and
+	// downloads don't change the object
+	return event.Namespace != nil && event.PolicyPassed && !event.FromSyncService && event.Type() != EventAccessed
+}
+
+func (sp *syncProcessor) Process(event *Event) error {
+	// Handle all sync targets in parallel but wait for them all to finish before returning
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+	for _, target := range event.Namespace.SyncTargets {
+		wg.Add(1)
+		go func(t *config.SyncTarget) {
+			defer wg.Done()
+			err := event.Record.handleSync(event.Namespace, t.Target, event.Metadata)
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, err.Error())
+				mu.Unlock()
+			}
+		}(target)
+	}
+
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to sync to %d target(s): %v", len(failed), failed)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// newTestEvent returns an event for an object of the given size
+func newTestEvent(eventName string, size int, fromSyncService bool) *Event {
+	record := &BucketNotificationRecord{EventName: eventName}
+	record.S3.Bucket.Name = "bucket"
+	record.S3.Object.Key = "dataset/file.tif"
+	record.S3.Object.Size = size
+	return &Event{Record: record, FromSyncService: fromSyncService}
+}
+
+func TestExtractionProcessorApplies(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *Event
+		applies bool
+	}{
+		{"created", newTestEvent("s3:ObjectCreated:Put", 100, false), true},
+		// the target core service indexes synced copies from the events of its own object store
+		{"synced copy", newTestEvent("s3:ObjectCreated:Put", 100, true), true},
+		{"removed", newTestEvent("s3:ObjectRemoved:Delete", 100, false), false},
+		{"accessed", newTestEvent("s3:ObjectAccessed:Get", 100, false), false},
+	}
+
+	processor := &extractionProcessor{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if processor.Applies(tt.event) != tt.applies {
+				t.Errorf("expected applies to be %t", tt.applies)
+			}
+		})
+	}
+}
+
+func TestContentHashProcessorApplies(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    *Event
+		maxBytes int64
+		applies  bool
+	}{
+		{"created", newTestEvent("s3:ObjectCreated:Put", 100, false), 100, true},
+		// synced copies are hashed so they are found as duplicates in the target core service
+		{"synced copy", newTestEvent("s3:ObjectCreated:Put", 100, true), 100, true},
+		{"too large", newTestEvent("s3:ObjectCreated:Put", 101, false), 100, false},
+		{"disabled", newTestEvent("s3:ObjectCreated:Put", 0, false), -1, false},
+		{"removed", newTestEvent("s3:ObjectRemoved:Delete", 100, false), 100, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := &contentHashProcessor{settings: config.ContentHash{MaxSizeBytes: tt.maxBytes}}
+			if processor.Applies(tt.event) != tt.applies {
+				t.Errorf("expected applies to be %t", tt.applies)
+			}
+		})
+	}
+}
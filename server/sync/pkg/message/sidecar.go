@@ -0,0 +1,286 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+const (
+	// sidecarCacheTTL is how long a dataset's sidecar configuration is cached before it is loaded again
+	sidecarCacheTTL = time.Minute
+	// maxSidecarBytes limits the size of a sidecar file that is read
+	maxSidecarBytes = 1024 * 1024
+)
+
+type sidecarCacheEntry struct {
+	suffixes []string
+	loaded   time.Time
+	// ready is closed once the suffixes have been loaded for the first time, and err is set if that failed
+	ready chan struct{}
+	err   error
+	// refreshing is true while expired suffixes are being loaded again
+	refreshing bool
+}
+
+// sidecarCache caches the sidecar file suffixes of each dataset, including datasets without sidecar files
+var sidecarCache = struct {
+	sync.Mutex
+	entries map[string]*sidecarCacheEntry
+}{entries: map[string]*sidecarCacheEntry{}}
+
+// getSidecarSuffixes returns the sidecar file suffixes configured for a dataset, or nil if the dataset
+// doesn't use sidecar files. The core service is only asked the first time a dataset is seen, concurrent
+// events for the dataset wait for that request. Expired suffixes are still returned while they are loaded
+// again in the background, so events aren't delayed by a request to the core service
+func getSidecarSuffixes(coreService *config.PopulatedCoreServiceConfiguration, datasetExtended string) ([]string, error) {
+	key := coreService.Endpoint + "|" + datasetExtended
+
+	sidecarCache.Lock()
+	entry, ok := sidecarCache.entries[key]
+	if !ok {
+		entry = &sidecarCacheEntry{ready: make(chan struct{})}
+		sidecarCache.entries[key] = entry
+		sidecarCache.Unlock()
+
+		suffixes, err := makeMetadataSidecarRequest(coreService, datasetExtended)
+
+		sidecarCache.Lock()
+		entry.suffixes = suffixes
+		entry.err = err
+		entry.loaded = time.Now()
+		if err != nil {
+			// the suffixes are requested again for the next event
+			delete(sidecarCache.entries, key)
+		}
+		close(entry.ready)
+		sidecarCache.Unlock()
+
+		return suffixes, err
+	}
+	sidecarCache.Unlock()
+
+	<-entry.ready
+
+	sidecarCache.Lock()
+	defer sidecarCache.Unlock()
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	if time.Since(entry.loaded) >= sidecarCacheTTL && !entry.refreshing {
+		entry.refreshing = true
+		go refreshSidecarSuffixes(coreService, datasetExtended, entry)
+	}
+
+	return entry.suffixes, nil
+}
+
+// refreshSidecarSuffixes loads the expired sidecar file suffixes of a dataset again. If the request fails the
+// cached suffixes are kept until they expire again
+func refreshSidecarSuffixes(coreService *config.PopulatedCoreServiceConfiguration, datasetExtended string,
+	entry *sidecarCacheEntry) {
+
+	suffixes, err := makeMetadataSidecarRequest(coreService, datasetExtended)
+	if err != nil {
+		logrus.Warnf("Unable to reload sidecar configuration for %s, using the cached configuration: %s",
+			datasetExtended, err.Error())
+	}
+
+	sidecarCache.Lock()
+	defer sidecarCache.Unlock()
+
+	entry.refreshing = false
+	entry.loaded = time.Now()
+	if err == nil {
+		entry.suffixes = suffixes
+	}
+}
+
+// makeMetadataSidecarRequest is a helper function to load a dataset's sidecar configuration from the core service
+func makeMetadataSidecarRequest(coreService *config.PopulatedCoreServiceConfiguration, datasetExtended string) ([]string, error) {
+	// Hack to support running on localhost
+	endpoint := strings.Replace(coreService.Endpoint, "localhost/core", "core:8080", 1)
+	path := endpoint + "/search/sidecar?dataset_extended=" + url.QueryEscape(datasetExtended)
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := coreService.Tokens.GetIDToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "exec-env/hoss-sync-service")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read metadata sidecar response")
+	}
+
+	// the dataset doesn't use sidecar files
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("metadata sidecar request to `%s` failed, Status Code %v, Response: %s",
+			path, resp.Status, string(body)))
+	}
+
+	response := struct {
+		Suffixes []string `json:"suffixes"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, errors.Wrap(err, "could not parse metadata sidecar response")
+	}
+
+	return response.Suffixes, nil
+}
+
+// sidecarTarget returns the key of the object described by a sidecar file and true, or false if the key
+// isn't a sidecar file
+func sidecarTarget(key string, suffixes []string) (string, bool) {
+	for _, suffix := range suffixes {
+		if !strings.HasSuffix(key, suffix) {
+			continue
+		}
+		target := strings.TrimSuffix(key, suffix)
+		if target != "" && !strings.HasSuffix(target, "/") {
+			return target, true
+		}
+	}
+
+	return "", false
+}
+
+// loadSidecarMetadata reads and flattens all of the sidecar files describing an object into a sorted list of
+// key-pairs separated by ':'. Sidecar files that don't exist are skipped
+func loadSidecarMetadata(client *s3.Client, bucket, targetKey string, suffixes []string) ([]string, error) {
+	flattened := map[string]string{}
+	for _, suffix := range suffixes {
+		data, err := readSidecar(client, bucket, targetKey+suffix)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+
+		var content interface{}
+		if err := yaml.Unmarshal(data, &content); err != nil {
+			logrus.Warnf("Skipping sidecar file %s that isn't valid JSON or YAML: %s", targetKey+suffix, err.Error())
+			continue
+		}
+		flattenSidecar("", content, flattened)
+	}
+
+	pairs := []string{}
+	for key, value := range flattened {
+		pairs = append(pairs, fmt.Sprintf("%s:%s", key, value))
+	}
+	sort.Strings(pairs)
+
+	return pairs, nil
+}
+
+// readSidecar reads the content of a sidecar file, returning nil if it doesn't exist
+func readSidecar(client *s3.Client, bucket, key string) ([]byte, error) {
+	output, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", maxSidecarBytes-1)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error requesting sidecar file "+key)
+	}
+	defer output.Body.Close()
+
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading sidecar file "+key)
+	}
+
+	return data, nil
+}
+
+// flattenSidecar flattens the content of a sidecar file into lower case keys, joining nested keys with '.'.
+// Lists of values are joined with ',' and lists containing objects are flattened by index
+func flattenSidecar(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenSidecar(joinSidecarKey(prefix, key), child, out)
+		}
+	case []interface{}:
+		scalars := []string{}
+		for i, child := range v {
+			switch child.(type) {
+			case map[string]interface{}, []interface{}:
+				flattenSidecar(joinSidecarKey(prefix, strconv.Itoa(i)), child, out)
+			default:
+				if child != nil {
+					scalars = append(scalars, formatSidecarValue(child))
+				}
+			}
+		}
+		if len(scalars) > 0 && prefix != "" {
+			out[prefix] = strings.Join(scalars, ",")
+		}
+	default:
+		if prefix != "" {
+			out[prefix] = formatSidecarValue(v)
+		}
+	}
+}
+
+func joinSidecarKey(prefix, key string) string {
+	key = strings.ToLower(key)
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func formatSidecarValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
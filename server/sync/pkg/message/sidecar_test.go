@@ -0,0 +1,315 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+)
+
+// fakeSidecarCore is a core service that responds to sidecar configuration requests with its suffixes, or
+// with its status if it is set
+type fakeSidecarCore struct {
+	mu       sync.Mutex
+	suffixes []string
+	status   int
+	requests int
+	// release blocks the responses while it is set, until it is closed
+	release chan struct{}
+}
+
+func (f *fakeSidecarCore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+	release := f.release
+	suffixes := f.suffixes
+	status := f.status
+	f.mu.Unlock()
+
+	if release != nil {
+		<-release
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"suffixes": suffixes})
+}
+
+func (f *fakeSidecarCore) set(suffixes []string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.suffixes = suffixes
+	f.status = status
+}
+
+func (f *fakeSidecarCore) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+func newSidecarCoreService(t *testing.T, core *fakeSidecarCore) *config.PopulatedCoreServiceConfiguration {
+	server := httptest.NewServer(core)
+	t.Cleanup(server.Close)
+
+	return &config.PopulatedCoreServiceConfiguration{Tokens: fakeTokens{}, Endpoint: server.URL}
+}
+
+// expireSidecarSuffixes makes the cached suffixes of a dataset expired
+func expireSidecarSuffixes(coreService *config.PopulatedCoreServiceConfiguration, datasetExtended string) {
+	sidecarCache.Lock()
+	defer sidecarCache.Unlock()
+	sidecarCache.entries[coreService.Endpoint+"|"+datasetExtended].loaded = time.Now().Add(-sidecarCacheTTL)
+}
+
+// waitForRequests waits for the core service to have received the given number of requests
+func waitForRequests(t *testing.T, core *fakeSidecarCore, requests int) {
+	deadline := time.Now().Add(time.Second)
+	for core.count() < requests && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := core.count(); got != requests {
+		t.Fatalf("expected %d requests to the core service, got %d", requests, got)
+	}
+}
+
+func assertSuffixes(t *testing.T, coreService *config.PopulatedCoreServiceConfiguration, want string) {
+	t.Helper()
+	suffixes, err := getSidecarSuffixes(coreService, "store|bucket|dataset")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(suffixes, ","); got != want {
+		t.Errorf("expected the suffixes %s, got %s", want, got)
+	}
+}
+
+func TestGetSidecarSuffixesCached(t *testing.T) {
+	core := &fakeSidecarCore{suffixes: []string{".meta.yaml"}}
+	coreService := newSidecarCoreService(t, core)
+
+	// only the first event of a dataset requests its suffixes
+	for i := 0; i < 3; i++ {
+		assertSuffixes(t, coreService, ".meta.yaml")
+	}
+	if got := core.count(); got != 1 {
+		t.Errorf("expected 1 request to the core service, got %d", got)
+	}
+
+	// expired suffixes are used while they are loaded again
+	core.set([]string{".meta.json"}, 0)
+	expireSidecarSuffixes(coreService, "store|bucket|dataset")
+	assertSuffixes(t, coreService, ".meta.yaml")
+	waitForRequests(t, core, 2)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		suffixes, _ := getSidecarSuffixes(coreService, "store|bucket|dataset")
+		if strings.Join(suffixes, ",") == ".meta.json" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assertSuffixes(t, coreService, ".meta.json")
+
+	// the cached suffixes are kept if they can't be loaded again
+	core.set(nil, http.StatusInternalServerError)
+	expireSidecarSuffixes(coreService, "store|bucket|dataset")
+	assertSuffixes(t, coreService, ".meta.json")
+	waitForRequests(t, core, 3)
+	assertSuffixes(t, coreService, ".meta.json")
+	if got := core.count(); got != 3 {
+		t.Errorf("expected the failed reload not to be retried before the suffixes expire, got %d requests", got)
+	}
+}
+
+func TestGetSidecarSuffixesConcurrent(t *testing.T) {
+	core := &fakeSidecarCore{suffixes: []string{".meta.yaml"}, release: make(chan struct{})}
+	coreService := newSidecarCoreService(t, core)
+
+	// events for a dataset that isn't cached yet wait for a single request
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			suffixes, err := getSidecarSuffixes(coreService, "store|bucket|dataset")
+			if err != nil {
+				results[i] = err.Error()
+				return
+			}
+			results[i] = strings.Join(suffixes, ",")
+		}(i)
+	}
+
+	waitForRequests(t, core, 1)
+	close(core.release)
+	wg.Wait()
+
+	for i, result := range results {
+		if result != ".meta.yaml" {
+			t.Errorf("unexpected suffixes for event %d: %s", i, result)
+		}
+	}
+	if got := core.count(); got != 1 {
+		t.Errorf("expected 1 request to the core service, got %d", got)
+	}
+}
+
+func TestGetSidecarSuffixesError(t *testing.T) {
+	core := &fakeSidecarCore{status: http.StatusInternalServerError}
+	coreService := newSidecarCoreService(t, core)
+
+	if _, err := getSidecarSuffixes(coreService, "store|bucket|dataset"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// a failed first request isn't cached
+	core.set([]string{".meta.yaml"}, 0)
+	assertSuffixes(t, coreService, ".meta.yaml")
+	if got := core.count(); got != 2 {
+		t.Errorf("expected 2 requests to the core service, got %d", got)
+	}
+
+	// datasets that don't use sidecar files are cached as well
+	core.set(nil, http.StatusNotFound)
+	suffixes, err := getSidecarSuffixes(coreService, "store|bucket|other")
+	if err != nil || suffixes != nil {
+		t.Fatalf("expected no suffixes, got %v %v", suffixes, err)
+	}
+	getSidecarSuffixes(coreService, "store|bucket|other")
+	if got := core.count(); got != 3 {
+		t.Errorf("expected 3 requests to the core service, got %d", got)
+	}
+}
+
+// fakeRenewingClient returns a fixed S3 client
+type fakeRenewingClient struct {
+	client *s3.Client
+}
+
+func (f *fakeRenewingClient) GetClient() (*s3.Client, error)     { return f.client, nil }
+func (f *fakeRenewingClient) ForceRefresh()                      {}
+func (f *fakeRenewingClient) RefreshRoutine(ctx context.Context) {}
+
+// newSidecarObjectStore returns an object store serving the given objects, by bucket and key. Other objects
+// respond with their status, or don't exist
+func newSidecarObjectStore(t *testing.T, coreService *config.PopulatedCoreServiceConfiguration, objects map[string]string,
+	status map[string]int) *config.PopulatedObjectStoreConfiguration {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		if code, ok := status[path]; ok {
+			w.WriteHeader(code)
+			return
+		}
+		content, ok := objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		EndpointResolver: s3.EndpointResolverFromURL(server.URL),
+		UsePathStyle:     true,
+		Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return &config.PopulatedObjectStoreConfiguration{
+		CoreService: coreService,
+		Name:        "store",
+		Client:      &fakeRenewingClient{client: client},
+	}
+}
+
+// newSidecarEvent returns an event for a bucket notification
+func newSidecarEvent(objectStore *config.PopulatedObjectStoreConfiguration, eventName, key string) *Event {
+	record := &BucketNotificationRecord{EventName: eventName}
+	record.S3.Bucket.Name = "bucket"
+	record.S3.Object.Key = key
+	return &Event{Record: record, ObjectStore: objectStore, Metadata: map[string]string{}}
+}
+
+// takeIndexOperations removes the buffered search index updates, describing each one
+func takeIndexOperations() []string {
+	described := []string{}
+	for _, entries := range metadataIndex.queue.take(true) {
+		for _, entry := range entries {
+			op := entry.item.(*indexOperation)
+			described = append(described, op.Action+" "+op.Document.ObjectKey+" ["+strings.Join(op.Document.SidecarMetadata, ",")+"]")
+		}
+	}
+	return described
+}
+
+func TestHandleMetaSidecar(t *testing.T) {
+	takeIndexOperations()
+	core := &fakeSidecarCore{suffixes: []string{".meta.yaml"}}
+	coreService := newSidecarCoreService(t, core)
+	objectStore := newSidecarObjectStore(t, coreService, map[string]string{
+		"bucket/dataset/file.txt.meta.yaml": "subject: mouse",
+	}, nil)
+
+	// the metadata of an object's sidecar files is indexed with the object
+	event := newSidecarEvent(objectStore, "s3:ObjectCreated:Put", "dataset/file.txt")
+	if err := event.Record.handleMeta(event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(takeIndexOperations(), "; "); got != "index dataset/file.txt [subject:mouse]" {
+		t.Errorf("unexpected index updates: %s", got)
+	}
+
+	// a sidecar file updates the object it describes as well
+	event = newSidecarEvent(objectStore, "s3:ObjectCreated:Put", "dataset/file.txt.meta.yaml")
+	if err := event.Record.handleMeta(event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(takeIndexOperations(), "; "); got != "sidecar dataset/file.txt [subject:mouse]; index dataset/file.txt.meta.yaml []" {
+		t.Errorf("unexpected index updates: %s", got)
+	}
+}
+
+func TestHandleMetaSidecarError(t *testing.T) {
+	takeIndexOperations()
+	core := &fakeSidecarCore{suffixes: []string{".meta.yaml"}}
+	coreService := newSidecarCoreService(t, core)
+	objectStore := newSidecarObjectStore(t, coreService, nil, map[string]int{
+		"bucket/dataset/file.txt.meta.yaml": http.StatusForbidden,
+	})
+
+	// an object isn't indexed without its sidecar metadata, which would remove it from the indexed document
+	for _, key := range []string{"dataset/file.txt", "dataset/file.txt.meta.yaml"} {
+		event := newSidecarEvent(objectStore, "s3:ObjectCreated:Put", key)
+		if err := event.Record.handleMeta(event); err == nil {
+			t.Errorf("expected an error for %s", key)
+		}
+	}
+	if got := takeIndexOperations(); len(got) != 0 {
+		t.Errorf("expected no index updates, got %v", got)
+	}
+
+	// the same goes for a dataset whose sidecar configuration can't be loaded
+	failing := newSidecarCoreService(t, &fakeSidecarCore{status: http.StatusInternalServerError})
+	event := newSidecarEvent(newSidecarObjectStore(t, failing, nil, nil), "s3:ObjectCreated:Put", "dataset/file.txt")
+	if err := event.Record.handleMeta(event); err == nil {
+		t.Error("expected an error")
+	}
+	if got := takeIndexOperations(); len(got) != 0 {
+		t.Errorf("expected no index updates, got %v", got)
+	}
+}
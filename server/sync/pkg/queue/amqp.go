@@ -49,7 +49,7 @@ func (q *AMQPQueue) Receive() <-chan config.Message {
 	return q.decodedMsgs
 }
 
-func AMQPNotifications(queueConfig *config.AMQPQueueConfig) Queue {
+func AMQPNotifications(queueConfig *config.AMQPQueueConfig, owner config.ShardOwner) Queue {
 	var err error
 	q := &AMQPQueue{
 		queueConfig:  queueConfig,
@@ -105,11 +105,20 @@ func AMQPNotifications(queueConfig *config.AMQPQueueConfig) Queue {
 	)
 	failOnError(err, "Failed to bind queue")
 
+	// Limit the number of deliveries that are held by this instance before they are acknowledged or requeued
+	err = q.channel.Qos(
+		prefetchCount, // prefetch count
+		0,             // prefetch size
+		false,         // global
+	)
+	failOnError(err, "Failed to set the prefetch count")
+
 	// Start the consumer reading from the queue
+	// Messages are acknowledged manually so that messages owned by another instance can be requeued
 	q.msgs, err = q.channel.Consume(
 		q.queueName, // queue
 		"",          // consumer
-		true,        // auto-ack
+		false,       // auto-ack
 		false,       // exclusive
 		false,       // no-local
 		false,       // no-wait
@@ -125,30 +134,67 @@ func AMQPNotifications(queueConfig *config.AMQPQueueConfig) Queue {
 				logrus.Error("AMQP Notification queue broken")
 				return
 			}
-			if q.messageType == "bucket_notification" {
-				var note message.BucketNotification
-				err := json.Unmarshal(data.Body, &note)
-				if err != nil {
-					logrus.Error("Problem decoding message: " + err.Error())
-				} else {
-					for _, record := range note.Records {
-						record.Endpoint = queueConfig.SourceEndpoint
-						q.decodedMsgs <- &record
-					}
-				}
-			} else if q.messageType == "api_notification" {
-				var msg message.ApiSyncNotification
-				err := json.Unmarshal(data.Body, &msg)
-				if err != nil {
-					logrus.Error("Problem decoding message: " + err.Error())
-				} else {
-					q.decodedMsgs <- &msg
-				}
-			} else {
-				logrus.Error("Unsupported message type set: " + q.messageType)
-			}
+
+			q.handleDelivery(data, owner)
 		}
 	}()
 
 	return q
 }
+
+// handleDelivery decodes a delivery and sends its messages to the Queue interface channel. Deliveries owned by
+// another instance are requeued before the next delivery is handled
+func (q *AMQPQueue) handleDelivery(data amqp.Delivery, owner config.ShardOwner) {
+	var msgs []config.Message
+	if q.messageType == "bucket_notification" {
+		var note message.BucketNotification
+		err := json.Unmarshal(data.Body, &note)
+		if err != nil {
+			logrus.Error("Problem decoding message: " + err.Error())
+		} else {
+			for i := range note.Records {
+				record := note.Records[i]
+				record.Endpoint = q.queueConfig.SourceEndpoint
+				msgs = append(msgs, &record)
+			}
+		}
+	} else if q.messageType == "api_notification" {
+		var msg message.ApiSyncNotification
+		err := json.Unmarshal(data.Body, &msg)
+		if err != nil {
+			logrus.Error("Problem decoding message: " + err.Error())
+		} else {
+			msgs = append(msgs, &msg)
+		}
+	} else {
+		logrus.Error("Unsupported message type set: " + q.messageType)
+	}
+
+	// Object stores send one record per bucket notification, so the notification belongs to the shard of its first record
+	var release func()
+	if len(msgs) > 0 {
+		var owned bool
+		release, owned = owner.Claim(msgs[0])
+		if !owned {
+			if err := data.Nack(false, true); err != nil {
+				logrus.Warning("Could not requeue message: " + err.Error())
+			}
+
+			// A delivery that was already requeued is still not owned by this instance, most likely because the
+			// shards are being rebalanced, so give the owning instance time to receive it
+			if data.Redelivered {
+				time.Sleep(requeueDelay)
+			}
+			return
+		}
+	}
+
+	// Messages that could not be decoded are acknowledged so that they are dropped
+	if err := data.Ack(false); err != nil {
+		logrus.Warning("Could not acknowledge message: " + err.Error())
+	}
+
+	for _, msg := range config.ClaimMessages(msgs, release) {
+		q.decodedMsgs <- msg
+	}
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/gigantum/hoss-sync/pkg/config"
+	"github.com/gigantum/hoss-sync/pkg/message"
+	"github.com/streadway/amqp"
+)
+
+// fakeAcknowledger records how a delivery was settled
+type fakeAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (f *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	f.acked = true
+	return nil
+}
+
+func (f *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	f.nacked = true
+	f.requeue = requeue
+	return nil
+}
+
+func (f *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return f.Nack(tag, false, requeue)
+}
+
+// fakeOwner owns every message if owned is true, counting the claims that are released
+type fakeOwner struct {
+	owned    bool
+	claimed  []config.Message
+	released int
+}
+
+func (f *fakeOwner) Claim(msg config.Message) (func(), bool) {
+	f.claimed = append(f.claimed, msg)
+	if !f.owned {
+		return nil, false
+	}
+	return func() { f.released++ }, true
+}
+
+const testNotification = `{"Records": [{"eventName": "s3:ObjectCreated:Put", "s3": {"bucket": {"name": "bucket"}, "object": {"key": "dataset/file.txt"}}}]}`
+
+func newTestAMQPQueue() *AMQPQueue {
+	return &AMQPQueue{
+		queueConfig: &config.AMQPQueueConfig{MessageType: "bucket_notification", SourceEndpoint: "http://minio:9000"},
+		decodedMsgs: make(chan config.Message, 10),
+		messageType: "bucket_notification",
+	}
+}
+
+func TestAMQPHandleDeliveryOwned(t *testing.T) {
+	q := newTestAMQPQueue()
+	ack := &fakeAcknowledger{}
+	owner := &fakeOwner{owned: true}
+
+	q.handleDelivery(amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte(testNotification)}, owner)
+
+	if !ack.acked || ack.nacked {
+		t.Errorf("expected the delivery to be acknowledged, got acked %t nacked %t", ack.acked, ack.nacked)
+	}
+	if len(q.decodedMsgs) != 1 {
+		t.Fatalf("expected 1 message to be delivered, got %d", len(q.decodedMsgs))
+	}
+
+	msg := <-q.decodedMsgs
+	if msg.ShardKey() != "http://minio:9000/bucket/dataset/file.txt" {
+		t.Errorf("unexpected shard key: %s", msg.ShardKey())
+	}
+
+	// the claim is held until the message is done
+	if owner.released != 0 {
+		t.Error("expected the claim to be held while the message is queued")
+	}
+	config.ReleaseMessage(msg)
+	if owner.released != 1 {
+		t.Errorf("expected the claim to be released, got %d", owner.released)
+	}
+}
+
+func TestAMQPHandleDeliveryRequeue(t *testing.T) {
+	q := newTestAMQPQueue()
+	ack := &fakeAcknowledger{}
+	owner := &fakeOwner{owned: false}
+
+	q.handleDelivery(amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte(testNotification)}, owner)
+
+	// a delivery for a shard owned by another instance is requeued before the next delivery is handled
+	if ack.acked || !ack.nacked || !ack.requeue {
+		t.Errorf("expected the delivery to be requeued, got acked %t nacked %t requeue %t", ack.acked, ack.nacked, ack.requeue)
+	}
+	if len(q.decodedMsgs) != 0 {
+		t.Errorf("expected no messages to be delivered, got %d", len(q.decodedMsgs))
+	}
+	if len(owner.claimed) != 1 {
+		t.Errorf("expected the delivery to be claimed once, got %d", len(owner.claimed))
+	}
+}
+
+func TestAMQPHandleDeliveryInvalid(t *testing.T) {
+	q := newTestAMQPQueue()
+	ack := &fakeAcknowledger{}
+	owner := &fakeOwner{owned: false}
+
+	q.handleDelivery(amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("not json")}, owner)
+
+	// messages that can't be decoded are dropped rather than requeued forever
+	if !ack.acked || ack.nacked {
+		t.Errorf("expected the delivery to be acknowledged, got acked %t nacked %t", ack.acked, ack.nacked)
+	}
+	if len(q.decodedMsgs) != 0 {
+		t.Errorf("expected no messages to be delivered, got %d", len(q.decodedMsgs))
+	}
+}
+
+func TestAMQPHandleDeliveryApiNotification(t *testing.T) {
+	q := newTestAMQPQueue()
+	q.messageType = "api_notification"
+	ack := &fakeAcknowledger{}
+	owner := &fakeOwner{owned: true}
+
+	q.handleDelivery(amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte(`{"event_type": "create-namespace"}`)}, owner)
+
+	if !ack.acked {
+		t.Error("expected the delivery to be acknowledged")
+	}
+	if len(q.decodedMsgs) != 1 {
+		t.Fatalf("expected 1 message to be delivered, got %d", len(q.decodedMsgs))
+	}
+	claimed, ok := (<-q.decodedMsgs).(*config.ClaimedMessage)
+	if !ok {
+		t.Fatal("expected the message to be claimed")
+	}
+	if asn, ok := claimed.Message.(*message.ApiSyncNotification); !ok || asn.EventType != "create-namespace" {
+		t.Errorf("unexpected message: %v", claimed.Message)
+	}
+}
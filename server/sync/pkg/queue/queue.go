@@ -1,11 +1,22 @@
 package queue
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 
 	"github.com/gigantum/hoss-sync/pkg/config"
 )
 
+const (
+	// requeueDelay is how long a message owned by another Sync Service instance is kept from being received
+	// again by this instance, so that unowned messages don't rapidly cycle while shards are rebalanced
+	requeueDelay = 500 * time.Millisecond
+	// prefetchCount is the number of messages that are delivered to this instance before they are acknowledged
+	// or requeued
+	prefetchCount = 10
+)
+
 // Queue provides a generic interface for a message queue implementation
 type Queue interface {
 	// Send gets the channel used to send messages to the queue
@@ -16,22 +27,23 @@ type Queue interface {
 }
 
 // LoadNotificationQueue loads the specific queue implementation that receives notification
-// messages from an object store or core service
-func LoadNotificationQueue(configuration *config.Configuration, queueConfig *config.NotificationQueueConfig) (Queue, error) {
+// messages from an object store or core service. Messages that are not owned by this instance
+// are returned to the queue so that the owning instance can process them
+func LoadNotificationQueue(configuration *config.Configuration, queueConfig *config.NotificationQueueConfig, owner config.ShardOwner) (Queue, error) {
 	switch queueConfig.Type {
 	case "amqp":
 		var queueSettings config.AMQPQueueConfig
 		if err := config.UnmarshalSettings(queueConfig.Settings, &queueSettings); err != nil {
 			return nil, errors.Wrap(err, "Could not load AMQP queue settings")
 		}
-		return AMQPNotifications(&queueSettings), nil
+		return AMQPNotifications(&queueSettings, owner), nil
 	case "sqs":
 		var queueSettings config.SQSQueueConfig
 		if err := config.UnmarshalSettings(queueConfig.Settings, &queueSettings); err != nil {
 			return nil, errors.Wrap(err, "Could not load SQS queue settings")
 		}
 		queueSettings.Profile = configuration.SqsProfile
-		return SQSNotifications(&queueSettings), nil
+		return SQSNotifications(&queueSettings, owner), nil
 	default:
 		return nil, errors.New("Notification queue type not supported")
 	}
@@ -38,7 +38,7 @@ func (q *SQSQueue) Receive() <-chan config.Message {
 	return q.decodedMsgs
 }
 
-func SQSNotifications(queueConfig *config.SQSQueueConfig) Queue {
+func SQSNotifications(queueConfig *config.SQSQueueConfig, owner config.ShardOwner) Queue {
 	var err error
 	q := &SQSQueue{
 		queueConfig: queueConfig,
@@ -96,15 +96,17 @@ func SQSNotifications(queueConfig *config.SQSQueueConfig) Queue {
 			}
 
 			if len(msgResult.Messages) > 0 {
+				var msgs []config.Message
 				if q.messageType == "bucket_notification" {
 					var note message.BucketNotification
 					err := json.Unmarshal([]byte(*msgResult.Messages[0].Body), &note)
 					if err != nil {
 						logrus.Error("Problem decoding message: " + err.Error())
 					} else {
-						for _, record := range note.Records {
+						for i := range note.Records {
+							record := note.Records[i]
 							record.Endpoint = queueConfig.SourceEndpoint
-							q.decodedMsgs <- &record
+							msgs = append(msgs, &record)
 						}
 					}
 				} else if q.messageType == "api_notification" {
@@ -113,13 +115,39 @@ func SQSNotifications(queueConfig *config.SQSQueueConfig) Queue {
 					if err != nil {
 						logrus.Error("Problem decoding message: " + err.Error())
 					} else {
-						q.decodedMsgs <- &notification
+						msgs = append(msgs, &notification)
 					}
 				} else {
 					logrus.Error("Unsupported message type set: " + q.messageType)
 					continue // skip the message delete
 				}
 
+				// Object stores send one record per bucket notification, so the notification belongs to the shard
+				// of its first record. Messages owned by another instance are made visible again, instead of being deleted
+				var release func()
+				owned := true
+				if len(msgs) > 0 {
+					release, owned = owner.Claim(msgs[0])
+				}
+				if !owned {
+					_, err = client.ChangeMessageVisibility(
+						context.TODO(),
+						&sqs.ChangeMessageVisibilityInput{
+							QueueUrl:          queueURL,
+							ReceiptHandle:     msgResult.Messages[0].ReceiptHandle,
+							VisibilityTimeout: int32(requeueDelay.Seconds() + 1),
+						},
+					)
+					if err != nil {
+						logrus.Warning("Could not requeue message: " + err.Error())
+					}
+					continue
+				}
+
+				for _, msg := range config.ClaimMessages(msgs, release) {
+					q.decodedMsgs <- msg
+				}
+
 				_, err = client.DeleteMessage(
 					context.TODO(),
 					&sqs.DeleteMessageInput{
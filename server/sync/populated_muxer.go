@@ -45,6 +45,9 @@ type PopulatedCoreServiceConfigurations struct {
 	reloadFinished *sync.Cond
 
 	populatedConfigs map[string]*config.PopulatedCoreServiceConfiguration
+
+	// workers tracks the running worker routines, so the service can wait for them to finish their messages
+	workers sync.WaitGroup
 }
 
 // ForceReload requests the Monitors to repoll their Core Service for any configuration changes
@@ -73,6 +76,11 @@ func (pcs *PopulatedCoreServiceConfigurations) GetConfigs() map[string]*config.P
 	return pcs.populatedConfigs
 }
 
+// WaitForWorkers blocks until the worker routines have stopped, after the context given to UpdateMuxer is done
+func (pcs *PopulatedCoreServiceConfigurations) WaitForWorkers() {
+	pcs.workers.Wait()
+}
+
 // UpdateMuxer waits for the CoreServiceConfigurations Monitors to notify it of a change in configuration and then works to reconcile the current statue with the new state
 func (pcs *PopulatedCoreServiceConfigurations) UpdateMuxer(ctx context.Context, configuration *config.Configuration, tokens service.RenewingTokens) {
 	logrus.Info("Starting core service configuration update muxer")
@@ -128,7 +136,11 @@ func (pcs *PopulatedCoreServiceConfigurations) UpdateMuxer(ctx context.Context,
 
 		// Create worker routines
 		for i := 0; i < configuration.WorkerInstanceCount; i++ {
-			go populatedCoreService.Worker(ctx)
+			pcs.workers.Add(1)
+			go func(coreService *config.PopulatedCoreServiceConfiguration) {
+				defer pcs.workers.Done()
+				coreService.Worker(ctx)
+			}(populatedCoreService)
 		}
 	}
 
@@ -161,6 +173,7 @@ func (pcs *PopulatedCoreServiceConfigurations) UpdateMuxer(ctx context.Context,
 							SourcePolicies:    populatedNamespace.SyncPolicies,
 							TargetCoreService: syncKey.CoreService,
 							TargetNamespace:   syncKey.Namespace,
+							CascadeDelete:     syncTarget.CascadeDelete,
 						}
 
 						toDelete[syncConfig.Hash()] = syncConfig
@@ -245,13 +258,15 @@ func (pcs *PopulatedCoreServiceConfigurations) UpdateMuxer(ctx context.Context,
 				}
 
 				if syncTarget, ok := namespace.SyncTargets[syncKey]; ok {
-					// Updating Sync Type field, no need to update the target
+					// Updating Sync Type and Cascade Delete fields, no need to update the target
 					syncTarget.SyncType = syncConfig.SyncType
+					syncTarget.CascadeDelete = syncConfig.CascadeDelete
 				} else {
 					// Adding a new Sync Target
 					namespace.SyncTargets[syncKey] = &config.SyncTarget{
-						SyncType: syncConfig.SyncType,
-						Target:   nil, // There will be a second pass to set this link
+						SyncType:      syncConfig.SyncType,
+						CascadeDelete: syncConfig.CascadeDelete,
+						Target:        nil, // There will be a second pass to set this link
 					}
 				}
 			}